@@ -0,0 +1,98 @@
+package changelog
+
+import (
+	"bytes"
+	"encoding/xml"
+
+	"github.com/gorilla/feeds"
+)
+
+// atomEntry is a feeds.AtomEntry with any number of categories (as terms), and
+// its source as the element Atom has for it
+type atomEntry struct {
+	*feeds.AtomEntry
+	Categories []atomCategory `xml:"category"`
+	Source     *atomSource    `xml:"source,omitempty"`
+}
+
+// atomEntryCDATA is an atomEntry with its summary as CDATA, so that its line
+// breaks are kept as is
+type atomEntryCDATA struct {
+	*atomEntry
+	Summary atomSummaryCDATA `xml:"summary"`
+}
+
+type atomSummaryCDATA struct {
+	Type string `xml:"type,attr"`
+	cdata
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomSource struct {
+	ID    string         `xml:"id"`
+	Title string         `xml:"title"`
+	Link  feeds.AtomLink `xml:"link"`
+}
+
+type atomFeed struct {
+	*feeds.AtomFeed
+	Lang string `xml:"xml:lang,attr,omitempty"`
+	// Links are the link of the feed, and its link of rel="self" (as the
+	// AtomFeed only has room for the one)
+	Links   []*feeds.AtomLink `xml:"link"`
+	Entries []interface{}     `xml:"entry"`
+}
+
+// RenderAtomOptions is a RenderFunc for Atom 1.0, with the RenderOptions
+func RenderAtomOptions(opts RenderOptions) RenderFunc {
+	return func(f *feeds.Feed) ([]byte, error) {
+		feed := (&feeds.Atom{Feed: f}).AtomFeed()
+		if feed.Author == nil {
+			// an Atom feed needs an author, when its entries have none
+			feed.Author = &feeds.AtomAuthor{AtomPerson: feeds.AtomPerson{Name: f.Title}}
+		}
+		x := &atomFeed{AtomFeed: feed, Lang: opts.Language}
+		if feed.Link != nil {
+			x.Links = append(x.Links, feed.Link)
+			feed.Link = nil
+		}
+		if opts.Self != "" {
+			x.Links = append(x.Links, &feeds.AtomLink{Href: opts.Self, Rel: "self", Type: "application/atom+xml"})
+		}
+		for i, entry := range feed.Entries {
+			e := &atomEntry{AtomEntry: entry}
+			for _, c := range opts.Categories[f.Items[i]] {
+				e.Categories = append(e.Categories, atomCategory{Term: c})
+			}
+			if s := opts.source(f.Items[i]); s != nil {
+				e.Source = &atomSource{ID: s.URL, Title: s.Name, Link: feeds.AtomLink{Href: s.URL}}
+			}
+			if opts.Indent {
+				x.Entries = append(x.Entries, &atomEntryCDATA{atomEntry: e, Summary: atomSummaryCDATA{Type: "html", cdata: cdata{multiline(entry.Summary.Content)}}})
+				continue
+			}
+			x.Entries = append(x.Entries, e)
+		}
+		feed.Entries = nil
+
+		header := xml.Header[:len(xml.Header)-1]
+		if opts.Indent {
+			header = xml.Header
+		}
+		buf := bytes.NewBufferString(header)
+		e := xml.NewEncoder(buf)
+		if opts.Indent {
+			e.Indent("", "  ")
+		}
+		if err := e.Encode(x); err != nil {
+			return nil, err
+		}
+		if opts.Indent {
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}
+}
@@ -0,0 +1,76 @@
+package changelog
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderAtom(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{Title: "slackware64-current"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &Source{Name: "osuosl", URL: "http://slackware.osuosl.org"}
+	for _, indent := range []bool{false, true} {
+		data, err := RenderAtomOptions(RenderOptions{Categories: cats, Indent: indent, Source: src})(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			XMLName xml.Name
+			ID      string `xml:"id"`
+			Author  string `xml:"author>name"`
+			Entries []struct {
+				ID         string `xml:"id"`
+				Updated    string `xml:"updated"`
+				Summary    string `xml:"summary"`
+				Categories []struct {
+					Term string `xml:"term,attr"`
+				} `xml:"category"`
+				Source struct {
+					Title string `xml:"title"`
+				} `xml:"source"`
+			} `xml:"entry"`
+		}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("indent %t: %v", indent, err)
+		}
+		if doc.XMLName.Space != "http://www.w3.org/2005/Atom" || doc.XMLName.Local != "feed" {
+			t.Errorf("indent %t: expected an Atom feed; got %v", indent, doc.XMLName)
+		}
+		if doc.ID == "" || doc.Author == "" || len(doc.Entries) != len(e) {
+			t.Errorf("indent %t: expected an id, author and %d entries; got %q, %q and %d", indent, len(e), doc.ID, doc.Author, len(doc.Entries))
+			continue
+		}
+		first := doc.Entries[0]
+		if first.Updated != "2017-01-23T21:30:13Z" || !strings.Contains(first.Summary, "d/gdb-7.12.1-x86_64-1.txz:  Upgraded.") || first.Source.Title != "osuosl" {
+			t.Errorf("indent %t: unexpected first entry %#v", indent, first)
+		}
+		kernels := 0
+		for _, entry := range doc.Entries {
+			for _, c := range entry.Categories {
+				if c.Term == CategoryKernel {
+					kernels++
+				}
+			}
+		}
+		if kernels == 0 {
+			t.Errorf("indent %t: expected the kernel entries to have their category", indent)
+		}
+		if indent && !strings.HasSuffix(string(data), "</feed>\n") {
+			t.Errorf("expected a newline at the end; got %q", data[len(data)-20:])
+		}
+	}
+}
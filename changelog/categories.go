@@ -0,0 +1,168 @@
+package changelog
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"github.com/gorilla/feeds"
+)
+
+// CategoryMassRebuild is the category of the feed items of entries updating
+// more packages than the FeedOptions MassRebuildThreshold, like for a rebuild
+// against a new gcc or glibc
+const CategoryMassRebuild = "mass-rebuild"
+
+// Categories are the categories of the items of a feed, by item, as the
+// items of github.com/gorilla/feeds have no field for them
+type Categories map[*feeds.Item][]string
+
+// Categories are the categories of the feed item for this Entry
+func (e Entry) Categories() []string {
+	cats := []string{}
+	if e.KernelVersion() != "" {
+		cats = append(cats, CategoryKernel)
+	}
+	return cats
+}
+
+// Categories are the categories of the feed item for just this Update
+func (u Update) Categories() []string {
+	cats := []string{}
+	if u.KernelVersion() != "" {
+		cats = append(cats, CategoryKernel)
+	}
+	return cats
+}
+
+// rssItem is a feeds.RssItem with any number of categories, and its source
+// with the url attribute (that feeds.RssItem has no room for)
+type rssItem struct {
+	*feeds.RssItem
+	Guid       *rssGuid   `xml:"guid,omitempty"`
+	Categories []string   `xml:"category"`
+	Source     *rssSource `xml:"source,omitempty"`
+}
+
+// rssGuid is the guid of an item, which is not its link
+type rssGuid struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+// rssItemCDATA is an rssItem with its description as CDATA, so that its line
+// breaks are kept as is
+type rssItemCDATA struct {
+	*rssItem
+	Description cdata `xml:"description"`
+}
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+type rssChannel struct {
+	*feeds.RssFeed
+	Self  *rssAtomLink
+	Items []interface{} `xml:"item"`
+}
+
+// rssAtomLink is the atom:link of the channel to the feed itself
+type rssAtomLink struct {
+	XMLName xml.Name `xml:"atom:link"`
+	Href    string   `xml:"href,attr"`
+	Rel     string   `xml:"rel,attr"`
+	Type    string   `xml:"type,attr"`
+}
+
+// atomNamespace is that of the atom:link of RSS
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type rssXML struct {
+	*feeds.RssFeedXml
+	AtomNamespace string `xml:"xmlns:atom,attr,omitempty"`
+	Channel       *rssChannel
+}
+
+// RenderRssCategories is a RenderFunc for RSS 2.0 that includes the
+// categories of the items
+func RenderRssCategories(cats Categories) RenderFunc {
+	return RenderRssOptions(RenderOptions{Categories: cats})
+}
+
+// RenderRssOptions is RenderRssCategories, with the rest of the RenderOptions
+func RenderRssOptions(opts RenderOptions) RenderFunc {
+	return func(f *feeds.Feed) ([]byte, error) {
+		channel := (&feeds.Rss{Feed: f}).RssFeed()
+		if f.Author != nil && f.Author.Email == "" {
+			// the managingEditor of RSS is an email, so there is none for
+			// an author with only a name
+			channel.ManagingEditor = ""
+		}
+		channel.Language = opts.Language
+		channel.Ttl = opts.TTL
+		c := &rssChannel{RssFeed: channel}
+		if opts.Self != "" {
+			c.Self = &rssAtomLink{Href: opts.Self, Rel: "self", Type: "application/rss+xml"}
+		}
+		for i, item := range channel.Items {
+			ri := &rssItem{RssItem: item, Categories: opts.Categories[f.Items[i]]}
+			if item.Guid != "" {
+				ri.Guid = &rssGuid{IsPermaLink: "false", ID: item.Guid}
+			}
+			if s := opts.source(f.Items[i]); s != nil {
+				ri.Source = &rssSource{URL: s.URL, Name: s.Name}
+			}
+			if opts.Indent {
+				c.Items = append(c.Items, &rssItemCDATA{rssItem: ri, Description: cdata{multiline(item.Description)}})
+				continue
+			}
+			c.Items = append(c.Items, ri)
+		}
+		x := channel.FeedXml().(*feeds.RssFeedXml)
+		x.Channel = nil
+		rss := &rssXML{RssFeedXml: x, Channel: c}
+		if c.Self != nil {
+			rss.AtomNamespace = atomNamespace
+		}
+
+		header := xml.Header[:len(xml.Header)-1]
+		if opts.Indent {
+			header = xml.Header
+		}
+		buf := bytes.NewBufferString(header)
+		e := xml.NewEncoder(buf)
+		if opts.Indent {
+			e.Indent("", "  ")
+		}
+		if err := e.Encode(rss); err != nil {
+			return nil, err
+		}
+		if opts.Indent {
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// multiline puts each line of an item description on its own line: after
+// each <br> (and list item), or in place of them within <pre>
+func multiline(html string) string {
+	if strings.HasPrefix(html, "<pre>") {
+		return strings.Replace(html, "<br>", "\n", -1)
+	}
+	return strings.NewReplacer("<br>", "<br>\n", "</li>", "</li>\n").Replace(html)
+}
+
+// unmultiline is the item description of the html from multiline, as it was
+func unmultiline(html string) string {
+	if strings.HasPrefix(html, "<pre>") {
+		return html
+	}
+	return strings.NewReplacer("<br>\n", "<br>", "</li>\n", "</li>").Replace(html)
+}
@@ -0,0 +1,71 @@
+package changelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// The JSON of the entries is for other tooling, so its field names are fixed
+// here rather than following the Go names of Entry and Update. Fields may be
+// added, but not renamed or removed.
+
+type jsonEntry struct {
+	Date        string       `json:"date"`
+	RawDate     string       `json:"raw_date,omitempty"`
+	Comment     string       `json:"comment"`
+	SecurityFix bool         `json:"security_fix"`
+	Updates     []jsonUpdate `json:"updates"`
+}
+
+type jsonUpdate struct {
+	Name        string      `json:"name"`
+	Action      string      `json:"action"`
+	Comment     string      `json:"comment"`
+	SecurityFix bool        `json:"security_fix"`
+	Package     jsonPackage `json:"package"`
+}
+
+type jsonPackage struct {
+	Series  string `json:"series"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	Build   string `json:"build"`
+}
+
+// EntriesJSON is the entries as an indented JSON array, each with its date (in
+// RFC 3339, UTC, and its raw_date when that could not be parsed), comment and
+// updates, and each update with its parsed package file name
+func EntriesJSON(entries []Entry) ([]byte, error) {
+	out := []jsonEntry{}
+	for _, e := range entries {
+		je := jsonEntry{
+			Date:        e.Date.UTC().Format(time.RFC3339),
+			RawDate:     e.RawDate,
+			Comment:     e.Comment,
+			SecurityFix: e.SecurityFix(),
+			Updates:     []jsonUpdate{},
+		}
+		for _, u := range e.Updates {
+			p := u.Package()
+			je.Updates = append(je.Updates, jsonUpdate{
+				Name:        u.Name,
+				Action:      u.Action,
+				Comment:     u.Comment,
+				SecurityFix: u.SecurityFix(),
+				Package:     jsonPackage{Series: p.Series, Name: p.Name, Version: p.Version, Arch: p.Arch, Build: p.Build},
+			})
+		}
+		out = append(out, je)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
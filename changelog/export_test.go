@@ -0,0 +1,29 @@
+package changelog
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEntriesJSON(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schema is for other tooling, so any change to it shows here
+	data, err := EntriesJSON(e[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "entries.json", string(data))
+
+	if data, err := EntriesJSON(nil); err != nil || string(data) != "[]\n" {
+		t.Errorf("expected an empty array for no entries; got %q, %v", data, err)
+	}
+}
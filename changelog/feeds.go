@@ -1,55 +1,350 @@
 package changelog
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gorilla/feeds"
 )
 
+const (
+	// GranularityEntry produces one feed item per ChangeLog Entry
+	GranularityEntry = "entry"
+	// GranularityPackage produces one feed item per updated package
+	GranularityPackage = "package"
+)
+
+const (
+	// SortDesc orders the feed items newest first (the default)
+	SortDesc = "desc"
+	// SortAsc orders the feed items oldest first
+	SortAsc = "asc"
+)
+
+const (
+	// ItemFormatPre is the ChangeLog text of the item in a <pre> (the default)
+	ItemFormatPre = "pre"
+	// ItemFormatList is the comment of the Entry, followed by a list of its
+	// updates with each package in bold
+	ItemFormatList = "list"
+	// ItemFormatPlain is the ChangeLog text of the item with a <br> for each
+	// newline, and not escaped, as the items were before ItemFormat
+	ItemFormatPlain = "plain"
+)
+
+const (
+	// DefaultMassRebuildThreshold is the count of updates above which an
+	// Entry is a mass rebuild, unless FeedOptions sets another
+	DefaultMassRebuildThreshold = 100
+	// DefaultMassRebuildShow is how many updates of a mass rebuild are listed
+	// in its item, unless FeedOptions sets another
+	DefaultMassRebuildShow = 20
+)
+
+// DefaultDescription is the feed description, unless FeedOptions sets one
+const DefaultDescription = "generated by github.com/vbatts/sl-feeds"
+
+// FeedOptions adjusts how the feed is produced from the ChangeLog Entries
+type FeedOptions struct {
+	// Granularity is either GranularityEntry (the default) or GranularityPackage
+	Granularity string
+	// Title of the feed
+	Title string
+	// Description of the feed, defaulting to DefaultDescription
+	Description string
+	// Author of the feed, as the name and email of its author (either may be
+	// empty), when it has one
+	Author      string
+	AuthorEmail string
+	// SortOrder is either SortDesc (the default) or SortAsc
+	SortOrder string
+	// MassRebuildThreshold is the count of updates above which an Entry is a
+	// mass rebuild (see CategoryMassRebuild). 0 is the
+	// DefaultMassRebuildThreshold, and less than 0 turns off the detection.
+	MassRebuildThreshold int
+	// MassRebuildShow is how many updates of a mass rebuild are listed in the
+	// description of its item, with a count of the rest. 0 is the
+	// DefaultMassRebuildShow, and less than 0 lists them all.
+	MassRebuildShow int
+	// ItemFormat is the HTML of the item descriptions, either ItemFormatPre
+	// (the default), ItemFormatList or ItemFormatPlain
+	ItemFormat string
+	// Reflow joins the hard-wrapped lines of the descriptions (see Reflow)
+	Reflow bool
+	// Release is the name of the release of the feed, for the GUIDs of its
+	// items. It defaults to the last element of the link.
+	Release string
+	// ItemLink, when set, links each item (given its Entry, and its package
+	// for GranularityPackage) instead of its anchor in the ChangeLog.txt. When
+	// it returns "", the item keeps that anchor.
+	ItemLink func(e Entry, pkg string) string
+}
+
+// itemLink is the link of an item: the ItemLink, or else its anchor in the
+// ChangeLog.txt at link
+func (opts FeedOptions) itemLink(link string, e Entry, pkg string) string {
+	if opts.ItemLink != nil {
+		if href := opts.ItemLink(e, pkg); href != "" {
+			return href
+		}
+	}
+	if pkg != "" {
+		return fmt.Sprintf("%s/ChangeLog.txt#src=feeds&time=%d&pkg=%s", link, e.Date.Unix(), url.QueryEscape(pkg))
+	}
+	return fmt.Sprintf("%s/ChangeLog.txt#src=feeds&time=%d", link, e.Date.Unix())
+}
+
+// release is the Release of the feed of link
+func (opts FeedOptions) release(link string) string {
+	if opts.Release != "" {
+		return opts.Release
+	}
+	return path.Base(strings.TrimRight(link, "/"))
+}
+
+// guid is the GUID of the item of the Entry, from the release, its date and a
+// hash of its text, so that it is the same for as long as the Entry is
+// unchanged (whatever the mirror, or how the feed is written), and not a link
+func (opts FeedOptions) guid(link string, e Entry) string {
+	sum := sha256.Sum256([]byte(e.ToChangeLog()))
+	return fmt.Sprintf("urn:sl-feeds:%s:%d:%x", url.PathEscape(opts.release(link)), e.Date.Unix(), sum[:8])
+}
+
+// description is the HTML of the Entry for its item, listing only the first
+// show updates (or all of them, when less than 0)
+func (opts FeedOptions) description(e Entry, show int) string {
+	switch opts.ItemFormat {
+	case ItemFormatPlain:
+		if opts.Reflow {
+			return reflowedHTML(e.collapsedText(show), false)
+		}
+		return e.ToHTMLCollapsed(show)
+	case ItemFormatList:
+		return listHTML(e, show, opts.Reflow)
+	}
+	if opts.Reflow {
+		return reflowedHTML(e.collapsedText(show), true)
+	}
+	return "<pre>" + html.EscapeString(e.collapsedText(show)) + "</pre>"
+}
+
+// listHTML is the Entry comment as HTML, followed by a list of its updates
+// with each package in bold. Only the first show updates are listed (all of
+// them, when show is less than 0).
+func listHTML(e Entry, show int, reflow bool) string {
+	lines := func(text string) string {
+		if reflow {
+			text = Reflow(text)
+		}
+		escaped := []string{}
+		for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+			escaped = append(escaped, html.EscapeString(strings.TrimSpace(line)))
+		}
+		return strings.Join(escaped, "<br>")
+	}
+
+	buf := &strings.Builder{}
+	if strings.TrimSpace(e.Comment) != "" {
+		fmt.Fprintf(buf, "<p>%s</p>", lines(e.Comment))
+	}
+	if len(e.Updates) == 0 {
+		return buf.String()
+	}
+	updates := e.Updates
+	if show >= 0 && len(updates) > show {
+		updates = updates[:show]
+	}
+	buf.WriteString("<ul>")
+	for _, u := range updates {
+		fmt.Fprintf(buf, "<li><b>%s</b>: %s.", html.EscapeString(u.Name), html.EscapeString(u.Action))
+		if strings.TrimSpace(u.Comment) != "" {
+			buf.WriteString("<br>" + lines(u.Comment))
+		}
+		buf.WriteString("</li>")
+	}
+	if rest := len(e.Updates) - len(updates); rest > 0 {
+		fmt.Fprintf(buf, "<li>…and %d more</li>", rest)
+	}
+	buf.WriteString("</ul>")
+	return buf.String()
+}
+
+func (opts FeedOptions) massRebuild(e Entry) bool {
+	threshold := opts.MassRebuildThreshold
+	if threshold == 0 {
+		threshold = DefaultMassRebuildThreshold
+	}
+	return threshold > 0 && len(e.Updates) > threshold
+}
+
+func (opts FeedOptions) massRebuildShow() int {
+	if opts.MassRebuildShow == 0 {
+		return DefaultMassRebuildShow
+	}
+	return opts.MassRebuildShow
+}
+
+// SortEntries orders the entries by their Date, either SortDesc (newest first)
+// or SortAsc. Entries with the same Date keep their order from the ChangeLog.
+func SortEntries(entries []Entry, order string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if order == SortAsc {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		return entries[i].Date.After(entries[j].Date)
+	})
+}
+
 // ToFeed produces a github.com/gorilla/feeds.Feed that can be written to Atom or Rss
 func ToFeed(link string, entries []Entry) (*feeds.Feed, error) {
-	var newestEntryTime time.Time
-	var oldestEntryTime time.Time
+	return ToFeedWithOptions(link, entries, FeedOptions{})
+}
+
+// ToFeedWithOptions is ToFeed, but with the FeedOptions applied
+func ToFeedWithOptions(link string, entries []Entry, opts FeedOptions) (*feeds.Feed, error) {
+	feed, _, err := ToFeedCategories(link, entries, opts)
+	return feed, err
+}
+
+// ToFeedCategories is ToFeedWithOptions, along with the Categories of the
+// items (for RenderRssCategories)
+func ToFeedCategories(link string, entries []Entry, opts FeedOptions) (*feeds.Feed, Categories, error) {
+	feed, cats, _, err := ToFeedTexts(link, entries, opts)
+	return feed, cats, err
+}
+
+// Texts are the plain ChangeLog text of the items of a feed, by item, as the
+// items of github.com/gorilla/feeds only have their HTML
+type Texts map[*feeds.Item]string
+
+// ToFeedTexts is ToFeedCategories, along with the Texts of the items (for
+// RenderJSONFeed)
+func ToFeedTexts(link string, entries []Entry, opts FeedOptions) (*feeds.Feed, Categories, Texts, error) {
+	switch opts.Granularity {
+	case "", GranularityEntry, GranularityPackage:
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown granularity %q", opts.Granularity)
+	}
+	switch opts.SortOrder {
+	case "", SortDesc, SortAsc:
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown sort order %q", opts.SortOrder)
+	}
+	switch opts.ItemFormat {
+	case "", ItemFormatPre, ItemFormatList, ItemFormatPlain:
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown item format %q", opts.ItemFormat)
+	}
+	entries = append([]Entry{}, entries...)
+	SortEntries(entries, opts.SortOrder)
 
+	// the feed is as of its newest entry, rather than of when it is written,
+	// so that it is the same for as long as its entries are
+	var newestEntryTime time.Time
 	for _, e := range entries {
 		if e.Date.After(newestEntryTime) {
 			newestEntryTime = e.Date
 		}
-		if e.Date.Before(oldestEntryTime) {
-			oldestEntryTime = e.Date
-		}
 	}
 
+	description := opts.Description
+	if description == "" {
+		description = DefaultDescription
+	}
 	feed := &feeds.Feed{
-		Title:       "",
+		Title:       opts.Title,
 		Link:        &feeds.Link{Href: link},
-		Description: "generated by github.com/vbatts/sl-feeds",
-		Created:     oldestEntryTime,
+		Description: description,
+		Created:     newestEntryTime,
 		Updated:     newestEntryTime,
 	}
-	feed.Items = make([]*feeds.Item, len(entries))
-	for i, e := range entries {
-		url := fmt.Sprintf("%s/ChangeLog.txt#src=feeds&time=%d", link, e.Date.Unix())
-		feed.Items[i] = &feeds.Item{
-			Created:     e.Date,
-			Link:        &feeds.Link{Href: url},
-			Description: e.ToHTML(),
-			Id:          url,
+	if opts.Author != "" || opts.AuthorEmail != "" {
+		feed.Author = &feeds.Author{Name: opts.Author, Email: opts.AuthorEmail}
+	}
+	feed.Items = []*feeds.Item{}
+	cats := Categories{}
+	texts := Texts{}
+	add := func(item *feeds.Item, c []string, text string) {
+		feed.Items = append(feed.Items, item)
+		if len(c) > 0 {
+			cats[item] = c
 		}
-
-		updateWord := "updates"
-		if len(e.Updates) == 1 {
-			updateWord = "update"
+		texts[item] = text
+	}
+	for _, e := range entries {
+		massRebuild := opts.massRebuild(e)
+		if opts.Granularity == GranularityPackage && len(e.Updates) > 0 {
+			for _, u := range e.Updates {
+				c := u.Categories()
+				if massRebuild {
+					c = append(c, CategoryMassRebuild)
+				}
+				sub := Entry{Date: e.Date, Comment: e.Comment, Updates: []Update{u}}
+				add(packageItem(link, e, u, opts), c, sub.ToChangeLog())
+			}
+			continue
 		}
-		if e.SecurityFix() {
-			feed.Items[i].Title = fmt.Sprintf("%d %s. Including a %s!", len(e.Updates), updateWord, securityFixStr)
-		} else if len(e.Updates) == 0 {
-			feed.Items[i].Title = ""
-		} else {
-			feed.Items[i].Title = fmt.Sprintf("%d %s", len(e.Updates), updateWord)
+		item, c := entryItem(link, e, opts), e.Categories()
+		if massRebuild {
+			c = append(c, CategoryMassRebuild)
+			item.Description = opts.description(e, opts.massRebuildShow())
 		}
+		add(item, c, e.ToChangeLog())
 	}
 
-	return feed, nil
+	return feed, cats, texts, nil
+}
+
+func entryItem(link string, e Entry, opts FeedOptions) *feeds.Item {
+	item := &feeds.Item{
+		Created:     e.Date,
+		Link:        &feeds.Link{Href: opts.itemLink(link, e, "")},
+		Description: opts.description(e, -1),
+		Id:          opts.guid(link, e),
+	}
+
+	updateWord := "updates"
+	if len(e.Updates) == 1 {
+		updateWord = "update"
+	}
+	if e.SecurityFix() {
+		item.Title = fmt.Sprintf("%d %s. Including a %s!", len(e.Updates), updateWord, securityFixStr)
+	} else if len(e.Updates) == 0 {
+		item.Title = ""
+	} else {
+		item.Title = fmt.Sprintf("%d %s", len(e.Updates), updateWord)
+	}
+	if v := e.KernelVersion(); v != "" {
+		item.Title = fmt.Sprintf("%s (kernel %s)", item.Title, v)
+	}
+	// the narrative of an announcement says more than the count of updates
+	if summary := e.Summary(); summary != "" && item.Title != "" {
+		item.Title = fmt.Sprintf("%s — %s", item.Title, summary)
+	} else if summary != "" {
+		item.Title = summary
+	}
+	return item
+}
+
+// packageItem is a feed item for just the one Update of the Entry, still
+// carrying the Entry's date and comment.
+func packageItem(link string, e Entry, u Update, opts FeedOptions) *feeds.Item {
+	sub := Entry{Date: e.Date, Comment: e.Comment, Updates: []Update{u}}
+	item := &feeds.Item{
+		Created:     e.Date,
+		Link:        &feeds.Link{Href: opts.itemLink(link, e, u.Name)},
+		Description: opts.description(sub, -1),
+		Id:          opts.guid(link, sub),
+		Title:       fmt.Sprintf("%s %s", u.Package(), strings.ToLower(u.Action)),
+	}
+	if u.SecurityFix() {
+		item.Title = item.Title + " (security)"
+	}
+	return item
 }
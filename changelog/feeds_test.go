@@ -1,11 +1,39 @@
 package changelog
 
 import (
+	"flag"
+	"fmt"
+	"html"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/feeds"
 )
 
+var update = flag.Bool("update", false, "update the golden files in testdata/golden/")
+
+// checkGolden compares got to the golden file testdata/golden/name
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(expected) {
+		t.Errorf("output differs from %s (rerun with -update if intended):\n%s", path, got)
+	}
+}
+
 func TestFeed(t *testing.T) {
 	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
 	if err != nil {
@@ -36,3 +64,427 @@ func TestFeed(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestFeedPackageGranularity(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{Granularity: GranularityPackage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLen := 0
+	for i := range e {
+		if len(e[i].Updates) == 0 {
+			expectedLen++
+		}
+		expectedLen += len(e[i].Updates)
+	}
+	if len(f.Items) != expectedLen {
+		t.Errorf("expected %d items; got %d", expectedLen, len(f.Items))
+	}
+
+	ids := map[string]bool{}
+	for _, item := range f.Items {
+		if ids[item.Id] {
+			t.Errorf("duplicate item id %q", item.Id)
+		}
+		ids[item.Id] = true
+	}
+
+	expectedTitle := "mozilla-firefox-51.0 upgraded (security)"
+	if f.Items[2].Title != expectedTitle {
+		t.Errorf("expected title %q; got %q", expectedTitle, f.Items[2].Title)
+	}
+
+	if _, err := ToFeedWithOptions("", e, FeedOptions{Granularity: "bogus"}); err == nil {
+		t.Error("expected an error for an unknown granularity")
+	}
+}
+
+func TestFeedTitleDescription(t *testing.T) {
+	e := []Entry{{Comment: "Hey folks\n"}}
+
+	f, err := ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Description != DefaultDescription {
+		t.Errorf("expected description %q; got %q", DefaultDescription, f.Description)
+	}
+
+	opts := FeedOptions{Title: "Slackware64 -current updates", Description: "from the mirror"}
+	f, err = ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", e, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != opts.Title || f.Description != opts.Description {
+		t.Errorf("expected %q and %q; got %q and %q", opts.Title, opts.Description, f.Title, f.Description)
+	}
+}
+
+func TestFeedAuthor(t *testing.T) {
+	e := []Entry{{Date: time.Date(2024, 6, 5, 19, 42, 11, 0, time.UTC), Comment: "Hey folks\n"}}
+	for _, c := range []struct {
+		name, email string
+		expected    map[string]string
+	}{
+		{"Slackware Feeds", "feeds@example.com", map[string]string{
+			FormatRss:      "<managingEditor>feeds@example.com (Slackware Feeds)</managingEditor>",
+			FormatAtom:     "<author>\n    <name>Slackware Feeds</name>\n    <email>feeds@example.com</email>\n  </author>",
+			FormatJSONFeed: `"authors":[{"name":"Slackware Feeds","url":"mailto:feeds@example.com"}]`,
+		}},
+		{"Slackware Feeds", "", map[string]string{
+			FormatRss:      "",
+			FormatAtom:     "<author>\n    <name>Slackware Feeds</name>\n  </author>",
+			FormatJSONFeed: `"authors":[{"name":"Slackware Feeds"}]`,
+		}},
+	} {
+		f, err := ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{Author: c.name, AuthorEmail: c.email})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for format, expected := range c.expected {
+			// (the JSON on one line, for comparing)
+			data, err := Formats[format].Renderer(RenderOptions{Indent: format != FormatJSONFeed})(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected == "" && strings.Contains(string(data), "managingEditor") || !strings.Contains(string(data), expected) {
+				t.Errorf("%s %q: expected %q; got:\n%s", format, c.email, expected, data)
+			}
+		}
+	}
+}
+
+func TestFeedItemLinks(t *testing.T) {
+	entries := []Entry{
+		{Date: time.Date(2024, 1, 3, 20, 10, 5, 0, time.UTC), Updates: []Update{{Name: "a/aaa_glibc-solibs-2.39-x86_64-1.txz", Action: "Upgraded"}}},
+		{Date: time.Date(2024, 1, 3, 4, 31, 40, 0, time.UTC), Updates: []Update{{Name: "n/curl-8.5.0-x86_64-1.txz", Action: "Upgraded"}}},
+	}
+	link := "http://slackware.osuosl.org/slackware64-current"
+
+	// by default, each item links to its own entry in the ChangeLog.txt
+	f, err := ToFeed(link, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Items[0].Link.Href != link+"/ChangeLog.txt#src=feeds&time=1704312605" || f.Items[1].Link.Href != link+"/ChangeLog.txt#src=feeds&time=1704256300" {
+		t.Errorf("expected a link to the entry of each item; got %q and %q", f.Items[0].Link.Href, f.Items[1].Link.Href)
+	}
+
+	opts := FeedOptions{Granularity: GranularityPackage, ItemLink: func(e Entry, pkg string) string {
+		if strings.HasPrefix(pkg, "n/") {
+			return ""
+		}
+		return "https://changelog.example/slackware64-current/" + e.Date.Format("2006-01-02T150405") + "/" + pkg
+	}}
+	if f, err = ToFeedWithOptions(link, entries, opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://changelog.example/slackware64-current/2024-01-03T201005/a/aaa_glibc-solibs-2.39-x86_64-1.txz",
+		link + "/ChangeLog.txt#src=feeds&time=1704256300&pkg=n%2Fcurl-8.5.0-x86_64-1.txz",
+	}
+	for i, item := range f.Items {
+		if item.Link.Href != expected[i] {
+			t.Errorf("expected %q; got %q", expected[i], item.Link.Href)
+		}
+	}
+}
+
+func TestFeedSortOrder(t *testing.T) {
+	fh, err := os.Open("testdata/unordered/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []string{SortDesc, SortAsc} {
+		// the ordering has to be the same no matter how many times it is done
+		for i := 0; i < 3; i++ {
+			f, err := ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{Granularity: GranularityPackage, SortOrder: order})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := []string{}
+			for _, item := range f.Items {
+				lines = append(lines, fmt.Sprintf("%s %s", item.Created.Format(time.RFC3339), item.Title))
+			}
+			checkGolden(t, "order-"+order+".txt", strings.Join(lines, "\n")+"\n")
+		}
+	}
+
+	if _, err := ToFeedWithOptions("", e, FeedOptions{SortOrder: "sideways"}); err == nil {
+		t.Error("expected an error for an unknown sort order")
+	}
+}
+
+func TestFeedMassRebuild(t *testing.T) {
+	rebuild := Entry{Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Comment: "Rebuilt against gcc-14.1.0.\n"}
+	for i := 0; i < 150; i++ {
+		rebuild.Updates = append(rebuild.Updates, Update{Name: fmt.Sprintf("l/lib%d-1.0-x86_64-2.txz", i), Action: "Rebuilt"})
+	}
+	small := Entry{Date: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), Updates: rebuild.Updates[:3]}
+	entries := []Entry{rebuild, small}
+
+	f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", entries, FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// newest first
+	if len(cats[f.Items[1]]) != 1 || cats[f.Items[1]][0] != CategoryMassRebuild {
+		t.Errorf("expected the rebuild to be a %s; got %q", CategoryMassRebuild, cats[f.Items[1]])
+	}
+	if len(cats[f.Items[0]]) != 0 {
+		t.Errorf("expected no categories for a small entry; got %q", cats[f.Items[0]])
+	}
+	desc := f.Items[1].Description
+	if !strings.Contains(desc, "lib19-1.0") || strings.Contains(desc, "lib20-1.0") || !strings.Contains(desc, "…and 130 more") {
+		t.Errorf("expected the first %d updates and a count of the rest; got %q", DefaultMassRebuildShow, desc)
+	}
+
+	f, cats, err = ToFeedCategories("http://slackware.osuosl.org/slackware64-current", entries, FeedOptions{MassRebuildThreshold: 2, MassRebuildShow: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cats) != 2 {
+		t.Errorf("expected both entries to be mass rebuilds over a threshold of 2; got %d", len(cats))
+	}
+	if f.Items[1].Description != "<pre>"+html.EscapeString(rebuild.ToChangeLog())+"</pre>" {
+		t.Error("expected all updates to be listed")
+	}
+
+	_, cats, err = ToFeedCategories("http://slackware.osuosl.org/slackware64-current", entries, FeedOptions{MassRebuildThreshold: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cats) != 0 {
+		t.Errorf("expected no mass rebuilds when turned off; got %d", len(cats))
+	}
+}
+
+func TestRenderRssIndent(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", e[:2], FeedOptions{Title: "slackware64-current"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := RenderRssOptions(RenderOptions{Categories: cats, Indent: true})
+	data, err := render(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "indent-rss.txt", string(data))
+	again, err := render(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Error("expected the same output for the same feed")
+	}
+
+	// and without it, compact
+	for _, name := range FormatNames() {
+		data, err := Formats[name].Renderer(RenderOptions{Categories: cats})(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "\n  ") || strings.HasSuffix(string(data), "\n") {
+			t.Errorf("%s: expected no indenting without Indent; got:\n%s", name, data)
+		}
+	}
+
+	f, cats, err = ToFeedCategories("http://slackware.osuosl.org/slackware64-current", e[:1], FeedOptions{Reflow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = RenderRssOptions(RenderOptions{Categories: cats, Indent: true})(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "d/gdb-7.12.1-x86_64-1.txz:  Upgraded.<br>\n") {
+		t.Errorf("expected a line for each line of the reflowed description; got:\n%s", data)
+	}
+}
+
+func TestFeedItemFormats(t *testing.T) {
+	e := Entry{
+		Date:    time.Date(2024, 6, 5, 19, 42, 11, 0, time.UTC),
+		Comment: "Thanks to <someone> & friends for the report.\n",
+		Updates: []Update{
+			{Name: "n/openssl-3.0.14-x86_64-1.txz", Action: "Upgraded", Comment: "  Fixed a crash when a length was > 64 & the name <empty>.\n  (* Security fix *)\n"},
+			{Name: "x/libX11-1.8.9-x86_64-1.txz", Action: "Upgraded"},
+		},
+	}
+	for _, format := range []string{ItemFormatPre, ItemFormatList, ItemFormatPlain} {
+		f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", []Entry{e}, FeedOptions{Title: "slackware64-current", ItemFormat: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := RenderRssOptions(RenderOptions{Categories: cats, Indent: true})(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, "item-format-"+format+".txt", string(data))
+	}
+
+	if _, err := ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", []Entry{e}, FeedOptions{ItemFormat: "markdown"}); err == nil {
+		t.Error("expected an error for an unknown item format")
+	}
+}
+
+func TestRenderRssSource(t *testing.T) {
+	e := []Entry{{Date: time.Date(2017, time.January, 23, 21, 30, 13, 0, time.UTC), Comment: "Hello.\n"}}
+	f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &Source{Name: "osuosl", URL: "http://slackware.osuosl.org"}
+	expected := `<source url="http://slackware.osuosl.org">osuosl</source>`
+	for _, indent := range []bool{false, true} {
+		data, err := RenderRssOptions(RenderOptions{Categories: cats, Indent: indent, Source: src})(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(string(data), expected) != 1 {
+			t.Errorf("indent %t: expected the item source %q; got:\n%s", indent, expected, data)
+		}
+	}
+	data, err := RenderRssOptions(RenderOptions{Categories: cats})(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "<source") {
+		t.Errorf("expected no item source; got:\n%s", data)
+	}
+
+	// the source of an item is over that of the feed
+	own := Sources{f.Items[0]: &Source{Name: "slackware64-current", URL: "http://slackware.osuosl.org/slackware64-current"}}
+	data, err = RenderRssOptions(RenderOptions{Categories: cats, Source: src, Sources: own})(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<source url="http://slackware.osuosl.org/slackware64-current">slackware64-current</source>`; !strings.Contains(string(data), expected) {
+		t.Errorf("expected the item source %q; got:\n%s", expected, data)
+	}
+}
+
+func TestRenderChannel(t *testing.T) {
+	e := []Entry{
+		{Date: time.Date(2017, time.January, 23, 21, 30, 13, 0, time.UTC), Comment: "Hello.\n"},
+		{Date: time.Date(2017, time.January, 20, 5, 1, 2, 0, time.UTC), Comment: "Hi.\n"},
+	}
+	f, cats, texts, err := ToFeedTexts("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{Title: "slackware64-current", SortOrder: SortAsc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range FormatNames() {
+		format := Formats[name]
+		opts := RenderOptions{
+			Categories: cats,
+			Texts:      texts,
+			Indent:     true,
+			Self:       "https://feeds.example/slackware64-current" + format.Ext,
+			Language:   "en",
+			TTL:        60,
+		}
+		data, err := format.Renderer(opts)(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, "channel-"+name+".txt", string(data))
+	}
+
+	// without them, the channel is as it was
+	data, err := RenderRssOptions(RenderOptions{Categories: cats})(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unexpected := range []string{"xmlns:atom", "<atom:link", "<ttl>", "<language>"} {
+		if strings.Contains(string(data), unexpected) {
+			t.Errorf("expected no %s; got:\n%s", unexpected, data)
+		}
+	}
+}
+
+func TestFeedStableGUIDs(t *testing.T) {
+	guids := func(link string, opts FeedOptions) []string {
+		fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+		e, err := Parse(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Granularity == "" {
+			// a change to the body of the newest entry
+			e[0].Updates[0].Comment += "\n  Thanks to a reader."
+		}
+		f, err := ToFeedWithOptions(link, e, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, item := range f.Items {
+			ids = append(ids, item.Id)
+		}
+		return ids
+	}
+
+	link := "http://slackware.osuosl.org/slackware64-current"
+	entry := FeedOptions{Granularity: GranularityEntry}
+	first, second := guids(link, entry), guids(link, entry)
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Errorf("expected the same GUIDs from parsing the ChangeLog again; got %q and %q", first[:2], second[:2])
+	}
+	// whatever the mirror, or how the feed is sorted
+	other := guids("http://mirrors.example.com/slackware/slackware64-current/", FeedOptions{Granularity: GranularityEntry, SortOrder: SortAsc})
+	if first[0] != other[len(other)-1] {
+		t.Errorf("expected the GUID of an entry to not depend on the mirror or order; got %q and %q", first[0], other[len(other)-1])
+	}
+	if !strings.HasPrefix(first[0], "urn:sl-feeds:slackware64-current:1485207013:") {
+		t.Errorf("expected the GUID to be of the release and date; got %q", first[0])
+	}
+
+	changed := guids(link, FeedOptions{})
+	if changed[0] == first[0] {
+		t.Errorf("expected the GUID to change along with the entry; got %q", changed[0])
+	}
+	if strings.Join(changed[1:], "\n") != strings.Join(first[1:], "\n") {
+		t.Error("expected the GUIDs of the unchanged entries to stay the same")
+	}
+
+	data, err := RenderRss(&feeds.Feed{Link: &feeds.Link{Href: link}, Items: []*feeds.Item{{Title: "x", Id: first[0], Link: &feeds.Link{Href: link}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `<guid isPermaLink="false">`+first[0]+`</guid>`) {
+		t.Errorf("expected the guid to not be a permalink; got:\n%s", data)
+	}
+}
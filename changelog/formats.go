@@ -0,0 +1,89 @@
+package changelog
+
+import (
+	"sort"
+
+	"github.com/gorilla/feeds"
+)
+
+// The names of the output formats
+const (
+	// FormatRss is RSS 2.0
+	FormatRss = "rss"
+	// FormatAtom is Atom 1.0
+	FormatAtom = "atom"
+	// FormatJSONFeed is JSON Feed 1.1
+	FormatJSONFeed = "json"
+)
+
+// Format is an output format of the feeds
+type Format struct {
+	// Ext is the extension of the files written in this format, like ".rss"
+	Ext string
+	// ContentType is the media type of the format, for serving the files
+	ContentType string
+	// Renderer is the RenderFunc of a feed, with the RenderOptions
+	Renderer func(opts RenderOptions) RenderFunc
+}
+
+// RenderOptions are the settings of a Renderer
+type RenderOptions struct {
+	// Categories are those of the items of the feed
+	Categories Categories
+	// Texts are the ChangeLog text of the items of the feed, for the formats
+	// that have them as well as the HTML
+	Texts Texts
+	// Indent writes the output for diffing, as when the feeds are kept in
+	// git: indented, with each line of an item description on a line of its
+	// own, and ending with a newline. Otherwise the output is compact.
+	Indent bool
+	// Source, when set, is where every item of the feed is from
+	Source *Source
+	// Sources are where each item is from, over the Source, as for a feed of
+	// the items of several releases
+	Sources Sources
+	// Self, when set, is the URL of the feed itself, as its link of
+	// rel="self" (the atom:link of RSS, or the feed_url of a JSON Feed)
+	Self string
+	// Language, when set, is that of the feed, like "en"
+	Language string
+	// TTL, when more than 0, is the minutes the RSS may be cached before it
+	// is fetched again
+	TTL int
+}
+
+// Source is the provenance of feed items, like the mirror they are from, for
+// readers of feeds that aggregate several
+type Source struct {
+	Name string
+	URL  string
+}
+
+// Sources are the Source of the items of a feed, by item
+type Sources map[*feeds.Item]*Source
+
+// source is where the item is from: its own of the Sources, or else the
+// Source of the feed
+func (opts RenderOptions) source(item *feeds.Item) *Source {
+	if s := opts.Sources[item]; s != nil {
+		return s
+	}
+	return opts.Source
+}
+
+// Formats are the registered output formats, by name
+var Formats = map[string]Format{
+	FormatRss:      {Ext: ".rss", ContentType: "application/rss+xml", Renderer: RenderRssOptions},
+	FormatAtom:     {Ext: ".atom", ContentType: "application/atom+xml", Renderer: RenderAtomOptions},
+	FormatJSONFeed: {Ext: ".json", ContentType: "application/feed+json", Renderer: RenderJSONFeed},
+}
+
+// FormatNames are the names of the registered Formats, sorted
+func FormatNames() []string {
+	names := []string{}
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,102 @@
+package changelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// JSONFeedVersion is the version of the JSON Feed spec written
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// jsonFeed is a JSON Feed, as of https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Items       []*jsonFeedItem  `json:"items"`
+}
+
+// jsonFeedAuthor has no email in JSON Feed, so that is its URL
+type jsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	ContentText   string   `json:"content_text,omitempty"`
+	ContentHTML   string   `json:"content_html,omitempty"`
+	DatePublished string   `json:"date_published,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// RenderJSONFeed is a RenderFunc for JSON Feed 1.1, with the RenderOptions.
+// The items have the ChangeLog text of the Texts as their content_text, or
+// else the HTML description as their content_html.
+func RenderJSONFeed(opts RenderOptions) RenderFunc {
+	return func(f *feeds.Feed) ([]byte, error) {
+		feed := jsonFeed{
+			Version:     JSONFeedVersion,
+			Title:       f.Title,
+			Description: f.Description,
+			FeedURL:     opts.Self,
+			Language:    opts.Language,
+			Items:       []*jsonFeedItem{},
+		}
+		if f.Link != nil {
+			feed.HomePageURL = f.Link.Href
+		}
+		if a := f.Author; a != nil {
+			author := jsonFeedAuthor{Name: a.Name}
+			if a.Email != "" {
+				author.URL = "mailto:" + a.Email
+			}
+			feed.Authors = []jsonFeedAuthor{author}
+		}
+		for _, item := range f.Items {
+			i := &jsonFeedItem{
+				ID:    item.Id,
+				Title: item.Title,
+				Tags:  opts.Categories[item],
+			}
+			if item.Link != nil {
+				i.URL = item.Link.Href
+			}
+			if i.ID == "" {
+				i.ID = i.URL
+			}
+			if text, ok := opts.Texts[item]; ok {
+				i.ContentText = text
+			} else {
+				i.ContentHTML = item.Description
+			}
+			if !item.Created.IsZero() {
+				i.DatePublished = item.Created.Format(time.RFC3339)
+			}
+			feed.Items = append(feed.Items, i)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		e := json.NewEncoder(buf)
+		e.SetEscapeHTML(false)
+		if opts.Indent {
+			e.SetIndent("", "  ")
+		}
+		if err := e.Encode(feed); err != nil {
+			return nil, err
+		}
+		if !opts.Indent {
+			return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+		}
+		return buf.Bytes(), nil
+	}
+}
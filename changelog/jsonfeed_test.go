@@ -0,0 +1,68 @@
+package changelog
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderJSONFeed(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, granularity := range []string{GranularityEntry, GranularityPackage} {
+		f, cats, texts, err := ToFeedTexts("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{Title: "slackware64-current", Granularity: granularity})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := RenderJSONFeed(RenderOptions{Categories: cats, Texts: texts})(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Version string `json:"version"`
+			Title   string `json:"title"`
+			Items   []struct {
+				ID            string   `json:"id"`
+				ContentText   string   `json:"content_text"`
+				ContentHTML   string   `json:"content_html"`
+				DatePublished string   `json:"date_published"`
+				Tags          []string `json:"tags"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.Version != JSONFeedVersion || doc.Title != "slackware64-current" || len(doc.Items) != len(f.Items) {
+			t.Fatalf("%s: unexpected feed %q, %q with %d items", granularity, doc.Version, doc.Title, len(doc.Items))
+		}
+		first := doc.Items[0]
+		if first.ID == "" || first.DatePublished != "2017-01-23T21:30:13Z" || first.ContentHTML != "" {
+			t.Errorf("%s: unexpected first item %#v", granularity, first)
+		}
+		if !strings.HasPrefix(first.ContentText, "Mon Jan 23 21:30:13 UTC 2017\nd/gdb-7.12.1-x86_64-1.txz:  Upgraded.\n") {
+			t.Errorf("%s: expected the ChangeLog text; got %q", granularity, first.ContentText)
+		}
+	}
+
+	// without the Texts, the HTML is the content
+	f, err := ToFeed("http://slackware.osuosl.org/slackware64-current", e[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := RenderJSONFeed(RenderOptions{Indent: true})(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"content_html": "<pre>Mon Jan 23 21:30:13 UTC 2017\n`) || !strings.HasSuffix(string(data), "}\n") {
+		t.Errorf("expected indented JSON with the HTML content; got:\n%s", data)
+	}
+}
@@ -0,0 +1,37 @@
+package changelog
+
+import "strings"
+
+// CategoryKernel is the category of the feed items that update the kernel
+const CategoryKernel = "kernel"
+
+// kernelPackages are the packages whose version is that of the kernel. Others
+// like kernel-firmware have versions of their own.
+var kernelPackages = map[string]bool{
+	"kernel-generic":     true,
+	"kernel-generic-smp": true,
+	"kernel-huge":        true,
+	"kernel-huge-smp":    true,
+	"kernel-source":      true,
+}
+
+// KernelVersion is the version of the kernel this update is for, like
+// `6.6.32`, or "" when it is not one of the kernel packages
+func (u Update) KernelVersion() string {
+	p := u.Package()
+	if !kernelPackages[p.Name] {
+		return ""
+	}
+	return strings.TrimSuffix(p.Version, "_smp")
+}
+
+// KernelVersion is the version of the kernel updated in this Entry, or ""
+// when no kernel package is updated
+func (e Entry) KernelVersion() string {
+	for _, u := range e.Updates {
+		if v := u.KernelVersion(); v != "" {
+			return v
+		}
+	}
+	return ""
+}
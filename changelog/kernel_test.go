@@ -0,0 +1,79 @@
+package changelog
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestKernelVersion(t *testing.T) {
+	cases := []struct {
+		updates  []string
+		expected string
+	}{
+		{[]string{"a/kernel-generic-6.6.32-x86_64-1.txz", "a/kernel-huge-6.6.32-x86_64-1.txz", "k/kernel-source-6.6.32-noarch-1.txz"}, "6.6.32"},
+		{[]string{"a/kernel-huge-smp-4.4.38_smp-i686-1.txz"}, "4.4.38"},
+		{[]string{"a/kernel-firmware-20161211git-noarch-1.txz"}, ""},
+		{[]string{"n/openssl-1.1.1w-x86_64-1.txz", "kernels/*"}, ""},
+	}
+	for _, c := range cases {
+		e := Entry{}
+		for _, name := range c.updates {
+			e.Updates = append(e.Updates, Update{Name: name, Action: "Upgraded"})
+		}
+		if v := e.KernelVersion(); v != c.expected {
+			t.Errorf("%q: expected %q; got %q", c.updates, c.expected, v)
+		}
+	}
+}
+
+func TestFeedKernelCategory(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", e, FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kernels := 0
+	for _, item := range f.Items {
+		hasCategory := len(cats[item]) == 1 && cats[item][0] == CategoryKernel
+		if strings.Contains(item.Title, "(kernel 4.4.38)") {
+			kernels++
+		}
+		if hasCategory != strings.Contains(item.Title, "(kernel ") {
+			t.Errorf("%q: expected the kernel category with the kernel in the title; got %q", item.Title, cats[item])
+		}
+	}
+	if kernels != 1 {
+		t.Errorf("expected %d item for kernel 4.4.38; got %d", 1, kernels)
+	}
+
+	data, err := RenderRssCategories(cats)(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<category>kernel</category>") {
+		t.Error("expected the kernel category in the rss")
+	}
+
+	// without any categories, it is the same as RenderRss
+	plain, err := RenderRss(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = RenderRssCategories(nil)(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(plain) {
+		t.Errorf("expected the same rss as RenderRss; got:\n%s", data)
+	}
+}
@@ -0,0 +1,32 @@
+package changelog
+
+import (
+	"sort"
+
+	"github.com/gorilla/feeds"
+)
+
+// MergeFeeds merges the items of parts into one feed, newest first (and in
+// part order for items of the same time), keeping only the newest maxItems
+// when it is more than 0. The items keep their Categories and Texts.
+func MergeFeeds(title, link string, parts []*feeds.Feed, maxItems int) *feeds.Feed {
+	feed := &feeds.Feed{
+		Title:       title,
+		Link:        &feeds.Link{Href: link},
+		Description: DefaultDescription,
+		Items:       []*feeds.Item{},
+	}
+	for _, p := range parts {
+		feed.Items = append(feed.Items, p.Items...)
+		if p.Updated.After(feed.Updated) {
+			feed.Updated = p.Updated
+		}
+	}
+	sort.SliceStable(feed.Items, func(i, j int) bool {
+		return feed.Items[i].Created.After(feed.Items[j].Created)
+	})
+	if maxItems > 0 && len(feed.Items) > maxItems {
+		feed.Items = feed.Items[:maxItems]
+	}
+	return feed
+}
@@ -0,0 +1,41 @@
+package changelog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+func TestMergeFeeds(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2017, time.January, d, 0, 0, 0, 0, time.UTC) }
+	a := &feeds.Feed{Updated: day(20), Items: []*feeds.Item{
+		{Title: "a 20", Created: day(20)},
+		{Title: "a 18", Created: day(18)},
+	}}
+	b := &feeds.Feed{Updated: day(23), Items: []*feeds.Item{
+		{Title: "b 18", Created: day(18)},
+		{Title: "b 23", Created: day(23)},
+		{Title: "b 14", Created: day(14)},
+	}}
+
+	merged := MergeFeeds("all", "http://mirror.example/", []*feeds.Feed{a, b}, 0)
+	expected := []string{"b 23", "a 20", "a 18", "b 18", "b 14"}
+	if len(merged.Items) != len(expected) {
+		t.Fatalf("expected %d items; got %d", len(expected), len(merged.Items))
+	}
+	for i, item := range merged.Items {
+		if item.Title != expected[i] {
+			t.Errorf("%d: expected %q; got %q", i, expected[i], item.Title)
+		}
+	}
+	if !merged.Updated.Equal(day(23)) || merged.Link.Href != "http://mirror.example/" {
+		t.Errorf("expected the newest of the parts, and the link; got %s, %q", merged.Updated, merged.Link.Href)
+	}
+
+	// the newest of all of the parts
+	merged = MergeFeeds("all", "http://mirror.example/", []*feeds.Feed{a, b}, 2)
+	if len(merged.Items) != 2 || merged.Items[1].Title != "a 20" {
+		t.Errorf("expected the 2 newest items; got %d", len(merged.Items))
+	}
+}
@@ -0,0 +1,63 @@
+package changelog
+
+import (
+	"path"
+	"strings"
+)
+
+// packageExts are the suffixes of slackware package files
+var packageExts = []string{".txz", ".tgz", ".tbz", ".tlz"}
+
+// Package is the parsed form of a slackware package file name, like
+// `n/openssl-1.1.1w-x86_64-1.txz`
+type Package struct {
+	Series  string
+	Name    string
+	Version string
+	Arch    string
+	Build   string
+}
+
+// ParsePackage splits an update name into the components of a slackware
+// package file name. Names that are not package files (like `isolinux/*` or
+// `kernels/*`) only get their Series and Name.
+func ParsePackage(name string) Package {
+	p := Package{Series: path.Dir(name), Name: path.Base(name)}
+	if p.Series == "." {
+		p.Series = ""
+	}
+	ext := ""
+	for _, e := range packageExts {
+		if strings.HasSuffix(p.Name, e) {
+			ext = e
+			break
+		}
+	}
+	if ext == "" {
+		return p
+	}
+	fields := strings.Split(strings.TrimSuffix(p.Name, ext), "-")
+	if len(fields) < 4 {
+		p.Name = strings.TrimSuffix(p.Name, ext)
+		return p
+	}
+	n := len(fields)
+	p.Name = strings.Join(fields[:n-3], "-")
+	p.Version = fields[n-3]
+	p.Arch = fields[n-2]
+	p.Build = fields[n-1]
+	return p
+}
+
+// String is the package name and version, like `openssl-1.1.1w`
+func (p Package) String() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "-" + p.Version
+}
+
+// Package is the parsed package file name of this update
+func (u Update) Package() Package {
+	return ParsePackage(u.Name)
+}
@@ -0,0 +1,90 @@
+package changelog
+
+import "testing"
+
+func TestParsePackage(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected Package
+		str      string
+	}{
+		{"n/openssl-1.1.1w-x86_64-1.txz", Package{Series: "n", Name: "openssl", Version: "1.1.1w", Arch: "x86_64", Build: "1"}, "openssl-1.1.1w"},
+		{"l/seamonkey-solibs-2.46-x86_64-3.txz", Package{Series: "l", Name: "seamonkey-solibs", Version: "2.46", Arch: "x86_64", Build: "3"}, "seamonkey-solibs-2.46"},
+		{"patches/packages/bind-9.10.4_P5-x86_64-1_slack14.2.txz", Package{Series: "patches/packages", Name: "bind", Version: "9.10.4_P5", Arch: "x86_64", Build: "1_slack14.2"}, "bind-9.10.4_P5"},
+		{"isolinux/initrd.img", Package{Series: "isolinux", Name: "initrd.img"}, "initrd.img"},
+		{"kernels/*", Package{Series: "kernels", Name: "*"}, "*"},
+	}
+	for _, c := range cases {
+		p := ParsePackage(c.name)
+		if p != c.expected {
+			t.Errorf("%q: expected %#v; got %#v", c.name, c.expected, p)
+		}
+		if p.String() != c.str {
+			t.Errorf("%q: expected %q; got %q", c.name, c.str, p.String())
+		}
+	}
+}
+
+func TestPackageEntries(t *testing.T) {
+	entries := []Entry{
+		{Comment: "both", Updates: []Update{
+			{Name: "a/openssl-solibs-1.0.2j-x86_64-1.txz", Action: "Upgraded"},
+			{Name: "n/openssl-1.0.2j-x86_64-1.txz", Action: "Upgraded"},
+		}},
+		{Comment: "only solibs", Updates: []Update{
+			{Name: "a/openssl-solibs-1.0.2i-x86_64-1.txz", Action: "Upgraded"},
+		}},
+		{Comment: "twice", Updates: []Update{
+			{Name: "n/openssl-1.0.2i-x86_64-1.txz", Action: "Removed"},
+			{Name: "n/openssl-1.0.2i-x86_64-2.txz", Action: "Added"},
+			{Name: "n/curl-7.51.0-x86_64-1.txz", Action: "Upgraded"},
+		}},
+	}
+	got := PackageEntries(entries, "openssl")
+	if len(got) != 2 || got[0].Comment != "both" || got[1].Comment != "twice" {
+		t.Fatalf("expected the two entries updating openssl; got %#v", got)
+	}
+	if len(got[0].Updates) != 1 || len(got[1].Updates) != 2 {
+		t.Errorf("expected only the updates of openssl; got %#v", got)
+	}
+	if len(entries[2].Updates) != 3 {
+		t.Error("expected the entries given to be left as they were")
+	}
+	if got := PackageEntries(entries, "openssl-solibs"); len(got) != 2 {
+		t.Errorf("expected the two entries updating openssl-solibs; got %d", len(got))
+	}
+	if got := PackageEntries(entries, "ssl"); len(got) != 0 {
+		t.Errorf("expected no entries for a part of a name; got %d", len(got))
+	}
+}
+
+func TestFilterPackages(t *testing.T) {
+	entries := []Entry{
+		{Comment: "kde", Updates: []Update{
+			{Name: "kde/kdelibs-4.14.3-x86_64-1.txz", Action: "Rebuilt"},
+			{Name: "kde/calligra-2.9.11-x86_64-1.txz", Action: "Rebuilt"},
+		}},
+		{Comment: "mixed", Updates: []Update{
+			{Name: "kde/kdelibs-4.14.3-x86_64-2.txz", Action: "Rebuilt"},
+			{Name: "kde/kdenlive-16.08.2-x86_64-1.txz", Action: "Upgraded"},
+			{Name: "n/openssl-1.0.2j-x86_64-1.txz", Action: "Upgraded"},
+		}},
+		{Comment: "no updates"},
+	}
+	if got := FilterPackages(entries, nil, nil); len(got) != 3 || len(got[1].Updates) != 3 {
+		t.Errorf("expected no filtering; got %#v", got)
+	}
+
+	got := FilterPackages(entries, []string{"kdenlive"}, []string{"kde*", "calligra*"})
+	if len(got) != 2 || got[0].Comment != "mixed" || got[1].Comment != "no updates" {
+		t.Fatalf("expected the entry of only KDE to be dropped; got %#v", got)
+	}
+	if len(got[0].Updates) != 2 || got[0].Updates[0].Package().Name != "kdenlive" || got[0].Updates[1].Package().Name != "openssl" {
+		t.Errorf("expected the include to win over the exclude; got %#v", got[0].Updates)
+	}
+
+	got = FilterPackages(entries, []string{"openssl"}, nil)
+	if len(got) != 2 || len(got[0].Updates) != 1 || got[0].Updates[0].Package().Name != "openssl" {
+		t.Errorf("expected only openssl with only an include; got %#v", got)
+	}
+}
@@ -1,9 +1,9 @@
 package changelog
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -12,69 +12,64 @@ import (
 const (
 	dividerStr     = `+--------------------------+`
 	securityFixStr = `(* Security fix *)`
-	dayPat         = `^(Mon|Tue|Wed|Thu|Fri|Sat|Sun)\s(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)\s.*\d{4}$`
+	dayPat         = `^(Mon|Tue|Wed|Thu|Fri|Sat|Sun)\s+(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)\s.*\d{4}\s*$`
 	updatePat      = `^([a-z].*/.*):  (Added|Rebuilt|Removed|Updated|Upgraded)\.$`
 )
 
 var (
 	dayReg    = regexp.MustCompile(dayPat)
 	updateReg = regexp.MustCompile(updatePat)
+	// looksLikeUpdateReg is a line that was probably meant as an update, like
+	// with an action that is not known
+	looksLikeUpdateReg = regexp.MustCompile(`^[a-z][^ ]*/[^ ]*:`)
 )
 
 // Parse takes in a slackware ChangeLog.txt and returns its collections of Entries
 func Parse(r io.Reader) ([]Entry, error) {
-	buf := bufio.NewReader(r)
-	entries := []Entry{}
-	curEntry := Entry{}
-	var curUpdate *Update
-	for {
-		line, err := buf.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		isEOF := err == io.EOF
-		trimmedline := strings.TrimSuffix(line, "\n")
+	e, _, err := ParseWithStats(r)
+	return e, err
+}
 
-		if trimmedline == dividerStr {
-			if curUpdate != nil {
-				curEntry.Updates = append(curEntry.Updates, *curUpdate)
-				curUpdate = nil
-			}
-			entries = append(entries, curEntry)
-			if isEOF {
-				break
-			}
-			curEntry = Entry{}
-		} else if dayReg.MatchString(trimmedline) {
-			// this date means it is the beginning of an entry
-			t, err := time.Parse(time.UnixDate, trimmedline)
-			if err != nil {
-				return nil, err
-			}
-			curEntry.Date = t
-		} else if updateReg.MatchString(trimmedline) {
-			// match on whether this is an update line
-			if curUpdate != nil {
-				curEntry.Updates = append(curEntry.Updates, *curUpdate)
-				curUpdate = nil
-			}
-			m := updateReg.FindStringSubmatch(trimmedline)
-			curUpdate = &Update{
-				Name:   m[1],
-				Action: m[2],
-			}
-		} else if curUpdate != nil && strings.HasPrefix(trimmedline, "  ") {
-			curUpdate.Comment = curUpdate.Comment + line
-		} else {
-			// Everything else is a comment on the Entry
-			curEntry.Comment = curEntry.Comment + line
-		}
+// ParseStats are the figures of a parsed ChangeLog, like for noticing when its
+// format drifts from what the parser understands
+type ParseStats struct {
+	Entries int
+	// Oldest and Newest are the range of dates of the Entries
+	Oldest, Newest time.Time
+	// LongestGap is the longest time between consecutive Entries
+	LongestGap time.Duration
+	// Packages is how many distinct packages were updated
+	Packages int
+	// SecurityEntries is how many Entries include a security fix
+	SecurityEntries int
+	// Lines is the count of lines that are not blank
+	Lines int
+	// Unrecognized is the count of lines that did not fit where they were
+	// found, and were kept as comments on the Entry: text before the date of
+	// an Entry, text breaking up the comment of an update, or what looks like
+	// an update but is not understood as one
+	Unrecognized int
+}
 
-		if isEOF {
-			break
-		}
+// UnrecognizedPercent is the percentage of the Lines that were Unrecognized
+func (s ParseStats) UnrecognizedPercent() float64 {
+	if s.Lines == 0 {
+		return 0
+	}
+	return float64(s.Unrecognized) * 100 / float64(s.Lines)
+}
+
+// ParseWithStats is Parse, along with the ParseStats of the ChangeLog
+func ParseWithStats(r io.Reader) ([]Entry, ParseStats, error) {
+	s := NewScanner(r)
+	entries := []Entry{}
+	for s.Scan() {
+		entries = append(entries, s.Entry())
 	}
-	return entries, nil
+	if err := s.Err(); err != nil {
+		return nil, s.Stats(), err
+	}
+	return entries, s.Stats(), nil
 }
 
 // Entry is an section of updates (or release comments) in a ChangeLog.txt
@@ -82,6 +77,9 @@ type Entry struct {
 	Date    time.Time
 	Comment string
 	Updates []Update
+	// RawDate is the date line of the Entry when it could not be parsed, its
+	// Date then being that of the Entry before it less a second
+	RawDate string
 }
 
 // SecurityFix is whether an update in this ChangeLog Entry includes a SecurityFix
@@ -94,14 +92,115 @@ func (e Entry) SecurityFix() bool {
 	return false
 }
 
+// SecurityFixes are the entries that include a security fix, leaving out the
+// rest
+func SecurityFixes(entries []Entry) []Entry {
+	fixes := []Entry{}
+	for _, e := range entries {
+		if e.SecurityFix() {
+			fixes = append(fixes, e)
+		}
+	}
+	return fixes
+}
+
+// PackageEntries are the entries that update the package of the name (exactly,
+// so that "openssl" is not "openssl-solibs"), each with only those updates.
+// An entry updating the package more than once is still only the one entry.
+func PackageEntries(entries []Entry, name string) []Entry {
+	pkgEntries := []Entry{}
+	for _, e := range entries {
+		updates := []Update{}
+		for _, u := range e.Updates {
+			if u.Package().Name == name {
+				updates = append(updates, u)
+			}
+		}
+		if len(updates) > 0 {
+			e.Updates = updates
+			pkgEntries = append(pkgEntries, e)
+		}
+	}
+	return pkgEntries
+}
+
+// FilterPackages are the entries with only the updates of the packages whose
+// names match the glob patterns (as of path.Match) of include, or else do not
+// match those of exclude. With only include patterns, every other package is
+// left out. An entry left with none of its updates is dropped, and with
+// neither include nor exclude the entries are returned as they are.
+func FilterPackages(entries []Entry, include, exclude []string) []Entry {
+	if len(include) == 0 && len(exclude) == 0 {
+		return entries
+	}
+	keep := func(name string) bool {
+		if matchAny(include, name) {
+			return true
+		}
+		if len(exclude) == 0 {
+			return false
+		}
+		return !matchAny(exclude, name)
+	}
+	filtered := []Entry{}
+	for _, e := range entries {
+		if len(e.Updates) == 0 {
+			filtered = append(filtered, e)
+			continue
+		}
+		updates := []Update{}
+		for _, u := range e.Updates {
+			if keep(u.Package().Name) {
+				updates = append(updates, u)
+			}
+		}
+		if len(updates) > 0 {
+			e.Updates = updates
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // ToHTML reformats the struct as the text for HTML output
 func (e Entry) ToHTML() string {
 	return "<pre><blockquote>" + strings.Replace(e.ToChangeLog(), "\n", "<br>", -1) + "</blockquote></pre>"
 }
 
+// ToHTMLCollapsed is ToHTML, but listing only the first show updates and a
+// count of the rest. A show less than 0 lists them all.
+func (e Entry) ToHTMLCollapsed(show int) string {
+	if show < 0 || len(e.Updates) <= show {
+		return e.ToHTML()
+	}
+	return "<pre><blockquote>" + strings.Replace(e.collapsedText(show), "\n", "<br>", -1) + "</blockquote></pre>"
+}
+
+// collapsedText is ToChangeLog, but listing only the first show updates and a
+// count of the rest. A show less than 0 lists them all.
+func (e Entry) collapsedText(show int) string {
+	if show < 0 || len(e.Updates) <= show {
+		return e.ToChangeLog()
+	}
+	sub := Entry{Date: e.Date, Comment: e.Comment, Updates: e.Updates[:show]}
+	return sub.ToChangeLog() + fmt.Sprintf("…and %d more\n", len(e.Updates)-show)
+}
+
 // ToChangeLog reformats the struct as the text for ChangeLog.txt output
 func (e Entry) ToChangeLog() string {
 	str := e.Date.Format(time.UnixDate) + "\n"
+	if e.RawDate != "" {
+		str = e.RawDate + "\n"
+	}
 	if strings.Trim(e.Comment, " \n") != "" {
 		str = str + e.Comment
 	}
@@ -4,8 +4,68 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
+func TestParseWithStats(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	e, stats, err := ParseWithStats(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != len(e) || stats.Entries != 52 {
+		t.Errorf("expected %d entries; got %d", 52, stats.Entries)
+	}
+	if stats.SecurityEntries != 34 {
+		t.Errorf("expected %d security entries; got %d", 34, stats.SecurityEntries)
+	}
+	if !stats.Newest.Equal(e[0].Date) || !stats.Oldest.Equal(e[len(e)-1].Date) {
+		t.Errorf("expected the range %s to %s; got %s to %s", e[len(e)-1].Date, e[0].Date, stats.Oldest, stats.Newest)
+	}
+	longest := time.Duration(0)
+	for i := 1; i < len(e); i++ {
+		if gap := e[i-1].Date.Sub(e[i].Date); gap > longest {
+			longest = gap
+		}
+	}
+	if longest == 0 || stats.LongestGap != longest {
+		t.Errorf("expected the longest gap %s; got %s", longest, stats.LongestGap)
+	}
+	if stats.Packages == 0 || stats.Packages > 597 {
+		t.Errorf("expected the distinct packages of the %d updates; got %d", 597, stats.Packages)
+	}
+	if stats.Unrecognized != 0 {
+		t.Errorf("expected every line to be recognized; got %d", stats.Unrecognized)
+	}
+
+	drifted := `Mon Jan 23 21:30:13 UTC 2017
+d/gdb-7.12.1-x86_64-1.txz:  Upgraded.
+  Some comment.
+not indented, breaking up the comment
+xap/fvwm-2.6.7-x86_64-3.txz:  Refreshed.
++--------------------------+
+stray text before the date
+Fri Jan 20 04:18:02 UTC 2017
+A note on the entry.
++--------------------------+
+`
+	_, stats, err = ParseWithStats(strings.NewReader(drifted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Unrecognized != 3 || stats.Lines != 10 {
+		t.Errorf("expected %d of %d lines unrecognized; got %d of %d", 3, 10, stats.Unrecognized, stats.Lines)
+	}
+	if p := stats.UnrecognizedPercent(); p != 30 {
+		t.Errorf("expected %g%%; got %g%%", 30.0, p)
+	}
+}
+
 func TestParse(t *testing.T) {
 	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
 	if err != nil {
@@ -35,6 +95,15 @@ func TestParse(t *testing.T) {
 	if secCount != expectedSec {
 		t.Errorf("expected %d security fix entries; got %d", expectedSec, secCount)
 	}
+	fixes := SecurityFixes(e)
+	if len(fixes) != expectedSec {
+		t.Errorf("expected %d entries of only security fixes; got %d", expectedSec, len(fixes))
+	}
+	for _, f := range fixes {
+		if !f.SecurityFix() {
+			t.Errorf("expected only entries with a security fix; got the one of %s", f.Date)
+		}
+	}
 
 	// Make sure we got as many individual updates as expected
 	expectedUp := 597
@@ -59,3 +128,57 @@ func TestParse(t *testing.T) {
 		t.Errorf("expected to find an Entry with comment %q", expectedComment)
 	}
 }
+
+func TestParseDate(t *testing.T) {
+	// date lines in the styles of the ChangeLogs of slackware-8.1 through
+	// -current, and of the arm and alphageek trees
+	for _, tc := range []struct {
+		line     string
+		expected time.Time
+	}{
+		{"Mon Jan 23 21:30:13 UTC 2017", time.Date(2017, time.January, 23, 21, 30, 13, 0, time.UTC)},
+		{"Tue Jun  4 13:56:47 PDT 2002", time.Date(2002, time.June, 4, 20, 56, 47, 0, time.UTC)},
+		{"Mon Mar 17 15:40:09 PST 2003", time.Date(2003, time.March, 17, 23, 40, 9, 0, time.UTC)},
+		{"Sun Jul  1 00:53:04 CDT 2007", time.Date(2007, time.July, 1, 5, 53, 4, 0, time.UTC)},
+		{"Wed Dec 31 18:12:30 CST 2008", time.Date(2009, time.January, 1, 0, 12, 30, 0, time.UTC)},
+		{"Sun Jun  5 08:41:12 BST 2016", time.Date(2016, time.June, 5, 7, 41, 12, 0, time.UTC)},
+		{"Wed Jan 18 09:05:41 GMT 2017", time.Date(2017, time.January, 18, 9, 5, 41, 0, time.UTC)},
+		{"Thu Feb  2 20:25:57 +0100 2017", time.Date(2017, time.February, 2, 19, 25, 57, 0, time.UTC)},
+		{"Fri Oct 20 07:15 UTC 2006", time.Date(2006, time.October, 20, 7, 15, 0, 0, time.UTC)},
+		{"Tue Feb  7  03:18:41  UTC 2017 ", time.Date(2017, time.February, 7, 3, 18, 41, 0, time.UTC)},
+		{"Sat Sep 24 12:00:00 UCT 2011", time.Date(2011, time.September, 24, 12, 0, 0, 0, time.UTC)},
+		{"Mon Aug  1 10:11:12 2005", time.Date(2005, time.August, 1, 10, 11, 12, 0, time.UTC)},
+	} {
+		got, ok := parseDate(tc.line)
+		if !ok || !got.Equal(tc.expected) || got.Location() != time.UTC {
+			t.Errorf("%q: expected %s; got %s (%t)", tc.line, tc.expected, got, ok)
+		}
+	}
+	for _, line := range []string{"Mon Jan 32 21:30:13 UTC 2017", "Mon Jan 23 25:30:13 UTC 2017", "Mon Jan 23 UTC 2017"} {
+		if got, ok := parseDate(line); ok {
+			t.Errorf("%q: expected it not to be parsed; got %s", line, got)
+		}
+	}
+}
+
+func TestParseUnparsedDate(t *testing.T) {
+	text := "Mon Jan 23 21:30:13 UTC 2017\na/foo-1.0-x86_64-1.txz:  Upgraded.\n+--------------------------+\n" +
+		"Mon Jan 32 21:30:13 UTC 2017\na/bar-1.0-x86_64-1.txz:  Upgraded.\n+--------------------------+\n" +
+		"Fri Jan 20 08:00:00 UTC 2017\na/baz-1.0-x86_64-1.txz:  Upgraded.\n+--------------------------+\n"
+	e, stats, err := ParseWithStats(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e) != 3 || stats.Unrecognized != 1 {
+		t.Fatalf("expected every entry, and the date line unrecognized; got %d, %d", len(e), stats.Unrecognized)
+	}
+	if !e[1].Date.Equal(e[0].Date.Add(-time.Second)) || e[1].RawDate != "Mon Jan 32 21:30:13 UTC 2017" {
+		t.Errorf("expected the date of the entry before, less a second, and the raw date; got %s, %q", e[1].Date, e[1].RawDate)
+	}
+	if !strings.HasPrefix(e[1].ToChangeLog(), "Mon Jan 32 21:30:13 UTC 2017\n") {
+		t.Errorf("expected the raw date in the ChangeLog of the entry; got %q", e[1].ToChangeLog())
+	}
+	if e[2].RawDate != "" {
+		t.Errorf("expected no raw date for a parsed date; got %q", e[2].RawDate)
+	}
+}
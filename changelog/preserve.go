@@ -0,0 +1,93 @@
+package changelog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// PreserveItems appends to the feed the items of prev (the RSS of the feed as
+// it was written before) that it no longer has, by their GUID, keeping it to
+// max items when max is more than 0. The feed then loses its oldest items
+// gradually, rather than as soon as their entries are dropped (like by a
+// MaxAge, or the ChangeLog being started anew). The categories of the
+// preserved items are added to cats, and the count of them is returned.
+// The feed is unchanged when prev can not be read.
+func PreserveItems(feed *feeds.Feed, cats Categories, prev []byte, max int) (int, error) {
+	var doc struct {
+		XMLName xml.Name
+		Items   []struct {
+			Title       string   `xml:"title"`
+			Link        string   `xml:"link"`
+			Description string   `xml:"description"`
+			Guid        string   `xml:"guid"`
+			PubDate     string   `xml:"pubDate"`
+			Categories  []string `xml:"category"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(prev, &doc); err != nil {
+		return 0, err
+	}
+	if doc.XMLName.Local != "rss" {
+		return 0, fmt.Errorf("not RSS, but %q", doc.XMLName.Local)
+	}
+
+	have := map[string]bool{}
+	for _, item := range feed.Items {
+		have[item.Id] = true
+	}
+	preserved := []*feeds.Item{}
+	preservedCats := Categories{}
+	for _, i := range doc.Items {
+		if i.Guid == "" || have[i.Guid] {
+			continue
+		}
+		have[i.Guid] = true
+		created, err := parsePubDate(i.PubDate)
+		if err != nil {
+			return 0, fmt.Errorf("item %q: %v", i.Guid, err)
+		}
+		item := &feeds.Item{
+			Title:       i.Title,
+			Link:        &feeds.Link{Href: i.Link},
+			Description: unmultiline(i.Description),
+			Id:          i.Guid,
+			Created:     created,
+		}
+		preserved = append(preserved, item)
+		if len(i.Categories) > 0 {
+			preservedCats[item] = i.Categories
+		}
+	}
+
+	if max > 0 {
+		room := max - len(feed.Items)
+		if room < 0 {
+			room = 0
+		}
+		if len(preserved) > room {
+			preserved = preserved[:room]
+		}
+	}
+	for _, item := range preserved {
+		feed.Items = append(feed.Items, item)
+		if c, ok := preservedCats[item]; ok {
+			cats[item] = c
+		}
+	}
+	return len(preserved), nil
+}
+
+// parsePubDate is the time of the pubDate of an RSS item
+func parsePubDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid pubDate %q", s)
+}
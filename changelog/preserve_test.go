@@ -0,0 +1,78 @@
+package changelog
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPreserveItems(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "http://slackware.osuosl.org/slackware64-current"
+	for _, format := range []string{ItemFormatPre, ItemFormatList} {
+		opts := FeedOptions{Title: "slackware64-current", ItemFormat: format}
+		f, cats, err := ToFeedCategories(link, e[:5], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		render := RenderRssOptions(RenderOptions{Categories: cats, Indent: true})
+		prev, err := render(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the ChangeLog has lost its oldest entries
+		f, cats, err = ToFeedCategories(link, e[:2], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := PreserveItems(f, cats, prev, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 || len(f.Items) != 5 {
+			t.Errorf("%s: expected 3 items preserved, of 5; got %d, of %d", format, n, len(f.Items))
+		}
+		render = RenderRssOptions(RenderOptions{Categories: cats, Indent: true})
+		data, err := render(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(prev) {
+			t.Errorf("%s: expected the feed as it was; got:\n%s", format, data)
+		}
+
+		// up to the max, and nothing of the items the feed still has
+		f, cats, err = ToFeedCategories(link, e[:2], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := PreserveItems(f, cats, prev, 3); err != nil || n != 1 || len(f.Items) != 3 {
+			t.Errorf("%s: expected 1 item preserved, of the max of 3; got %d, of %d (%v)", format, n, len(f.Items), err)
+		}
+	}
+}
+
+func TestPreserveItemsInvalid(t *testing.T) {
+	for _, prev := range []string{
+		"<rss><channel><item>",
+		`<feed xmlns="http://www.w3.org/2005/Atom"></feed>`,
+		"<rss><channel><item><guid>a</guid><pubDate>yesterday</pubDate></item></channel></rss>",
+	} {
+		f, cats, err := ToFeedCategories("http://slackware.osuosl.org/slackware64-current", nil, FeedOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := PreserveItems(f, cats, []byte(prev), 0); err == nil || n != 0 || len(f.Items) != 0 {
+			t.Errorf("%q: expected an error, and the feed unchanged; got %d, %d items (%v)", prev, n, len(f.Items), err)
+		}
+	}
+}
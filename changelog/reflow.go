@@ -0,0 +1,99 @@
+package changelog
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// listItemReg is a line starting an item of a list, which is never joined to
+// the line before it
+var listItemReg = regexp.MustCompile(`^([-*]|\d+[.)])\s`)
+
+// Reflow joins the lines of text that were hard-wrapped within a paragraph,
+// so that it reads well in a proportional font. The hanging indent of an item
+// (like "* CVE-...:" followed by its deeper indented lines) is joined too.
+// Blank lines (the breaks between paragraphs), the dates and package lines of
+// a ChangeLog, and other blocks indented deeper than the line before them
+// (like the links after "For more information, see:") are kept as they are.
+func Reflow(text string) string {
+	lines := strings.Split(text, "\n")
+	out := []string{}
+	// base is the indent of the paragraph, and cont the indent of the lines
+	// continuing it (deeper, for a hanging indent)
+	base, cont, canJoin := -1, -1, false
+	for i, line := range lines {
+		indent := indentOf(line)
+		switch {
+		case fixedLine(line):
+			out = append(out, line)
+			base, cont, canJoin = -1, -1, false
+		case canJoin && indent == cont && !startsItem(lines, i):
+			out[len(out)-1] = join(out[len(out)-1], line)
+		case canJoin && cont == base && indent > base && continues(out[len(out)-1], line):
+			out[len(out)-1] = join(out[len(out)-1], line)
+			cont = indent
+		case base >= 0 && indent > base:
+			// an indented block, kept as is
+			out = append(out, line)
+			canJoin = false
+		default:
+			out = append(out, line)
+			base, cont, canJoin = indent, indent, true
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func join(prev, line string) string {
+	return strings.TrimRight(prev, " ") + " " + strings.TrimSpace(line)
+}
+
+// fixedLine is never joined with another: a blank line, or a divider, date or
+// package line of a ChangeLog, or a note like "(* Security fix *)"
+func fixedLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || line == dividerStr || dayReg.MatchString(line) || updateReg.MatchString(line) || strings.HasPrefix(trimmed, "(*")
+}
+
+// continues is whether line, indented deeper than prev, is the wrapped rest of
+// it, rather than the start of an indented block (like a list of links)
+func continues(prev, line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasSuffix(strings.TrimSpace(prev), ":") {
+		return false
+	}
+	return !(strings.Contains(trimmed, "://") && !strings.Contains(trimmed, " "))
+}
+
+// startsItem is whether lines[i] starts an item of a list, either with a
+// bullet or by being followed by its hanging indent
+func startsItem(lines []string, i int) bool {
+	if listItemReg.MatchString(strings.TrimSpace(lines[i])) {
+		return true
+	}
+	if i+1 >= len(lines) {
+		return false
+	}
+	next := lines[i+1]
+	return indentOf(next) > indentOf(lines[i]) && !fixedLine(next) && continues(lines[i], next)
+}
+
+// reflowedHTML is the text reflowed for HTML output. Without <pre> the lines
+// wrap to the reader, so the indenting is kept with non-breaking spaces.
+func reflowedHTML(text string, escape bool) string {
+	lines := strings.Split(Reflow(text), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := strings.Repeat("&nbsp;", len(line)-len(trimmed))
+		if escape {
+			trimmed = html.EscapeString(trimmed)
+		}
+		lines[i] = indent + trimmed
+	}
+	return "<blockquote>" + strings.Join(lines, "<br>") + "</blockquote>"
+}
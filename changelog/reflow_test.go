@@ -0,0 +1,51 @@
+package changelog
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReflow(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	entries, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var advisory Entry
+	for _, e := range entries {
+		if e.Date.Equal(time.Date(2016, time.December, 24, 2, 36, 5, 0, time.UTC)) {
+			advisory = e
+		}
+	}
+	if len(advisory.Updates) == 0 {
+		t.Fatal("expected the entry of the httpd and openssh advisories")
+	}
+	raw := advisory.ToChangeLog()
+	checkGolden(t, "reflow-advisory.txt", Reflow(raw))
+	if advisory.ToChangeLog() != raw {
+		t.Error("expected the Entry to be untouched")
+	}
+
+	f, err := ToFeedWithOptions("http://slackware.osuosl.org/slackware64-current", []Entry{advisory}, FeedOptions{Reflow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := f.Items[0].Description
+	if strings.Contains(desc, "<pre>") || !strings.Contains(desc, "&nbsp;&nbsp;&nbsp;&nbsp;https://www.openssh.com/txt/release-7.4<br>") {
+		t.Errorf("expected reflowed HTML with the indented links kept; got %q", desc)
+	}
+}
+
+func TestReflowParagraphs(t *testing.T) {
+	in := "First line of a\nparagraph that wraps.\n\nSecond paragraph:\n- one item that\nwraps\n- two\n\nAn indented block:\n  kept\n  as is\n"
+	expected := "First line of a paragraph that wraps.\n\nSecond paragraph:\n- one item that wraps\n- two\n\nAn indented block:\n  kept\n  as is\n"
+	if got := Reflow(in); got != expected {
+		t.Errorf("expected %q; got %q", expected, got)
+	}
+}
@@ -0,0 +1,271 @@
+package changelog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineBytes is the longest line of a ChangeLog that is read, a longer one
+// being an error rather than cut short
+const maxLineBytes = 4 << 20
+
+// Scanner reads the Entries of a ChangeLog one at a time, as they are read
+// from it, so that the whole of a large ChangeLog is never in memory and the
+// reading can be stopped early (like once the entries are older than needed):
+//
+//	s := changelog.NewScanner(r)
+//	for s.Scan() {
+//		e := s.Entry()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+type Scanner struct {
+	lines *bufio.Scanner
+	err   error
+	done  bool
+
+	entry  Entry
+	cur    Entry
+	update *Update
+	// prev is the Date of the last Entry with one
+	prev time.Time
+
+	stats    ParseStats
+	dates    []time.Time
+	packages map[string]bool
+}
+
+// NewScanner is a Scanner of the ChangeLog read from r
+func NewScanner(r io.Reader) *Scanner {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64<<10), maxLineBytes)
+	lines.Split(scanLines)
+	return &Scanner{lines: lines, packages: map[string]bool{}}
+}
+
+// scanLines is bufio.ScanLines, but keeping the end of each line
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Scan reads the next Entry, which is then the Entry. It is false once there
+// are no more, or on an error (see Err).
+func (s *Scanner) Scan() bool {
+	if s.done {
+		return false
+	}
+	for s.lines.Scan() {
+		if s.line(s.lines.Text()) {
+			return true
+		}
+	}
+	if err := s.lines.Err(); err == bufio.ErrTooLong {
+		s.err = fmt.Errorf("a line of the ChangeLog is longer than %d bytes", maxLineBytes)
+	} else {
+		s.err = err
+	}
+	s.done = true
+	return false
+}
+
+// Entry is the Entry last read by Scan
+func (s *Scanner) Entry() Entry {
+	return s.entry
+}
+
+// Err is the error that stopped Scan, if any
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Stats are the ParseStats of the ChangeLog as far as it has been read
+func (s *Scanner) Stats() ParseStats {
+	stats := s.stats
+	stats.Packages = len(s.packages)
+	dates := append([]time.Time{}, s.dates...)
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	for i := 1; i < len(dates); i++ {
+		if gap := dates[i].Sub(dates[i-1]); gap > stats.LongestGap {
+			stats.LongestGap = gap
+		}
+	}
+	return stats
+}
+
+// zoneOffsets are the offsets (in hours east of UTC) of the time zones found in
+// the date lines of ChangeLogs, like those of Slackware before it went to UTC,
+// and of the arm tree. Any other, like a typo of UTC, is taken as UTC.
+var zoneOffsets = map[string]int{
+	"PST": -8, "PDT": -7,
+	"MST": -7, "MDT": -6,
+	"CST": -6, "CDT": -5,
+	"EST": -5, "EDT": -4,
+	"BST": 1,
+	"CET": 1, "CEST": 2,
+}
+
+// dateLayouts are the layouts of the date line of an Entry, without its time
+// zone and with single spaces, in the order they are tried
+var dateLayouts = []string{
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04 2006",
+}
+
+// parseDate is the time (in UTC) of the date line of an Entry, like "Mon Jan 23
+// 21:30:13 UTC 2017", with or without its seconds and time zone, and however
+// it is spaced
+func parseDate(line string) (time.Time, bool) {
+	fields := strings.Fields(line)
+	zone := time.UTC
+	if len(fields) == 6 {
+		if offset, err := time.Parse("-0700", fields[4]); err == nil {
+			zone = offset.Location()
+		} else if hours, ok := zoneOffsets[strings.ToUpper(fields[4])]; ok {
+			zone = time.FixedZone(fields[4], hours*60*60)
+		}
+		fields = append(fields[:4], fields[5])
+	}
+	text := strings.Join(fields, " ")
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, text, zone); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cleanLine is the line as valid UTF-8, and without the control characters
+// that are not allowed in XML 1.0, for the feeds to be too. A line that is not
+// UTF-8 is taken as ISO-8859-1 (like the names and © signs of some older
+// entries), unless some of it is, when its invalid bytes are replaced.
+func cleanLine(line string) string {
+	if !utf8.ValidString(line) {
+		if latin1(line) {
+			runes := make([]rune, len(line))
+			for i := 0; i < len(line); i++ {
+				runes[i] = rune(line[i])
+			}
+			line = string(runes)
+		} else {
+			line = strings.ToValidUTF8(line, "\uFFFD")
+		}
+	}
+	if strings.IndexFunc(line, illegalXML) >= 0 {
+		line = strings.Map(func(r rune) rune {
+			if illegalXML(r) {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	return line
+}
+
+// latin1 is whether the text has nothing of UTF-8 but ASCII
+func latin1(text string) bool {
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != utf8.RuneError && size > 1 {
+			return false
+		}
+		i += size
+	}
+	return true
+}
+
+// illegalXML is whether r is a character not allowed in XML 1.0
+func illegalXML(r rune) bool {
+	return (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0xFFFE || r == 0xFFFF
+}
+
+// line takes the next line of the ChangeLog, and is whether it ended an Entry
+func (s *Scanner) line(line string) bool {
+	line = cleanLine(line)
+	trimmedline := strings.TrimSuffix(line, "\n")
+	if strings.TrimSpace(trimmedline) != "" {
+		s.stats.Lines++
+	}
+
+	if trimmedline == dividerStr {
+		if s.update != nil {
+			s.cur.Updates = append(s.cur.Updates, *s.update)
+			s.update = nil
+		}
+		s.entry, s.cur = s.cur, Entry{}
+		if !s.entry.Date.IsZero() {
+			s.prev = s.entry.Date
+		}
+		s.count(s.entry)
+		return true
+	} else if dayReg.MatchString(trimmedline) {
+		// this date means it is the beginning of an entry
+		t, ok := parseDate(trimmedline)
+		if !ok {
+			// rather than failing the whole of the ChangeLog
+			s.stats.Unrecognized++
+			s.cur.RawDate = strings.TrimSpace(trimmedline)
+			if !s.prev.IsZero() {
+				t = s.prev.Add(-time.Second)
+			}
+		}
+		s.cur.Date = t
+	} else if updateReg.MatchString(trimmedline) {
+		// match on whether this is an update line
+		if s.update != nil {
+			s.cur.Updates = append(s.cur.Updates, *s.update)
+			s.update = nil
+		}
+		m := updateReg.FindStringSubmatch(trimmedline)
+		s.update = &Update{
+			Name:   m[1],
+			Action: m[2],
+		}
+	} else if s.update != nil && strings.HasPrefix(trimmedline, "  ") {
+		s.update.Comment = s.update.Comment + line
+	} else {
+		// Everything else is a comment on the Entry
+		if strings.TrimSpace(trimmedline) != "" && (s.cur.Date.IsZero() || s.update != nil || looksLikeUpdateReg.MatchString(trimmedline)) {
+			s.stats.Unrecognized++
+		}
+		s.cur.Comment = s.cur.Comment + line
+	}
+	return false
+}
+
+// count adds the Entry to the Stats
+func (s *Scanner) count(e Entry) {
+	s.stats.Entries++
+	if !e.Date.IsZero() {
+		s.dates = append(s.dates, e.Date)
+	}
+	if !e.Date.IsZero() && (s.stats.Oldest.IsZero() || e.Date.Before(s.stats.Oldest)) {
+		s.stats.Oldest = e.Date
+	}
+	if e.Date.After(s.stats.Newest) {
+		s.stats.Newest = e.Date
+	}
+	if e.SecurityFix() {
+		s.stats.SecurityEntries++
+	}
+	for _, u := range e.Updates {
+		p := u.Package()
+		s.packages[p.Series+"/"+p.Name] = true
+	}
+}
@@ -0,0 +1,145 @@
+package changelog
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestScanner(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, stats, err := ParseWithStats(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stopping after the newest 3 entries
+	s := NewScanner(bytes.NewReader(data))
+	got := []Entry{}
+	for len(got) < 3 && s.Scan() {
+		got = append(got, s.Entry())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, e[:3]) {
+		t.Errorf("expected the newest 3 entries of Parse; got %#v", got)
+	}
+	if s.Stats().Entries != 3 || !s.Stats().Newest.Equal(stats.Newest) {
+		t.Errorf("expected the stats of the entries read so far; got %#v", s.Stats())
+	}
+	for s.Scan() {
+	}
+	if s.Err() != nil || !reflect.DeepEqual(s.Stats(), stats) {
+		t.Errorf("expected the stats of the whole ChangeLog; got %#v (%v)", s.Stats(), s.Err())
+	}
+	if s.Scan() {
+		t.Error("expected no more entries")
+	}
+}
+
+func TestScannerLongLines(t *testing.T) {
+	// longer than the default limit of a bufio.Scanner
+	url := "https://example.com/" + strings.Repeat("a", 100<<10)
+	text := "Mon Jan 23 21:30:13 UTC 2017\na/foo-1.0-x86_64-1.txz:  Upgraded.\n  See " + url + "\n" + dividerStr + "\n"
+	e, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e) != 1 || len(e[0].Updates) != 1 || !strings.Contains(e[0].Updates[0].Comment, url+"\n") {
+		t.Errorf("expected the whole of the long line; got %#v", e)
+	}
+
+	long := "Mon Jan 23 21:30:13 UTC 2017\n" + strings.Repeat("a", maxLineBytes+1) + "\n" + dividerStr + "\n"
+	if _, err := Parse(strings.NewReader(long)); err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Errorf("expected an error for a line longer than %d bytes; got %v", maxLineBytes, err)
+	}
+}
+
+// largeChangeLog is the ChangeLog of testdata repeated, to several MB like
+// that of -current
+func largeChangeLog(b *testing.B) []byte {
+	data, err := ioutil.ReadFile("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return bytes.Repeat(append(data, "\n"+dividerStr+"\n"...), 100)
+}
+
+func BenchmarkParse(b *testing.B) {
+	data := largeChangeLog(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	data := largeChangeLog(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := NewScanner(bytes.NewReader(data))
+		for s.Scan() {
+		}
+		if err := s.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCleanLine(t *testing.T) {
+	for line, expected := range map[string]string{
+		"plain ASCII\n":                               "plain ASCII\n",
+		"Copyright \xa9 Fr\xe9d\xe9ric\n":             "Copyright © Frédéric\n",
+		"already UTF-8: © Frédéric":                   "already UTF-8: © Frédéric",
+		"mostly UTF-8: é and \xe9":                    "mostly UTF-8: é and �",
+		"a NUL\x00, a \x1b[1mbell\x07\tand a tab\r\n": "a NUL, a [1mbell\tand a tab\r\n",
+	} {
+		if got := cleanLine(line); got != expected {
+			t.Errorf("%q: expected %q; got %q", line, expected, got)
+		}
+	}
+}
+
+func TestFeedNotUTF8(t *testing.T) {
+	text := "Mon Jan 23 21:30:13 UTC 2017\n" +
+		"a/foo-1.0-x86_64-1.txz:  Upgraded.\n  Thanks to Fr\xe9d\xe9ric, \xa9 2017.\x00\n" +
+		"+--------------------------+\n"
+	e, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ToFeed("http://slackware.osuosl.org/slackware64-current", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, format := range Formats {
+		data, err := format.Renderer(RenderOptions{})(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.Valid(data) || !strings.Contains(string(data), "Frédéric, © 2017.") || bytes.IndexByte(data, 0) >= 0 {
+			t.Errorf("%s: expected valid UTF-8, without the NUL; got:\n%s", name, data)
+		}
+		if name == FormatJSONFeed {
+			continue
+		}
+		var doc struct{}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			t.Errorf("%s: expected valid XML; got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package changelog
+
+import (
+	"strings"
+	"unicode"
+)
+
+// summaryMax is the most runes of a Summary, before its ellipsis
+const summaryMax = 80
+
+// Summary is the first sentence of the Entry's narrative, like the "Hey
+// folks, ..." of an announcement, as one line of at most about 80 characters.
+// It is "" when the Entry is only updates. The narrative is the first
+// paragraph of the Entry comment, without lines that look like updates or are
+// just a URL.
+func (e Entry) Summary() string {
+	para := []string{}
+	for _, line := range strings.Split(e.Comment, "\n") {
+		line = strings.TrimSpace(line)
+		if !narrative(line) {
+			if len(para) > 0 {
+				break
+			}
+			continue
+		}
+		para = append(para, line)
+	}
+	return truncateSummary(firstSentence(strings.Join(para, " ")), summaryMax)
+}
+
+// narrative is whether the line of a comment is of its prose
+func narrative(line string) bool {
+	if line == "" || looksLikeUpdateReg.MatchString(line) || strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+		return false
+	}
+	return strings.IndexFunc(line, unicode.IsLetter) >= 0
+}
+
+// firstSentence is text up to the end of its first sentence (a ".", "!" or
+// "?" followed by a space), or all of it
+func firstSentence(text string) string {
+	for i := 0; i+1 < len(text); i++ {
+		switch text[i] {
+		case '.', '!', '?':
+			if text[i+1] == ' ' {
+				return text[:i+1]
+			}
+		}
+	}
+	return text
+}
+
+// truncateSummary cuts text to at most max runes, at the end of a word, with
+// an ellipsis for what was cut
+func truncateSummary(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:-") + "…"
+}
@@ -0,0 +1,67 @@
+package changelog
+
+import (
+	"os"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSummary(t *testing.T) {
+	fh, err := os.Open("testdata/narrative/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	entries, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		summary, title string
+	}{
+		{
+			"Hey folks, big toolchain update today with a new glibc and gcc.",
+			"3 updates — Hey folks, big toolchain update today with a new glibc and gcc.",
+		},
+		// the note of the kernel upgrade is of an update, not of the entry
+		{"", "7 updates (kernel 6.6.9)"},
+		{
+			"We've switched to the 6.6 LTS kernel series, which should be supported until at…",
+			"2 updates (kernel 6.6.8) — We've switched to the 6.6 LTS kernel series, which should be supported until at…",
+		},
+		{"", "1 update. Including a (* Security fix *)!"},
+		// the 15.0 release announcement, with no updates
+		{"Slackware 15.0 x86_64 is released!", "Slackware 15.0 x86_64 is released!"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries; got %d", len(expected), len(entries))
+	}
+	f, err := ToFeed("http://slackware.osuosl.org/slackware64-current", entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if s := e.Summary(); s != expected[i].summary {
+			t.Errorf("%s: expected the summary %q; got %q", e.Date, expected[i].summary, s)
+		}
+		if n := utf8.RuneCountInString(e.Summary()); n > summaryMax+1 {
+			t.Errorf("%s: expected at most %d characters; got %d", e.Date, summaryMax+1, n)
+		}
+		if title := f.Items[i].Title; title != expected[i].title {
+			t.Errorf("%s: expected the title %q; got %q", e.Date, expected[i].title, title)
+		}
+	}
+}
+
+func TestFirstSentence(t *testing.T) {
+	for text, expected := range map[string]string{
+		"Slackware 15.0 is released! Enjoy.": "Slackware 15.0 is released!",
+		"Is it done? Yes.":                   "Is it done?",
+		"No end to it":                       "No end to it",
+		"Ends at the end.":                   "Ends at the end.",
+	} {
+		if s := firstSentence(text); s != expected {
+			t.Errorf("%q: expected %q; got %q", text, expected, s)
+		}
+	}
+}
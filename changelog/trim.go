@@ -0,0 +1,94 @@
+package changelog
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// RenderFunc serializes a feed, like to RSS or Atom
+type RenderFunc func(f *feeds.Feed) ([]byte, error)
+
+// RenderRss is a RenderFunc for RSS 2.0, with the guids of the items marked as
+// not being links
+func RenderRss(f *feeds.Feed) ([]byte, error) {
+	return RenderRssOptions(RenderOptions{})(f)
+}
+
+// LimitEntries are the newest of the entries (newest first, whatever their
+// order in the ChangeLog), at most maxItems of them and none older than maxAge
+// before now, whichever leaves fewer. A maxItems or maxAge of 0 or less is no
+// limit. The entries given are left in their order.
+func LimitEntries(entries []Entry, maxItems int, maxAge time.Duration, now time.Time) []Entry {
+	if maxItems <= 0 && maxAge <= 0 {
+		return entries
+	}
+	limited := make([]Entry, len(entries))
+	copy(limited, entries)
+	SortEntries(limited, SortDesc)
+	if maxAge > 0 {
+		cutoff := now.Add(-maxAge)
+		n := sort.Search(len(limited), func(i int) bool { return !limited[i].Date.After(cutoff) })
+		limited = limited[:n]
+	}
+	if maxItems > 0 && len(limited) > maxItems {
+		limited = limited[:maxItems]
+	}
+	return limited
+}
+
+// RenderMaxBytes renders the feed, dropping its oldest items until the output
+// fits within maxBytes, but never dropping below one item. trimmed is how many
+// items were dropped. A maxBytes of 0 or less is no limit.
+func RenderMaxBytes(f *feeds.Feed, maxBytes int, render RenderFunc) (data []byte, trimmed int, err error) {
+	data, err = render(f)
+	if err != nil || maxBytes <= 0 || len(data) <= maxBytes || len(f.Items) <= 1 {
+		return data, 0, err
+	}
+
+	// newest first, keeping the feed's order for ties
+	byAge := make([]int, len(f.Items))
+	for i := range byAge {
+		byAge[i] = i
+	}
+	sort.SliceStable(byAge, func(i, j int) bool {
+		return f.Items[byAge[i]].Created.After(f.Items[byAge[j]].Created)
+	})
+	keep := func(n int) *feeds.Feed {
+		kept := map[int]bool{}
+		for _, i := range byAge[:n] {
+			kept[i] = true
+		}
+		trim := *f
+		trim.Items = []*feeds.Item{}
+		for i, item := range f.Items {
+			if kept[i] {
+				trim.Items = append(trim.Items, item)
+			}
+		}
+		return &trim
+	}
+
+	// find the most items that fit, but always at least one
+	lo, hi := 1, len(f.Items)-1
+	best := keep(1)
+	bestData, err := render(best)
+	if err != nil {
+		return nil, 0, err
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		trial := keep(mid)
+		trialData, err := render(trial)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(trialData) <= maxBytes {
+			lo, best, bestData = mid, trial, trialData
+		} else {
+			hi = mid - 1
+		}
+	}
+	return bestData, len(f.Items) - len(best.Items), nil
+}
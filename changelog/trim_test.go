@@ -0,0 +1,118 @@
+package changelog
+
+import (
+	"html"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMaxBytes(t *testing.T) {
+	fh, err := os.Open("testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	e, err := Parse(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ToFeed("http://slackware.osuosl.org/slackware64-current", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := RenderRss(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no limit, or a limit that fits
+	for _, max := range []int{0, len(full)} {
+		data, trimmed, err := RenderMaxBytes(f, max, RenderRss)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trimmed != 0 || len(data) != len(full) {
+			t.Errorf("max %d: expected nothing trimmed; got %d trimmed", max, trimmed)
+		}
+	}
+
+	max := len(full) / 2
+	data, trimmed, err := RenderMaxBytes(f, max, RenderRss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > max {
+		t.Errorf("expected at most %d bytes; got %d", max, len(data))
+	}
+	if trimmed == 0 || trimmed >= len(f.Items) {
+		t.Errorf("expected some items trimmed; got %d of %d", trimmed, len(f.Items))
+	}
+	if len(f.Items) != len(e) {
+		t.Errorf("expected the feed to be left with %d items; got %d", len(e), len(f.Items))
+	}
+	// the newest are kept
+	if !strings.Contains(string(data), html.EscapeString(f.Items[0].Id)) {
+		t.Error("expected the newest item to be kept")
+	}
+	if strings.Contains(string(data), html.EscapeString(f.Items[len(f.Items)-1].Id)) {
+		t.Error("expected the oldest item to be dropped")
+	}
+
+	// never below one item
+	data, trimmed, err = RenderMaxBytes(f, 10, RenderRss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trimmed != len(f.Items)-1 {
+		t.Errorf("expected %d trimmed; got %d", len(f.Items)-1, trimmed)
+	}
+	if !strings.Contains(string(data), html.EscapeString(f.Items[0].Id)) {
+		t.Error("expected the newest item to be kept")
+	}
+}
+
+func TestLimitEntries(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// oldest first, as an unordered ChangeLog may be
+	entries := []Entry{
+		{Date: now.Add(-10 * day), Comment: "10"},
+		{Date: now.Add(-1 * day), Comment: "1"},
+		{Date: now.Add(-5 * day), Comment: "5"},
+		{Date: now.Add(-3 * day), Comment: "3"},
+	}
+	comments := func(entries []Entry) string {
+		c := []string{}
+		for _, e := range entries {
+			c = append(c, e.Comment)
+		}
+		return strings.Join(c, ",")
+	}
+
+	for _, c := range []struct {
+		maxItems int
+		maxAge   time.Duration
+		expected string
+	}{
+		{0, 0, "10,1,5,3"},
+		{2, 0, "1,3"},
+		{4, 0, "1,3,5,10"},
+		{5, 0, "1,3,5,10"},
+		{0, 4 * day, "1,3"},
+		{0, 5 * day, "1,3"}, // exactly MaxAge old is not newer than it
+		{0, day / 2, ""},
+		{3, 4 * day, "1,3"},
+		{1, 4 * day, "1"},
+	} {
+		got := comments(LimitEntries(entries, c.maxItems, c.maxAge, now))
+		if got != c.expected {
+			t.Errorf("MaxItems %d, MaxAge %s: expected %q; got %q", c.maxItems, c.maxAge, c.expected, got)
+		}
+	}
+	if got := comments(entries); got != "10,1,5,3" {
+		t.Errorf("expected the entries given to keep their order; got %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/internal/cliutil"
+)
+
+var checkCommand = cli.Command{
+	Name:  "check",
+	Usage: "Check the --config for problems, printing one line for each, without writing any feeds",
+	Flags: []cli.Flag{
+		configFlag,
+		destFlag,
+		cli.BoolFlag{
+			Name:  "probe",
+			Usage: "also check that each release has a ChangeLog.txt on its mirror",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		c := cliutil.Flags{Context: ctx}
+		path := c.String("config")
+		if path == "" {
+			return cli.NewExitError("no --config to check", exitConfig)
+		}
+		config, warnings, err := feedsync.LoadConfig(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitConfig)
+		}
+		if dest := c.String("dest"); dest != "" {
+			config.Dest = dest
+		}
+		probs := append(warnings, config.Check()...)
+		for _, p := range probs {
+			fmt.Println(p)
+		}
+
+		var failed []string
+		if c.Bool("probe") {
+			tlsConfig, err := cliutil.TLSConfig(c.String("ca"), c.Bool("insecure"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), exitConfig)
+			}
+			r := feedsync.Syncer{
+				Config:    config,
+				Quiet:     true,
+				Logger:    log.New(ioutil.Discard, "", 0),
+				TLSConfig: tlsConfig,
+			}
+			if n, err := feedsync.LoadNetrc(); err == nil {
+				r.Netrc = n
+			}
+			failed = r.Probe()
+			for _, p := range failed {
+				fmt.Println(p)
+			}
+		}
+
+		switch {
+		case len(probs) > 0:
+			return cli.NewExitError(fmt.Sprintf("%d problems in %q", len(probs)+len(failed), path), exitConfig)
+		case len(failed) > 0:
+			return cli.NewExitError(fmt.Sprintf("%d releases not found on their mirror", len(failed)), exitFetch)
+		}
+		fmt.Printf("%s: no problems\n", path)
+		return nil
+	},
+}
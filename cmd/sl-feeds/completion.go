@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+const bashCompletion = `# bash completion for sl-feeds
+_sl_feeds() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	COMPREPLY=( $(compgen -W "$("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "$cur") )
+}
+complete -F _sl_feeds sl-feeds
+`
+
+const zshCompletion = `#compdef sl-feeds
+# zsh completion for sl-feeds
+_sl_feeds() {
+	local -a candidates
+	candidates=(${(f)"$("${words[1]}" __complete "${(@)words[2,$CURRENT]}" 2>/dev/null)"})
+	compadd -- $candidates
+}
+compdef _sl_feeds sl-feeds
+`
+
+var completionCommand = cli.Command{
+	Name:      "completion",
+	Usage:     "Output the shell completion script for bash or zsh",
+	ArgsUsage: "bash|zsh",
+	Action: func(c *cli.Context) error {
+		switch c.Args().First() {
+		case "bash":
+			fmt.Print(bashCompletion)
+		case "zsh":
+			fmt.Print(zshCompletion)
+		default:
+			return cli.NewExitError(fmt.Sprintf("unsupported shell %q, expected bash or zsh", c.Args().First()), 1)
+		}
+		return nil
+	},
+}
+
+// completeCommand is what the completion scripts call back into, with the
+// words of the command line so far (the last being the word to complete)
+var completeCommand = cli.Command{
+	Name:            "__complete",
+	Hidden:          true,
+	SkipFlagParsing: true,
+	Action: func(c *cli.Context) error {
+		for _, candidate := range completions(c.App, c.Args()) {
+			fmt.Println(candidate)
+		}
+		return nil
+	},
+}
+
+// completions are the candidates for the last of words
+func completions(app *cli.App, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := ""
+	if len(words) > 1 {
+		prev = words[len(words)-2]
+	}
+
+	candidates := []string{}
+	switch {
+	case prev == "--only":
+		if config, _, err := feedsync.LoadConfig(completionConfigPath(words)); err == nil {
+			candidates = append(candidates, config.ReleaseNames()...)
+		}
+	case prev == "--mirror":
+		if config, _, err := feedsync.LoadConfig(completionConfigPath(words)); err == nil {
+			candidates = append(candidates, config.MirrorNames()...)
+		}
+	case takesValue(app, prev):
+		// like a file name, which the shell is better at
+	case strings.HasPrefix(cur, "-"):
+		for _, f := range app.Flags {
+			for _, name := range strings.Split(f.GetName(), ",") {
+				if name = strings.TrimSpace(name); len(name) > 1 {
+					candidates = append(candidates, "--"+name)
+				}
+			}
+		}
+	default:
+		for _, cmd := range app.Commands {
+			if !cmd.Hidden {
+				candidates = append(candidates, cmd.Name)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	matches := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, cur) && !seen[candidate] {
+			seen[candidate] = true
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// takesValue is whether word is a flag of app that is followed by a value
+func takesValue(app *cli.App, word string) bool {
+	if !strings.HasPrefix(word, "-") {
+		return false
+	}
+	word = strings.TrimLeft(word, "-")
+	for _, f := range app.Flags {
+		if _, ok := f.(cli.BoolFlag); ok {
+			continue
+		}
+		for _, name := range strings.Split(f.GetName(), ",") {
+			if strings.TrimSpace(name) == word {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// completionConfigPath is the --config from words, or else ~/.sl-feeds.toml
+func completionConfigPath(words []string) string {
+	for i, w := range words {
+		if (w == "-c" || w == "--config" || w == "-config") && i+1 < len(words)-1 {
+			return words[i+1]
+		}
+		if strings.HasPrefix(w, "--config=") {
+			return strings.TrimPrefix(w, "--config=")
+		}
+	}
+	return filepath.Join(os.Getenv("HOME"), ".sl-feeds.toml")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestCompletions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-complete.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	confPath := filepath.Join(dir, "conf.toml")
+	conf := `
+[[Mirrors]]
+URL = "http://slackware.osuosl.org/"
+Releases = ["slackware64-14.2", "slackware64-current", "slackwarearm-current"]
+
+[[Mirrors]]
+URL = "http://alphageek.noip.me/mirrors/alphageek/"
+Name = "alphageek"
+Releases = ["slackware64-14.2"]
+`
+	if err := ioutil.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "config, c"},
+		cli.BoolFlag{Name: "quiet, q"},
+		cli.StringSliceFlag{Name: "only"},
+		cli.StringSliceFlag{Name: "mirror"},
+	}
+	app.Commands = []cli.Command{completionCommand, completeCommand}
+
+	cases := []struct {
+		words    []string
+		expected []string
+	}{
+		{[]string{"-c", confPath, "--only", "slack"}, []string{"slackware64-14.2", "slackware64-current", "slackwarearm-current"}},
+		{[]string{"-c", confPath, "--only", "slackware64-c"}, []string{"slackware64-current"}},
+		{[]string{"--config=" + confPath, "--mirror", ""}, []string{"alphageek", "slackware.osuosl.org"}},
+		{[]string{"--q"}, []string{"--quiet"}},
+		{[]string{"-c", ""}, []string{}},
+		{[]string{"comp"}, []string{"completion"}},
+		{[]string{""}, []string{"completion"}},
+	}
+	for _, c := range cases {
+		got := completions(app, c.words)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%q: expected %q; got %q", c.words, c.expected, got)
+		}
+	}
+}
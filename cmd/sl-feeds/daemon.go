@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// refreshPrefix is the path of the API to refresh a feed, followed by its name
+const refreshPrefix = "/api/v1/refresh/"
+
+// reportPath is the path of the API for the Report of the last run, or (when
+// followed by a feed name) for the latest outcome of that feed
+const reportPath = "/api/v1/report"
+
+// metricsPath is the path of the prometheus metrics of the last run
+const metricsPath = "/metrics"
+
+// daemon runs each feed on its Schedule (or Every, or else every interval),
+// and on demand for single feeds from its HTTP API. Only one run is ever in
+// progress at a time.
+type daemon struct {
+	runner   feedsync.Syncer
+	state    *feedsync.State
+	interval time.Duration
+	// token is the bearer token required to refresh a feed. When empty,
+	// refreshing is refused.
+	token string
+	// metricsFile, when set, is where the metrics are written after each run
+	metricsFile string
+	// ctx is of every run, for the run in progress to be stopped too
+	ctx context.Context
+	// latest is the last result of each feed, for the metrics
+	latest map[string]feedsync.ReleaseResult
+
+	mu sync.Mutex
+	// queue are the feeds to be refreshed, in order, and queued is the set of
+	// them so that triggers for a feed already waiting are coalesced
+	queue  []string
+	queued map[string]bool
+	wake   chan struct{}
+	report *feedsync.Report
+	feeds  map[string]feedsync.ReportFeed
+	// metrics are those of the latest results, as of the last run
+	metrics []byte
+}
+
+func newDaemon(r feedsync.Syncer, state *feedsync.State, interval time.Duration, token string) *daemon {
+	return &daemon{
+		runner:   r,
+		state:    state,
+		interval: interval,
+		token:    token,
+		ctx:      context.Background(),
+		queued:   map[string]bool{},
+		wake:     make(chan struct{}, 1),
+		feeds:    map[string]feedsync.ReportFeed{},
+		latest:   map[string]feedsync.ReleaseResult{},
+	}
+}
+
+// loop does a run of all the feeds, then runs each as it is due and the
+// refreshes as they are queued, until stop is closed. A Config from reload is
+// used from then on, between runs.
+func (d *daemon) loop(stop <-chan struct{}, reload <-chan feedsync.Config) {
+	d.run(d.runner.Only)
+	timer := time.NewTimer(d.untilDue(time.Now()))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case conf := <-reload:
+			d.reconfigure(conf)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(d.untilDue(time.Now()))
+		case <-timer.C:
+			if due := d.due(time.Now()); len(due) > 0 {
+				d.run(due)
+			}
+			timer.Reset(d.untilDue(time.Now()))
+		case <-d.wake:
+			for {
+				feed, ok := d.dequeue()
+				if !ok {
+					break
+				}
+				d.run([]string{feed})
+			}
+		}
+	}
+}
+
+// reconfigure has the daemon use conf from now on, right away running the
+// feeds it adds (as they are not due until they have been run once). conf is
+// checked and loaded as by feedsync.New, and is not used when that fails.
+func (d *daemon) reconfigure(conf feedsync.Config) {
+	d.mu.Lock()
+	r := d.runner
+	d.mu.Unlock()
+	old := r.Config
+	if names := keepRestartOnly(old, &conf); len(names) > 0 {
+		r.Errorf(feedsync.LogFields{Action: "reload"}, "not changing %s, which need a restart", strings.Join(names, ", "))
+	}
+	next, err := feedsync.New(conf, r.TLSConfig)
+	if err != nil {
+		r.Errorf(feedsync.LogFields{Action: "reload", Err: err}, "not reloading the config: %v", err)
+		return
+	}
+	r.Config, r.Publisher, r.Signer = next.Config, next.Publisher, next.Signer
+
+	d.mu.Lock()
+	d.runner = r
+	if conf.Interval.Duration > 0 {
+		d.interval = conf.Interval.Duration
+	}
+	d.mu.Unlock()
+
+	added := []string{}
+	for _, feed := range conf.Feeds() {
+		if !old.HasFeed(feed) && (len(r.Only) == 0 || contains(r.Only, feed)) {
+			added = append(added, feed)
+		}
+	}
+	if len(added) == 0 {
+		r.Infof(feedsync.LogFields{Action: "reload"}, "reloaded the config")
+		return
+	}
+	r.Infof(feedsync.LogFields{Action: "reload"}, "reloaded the config, running the new feeds %q", added)
+	d.run(added)
+}
+
+// keepRestartOnly sets the settings of conf that a reload can not change back
+// to those of old, as the dest directory is served, locked and has the state,
+// and is the names of those that were changed
+func keepRestartOnly(old feedsync.Config, conf *feedsync.Config) []string {
+	names := []string{}
+	if conf.LocalDest() != old.LocalDest() {
+		names = append(names, "Dest")
+		conf.Dest, conf.WorkDir = old.Dest, old.WorkDir
+	}
+	if conf.LockFile != old.LockFile {
+		names = append(names, "LockFile")
+		conf.LockFile = old.LockFile
+	}
+	if conf.MetricsFile != old.MetricsFile {
+		names = append(names, "MetricsFile")
+		conf.MetricsFile = old.MetricsFile
+	}
+	return names
+}
+
+// enqueue queues the feed to be refreshed, and is false when it was already
+// waiting to be
+func (d *daemon) enqueue(feed string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.queued[feed] {
+		return false
+	}
+	d.queued[feed] = true
+	d.queue = append(d.queue, feed)
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// dequeue is the next feed to refresh. Once it is taken, a further trigger
+// for it queues another refresh, as the one starting may be too early.
+func (d *daemon) dequeue() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queue) == 0 {
+		return "", false
+	}
+	feed := d.queue[0]
+	d.queue = d.queue[1:]
+	delete(d.queued, feed)
+	return feed, true
+}
+
+// due are the feeds whose NextRun has come by now
+func (d *daemon) due(now time.Time) []string {
+	feeds := []string{}
+	for name, fs := range d.state.Feeds {
+		if !fs.NextRun.IsZero() && !fs.NextRun.After(now) && d.runner.Config.HasFeed(name) {
+			feeds = append(feeds, name)
+		}
+	}
+	sort.Strings(feeds)
+	return feeds
+}
+
+// untilDue is how long from now until the next feed is due, or the interval
+// when none is scheduled
+func (d *daemon) untilDue(now time.Time) time.Duration {
+	var next time.Time
+	for name, fs := range d.state.Feeds {
+		if fs.NextRun.IsZero() || !d.runner.Config.HasFeed(name) {
+			continue
+		}
+		if next.IsZero() || fs.NextRun.Before(next) {
+			next = fs.NextRun
+		}
+	}
+	if next.IsZero() {
+		return d.interval
+	}
+	if wait := next.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// run does one Run of the runner, limited to only (when set), recording the
+// outcome and when each feed is next due in the state, and for the report API
+func (d *daemon) run(only []string) {
+	r := d.runner
+	r.Only = only
+	r.State = d.state
+	r.Interval = d.interval
+	start := time.Now()
+	rep, err := r.Run(d.ctx)
+	if err != nil {
+		r.Errorf(feedsync.LogFields{Action: "state", Err: err}, "%v", err)
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.report = &rep
+	for _, f := range rep.Feeds {
+		d.feeds[f.Feed] = f
+	}
+	for _, res := range rep.Results {
+		d.latest[res.Name] = res
+	}
+	latest := []feedsync.ReleaseResult{}
+	for _, res := range d.latest {
+		latest = append(latest, res)
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].Name < latest[j].Name })
+	buf := bytes.NewBuffer(nil)
+	if err := feedsync.WriteMetrics(buf, latest, d.state, start, now.Sub(start), nil); err != nil {
+		r.Errorf(feedsync.LogFields{Action: "metrics", Err: err}, "%v", err)
+		return
+	}
+	d.metrics = buf.Bytes()
+	if d.metricsFile != "" {
+		err := util.WriteFileAtomic(d.metricsFile, time.Time{}, func(w io.Writer) error {
+			_, err := w.Write(d.metrics)
+			return err
+		})
+		if err != nil {
+			r.Errorf(feedsync.LogFields{Action: "metrics", Err: err}, "%v", err)
+		}
+	}
+}
+
+// handler is the HTTP API of the daemon, and the feeds it writes
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", feedServer{dest: d.runner.Dest})
+	mux.HandleFunc(refreshPrefix, d.serveRefresh)
+	mux.HandleFunc(reportPath, d.serveReport)
+	mux.HandleFunc(reportPath+"/", d.serveReport)
+	mux.HandleFunc(metricsPath, d.serveMetrics)
+	return mux
+}
+
+// serveMetrics is the metrics of the last run, in the prometheus text
+// exposition format, as written to the --metrics-file
+func (d *daemon) serveMetrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d.mu.Lock()
+	metrics := d.metrics
+	d.mu.Unlock()
+	if metrics == nil {
+		http.Error(w, "no run has finished yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(metrics)
+}
+
+// serveRefresh queues the feed named in the path to be refreshed, responding
+// 202 Accepted (whether it was queued now or already waiting)
+func (d *daemon) serveRefresh(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if d.token == "" {
+		http.Error(w, "refreshing is disabled without an API token", http.StatusForbidden)
+		return
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(d.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sl-feeds"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	feed := strings.TrimPrefix(req.URL.Path, refreshPrefix)
+	d.mu.Lock()
+	ok := d.runner.Config.HasFeed(feed)
+	d.mu.Unlock()
+	if !ok {
+		http.Error(w, "no feed "+feed+" configured", http.StatusNotFound)
+		return
+	}
+	queued := d.enqueue(feed)
+	writeJSON(w, http.StatusAccepted, struct {
+		Feed      string
+		Coalesced bool
+		Report    string
+	}{feed, !queued, reportPath + "/" + feed})
+}
+
+// serveReport is the Report of the last run, or the latest outcome of the feed
+// named in the path
+func (d *daemon) serveReport(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	feed := strings.Trim(strings.TrimPrefix(req.URL.Path, reportPath), "/")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if feed == "" {
+		if d.report == nil {
+			http.Error(w, "no run has finished yet", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, d.report)
+		return
+	}
+	f, ok := d.feeds[feed]
+	if !ok {
+		http.Error(w, "no outcome of "+feed+" yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
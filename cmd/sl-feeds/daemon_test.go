@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+func TestDaemonRefresh(t *testing.T) {
+	requests := map[string]int{}
+	files := http.FileServer(http.Dir("../../changelog/testdata/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests[req.URL.Path]++
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	r := newTestSyncer(t, feedsync.Mirror{URL: server.URL, Releases: []string{"slackware64", "slackwarearm"}})
+	d := newDaemon(r, feedsync.NewState(), time.Hour, "s3cret")
+	api := httptest.NewServer(d.handler())
+	defer api.Close()
+
+	refresh := func(feed, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, api.URL+refreshPrefix+feed, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for _, c := range []struct {
+		feed, token string
+		status      int
+	}{
+		{"slackware64", "", http.StatusUnauthorized},
+		{"slackware64", "wrong", http.StatusUnauthorized},
+		{"missing", "s3cret", http.StatusNotFound},
+		{"slackware64", "s3cret", http.StatusAccepted},
+		{"slackware64", "s3cret", http.StatusAccepted},
+	} {
+		if resp := refresh(c.feed, c.token); resp.StatusCode != c.status {
+			t.Errorf("%s with %q: expected %d; got %d", c.feed, c.token, c.status, resp.StatusCode)
+		}
+	}
+	if len(d.queue) != 1 {
+		t.Errorf("expected the triggers to coalesce into %d refresh; got %q", 1, d.queue)
+	}
+
+	if resp, err := http.Get(api.URL + reportPath + "/slackware64"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected no report before the refresh; got %v", err)
+	}
+
+	// only the queued feed is refreshed
+	feed, ok := d.dequeue()
+	if !ok {
+		t.Fatal("expected a queued refresh")
+	}
+	d.run([]string{feed})
+	if requests["/slackware64/ChangeLog.txt"] != 1 || requests["/slackwarearm/ChangeLog.txt"] != 0 {
+		t.Errorf("expected only slackware64 to be fetched; got %v", requests)
+	}
+
+	resp, err := http.Get(api.URL + reportPath + "/slackware64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var f feedsync.ReportFeed
+	if err := json.NewDecoder(resp.Body).Decode(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Status != "updated" || f.NewEntries == 0 {
+		t.Errorf("expected slackware64 to be updated; got %#v", f)
+	}
+	if d.state.Feed("slackware64").LastSuccess.IsZero() {
+		t.Error("expected the refresh to be recorded in the state")
+	}
+
+	// the feeds are served alongside the API
+	feedResp, err := http.Get(api.URL + "/slackware64.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedResp.Body.Close()
+	if feedResp.StatusCode != http.StatusOK || feedResp.Header.Get("Content-Type") != "application/rss+xml" {
+		t.Errorf("expected the feed to be served; got %d of %s", feedResp.StatusCode, feedResp.Header.Get("Content-Type"))
+	}
+}
+
+func TestDaemonNoToken(t *testing.T) {
+	r := newTestSyncer(t, feedsync.Mirror{URL: "http://127.0.0.1:0", Releases: []string{"slackware64"}})
+	d := newDaemon(r, feedsync.NewState(), time.Hour, "")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, refreshPrefix+"slackware64", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	d.handler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected refreshing to be refused without a token; got %d", w.Code)
+	}
+}
+
+func TestDaemonSchedule(t *testing.T) {
+	r := newTestSyncer(t, feedsync.Mirror{
+		URL: "http://127.0.0.1:0",
+		Release: []feedsync.Release{
+			{Name: "slackware64", Schedule: "*/15 * * * *"},
+			{Name: "slackwarearm", Every: feedsync.Duration{Duration: 12 * time.Hour}},
+			{Name: "slackware"},
+		},
+	})
+	d := newDaemon(r, feedsync.NewState(), time.Hour, "")
+	if wait := d.untilDue(time.Now()); wait != time.Hour {
+		t.Errorf("expected to wait the interval with nothing scheduled; got %s", wait)
+	}
+
+	before := time.Now()
+	d.run(nil)
+	for feed, max := range map[string]time.Duration{
+		"slackware64":  15 * time.Minute,
+		"slackwarearm": 12 * time.Hour,
+		"slackware":    time.Hour,
+	} {
+		next := d.state.Feed(feed).NextRun
+		if next.Before(before) || next.After(time.Now().Add(max)) {
+			t.Errorf("%s: expected the next run within %s; got %s", feed, max, next)
+		}
+		if f := d.feeds[feed]; f.NextRun == nil || !f.NextRun.Equal(next) {
+			t.Errorf("%s: expected the next run in the report; got %#v", feed, f.NextRun)
+		}
+	}
+	if wait := d.untilDue(time.Now()); wait > 15*time.Minute {
+		t.Errorf("expected to wait for slackware64; got %s", wait)
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	if due := d.due(later); len(due) != 2 || due[0] != "slackware" || due[1] != "slackware64" {
+		t.Errorf("expected slackware and slackware64 to be due; got %q", due)
+	}
+}
+
+func TestDaemonReconfigure(t *testing.T) {
+	requests := map[string]int{}
+	files := http.FileServer(http.Dir("../../changelog/testdata/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests[req.URL.Path]++
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	r := newTestSyncer(t, feedsync.Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	d := newDaemon(r, feedsync.NewState(), time.Hour, "s3cret")
+	d.run(nil)
+
+	conf := r.Config
+	conf.Mirrors = []feedsync.Mirror{{URL: server.URL, Releases: []string{"slackware64", "slackwarearm"}}}
+	conf.Interval = feedsync.Duration{Duration: 2 * time.Hour}
+	d.reconfigure(conf)
+	if requests["/slackware64/ChangeLog.txt"] != 1 || requests["/slackwarearm/ChangeLog.txt"] != 1 {
+		t.Errorf("expected only the new feed to be run; got %v", requests)
+	}
+	if d.interval != 2*time.Hour {
+		t.Errorf("expected the Interval of the new config; got %s", d.interval)
+	}
+	if due := d.due(time.Now().Add(3 * time.Hour)); len(due) != 2 {
+		t.Errorf("expected both feeds to be scheduled; got %q", due)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, refreshPrefix+"slackwarearm", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	d.handler().ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected the new feed to be refreshable; got %d", w.Code)
+	}
+
+	// a config with problems is not used, and the Dest is kept
+	bad := conf
+	bad.Jobs = -1
+	d.reconfigure(bad)
+	if d.runner.Config.Jobs != conf.Jobs {
+		t.Errorf("expected the config with problems to not be used; got Jobs %d", d.runner.Config.Jobs)
+	}
+	moved := conf
+	moved.Dest = t.TempDir()
+	moved.Jobs = 2
+	d.reconfigure(moved)
+	if d.runner.Dest != r.Dest || d.runner.Config.Dest != r.Config.Dest || d.runner.Config.Jobs != 2 {
+		t.Errorf("expected the rest of the config, but the Dest %q kept; got %q (Jobs %d)", r.Dest, d.runner.Config.Dest, d.runner.Config.Jobs)
+	}
+}
+
+func TestDaemonMetrics(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../../changelog/testdata/")))
+	defer server.Close()
+
+	r := newTestSyncer(t, feedsync.Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	d := newDaemon(r, feedsync.NewState(), time.Hour, "")
+	d.metricsFile = filepath.Join(r.Dest, "sl-feeds.prom")
+	api := httptest.NewServer(d.handler())
+	defer api.Close()
+
+	if resp, err := http.Get(api.URL + metricsPath); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected no metrics before a run; got %v", err)
+	}
+	d.run(nil)
+
+	resp, err := http.Get(api.URL + metricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	served, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"sl_feeds_last_run_duration_seconds ",
+		`sl_feeds_feed_fetch_duration_seconds{feed="slackware64"} `,
+		`sl_feeds_feed_consecutive_failures{feed="slackware64"} 0` + "\n",
+	} {
+		if !strings.Contains(string(served), line) {
+			t.Errorf("expected the metrics to include %q; got:\n%s", line, served)
+		}
+	}
+	written, err := ioutil.ReadFile(d.metricsFile)
+	if err != nil || string(written) != string(served) {
+		t.Errorf("expected the metrics served to be those written; got %v", err)
+	}
+}
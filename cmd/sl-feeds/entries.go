@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/internal/cliutil"
+)
+
+var entriesCommand = cli.Command{
+	Name:  "entries",
+	Usage: "Write the parsed entries of a ChangeLog as JSON to stdout, for other tooling",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "file, f",
+			Usage: "read the ChangeLog from `FILE` (or - for stdin), instead of fetching it",
+		},
+		cli.StringFlag{
+			Name:  "url",
+			Usage: "fetch the ChangeLog from the mirror at `URL`, instead of the one of the --release in the --config",
+		},
+		cli.StringFlag{
+			Name:  "release",
+			Usage: "the `RELEASE` (or feed name) to fetch the ChangeLog of",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "only the entries newer than `TIME` (RFC 3339, like 2017-01-18T00:00:00Z)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		var since time.Time
+		if s := c.String("since"); s != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, s); err != nil {
+				return cli.NewExitError(fmt.Sprintf("invalid --since: %v", err), exitConfig)
+			}
+		}
+
+		var (
+			entries []changelog.Entry
+			err     error
+		)
+		if path := c.String("file"); path != "" {
+			entries, err = parseFile(path, since)
+		} else {
+			config, mirror, rel, cerr := entriesMirror(c)
+			if cerr != nil {
+				return cli.NewExitError(cerr.Error(), exitConfig)
+			}
+			entries, err = fetchEntries(c, config, mirror, rel)
+		}
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitFetch)
+		}
+
+		newer := []changelog.Entry{}
+		for _, e := range entries {
+			if e.Date.After(since) {
+				newer = append(newer, e)
+			}
+		}
+		data, err := changelog.EntriesJSON(newer)
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitWrite)
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			return cli.NewExitError(err.Error(), exitWrite)
+		}
+		return nil
+	},
+}
+
+// parseFile is the entries of the ChangeLog at path (or of stdin for "-")
+// newer than since, when it is set. As a ChangeLog is newest first, the rest
+// of it is not read after the first entry that is not.
+func parseFile(path string, since time.Time) ([]changelog.Entry, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		fh, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer fh.Close()
+		in = fh
+	}
+	s := changelog.NewScanner(in)
+	entries := []changelog.Entry{}
+	for s.Scan() {
+		e := s.Entry()
+		if !since.IsZero() {
+			if e.Date.IsZero() {
+				// (as there is no telling how new it is)
+				continue
+			}
+			if !e.Date.After(since) {
+				break
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// entriesMirror is the mirror and release the entries are fetched from, that is
+// of the --url, or else the first mirror of the --config with the --release
+func entriesMirror(c *cli.Context) (config feedsync.Config, mirror feedsync.Mirror, rel feedsync.Release, err error) {
+	name := c.String("release")
+	if name == "" {
+		return config, mirror, rel, errors.New("expected a --release, or a --file")
+	}
+	if path := c.GlobalString("config"); path != "" {
+		if config, _, err = feedsync.LoadConfig(path); err != nil {
+			return config, mirror, rel, err
+		}
+	}
+	if u := c.String("url"); u != "" {
+		if err := feedsync.CheckMirrorURL(u); err != nil {
+			return config, mirror, rel, fmt.Errorf("--url: %v", err)
+		}
+		return config, feedsync.Mirror{URL: u}.WithoutUserinfo(), feedsync.Release{Name: name}, nil
+	}
+	if m, r, ok := config.FindRelease(name); ok {
+		return config, m, r, nil
+	}
+	return config, mirror, rel, fmt.Errorf("no release %q in the --config, or a --url to fetch it from", name)
+}
+
+// fetchEntries is the entries of the ChangeLog of the release of the mirror,
+// fetched with the settings of the config, and the --ca and --insecure
+func fetchEntries(c *cli.Context, config feedsync.Config, mirror feedsync.Mirror, rel feedsync.Release) ([]changelog.Entry, error) {
+	tlsConfig, err := cliutil.TLSConfig(c.GlobalString("ca"), c.GlobalBool("insecure"))
+	if err != nil {
+		return nil, err
+	}
+	r := feedsync.Syncer{
+		Config:    config,
+		Quiet:     true,
+		Logger:    log.New(ioutil.Discard, "", 0),
+		TLSConfig: tlsConfig,
+		// nothing is written, not even to the cache
+		DryRun: true,
+	}
+	if n, err := feedsync.LoadNetrc(); err == nil {
+		r.Netrc = n
+	}
+	return r.FetchEntries(mirror, rel)
+}
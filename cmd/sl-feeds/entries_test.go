@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+func TestEntriesMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-entries.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sl-feeds.toml")
+	conf := "Dest = \"/srv/feeds\"\n[[Mirrors]]\n  URL = \"http://ftp.arm.slackware.com/slackwarearm/\"\n  Prefix = \"arm-\"\n  Releases = [\"slackwarearm-current\"]\n"
+	if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entriesMirrorArgs := func(args ...string) (mirror feedsync.Mirror, rel feedsync.Release, err error) {
+		app := cli.NewApp()
+		app.Flags = []cli.Flag{cli.StringFlag{Name: "config, c"}}
+		cmd := entriesCommand
+		cmd.Action = func(c *cli.Context) error {
+			_, mirror, rel, err = entriesMirror(c)
+			return nil
+		}
+		app.Commands = []cli.Command{cmd}
+		if runErr := app.Run(append([]string{"sl-feeds"}, args...)); runErr != nil {
+			return mirror, rel, runErr
+		}
+		return mirror, rel, err
+	}
+
+	for _, name := range []string{"slackwarearm-current", "arm-slackwarearm-current"} {
+		mirror, rel, err := entriesMirrorArgs("-c", path, "entries", "--release", name)
+		if err != nil || mirror.URL != "http://ftp.arm.slackware.com/slackwarearm/" || rel.Name != "slackwarearm-current" {
+			t.Errorf("%s: expected the release of the config; got %q, %q (%v)", name, mirror.URL, rel.Name, err)
+		}
+	}
+	mirror, rel, err := entriesMirrorArgs("-c", path, "entries", "--url", "http://slackware.osuosl.org/", "--release", "slackware64-current")
+	if err != nil || mirror.URL != "http://slackware.osuosl.org/" || rel.Name != "slackware64-current" {
+		t.Errorf("expected the --url over the config; got %q, %q (%v)", mirror.URL, rel.Name, err)
+	}
+	for args, expected := range map[string]string{
+		"entries":                                "expected a --release",
+		"-c " + path + " entries --release nope": `no release "nope"`,
+		"entries --url slackware --release nope": "--url: invalid URL",
+	} {
+		if _, _, err := entriesMirrorArgs(strings.Fields(args)...); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error of %q; got %v", args, expected, err)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	path := "../../changelog/testdata/slackware64/ChangeLog.txt"
+	all, err := parseFile(path, time.Time{})
+	if err != nil || len(all) != 52 {
+		t.Fatalf("expected every entry; got %d (%v)", len(all), err)
+	}
+	newer, err := parseFile(path, all[3].Date)
+	if err != nil || len(newer) != 3 || !newer[2].Date.Equal(all[2].Date) {
+		t.Errorf("expected the 3 entries newer than the 4th; got %d (%v)", len(newer), err)
+	}
+
+	// an entry of no date is only skipped for a since
+	path = filepath.Join(t.TempDir(), "ChangeLog.txt")
+	text := "Mon Jan 32 21:30:13 UTC 2017\na/bar-1.0-x86_64-1.txz:  Upgraded.\n+--------------------------+\n" +
+		"Fri Jan 20 08:00:00 UTC 2017\na/baz-1.0-x86_64-1.txz:  Upgraded.\n+--------------------------+\n"
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := parseFile(path, time.Time{}); err != nil || len(all) != 2 || !all[0].Date.IsZero() {
+		t.Errorf("expected both entries, the first of no date; got %d (%v)", len(all), err)
+	}
+	if newer, err := parseFile(path, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)); err != nil || len(newer) != 1 {
+		t.Errorf("expected the one entry of a date; got %d (%v)", len(newer), err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+// The exit codes of a run, for scripts to tell the kinds of failure apart
+// without reading the logs
+const (
+	// exitPartial is for some releases failing, with --strict
+	exitPartial = 1
+	// exitConfig is for a config (or flags) that can not be used
+	exitConfig = 2
+	// exitFetch is for every release attempted failing to be fetched, as
+	// when the local network is down
+	exitFetch = 3
+	// exitWrite is for failing to write or upload the feeds
+	exitWrite = 4
+	// exitInterrupted is for releases not attempted because of a signal or
+	// the --deadline
+	exitInterrupted = 5
+	// exitLocked is for another run holding the lock (past the --lock-wait),
+	// so that nothing was attempted
+	exitLocked = 6
+)
+
+// exitCode is the exit code for the results of a run. The kinds of failure
+// are by precedence: an interrupted run, then writing, then every fetch
+// failing. Otherwise failures are only an error with strict.
+func exitCode(results []feedsync.ReleaseResult, strict bool) int {
+	var (
+		attempted, fetchFailed int
+		failed, interrupted    bool
+		writeFailed            bool
+	)
+	for _, res := range results {
+		if res.Skipped() {
+			continue
+		}
+		attempted++
+		var werr feedsync.WriteError
+		switch {
+		case res.Err == feedsync.ErrDeadline || res.Err == feedsync.ErrInterrupted:
+			interrupted = true
+		case errors.As(res.Err, &werr):
+			writeFailed = true
+		case res.Err != nil && res.Failed():
+			fetchFailed++
+		}
+		for _, err := range res.Dests {
+			if err != nil {
+				writeFailed = true
+			}
+		}
+		failed = failed || res.Failed()
+	}
+	switch {
+	case interrupted:
+		return exitInterrupted
+	case writeFailed:
+		return exitWrite
+	case attempted > 0 && fetchFailed == attempted:
+		return exitFetch
+	case strict && failed:
+		return exitPartial
+	}
+	return 0
+}
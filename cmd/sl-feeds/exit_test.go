@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+func TestExitCode(t *testing.T) {
+	var (
+		ok        = feedsync.ReleaseResult{Name: "ok"}
+		unchanged = feedsync.ReleaseResult{Name: "unchanged", Err: fetch.ErrNotNewer}
+		fetchErr  = feedsync.ReleaseResult{Name: "fetch", Err: errors.New("503 status")}
+		writeErr  = feedsync.ReleaseResult{Name: "write", Err: feedsync.WriteError{Err: errors.New("disk full")}}
+		copyErr   = feedsync.ReleaseResult{Name: "copy", Dests: map[string]error{"/mnt/feeds": errors.New("read-only file system")}}
+		deadline  = feedsync.ReleaseResult{Name: "deadline", Err: feedsync.ErrDeadline}
+		stopped   = feedsync.ReleaseResult{Name: "stopped", Err: feedsync.ErrInterrupted}
+		deferred  = feedsync.ReleaseResult{Name: "deferred", Err: feedsync.ErrDeferred}
+		notTried  = feedsync.ReleaseResult{Name: "not tried", Err: feedsync.ErrFailFast}
+	)
+	cases := []struct {
+		name     string
+		results  []feedsync.ReleaseResult
+		strict   bool
+		expected int
+	}{
+		{"nothing", nil, true, 0},
+		{"success", []feedsync.ReleaseResult{ok, unchanged}, true, 0},
+		{"partial", []feedsync.ReleaseResult{ok, fetchErr}, false, 0},
+		{"partial strict", []feedsync.ReleaseResult{ok, fetchErr}, true, exitPartial},
+		{"all fetches failed", []feedsync.ReleaseResult{fetchErr, fetchErr}, false, exitFetch},
+		{"all attempted fetches failed", []feedsync.ReleaseResult{fetchErr, deferred}, false, exitFetch},
+		{"only deferred", []feedsync.ReleaseResult{deferred}, true, 0},
+		{"fail fast", []feedsync.ReleaseResult{ok, fetchErr, notTried}, true, exitPartial},
+		{"write", []feedsync.ReleaseResult{ok, writeErr}, false, exitWrite},
+		{"write over fetch", []feedsync.ReleaseResult{fetchErr, writeErr}, true, exitWrite},
+		{"copy to extra dest", []feedsync.ReleaseResult{copyErr, ok}, false, exitWrite},
+		{"deadline", []feedsync.ReleaseResult{ok, deadline}, false, exitInterrupted},
+		{"interrupted over write", []feedsync.ReleaseResult{writeErr, stopped}, true, exitInterrupted},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.results, c.strict); code != c.expected {
+			t.Errorf("%s: expected %d; got %d", c.name, c.expected, code)
+		}
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	r := newTestSyncer(t, feedsync.Mirror{URL: "http://127.0.0.1:0", Releases: []string{"slackware64", "slackwarearm"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rep, _ := r.Run(ctx)
+	results := rep.Results
+	if len(results) != 2 || results[0].Err != feedsync.ErrInterrupted || results[1].Err != feedsync.ErrInterrupted {
+		t.Fatalf("expected no release to be attempted; got %#v", results)
+	}
+	if code := exitCode(results, false); code != exitInterrupted {
+		t.Errorf("expected %d; got %d", exitInterrupted, code)
+	}
+}
+
+func TestRunFailFast(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/broken") {
+			http.NotFound(w, req)
+			return
+		}
+		http.ServeFile(w, req, "../../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+
+	r := newTestSyncer(t, feedsync.Mirror{URL: server.URL, Releases: []string{"a", "broken", "c"}})
+	r.Config.Jobs = 1
+	r.FailFast = true
+
+	rep, _ := r.Run(context.Background())
+	results := rep.Results
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results; got %d", len(results))
+	}
+	for i, status := range []string{"updated", "failed", "skipped"} {
+		if s := results[i].Status(); s != status {
+			t.Errorf("%s: expected %s; got %s (%v)", results[i].Name, status, s, results[i].Err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "c.rss")); !os.IsNotExist(err) {
+		t.Errorf("expected no feed of the release after the failure; got %v", err)
+	}
+	if code := exitCode(results, true); code != exitPartial {
+		t.Errorf("expected %d; got %d", exitPartial, code)
+	}
+}
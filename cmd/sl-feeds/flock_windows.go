@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+// flock does not lock anything, as there is no flock on Windows, so runs there
+// are not kept from overlapping
+func flock(fh *os.File) error {
+	return nil
+}
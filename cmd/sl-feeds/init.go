@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// knownMirrors are public mirrors offered by `sl-feeds init`
+var knownMirrors = []string{
+	"http://slackware.osuosl.org/",
+	"https://mirrors.slackware.com/slackware/",
+	"http://ftp.arm.slackware.com/slackwarearm/",
+}
+
+const defaultDest = "$HOME/public_html/feeds/"
+
+var initCommand = cli.Command{
+	Name:  "init",
+	Usage: "Write a new configuration, probing the mirrors for their releases",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: filepath.Join("$HOME", ".sl-feeds.toml"),
+			Usage: "write the configuration to `FILE`",
+		},
+		cli.StringFlag{
+			Name:  "dest, d",
+			Usage: "write the feeds to `DIR` (prompted for if not set)",
+		},
+		cli.StringSliceFlag{
+			Name:  "url",
+			Usage: "use the mirror at `URL` (may be repeated, prompted for if not set)",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "overwrite an existing configuration",
+		},
+		cli.BoolFlag{
+			Name:  "run",
+			Usage: "run one generation with the new configuration",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		path := os.ExpandEnv(c.String("output"))
+		if _, err := os.Stat(path); err == nil && !c.Bool("force") {
+			return cli.NewExitError(fmt.Sprintf("%q already exists, use --force to overwrite it", path), 1)
+		}
+
+		in := bufio.NewReader(os.Stdin)
+		config, err := initConfig(in, os.Stdout, c.String("dest"), c.StringSlice("url"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		fh, err := os.Create(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		if err := toml.NewEncoder(fh).Encode(config); err != nil {
+			fh.Close()
+			return cli.NewExitError(err.Error(), 1)
+		}
+		if err := fh.Close(); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		fmt.Printf("Wrote %q\n", path)
+
+		run := c.Bool("run")
+		if !run && !c.IsSet("dest") && len(c.StringSlice("url")) == 0 {
+			run = strings.HasPrefix(strings.ToLower(prompt(in, os.Stdout, "Run a generation now?", "n")), "y")
+		}
+		if !run {
+			return nil
+		}
+		dest := os.ExpandEnv(config.Dest)
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		r := feedsync.Syncer{Config: config, Dest: dest, Logger: log.New(os.Stderr, "", log.LstdFlags)}
+		rep, err := r.Run(context.Background())
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		failed := 0
+		for _, res := range rep.Results {
+			if res.Failed() {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return cli.NewExitError(fmt.Sprintf("%d releases failed", failed), 1)
+		}
+		return nil
+	},
+}
+
+// initConfig builds a Config, prompting on out and reading answers from in
+// for the dest and mirror urls that are not already set
+func initConfig(in *bufio.Reader, out io.Writer, dest string, urls []string) (feedsync.Config, error) {
+	config := feedsync.Config{Dest: dest}
+	if config.Dest == "" {
+		config.Dest = prompt(in, out, "Destination directory for the feeds", defaultDest)
+	}
+
+	if len(urls) == 0 {
+		fmt.Fprintln(out, "Known mirrors:")
+		for i, m := range knownMirrors {
+			fmt.Fprintf(out, "  %d) %s\n", i+1, m)
+		}
+		answer := prompt(in, out, "Mirrors to use (comma separated numbers or URLs)", "1")
+		for _, a := range strings.Split(answer, ",") {
+			a = strings.TrimSpace(a)
+			if a == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(a); err == nil {
+				if n < 1 || n > len(knownMirrors) {
+					return config, fmt.Errorf("no known mirror %d", n)
+				}
+				a = knownMirrors[n-1]
+			}
+			urls = append(urls, a)
+		}
+	}
+
+	for _, u := range urls {
+		fmt.Fprintf(out, "Probing %s ...\n", u)
+		releases, err := fetch.Discover(u, fetch.KnownReleases)
+		if err != nil {
+			fmt.Fprintf(out, "  skipping: %v\n", err)
+			continue
+		}
+		if len(releases) == 0 {
+			fmt.Fprintln(out, "  skipping: no known releases found")
+			continue
+		}
+		fmt.Fprintf(out, "  found %s\n", strings.Join(releases, ", "))
+		config.Mirrors = append(config.Mirrors, feedsync.Mirror{URL: u, Releases: releases})
+	}
+	if len(config.Mirrors) == 0 {
+		return config, fmt.Errorf("none of the mirrors had any releases")
+	}
+	return config, nil
+}
+
+// prompt asks question on out, reading the answer from in, and falling back
+// to def for an empty answer
+func prompt(in *bufio.Reader, out io.Writer, question, def string) string {
+	fmt.Fprintf(out, "%s [%s]: ", question, def)
+	answer, _ := in.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def
+	}
+	return answer
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slackware64-current/ChangeLog.txt" {
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	in := bufio.NewReader(strings.NewReader("/srv/feeds\n" + server.URL + "/\n"))
+	config, err := initConfig(in, ioutil.Discard, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Dest != "/srv/feeds" {
+		t.Errorf("expected dest %q; got %q", "/srv/feeds", config.Dest)
+	}
+	if len(config.Mirrors) != 1 {
+		t.Fatalf("expected %d mirror; got %d", 1, len(config.Mirrors))
+	}
+	expected := []string{"slackware64-current"}
+	if !reflect.DeepEqual(config.Mirrors[0].Releases, expected) {
+		t.Errorf("expected releases %q; got %q", expected, config.Mirrors[0].Releases)
+	}
+
+	// with the flags set, nothing is prompted for
+	config, err = initConfig(bufio.NewReader(strings.NewReader("")), ioutil.Discard, "/tmp/feeds", []string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Dest != "/tmp/feeds" || len(config.Mirrors) != 1 {
+		t.Errorf("unexpected config %#v", config)
+	}
+
+	// the default answers are used for empty input
+	in = bufio.NewReader(strings.NewReader("\n"))
+	if got := prompt(in, ioutil.Discard, "Destination", defaultDest); got != defaultDest {
+		t.Errorf("expected %q; got %q", defaultDest, got)
+	}
+}
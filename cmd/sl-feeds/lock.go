@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+// lockFileName is the name of the lock file kept in the dest directory, unless
+// the config has a LockFile
+const lockFileName = ".sl-feeds.lock"
+
+// lockPoll is how often a lock held by another run is tried again, while
+// waiting for it
+const lockPoll = 100 * time.Millisecond
+
+// errLocked is of the lock being held by another run
+var errLocked = errors.New("another run of sl-feeds holds the lock")
+
+// lockPath is the path of the lock file of the runs writing to dest, that is
+// the LockFile of c (like for a dest on NFS, where flock may not
+// work), or else lockFileName in dest
+func lockPath(c feedsync.Config, dest string) string {
+	if c.LockFile != "" {
+		return os.ExpandEnv(c.LockFile)
+	}
+	return filepath.Join(dest, lockFileName)
+}
+
+// acquireLock locks the file at path (creating it as needed), waiting up to
+// wait for another run holding it to be done. The lock is released by closing
+// the file, or by the process exiting however it does, so that a crashed run
+// never leaves behind a lock to be removed.
+func acquireLock(path string, wait time.Duration) (*os.File, error) {
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err := flock(fh)
+		if err == nil {
+			return fh, nil
+		}
+		if err != errLocked || !time.Now().Before(deadline) {
+			fh.Close()
+			if err == errLocked {
+				return nil, fmt.Errorf("%w (%s)", err, path)
+			}
+			return nil, fmt.Errorf("locking %s: %v", path, err)
+		}
+		time.Sleep(lockPoll)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+func TestAcquireLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no flock on windows")
+	}
+	dir, err := ioutil.TempDir("", "sl-feeds-lock.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := lockPath(feedsync.Config{}, dir)
+	if path != filepath.Join(dir, ".sl-feeds.lock") {
+		t.Errorf("expected the lock file in the dest; got %q", path)
+	}
+
+	lock, err := acquireLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireLock(path, 0); !errors.Is(err, errLocked) {
+		t.Fatalf("expected the lock to be held; got %v", err)
+	}
+	if _, err := acquireLock(path, 2*lockPoll); !errors.Is(err, errLocked) {
+		t.Fatalf("expected the lock to still be held after waiting; got %v", err)
+	}
+
+	// released while waiting for it
+	go func() {
+		time.Sleep(2 * lockPoll)
+		lock.Close()
+	}()
+	again, err := acquireLock(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Close()
+
+	// a lock file left behind (as by a crashed run) is not held
+	if again, err = acquireLock(path, 0); err != nil {
+		t.Errorf("expected the lock file left behind to be locked again; got %v", err)
+	} else {
+		again.Close()
+	}
+
+	if path := lockPath(feedsync.Config{LockFile: "$HOME/sl-feeds.lock"}, dir); path != filepath.Join(os.Getenv("HOME"), "sl-feeds.lock") {
+		t.Errorf("expected the LockFile of the config; got %q", path)
+	}
+}
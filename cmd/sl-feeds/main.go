@@ -1,225 +1,650 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/urfave/cli"
 	"github.com/vbatts/sl-feeds/changelog"
-	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/internal/cliutil"
 )
 
+// version is that of the build, as set with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
-	config := Config{}
+	newApp().Run(os.Args)
+}
 
+// newApp is the sl-feeds command. Without a subcommand it is the same as its
+// run command, as it was before there were any, so that "sl-feeds -c
+// conf.toml" (like from cron) keeps working.
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "sl-feeds"
+	app.Version = version
+	feedsync.Version = version
 	app.Usage = "Transform slackware ChangeLog.txt into RSS feeds"
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:  "config, c",
-			Usage: "Load configuration from `FILE`",
-		},
-		cli.StringFlag{
-			Name:  "dest, d",
-			Usage: "Output RSS files to `DIR`",
-		},
-		cli.BoolFlag{
-			Name:  "quiet, q",
-			Usage: "Less output",
-		},
-		cli.BoolFlag{
-			Name:  "insecure",
-			Usage: "do not validate server certificate",
-		},
-		cli.StringFlag{
-			Name:  "ca",
-			Usage: "additional CA cert to use",
-		},
-		cli.BoolFlag{
-			Name:  "sample-config",
-			Usage: "Output sample config file to stdout",
-		},
-	}
-
-	// This is the main/default application
-	app.Action = func(c *cli.Context) error {
-		rootCAs, _ := x509.SystemCertPool()
-		if c.String("ca") != "" {
-			if rootCAs == nil {
-				rootCAs = x509.NewCertPool()
-			}
-			// Read in the cert file
-			certs, err := ioutil.ReadFile(c.String("ca"))
-			if err != nil {
-				log.Fatalf("Failed to append %q to RootCAs: %v", c.String("ca"), err)
-			}
+	app.Flags = runFlags
+	app.Action = runAction
+	app.Commands = []cli.Command{
+		runCommand,
+		initCommand,
+		serveCommand,
+		parseCommand,
+		checkCommand,
+		entriesCommand,
+		completionCommand,
+		completeCommand,
+	}
+	return app
+}
 
-			// Append our cert to the system pool
-			if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
-				log.Println("No certs appended, using system certs only")
-			}
-		}
-		if c.Bool("insecure") {
-			config := &tls.Config{
-				InsecureSkipVerify: true,
-				RootCAs:            rootCAs,
-			}
-			http.DefaultTransport = &http.Transport{TLSClientConfig: config}
-		}
-		if c.Bool("sample-config") {
-			c := Config{
-				Dest:  "$HOME/public_html/feeds/",
-				Quiet: false,
-				Mirrors: []Mirror{
-					Mirror{
-						URL: "http://slackware.osuosl.org/",
-						Releases: []string{
-							"slackware-14.0",
-							"slackware-14.1",
-							"slackware-14.2",
-							"slackware-current",
-							"slackware64-14.0",
-							"slackware64-14.1",
-							"slackware64-14.2",
-							"slackware64-current",
-						},
+var runCommand = cli.Command{
+	Name:   "run",
+	Usage:  "Fetch the ChangeLog.txt of the releases and write their feeds (the default, without a command)",
+	Flags:  runFlags,
+	Action: runAction,
+}
+
+// configFlag and destFlag are of the commands that read the config too, for
+// them to be given either before or after the command
+var (
+	configFlag = cli.StringFlag{
+		Name:  "config, c",
+		Usage: "Load configuration from `FILE`",
+	}
+	destFlag = cli.StringFlag{
+		Name:  "dest, d",
+		Usage: "Output RSS files to `DIR`",
+	}
+)
+
+// runFlags are those of the run command, which are those of the app too, for
+// them to be given before any command (like "sl-feeds -c FILE check")
+var runFlags = []cli.Flag{
+	configFlag,
+	destFlag,
+	cli.StringFlag{
+		Name:  "url",
+		Usage: "add a mirror at `URL`, for a run without a --config (or in addition to its mirrors)",
+	},
+	cli.StringSliceFlag{
+		Name:  "release",
+		Usage: "a `RELEASE` of the mirror of --url (may be repeated)",
+	},
+	cli.StringFlag{
+		Name:  "prefix",
+		Usage: "the `PREFIX` of the feeds of the mirror of --url",
+	},
+	cli.BoolFlag{
+		Name:  "quiet, q",
+		Usage: "Less output",
+	},
+	cli.BoolFlag{
+		Name:  "verbose",
+		Usage: "more output, like each request made and the bytes of it",
+	},
+	cli.StringFlag{
+		Name:  "log-format",
+		Value: "text",
+		Usage: "log as `FORMAT`, text or json (an object per line)",
+	},
+	cli.BoolFlag{
+		Name:  "insecure",
+		Usage: "do not validate server certificate",
+	},
+	cli.StringFlag{
+		Name:  "ca",
+		Usage: "additional CA cert to use",
+	},
+	cli.BoolFlag{
+		Name:  "strict",
+		Usage: "exit non-zero (1) if any release failed, not just when they all did",
+	},
+	cli.BoolFlag{
+		Name:  "fail-fast",
+		Usage: "stop at the first release that fails, and exit non-zero (1)",
+	},
+	cli.BoolFlag{
+		Name:  "strict-config",
+		Usage: "fail on unknown keys in the config, rather than warn",
+	},
+	cli.BoolFlag{
+		Name:  "cron",
+		Usage: "no per-release output, only a single summary of any failures",
+	},
+	cli.BoolFlag{
+		Name:  "trace",
+		Usage: "log DNS, connection, TLS and header details of every request",
+	},
+	cli.IntFlag{
+		Name:  "jobs, j",
+		Usage: "process `N` releases at once (default the Jobs of the config, or 4)",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "give up on a request after `DURATION` (default the Timeout of the config, or 5m)",
+	},
+	cli.DurationFlag{
+		Name:  "deadline",
+		Usage: "do not start on any more releases after `DURATION` (like \"10m\")",
+	},
+	cli.StringFlag{
+		Name:  "since",
+		Usage: "write only the entries newer than `WHEN` (RFC 3339, or like \"30d\") to the feeds being created, instead of the MinDate of the config",
+	},
+	cli.StringSliceFlag{
+		Name:  "only",
+		Usage: "only process `RELEASE` (may be repeated)",
+	},
+	cli.StringSliceFlag{
+		Name:  "mirror",
+		Usage: "only process the mirror `NAME` (may be repeated)",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run, n",
+		Usage: "fetch the releases and report what would change in their feeds, without writing anything",
+	},
+	cli.BoolFlag{
+		Name:  "offline",
+		Usage: "regenerate every feed from the ChangeLogs cached by previous runs, without any requests",
+	},
+	cli.DurationFlag{
+		Name:  "lock-wait",
+		Usage: "wait up to `DURATION` for another run to be done, rather than exiting (6) right away",
+	},
+	cli.StringFlag{
+		Name:  "lock-file",
+		Usage: "lock `FILE` rather than the LockFile of the config (or .sl-feeds.lock in the dest directory)",
+	},
+	cli.BoolFlag{
+		Name:  "no-follow-redirects",
+		Usage: "fail a release whose mirror redirects, rather than following it (for noticing a mirror whose layout changed)",
+	},
+	cli.BoolFlag{
+		Name:  "no-hooks",
+		Usage: "do not run the OnUpdate commands, like for a run by hand",
+	},
+	cli.BoolFlag{
+		Name:  "force",
+		Usage: "fetch and write every feed, ignoring the state of previous runs and the times of the feed files",
+	},
+	cli.BoolFlag{
+		Name:  "prune",
+		Usage: "after a run with no failures, remove the files of the feeds no longer of the config (with --dry-run, only list them)",
+	},
+	cli.BoolFlag{
+		Name:  "reset-backoff",
+		Usage: "clear the backoff of any repeatedly failing mirrors",
+	},
+	cli.StringSliceFlag{
+		Name:  "rollback",
+		Usage: "restore the last-known-good feed of `RELEASE` (may be repeated), without fetching",
+	},
+	cli.StringFlag{
+		Name:  "report",
+		Usage: "write a JSON report of the run to `FILE`",
+	},
+	cli.StringFlag{
+		Name:  "metrics-file, textfile-metrics",
+		Usage: "write prometheus metrics of the run to `FILE` (for the node_exporter textfile collector), instead of the MetricsFile of the config",
+	},
+	cli.StringFlag{
+		Name:  "statsd",
+		Usage: "emit metrics of the run to the statsd daemon at `HOST:PORT` (UDP)",
+	},
+	cli.StringFlag{
+		Name:  "statsd-prefix",
+		Value: "sl-feeds",
+		Usage: "prefix for the statsd metric names",
+	},
+	cli.BoolFlag{
+		Name:  "daemon",
+		Usage: "keep running, processing the releases on their Schedule (or Every), or else every --interval",
+	},
+	cli.DurationFlag{
+		Name:  "interval",
+		Value: 30 * time.Minute,
+		Usage: "in --daemon mode, process the releases every `DURATION` (overriding the Interval of the config)",
+	},
+	cli.StringFlag{
+		Name:  "listen",
+		Usage: "in --daemon mode, serve the feeds and the API (to refresh a feed, and for the reports) on `ADDR`",
+	},
+	cli.StringFlag{
+		Name:  "api-token-file",
+		Usage: "require the bearer token in `FILE` to refresh a feed through the API (default $SL_FEEDS_API_TOKEN)",
+	},
+	cli.BoolFlag{
+		Name:  "sample-config",
+		Usage: "Output sample config file to stdout",
+	},
+}
+
+// runAction processes the releases of the --config (and of any --url), once
+// or as a --daemon
+func runAction(ctx *cli.Context) (runErr error) {
+	c := cliutil.Flags{Context: ctx}
+	config, err := readConfig(c)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := cliutil.TLSConfig(c.String("ca"), c.Bool("insecure"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), exitConfig)
+	}
+	if c.Bool("sample-config") {
+		c := feedsync.Config{
+			Dest:        "$HOME/public_html/feeds/",
+			Quiet:       false,
+			Jobs:        4,
+			Interval:    feedsync.Duration{Duration: 30 * time.Minute},
+			Retries:     2,
+			RetryDelay:  feedsync.Duration{Duration: time.Second},
+			Timeout:     feedsync.Duration{Duration: 5 * time.Minute},
+			Granularity: changelog.GranularityEntry,
+			ItemFormat:  changelog.ItemFormatPre,
+			Formats:     []string{changelog.FormatRss, changelog.FormatAtom},
+			Mirrors: []feedsync.Mirror{
+				feedsync.Mirror{
+					URL: "http://slackware.osuosl.org/",
+					Releases: []string{
+						"slackware-14.0",
+						"slackware-14.1",
+						"slackware-14.2",
+						"slackware-current",
+						"slackware64-14.0",
+						"slackware64-14.1",
+						"slackware64-14.2",
+						"slackware64-current",
 					},
-					Mirror{
-						URL: "http://ftp.arm.slackware.com/slackwarearm/",
-						Releases: []string{
-							"slackwarearm-14.2",
-							"slackwarearm-current",
-						},
+				},
+				feedsync.Mirror{
+					URL: "http://ftp.arm.slackware.com/slackwarearm/",
+					Releases: []string{
+						"slackwarearm-14.2",
+						"slackwarearm-current",
 					},
-					Mirror{
-						URL:    "http://alphageek.noip.me/mirrors/alphageek/",
-						Prefix: "alphageek-",
-						Releases: []string{
-							"slackware64-14.2",
-						},
+				},
+				feedsync.Mirror{
+					URL:    "http://alphageek.noip.me/mirrors/alphageek/",
+					Prefix: "alphageek-",
+					Releases: []string{
+						"slackware64-14.2",
 					},
 				},
+			},
+		}
+		toml.NewEncoder(os.Stdout).Encode(c)
+		return nil
+	}
+
+	if err := overrideConfig(c, &config); err != nil {
+		return cli.NewExitError(err.Error(), exitConfig)
+	}
+	if c.Bool("prune") {
+		config.Prune = true
+	}
+	dest := config.LocalDest()
+	if !c.Bool("dry-run") {
+		// held until exiting, for runs from cron that overlap
+		path := lockPath(config, dest)
+		if c.IsSet("lock-file") {
+			path = c.String("lock-file")
+		}
+		lock, err := acquireLock(path, c.Duration("lock-wait"))
+		if errors.Is(err, errLocked) {
+			return cli.NewExitError(err.Error(), exitLocked)
+		} else if err != nil {
+			return cli.NewExitError(err.Error(), exitWrite)
+		}
+		defer lock.Close()
+	}
+	var (
+		start   = time.Now()
+		results = []feedsync.ReleaseResult{}
+		state   = feedsync.LoadState(dest)
+	)
+	quiet := c.Bool("quiet") || c.Bool("cron")
+	if c.Bool("dry-run") && c.Bool("daemon") {
+		return cli.NewExitError("--dry-run is for a single run, not --daemon", exitConfig)
+	}
+	stderr := ctx.App.ErrWriter
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	logger, logJSON, err := cliutil.NewLogger(stderr, c.String("log-format"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), exitConfig)
+	}
+	r, err := feedsync.New(config, tlsConfig)
+	if err != nil {
+		return cli.NewExitError(err.Error(), exitConfig)
+	}
+	r.Quiet = quiet
+	r.Verbose = c.Bool("verbose") && !quiet
+	r.Logger = logger
+	r.LogJSON = logJSON
+	r.Only = c.StringSlice("only")
+	r.OnlyMirrors = c.StringSlice("mirror")
+	r.Offline = c.Bool("offline")
+	r.DryRun = c.Bool("dry-run")
+	r.Force = c.Bool("force")
+	r.NoRedirects = c.Bool("no-follow-redirects")
+	r.NoHooks = c.Bool("no-hooks")
+	if path := metricsFile(c, config); path != "" {
+		defer func() {
+			if err := feedsync.WriteMetricsFile(path, results, state, start, time.Since(start), runErr); err != nil {
+				r.Errorf(feedsync.LogFields{Action: "metrics", Err: err}, "%v", err)
 			}
-			toml.NewEncoder(os.Stdout).Encode(c)
-			return nil
-		}
-
-		dest := os.ExpandEnv(config.Dest)
-		if !c.Bool("quiet") {
-			fmt.Printf("Writing to: %q\n", dest)
-		}
-		/*
-			for each mirror in Mirrors
-				if there is not a $release.RSS file, then fetch the whole ChangeLog
-				if there is a $release.RSS file, then stat the file and only fetch remote if it is newer than the local RSS file
-				if the remote returns any error (404, 503, etc) then print a warning but continue
-		*/
-		for _, mirror := range config.Mirrors {
-			for _, release := range mirror.Releases {
-				repo := fetch.Repo{
-					URL:     mirror.URL,
-					Release: release,
-				}
-
-				if !c.Bool("quiet") {
-					log.Printf("processing %q", repo.URL+"/"+repo.Release)
-				}
-
-				stat, err := os.Stat(filepath.Join(dest, mirror.Prefix+release+".rss"))
-				if err != nil && !os.IsNotExist(err) {
-					log.Println(release, err)
-					continue
-				}
-				var (
-					entries []changelog.Entry
-					mtime   time.Time
-				)
-				if os.IsNotExist(err) {
-					entries, mtime, err = repo.ChangeLog()
-					if err != nil {
-						log.Println(release, err)
-						continue
-					}
-				} else {
-					// compare times
-					entries, mtime, err = repo.NewerChangeLog(stat.ModTime())
-					if err != nil {
-						if !(err == fetch.ErrNotNewer && c.Bool("quiet")) {
-							log.Println(release, err)
-						}
-						continue
-					}
-				}
-
-				// write out the rss and chtime it to be mtime
-				feeds, err := changelog.ToFeed(repo.URL+"/"+release, entries)
-				if err != nil {
-					log.Println(release, err)
-					continue
-				}
-				feeds.Title = fmt.Sprintf("ChangeLog.txt for %s%s", mirror.Prefix, release)
-				fh, err := os.Create(filepath.Join(dest, mirror.Prefix+release+".rss"))
-				if err != nil {
-					log.Println(release, err)
-					continue
-				}
-				if err := feeds.WriteRss(fh); err != nil {
-					log.Println(release, err)
-					fh.Close()
-					continue
-				}
-				fh.Close()
-				err = os.Chtimes(filepath.Join(dest, mirror.Prefix+release+".rss"), mtime, mtime)
-				if err != nil {
-					log.Println(release, err)
-					continue
-				}
+		}()
+	}
+	to := dest
+	if r.Publisher != nil {
+		to = os.ExpandEnv(config.Dest)
+	}
+	if r.DryRun {
+		r.Infof(feedsync.LogFields{Action: "start"}, "Dry run, not writing to: %q", to)
+	} else {
+		r.Infof(feedsync.LogFields{Action: "start"}, "Writing to: %q", to)
+	}
+	if c.Bool("reset-backoff") {
+		state.ResetBackoff()
+	}
+	r.State = state
+	if c.Bool("cron") {
+		r.Logger.SetOutput(ioutil.Discard)
+	}
+	if c.Bool("trace") {
+		r.Trace = log.New(stderr, "trace: ", log.LstdFlags)
+	}
+	if n, err := feedsync.LoadNetrc(); err != nil {
+		r.Warnf(feedsync.LogFields{Action: "netrc", Err: err}, "not using netrc: %v", err)
+	} else {
+		r.Netrc = n
+	}
+	if releases := c.StringSlice("rollback"); len(releases) > 0 {
+		for _, release := range releases {
+			if err := r.Rollback(release); err != nil {
+				return cli.NewExitError(err.Error(), exitWrite)
 			}
 		}
 		return nil
 	}
+	if addr := c.String("statsd"); addr != "" {
+		s, err := feedsync.DialStatsd(addr, c.String("statsd-prefix"))
+		if err != nil {
+			r.Warnf(feedsync.LogFields{Action: "statsd", Err: err}, "statsd disabled: %v", err)
+		}
+		defer s.Close()
+		r.Statsd = s
+	}
+	if c.Bool("daemon") {
+		return runDaemon(r, state, c)
+	}
 
-	app.Before = func(c *cli.Context) error {
-		if c.String("config") == "" {
-			return nil
+	// the first signal stops the run after the releases in progress, and
+	// another one right away
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if d := c.Duration("deadline"); d > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithDeadline(runCtx, start.Add(d))
+		defer cancel()
+	}
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		<-sigs
+		r.Printf(feedsync.LogFields{Action: "interrupt"}, "interrupted, stopping after the releases in progress")
+		stop()
+		<-sigs
+		os.Exit(exitInterrupted)
+	}()
+	r.FailFast = c.Bool("fail-fast")
+	rep, err := r.Run(runCtx)
+	if err != nil {
+		r.Errorf(feedsync.LogFields{Action: "state", Err: err}, "%v", err)
+	}
+	results = rep.Results
+	if path := c.String("report"); path != "" {
+		if err := feedsync.WriteReportFile(path, rep); err != nil {
+			r.Errorf(feedsync.LogFields{Action: "report", Err: err}, "%v", err)
 		}
+	}
+	if c.Bool("cron") {
+		// the notices are given once, so cron mails them
+		for _, msg := range rep.Notices {
+			fmt.Fprintln(stderr, msg)
+		}
+	}
+	if c.Bool("reset-backoff") && len(results) == 0 && !r.DryRun {
+		// (as Run saves the state only when it had releases to run)
+		if err := state.Save(dest); err != nil {
+			r.Errorf(feedsync.LogFields{Action: "state", Err: err}, "%v", err)
+		}
+	}
 
-		data, err := ioutil.ReadFile(c.String("config"))
+	failed := 0
+	for _, res := range results {
+		if res.Failed() {
+			failed++
+		}
+	}
+	if c.Bool("cron") && failed > 0 {
+		fmt.Fprint(stderr, cronSummary(results, state))
+	}
+	if code := exitCode(results, c.Bool("strict") || c.Bool("fail-fast")); code != 0 {
+		return cli.NewExitError("", code)
+	}
+	return nil
+}
+
+// readConfig loads the --config (if any), checking it and applying the flags
+// that override it, or add the mirror of --url to it
+func readConfig(c cliutil.Flags) (feedsync.Config, error) {
+	var config feedsync.Config
+	if path := c.String("config"); path != "" {
+		var (
+			warnings []string
+			err      error
+		)
+		config, warnings, err = feedsync.LoadConfig(path)
 		if err != nil {
-			return err
+			return config, cli.NewExitError(err.Error(), exitConfig)
+		}
+		for _, w := range warnings {
+			log.Println("warning:", w)
 		}
-		if _, err := toml.Decode(string(data), &config); err != nil {
-			return err
+		if len(warnings) > 0 && c.Bool("strict-config") {
+			return config, cli.NewExitError(fmt.Sprintf("%d problems in %q", len(warnings), path), exitConfig)
 		}
-		if c.String("dest") != "" {
-			config.Dest = c.String("dest")
+		if probs := config.Problems(); len(probs) > 0 {
+			return config, cli.NewExitError(fmt.Sprintf("%s: %s", path, strings.Join(probs, "; ")), exitConfig)
+		}
+	}
+	if c.String("dest") != "" {
+		config.Dest = c.String("dest")
+	}
+	if err := addURLMirror(c, &config); err != nil {
+		return config, cli.NewExitError(err.Error(), exitConfig)
+	}
+	return config, nil
+}
+
+// addURLMirror adds the mirror of the --url, --release and --prefix flags to
+// the config, as if it were one more of its Mirrors
+func addURLMirror(c cliutil.Flags, config *feedsync.Config) error {
+	if c.String("url") == "" {
+		if len(c.StringSlice("release")) > 0 || c.String("prefix") != "" {
+			return errors.New("--release and --prefix are for the mirror of a --url")
 		}
 		return nil
 	}
+	m := feedsync.Mirror{URL: c.String("url"), Prefix: c.String("prefix"), Releases: c.StringSlice("release")}.WithoutUserinfo()
+	if len(m.Releases) == 0 {
+		return errors.New("--url needs at least one --release")
+	}
+	if err := feedsync.CheckMirrorURL(m.URL); err != nil {
+		return fmt.Errorf("--url: %v", err)
+	}
+	if config.Dest == "" {
+		return errors.New("--url needs a --dest, when there is no Dest in a --config")
+	}
+	config.Mirrors = append(config.Mirrors, m)
+	if probs := config.Problems(); len(probs) > 0 {
+		return fmt.Errorf("--url: %s", strings.Join(probs, "; "))
+	}
+	return nil
+}
+
+// overrideConfig applies the flags that override a setting of the config
+func overrideConfig(c cliutil.Flags, config *feedsync.Config) error {
+	if c.IsSet("jobs") {
+		if c.Int("jobs") <= 0 {
+			return errors.New("--jobs must be positive")
+		}
+		config.Jobs = c.Int("jobs")
+	}
+	if c.IsSet("timeout") {
+		if c.Duration("timeout") <= 0 {
+			return errors.New("--timeout must be positive")
+		}
+		config.Timeout = feedsync.Duration{Duration: c.Duration("timeout")}
+	}
+	if c.IsSet("since") {
+		if _, err := feedsync.ParseMinDate(c.String("since"), time.Now()); err != nil {
+			return fmt.Errorf("--since: %v", err)
+		}
+		config.MinDate = c.String("since")
+	}
+	return nil
+}
 
-	app.Run(os.Args)
+// metricsFile is the path the metrics are written to: the --metrics-file when
+// it is given, or else the MetricsFile of the config
+func metricsFile(c cliutil.Flags, config feedsync.Config) string {
+	if c.IsSet("metrics-file") || c.IsSet("textfile-metrics") {
+		return c.String("metrics-file")
+	}
+	return os.ExpandEnv(config.MetricsFile)
 }
 
-// Config is read in to point to where RSS are written to, and the Mirrors to
-// be fetched from
-type Config struct {
-	Quiet   bool
-	Dest    string
-	Mirrors []Mirror
+// daemonInterval is the --interval when it is given, or else the Interval of
+// the config, or the default of --interval
+func daemonInterval(c cliutil.Flags, config feedsync.Config) time.Duration {
+	if !c.IsSet("interval") && config.Interval.Duration > 0 {
+		return config.Interval.Duration
+	}
+	return c.Duration("interval")
 }
 
-// Mirror is where the release/ChangeLog.txt will be fetched from
-type Mirror struct {
-	URL      string
-	Releases []string
-	Prefix   string
+// runDaemon runs r every --interval, serving the API on --listen (when set),
+// until interrupted. On SIGHUP the --config is read again.
+func runDaemon(r feedsync.Syncer, state *feedsync.State, c cliutil.Flags) error {
+	interval := daemonInterval(c, r.Config)
+	if interval <= 0 {
+		return cli.NewExitError("--interval must be positive", exitConfig)
+	}
+	token := strings.TrimSpace(os.Getenv("SL_FEEDS_API_TOKEN"))
+	if path := c.String("api-token-file"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitConfig)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	d := newDaemon(r, state, interval, token)
+	d.metricsFile = metricsFile(c, r.Config)
+	if addr := c.String("listen"); addr != "" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitConfig)
+		}
+		server := &http.Server{Handler: d.handler()}
+		go server.Serve(l)
+		defer server.Close()
+		r.Infof(feedsync.LogFields{Action: "listen"}, "serving the API on %s", l.Addr())
+	}
+
+	// the run in progress is finished before stopping, or reloading, and
+	// another signal stops it after the releases in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		<-sigs
+		r.Printf(feedsync.LogFields{Action: "interrupt"}, "stopping after the run in progress")
+		close(stop)
+		select {
+		case <-sigs:
+			r.Printf(feedsync.LogFields{Action: "interrupt"}, "interrupted, stopping after the releases in progress")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	reload := make(chan feedsync.Config)
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	defer signal.Stop(hups)
+	go func() {
+		for range hups {
+			if c.String("config") == "" {
+				r.Warnf(feedsync.LogFields{Action: "reload"}, "no --config to reload")
+				continue
+			}
+			config, err := readConfig(c)
+			if err != nil {
+				r.Errorf(feedsync.LogFields{Action: "reload", Err: err}, "not reloading the config: %v", err)
+				continue
+			}
+			if err := overrideConfig(c, &config); err != nil {
+				r.Errorf(feedsync.LogFields{Action: "reload", Err: err}, "not reloading the config: %v", err)
+				continue
+			}
+			config.Interval = feedsync.Duration{Duration: daemonInterval(c, config)}
+			select {
+			case reload <- config:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	d.loop(stop, reload)
+	return nil
+}
+
+// cronSummary is the one report of all the failed feeds in results
+func cronSummary(results []feedsync.ReleaseResult, state *feedsync.State) string {
+	lines := []string{}
+	for _, res := range results {
+		if !res.Failed() {
+			continue
+		}
+		runs := state.Feed(res.Name).ConsecutiveFailures
+		runWord := "runs"
+		if runs == 1 {
+			runWord = "run"
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s (failing for %d %s)", res.Name, res.Error(), runs, runWord))
+	}
+	return fmt.Sprintf("sl-feeds: %d of %d feeds failed\n%s\n", len(lines), len(results), strings.Join(lines, "\n"))
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/internal/cliutil"
+)
+
+// readConfigArgs is the Config that readConfig has for the flags in args
+func readConfigArgs(args ...string) (config feedsync.Config, err error) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "config, c"},
+		cli.StringFlag{Name: "dest, d"},
+		cli.BoolFlag{Name: "strict-config"},
+		cli.StringFlag{Name: "url"},
+		cli.StringSliceFlag{Name: "release"},
+		cli.StringFlag{Name: "prefix"},
+	}
+	app.Action = func(c *cli.Context) error {
+		config, err = readConfig(cliutil.Flags{Context: c})
+		return nil
+	}
+	if runErr := app.Run(append([]string{"sl-feeds"}, args...)); runErr != nil {
+		return config, runErr
+	}
+	return config, err
+}
+
+func TestReadConfigURL(t *testing.T) {
+	config, err := readConfigArgs("--url", "http://slackware.osuosl.org/", "--release", "slackware64-current", "--release", "slackware64-15.0", "--prefix", "osuosl-", "--dest", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []feedsync.Mirror{{URL: "http://slackware.osuosl.org/", Prefix: "osuosl-", Releases: []string{"slackware64-current", "slackware64-15.0"}}}
+	if config.Dest != "." || !reflect.DeepEqual(config.Mirrors, expected) {
+		t.Errorf("expected the one mirror of the flags, to %q; got %#v", ".", config)
+	}
+
+	// with a config, the flags add a mirror
+	dir, err := ioutil.TempDir("", "sl-feeds-config.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sl-feeds.toml")
+	conf := "Dest = \"/srv/feeds\"\n[[Mirrors]]\n  URL = \"http://ftp.arm.slackware.com/slackwarearm/\"\n  Releases = [\"slackwarearm-current\"]\n"
+	if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = readConfigArgs("-c", path, "--url", "http://slackware.osuosl.org/", "--release", "slackware64-current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Mirrors) != 2 || config.Mirrors[1].URL != "http://slackware.osuosl.org/" || config.Dest != "/srv/feeds" {
+		t.Errorf("expected the mirror of the flags after the one of the config; got %#v", config)
+	}
+
+	// the dest alone is used too
+	if config, err = readConfigArgs("--dest", "/tmp/feeds"); err != nil || config.Dest != "/tmp/feeds" {
+		t.Errorf("expected the --dest without a config; got %q (%v)", config.Dest, err)
+	}
+}
+
+func TestReadConfigURLProblems(t *testing.T) {
+	for args, expected := range map[string]string{
+		"--url http://slackware.osuosl.org/ --dest .":                         "at least one --release",
+		"--release slackware64-current --dest .":                              "for the mirror of a --url",
+		"--url slackware.osuosl.org --release slackware64-current --dest .":   "--url: invalid URL",
+		"--url http://slackware.osuosl.org/ --release slackware64-current":    "needs a --dest",
+		"--url http://slackware.osuosl.org/ --release x --release x --dest .": "duplicate release",
+		"--prefix a- --dest .": "for the mirror of a --url",
+	} {
+		_, err := readConfigArgs(strings.Fields(args)...)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error of %q; got %v", args, expected, err)
+		}
+	}
+}
+
+// newTestSyncer is a quiet Syncer of the mirrors, writing to a temporary
+// directory and retrying without waiting
+func newTestSyncer(t *testing.T, mirrors ...feedsync.Mirror) feedsync.Syncer {
+	dir := t.TempDir()
+	r, err := feedsync.New(feedsync.Config{Dest: dir, Mirrors: mirrors, RetryDelay: feedsync.Duration{Duration: time.Millisecond}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Quiet = true
+	r.Logger = log.New(ioutil.Discard, "", 0)
+	return r
+}
+
+// runApp runs the sl-feeds app with args, with its output (and its errors)
+func runApp(args ...string) (string, error) {
+	var out bytes.Buffer
+	app := newApp()
+	app.Writer = &out
+	app.ErrWriter = &out
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	err := app.Run(append([]string{"sl-feeds"}, args...))
+	return out.String(), err
+}
+
+func TestAppHelp(t *testing.T) {
+	for _, cmd := range []cli.Command{runCommand, checkCommand, parseCommand, serveCommand} {
+		out, err := runApp(cmd.Name, "--help")
+		if err != nil {
+			t.Fatalf("%s: %v", cmd.Name, err)
+		}
+		if !strings.Contains(out, " "+cmd.Name+" [command options]") || !strings.Contains(out, cmd.Usage) {
+			t.Errorf("%s: expected its own help; got:\n%s", cmd.Name, out)
+		}
+	}
+	if out, err := runApp("--help"); err != nil || !strings.Contains(out, runCommand.Usage) || !strings.Contains(out, "--config") {
+		t.Errorf("expected the commands and flags of the app; got %v:\n%s", err, out)
+	}
+}
+
+func TestAppRun(t *testing.T) {
+	testdata, err := filepath.Abs("../../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "sl-feeds-app.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sl-feeds.toml")
+	conf := fmt.Sprintf("Dest = %q\nRetryDelay = \"1ms\"\n[[Mirrors]]\n  URL = %q\n  Releases = [\"slackware64\"]\n", filepath.Join(dir, "feeds"), "file://"+testdata)
+	if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "feeds"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	feed := filepath.Join(dir, "feeds", "slackware64.rss")
+
+	// the run command, with its flags after it, or before it
+	if _, err := runApp("run", "-c", path, "--dry-run", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(feed); !os.IsNotExist(err) {
+		t.Fatalf("expected no feed written by a --dry-run; got %v", err)
+	}
+	if _, err := runApp("-c", path, "-q", "run", "--force"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(feed); err != nil {
+		t.Fatalf("expected the feed of the run command; got %v", err)
+	}
+
+	// and as it was without a command
+	os.Remove(feed)
+	if _, err := runApp("-c", path, "-q", "--force"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(feed); err != nil {
+		t.Fatalf("expected the feed of a run without a command; got %v", err)
+	}
+
+	// the config may be given after check too
+	if _, err := runApp("check", "-c", path); err != nil {
+		t.Errorf("expected no problems of the config; got %v", err)
+	}
+	if _, err := runApp("-c", filepath.Join(dir, "missing.toml")); err == nil {
+		t.Error("expected an error of a missing config")
+	}
+}
+
+func TestAppRunCron(t *testing.T) {
+	testdata, err := filepath.Abs("../../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeConfig := func(releases string) string {
+		path := filepath.Join(dir, "sl-feeds.toml")
+		conf := fmt.Sprintf("Dest = %q\nRetries = 0\n[[Mirrors]]\n  URL = %q\n  Releases = [%s]\n", dir, "file://"+testdata, releases)
+		if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// nothing at all of a run with no failures, for cron to have nothing to mail
+	path := writeConfig(`"slackware64"`)
+	if out, err := runApp("-c", path, "--cron", "--strict"); err != nil || out != "" {
+		t.Errorf("expected no output of a --cron run; got %v:\n%s", err, out)
+	}
+
+	// the one summary of the failures, and with --strict, the exit status of
+	// some of the releases failing
+	path = writeConfig(`"slackware64", "missing"`)
+	out, err := runApp("-c", path, "--cron", "--force")
+	if err != nil {
+		t.Errorf("expected no error of a partial failure without --strict; got %v", err)
+	}
+	if !strings.HasPrefix(out, "sl-feeds: 1 of 2 feeds failed\n  missing: ") || strings.Contains(out, "slackware64") {
+		t.Errorf("expected only the summary of the failure; got:\n%s", out)
+	}
+	_, err = runApp("-c", path, "--strict", "-q", "--force")
+	if exit, ok := err.(cli.ExitCoder); !ok || exit.ExitCode() != exitPartial {
+		t.Errorf("expected the exit status %d of --strict; got %v", exitPartial, err)
+	}
+}
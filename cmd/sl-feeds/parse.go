@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/util"
+)
+
+var parseCommand = cli.Command{
+	Name:      "parse",
+	Usage:     "Write the feed of a local ChangeLog.txt (or stdin), without any mirror",
+	ArgsUsage: "FILE|-",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "write the feed to `FILE` (default stdout)",
+		},
+		cli.StringFlag{
+			Name:  "link",
+			Usage: "the `URL` the feed and its items link to",
+		},
+		cli.StringFlag{
+			Name:  "title",
+			Value: "ChangeLog.txt",
+			Usage: "the `TITLE` of the feed",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Value: changelog.FormatRss,
+			Usage: fmt.Sprintf("the `FORMAT` of the feed, one of %q", changelog.FormatNames()),
+		},
+		cli.StringFlag{
+			Name:  "granularity",
+			Value: changelog.GranularityEntry,
+			Usage: "`GRANULARITY` of the feed items, either \"entry\" or \"package\"",
+		},
+		cli.StringFlag{
+			Name:  "item-format",
+			Value: changelog.ItemFormatPre,
+			Usage: "the `HTML` of the feed items, one of \"pre\", \"list\" or \"plain\"",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return cli.NewExitError("expected the ChangeLog.txt to parse, or - for stdin", exitConfig)
+		}
+		format, ok := changelog.Formats[c.String("format")]
+		if !ok {
+			return cli.NewExitError(fmt.Sprintf("unknown format %q, expected one of %q", c.String("format"), changelog.FormatNames()), exitConfig)
+		}
+
+		// the mtime of the file is the time of the feed, as the last-modified
+		// is for a mirror
+		var (
+			in    io.Reader = os.Stdin
+			mtime time.Time
+		)
+		if path := c.Args().First(); path != "-" {
+			fh, err := os.Open(path)
+			if err != nil {
+				return cli.NewExitError(err.Error(), exitFetch)
+			}
+			defer fh.Close()
+			stat, err := fh.Stat()
+			if err != nil {
+				return cli.NewExitError(err.Error(), exitFetch)
+			}
+			in, mtime = fh, stat.ModTime()
+		}
+		data, err := renderChangeLog(in, c.String("link"), format, changelog.FeedOptions{
+			Title:       c.String("title"),
+			Granularity: c.String("granularity"),
+			ItemFormat:  c.String("item-format"),
+		})
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitFetch)
+		}
+
+		if out := c.String("output"); out != "" && out != "-" {
+			err = util.WriteFileAtomic(out, mtime, func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			})
+		} else {
+			_, err = os.Stdout.Write(data)
+		}
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitWrite)
+		}
+		return nil
+	},
+}
+
+// renderChangeLog parses the ChangeLog from r, and renders its feed in the
+// format
+func renderChangeLog(r io.Reader, link string, format changelog.Format, opts changelog.FeedOptions) ([]byte, error) {
+	entries, err := changelog.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	feed, cats, texts, err := changelog.ToFeedTexts(link, entries, opts)
+	if err != nil {
+		return nil, err
+	}
+	return format.Renderer(changelog.RenderOptions{Categories: cats, Texts: texts})(feed)
+}
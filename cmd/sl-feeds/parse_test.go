@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vbatts/sl-feeds/changelog"
+)
+
+func TestRenderChangeLog(t *testing.T) {
+	fh, err := os.Open("../../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	data, err := renderChangeLog(fh, "http://mirror.example/slackware64", changelog.Formats[changelog.FormatRss], changelog.FeedOptions{Title: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := strings.Count(string(data), "<item>"); items != 52 {
+		t.Errorf("expected %d items; got %d", 52, items)
+	}
+	if !strings.Contains(string(data), "<title>local</title>") || !strings.Contains(string(data), "<link>http://mirror.example/slackware64</link>") {
+		t.Errorf("expected the title and link of the flags; got %.300s", data)
+	}
+}
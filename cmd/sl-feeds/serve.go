@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/feedsync"
+	"github.com/vbatts/sl-feeds/internal/cliutil"
+)
+
+var serveCommand = cli.Command{
+	Name:  "serve",
+	Usage: "Serve the feeds in the dest directory over HTTP, with an index of them",
+	Flags: []cli.Flag{
+		configFlag,
+		destFlag,
+		cli.StringFlag{
+			Name:  "listen",
+			Value: ":8080",
+			Usage: "serve on `ADDR`",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		c := cliutil.Flags{Context: ctx}
+		dest := c.String("dest")
+		if dest == "" && c.String("config") != "" {
+			config, _, err := feedsync.LoadConfig(c.String("config"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), exitConfig)
+			}
+			dest = config.Dest
+			if _, _, ok := config.S3Dest(); ok {
+				return cli.NewExitError(fmt.Sprintf("the feeds of Dest %q are served by the object storage, not by serve", dest), exitConfig)
+			}
+		}
+		if dest == "" {
+			return cli.NewExitError("no dest directory to serve, set --dest or the Dest of the --config", exitConfig)
+		}
+		l, err := net.Listen("tcp", c.String("listen"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), exitConfig)
+		}
+		dest = os.ExpandEnv(dest)
+		log.Printf("serving %q on %s", dest, l.Addr())
+		return http.Serve(l, feedServer{dest: dest})
+	},
+}
+
+// feedServer serves the feeds written to the dest directory (and their
+// signatures, their gzip copies, and the indexes), with an index of them at
+// "/". Nothing else in the directory, like the state, the cache and the
+// backups, is served.
+type feedServer struct {
+	dest string
+}
+
+// contentType is the media type of the file name, and its Content-Encoding
+// for a gzip copy, and false when it is not a file to be served
+func (s feedServer) contentType(name string) (ctype, encoding string, ok bool) {
+	if strings.HasPrefix(name, ".") || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	switch name {
+	case feedsync.OPMLName:
+		return "text/x-opml", "", true
+	case feedsync.HTMLIndexName:
+		return "text/html; charset=utf-8", "", true
+	}
+	if file := strings.TrimSuffix(name, feedsync.GzExt); file != name {
+		if ctype, encoding, ok := s.contentType(file); ok && encoding == "" {
+			return ctype, "gzip", true
+		}
+		return "", "", false
+	}
+	if feed := strings.TrimSuffix(name, feedsync.SigExt); feed != name {
+		if _, encoding, ok := s.contentType(feed); ok && encoding == "" {
+			return "application/pgp-signature", "", true
+		}
+		return "", "", false
+	}
+	for _, f := range changelog.Formats {
+		if strings.HasSuffix(name, f.Ext) {
+			if f.ContentType == "" {
+				return "application/octet-stream", "", true
+			}
+			return f.ContentType, "", true
+		}
+	}
+	return "", "", false
+}
+
+func (s feedServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean(req.URL.Path), "/")
+	if name == "" {
+		s.serveIndex(w, req)
+		return
+	}
+	ctype, encoding, ok := s.contentType(name)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	fh, err := os.Open(filepath.Join(s.dest, name))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer fh.Close()
+	stat, err := fh.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	// with the Last-Modified of the feed, and a 304 for an If-Modified-Since
+	// that is not older
+	http.ServeContent(w, req, name, stat.ModTime(), fh)
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>sl-feeds</title></head>
+<body>
+<h1>Slackware ChangeLog feeds</h1>
+<ul>
+{{- range .}}
+<li><a href="{{.Name}}">{{.Name}}</a> (updated {{.ModTime.UTC.Format "2006-01-02 15:04 MST"}})</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// serveIndex is a page linking each of the feeds, sorted by name
+func (s feedServer) serveIndex(w http.ResponseWriter, req *http.Request) {
+	infos, err := ioutil.ReadDir(s.dest)
+	if err != nil {
+		http.Error(w, "no feeds to serve", http.StatusInternalServerError)
+		return
+	}
+	feeds := []os.FileInfo{}
+	for _, info := range infos {
+		ctype, encoding, ok := s.contentType(info.Name())
+		if !ok || info.IsDir() || ctype == "application/pgp-signature" || encoding != "" || info.Name() == feedsync.OPMLName || info.Name() == feedsync.HTMLIndexName {
+			continue
+		}
+		feeds = append(feeds, info)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, feeds); err != nil {
+		log.Printf("index of %q: %v", s.dest, err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/feedsync"
+)
+
+func TestFeedServer(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2017, time.January, 23, 4, 5, 6, 0, time.UTC)
+	for _, name := range []string{"slackware64.rss", "slackware64.rss.asc", "slackware64.atom", "slackware64.rss" + ".bak", ".sl-feeds-state.json", feedsync.OPMLName, feedsync.HTMLIndexName, "slackware64.rss" + feedsync.GzExt, ".sl-feeds-state.json" + feedsync.GzExt} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := feedServer{dest: dir}
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		s.ServeHTTP(w, req)
+		return w
+	}
+	for path, ctype := range map[string]string{
+		"/slackware64.rss":           "application/rss+xml",
+		"/slackware64.atom":          "application/atom+xml",
+		"/slackware64.rss.asc":       "application/pgp-signature",
+		"/" + feedsync.OPMLName:      "text/x-opml",
+		"/" + feedsync.HTMLIndexName: "text/html; charset=utf-8",
+		"/slackware64.rss.gz":        "application/rss+xml",
+	} {
+		w := get(path, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != ctype {
+			t.Errorf("%s: expected %d of %s; got %d of %s", path, http.StatusOK, ctype, w.Code, w.Header().Get("Content-Type"))
+		}
+		if encoding := w.Header().Get("Content-Encoding"); (encoding == "gzip") != strings.HasSuffix(path, feedsync.GzExt) {
+			t.Errorf("%s: expected the Content-Encoding of only a gzip copy; got %q", path, encoding)
+		}
+		if lm := w.Header().Get("Last-Modified"); lm != mtime.Format(http.TimeFormat) {
+			t.Errorf("%s: expected the mtime as the Last-Modified; got %q", path, lm)
+		}
+	}
+	if w := get("/slackware64.rss", http.Header{"If-Modified-Since": {mtime.Format(http.TimeFormat)}}); w.Code != http.StatusNotModified {
+		t.Errorf("expected %d for an If-Modified-Since of the mtime; got %d", http.StatusNotModified, w.Code)
+	}
+	if w := get("/slackware64.rss", http.Header{"If-Modified-Since": {mtime.Add(-time.Hour).Format(http.TimeFormat)}}); w.Code != http.StatusOK {
+		t.Errorf("expected %d for an older If-Modified-Since; got %d", http.StatusOK, w.Code)
+	}
+	for _, path := range []string{"/" + ".sl-feeds-state.json", "/slackware64.rss" + ".bak", "/missing.rss", "/../slackware64.rss/x.rss", "/.sl-feeds-state.json" + feedsync.GzExt} {
+		if w := get(path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected %d; got %d", path, http.StatusNotFound, w.Code)
+		}
+	}
+
+	w := get("/", nil)
+	index := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(index, `href="slackware64.rss"`) || !strings.Contains(index, `href="slackware64.atom"`) {
+		t.Errorf("expected the index to link the feeds; got %d %s", w.Code, index)
+	}
+	if strings.Contains(index, ".sl-feeds-state.json") || strings.Contains(index, feedsync.SigExt) || strings.Contains(index, ".bak") || strings.Contains(index, feedsync.GzExt) || strings.Contains(index, feedsync.HTMLIndexName) {
+		t.Errorf("expected only the feeds in the index; got %s", index)
+	}
+}
@@ -0,0 +1,141 @@
+package feedsync
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// backupExt is appended to the name of a feed for its last-known-good copy
+const backupExt = ".bak"
+
+// backup copies the current path (and its signature, if any) to the backup
+// name. A missing path has nothing to back up.
+func backup(path string) error {
+	for _, p := range []string{path, path + SigExt} {
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		if err := util.CopyFileAtomic(p, p+backupExt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errNoBackup is when there is no last-known-good copy to restore
+var errNoBackup = errors.New("no backup to restore")
+
+// restore puts the backup of path (and its signature, if any) back in place
+func restore(path string) error {
+	if _, err := os.Stat(path + backupExt); os.IsNotExist(err) {
+		return errNoBackup
+	}
+	for _, p := range []string{path, path + SigExt} {
+		if _, err := os.Stat(p + backupExt); os.IsNotExist(err) {
+			continue
+		}
+		if err := util.CopyFileAtomic(p+backupExt, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validators check the written files of the formats, by their extension
+var validators = map[string]func(path string) error{
+	".rss":  validateRss,
+	".atom": validateAtom,
+	".json": validateJSONFeed,
+}
+
+// validate checks the written file at path, if there is a validator for its
+// format
+func validate(path string) error {
+	if v, ok := validators[filepath.Ext(path)]; ok {
+		return v(path)
+	}
+	return nil
+}
+
+// validateRss checks that the file at path is well-formed RSS, with a channel
+func validateRss(path string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var doc struct {
+		XMLName xml.Name
+		Channel *struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Guid string `xml:"guid"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.NewDecoder(fh).Decode(&doc); err != nil {
+		return fmt.Errorf("%q is not well-formed: %v", path, err)
+	}
+	if doc.XMLName.Local != "rss" {
+		return fmt.Errorf("%q is not RSS, but %q", path, doc.XMLName.Local)
+	}
+	if doc.Channel == nil {
+		return fmt.Errorf("%q has no channel", path)
+	}
+	return nil
+}
+
+// validateJSONFeed checks that the file at path is a JSON Feed, with items
+func validateJSONFeed(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Version string        `json:"version"`
+		Items   []interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%q is not well-formed: %v", path, err)
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return fmt.Errorf("%q is not a JSON Feed, with version %q", path, doc.Version)
+	}
+	if doc.Items == nil {
+		return fmt.Errorf("%q has no items", path)
+	}
+	return nil
+}
+
+// validateAtom checks that the file at path is well-formed Atom, with an id
+func validateAtom(path string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var doc struct {
+		XMLName xml.Name
+		ID      string `xml:"id"`
+	}
+	if err := xml.NewDecoder(fh).Decode(&doc); err != nil {
+		return fmt.Errorf("%q is not well-formed: %v", path, err)
+	}
+	if doc.XMLName.Local != "feed" || doc.XMLName.Space != "http://www.w3.org/2005/Atom" {
+		return fmt.Errorf("%q is not Atom, but %q", path, doc.XMLName.Local)
+	}
+	if doc.ID == "" {
+		return fmt.Errorf("%q has no id", path)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package feedsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-backup.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "slackware64-current.rss")
+	good := `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>ChangeLog.txt for slackware64-current</title></channel></rss>`
+	bad := `<rss version="2.0"><channel><title>truncated`
+
+	if err := restore(path); err != errNoBackup {
+		t.Errorf("expected %v; got %v", errNoBackup, err)
+	}
+	// nothing to back up yet
+	if err := backup(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(good), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateRss(path); err != nil {
+		t.Errorf("expected valid RSS; got %v", err)
+	}
+	if err := backup(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateRss(path); err == nil {
+		t.Error("expected the truncated RSS to not validate")
+	}
+	if err := restore(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != good {
+		t.Errorf("expected the restored feed to be %q; got %q", good, string(data))
+	}
+
+	atom := filepath.Join(dir, "not-rss.rss")
+	if err := ioutil.WriteFile(atom, []byte(`<feed xmlns="http://www.w3.org/2005/Atom"></feed>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateRss(atom); err == nil {
+		t.Error("expected a non-RSS document to not validate")
+	}
+}
@@ -0,0 +1,59 @@
+package feedsync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// cacheDirName is the directory kept in the dest directory, with the last
+// fetched ChangeLog.txt of each feed (as "$name/ChangeLog.txt") for --offline
+const cacheDirName = ".sl-feeds-cache"
+
+// writeCache keeps the fetched ChangeLog data of the feed name, with its
+// last-modified as the mtime
+func writeCache(dest, name string, data []byte, mtime time.Time) error {
+	path := filepath.Join(dest, cacheDirName, name, "ChangeLog.txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, mtime, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// readCache is the cached ChangeLog data of the feed name
+func readCache(dest, name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(dest, cacheDirName, name, "ChangeLog.txt"))
+}
+
+// removeCache removes the cached ChangeLog of the feed name, as when it is
+// older than the one read short of its end
+func removeCache(dest, name string) error {
+	err := os.Remove(filepath.Join(dest, cacheDirName, name, "ChangeLog.txt"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// cachedRepo reads the cached ChangeLog of a feed
+func cachedRepo(dest, name string) fetch.Repo {
+	return fetch.Repo{URL: "file://" + filepath.Join(dest, cacheDirName), Release: name}
+}
+
+// cachedError is a readable error for a feed with nothing cached
+func cachedError(name string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no cached ChangeLog for %s (it must be fetched once without --offline)", name)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package feedsync
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// Check is every problem with the config, that is its Problems stopping a run
+// and those only found once it is under way: the Dest, and the URLs of the
+// mirrors
+func (c Config) Check() []string {
+	probs := c.Problems()
+	if _, _, remote := c.S3Dest(); !remote || c.WorkDir != "" {
+		if err := checkDest(c.LocalDest()); err != nil {
+			probs = append(probs, err.Error())
+		}
+	}
+	if len(c.Mirrors) == 0 {
+		probs = append(probs, "no Mirrors")
+	}
+
+	for _, m := range c.Mirrors {
+		if len(m.urls()) == 0 {
+			probs = append(probs, fmt.Sprintf("mirror %q: no URL", m.name()))
+		}
+		for _, u := range m.urls() {
+			if err := CheckMirrorURL(u); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+			}
+		}
+	}
+	return probs
+}
+
+// checkDest is the problem (if any) with writing the feeds to dest, which is
+// to be a directory, or to be creatable as one
+func checkDest(dest string) error {
+	if dest == "" {
+		return errors.New("no Dest")
+	}
+	for p := filepath.Clean(dest); ; p = filepath.Dir(p) {
+		info, err := os.Stat(p)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("Dest %q: %q is not a directory", dest, p)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Dest %q: %v", dest, err)
+		}
+		if filepath.Dir(p) == p {
+			return fmt.Errorf("Dest %q: can not be created", dest)
+		}
+	}
+}
+
+// CheckMirrorURL is the problem (if any) with the URL of a mirror, which is
+// to be one fetch can get a ChangeLog from
+func CheckMirrorURL(u string) error {
+	if _, _, ok := fetch.SplitUnixURL(u); ok {
+		return nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("invalid URL %q, with no host", u)
+		}
+	case "file", "iso":
+		if parsed.Path == "" {
+			return fmt.Errorf("invalid URL %q, with no path", u)
+		}
+	default:
+		return fmt.Errorf("invalid URL %q, expected an http://, https://, http+unix://, file:// or iso:// URL", u)
+	}
+	return nil
+}
+
+// Probe is a problem for each release of an enabled mirror that has no
+// ChangeLog.txt at any of the mirror URLs
+func (r Syncer) Probe() []string {
+	probs := []string{}
+	for _, m := range r.Config.Mirrors {
+		if !m.enabled() {
+			continue
+		}
+		for _, u := range m.urls() {
+			at := ""
+			if len(m.urls()) > 1 {
+				at = fmt.Sprintf(" at %q", u)
+			}
+			for _, rel := range m.releases() {
+				res := ReleaseResult{Name: m.feedName(rel), Mirror: m.name()}
+				repo, err := r.mirrorRepo(m.withURL(u), rel.Name, &res)
+				if err != nil {
+					probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+					break
+				}
+				ok, err := repo.HasChangeLog()
+				switch {
+				case err != nil:
+					probs = append(probs, fmt.Sprintf("mirror %q%s: release %q: %v", m.name(), at, rel.Name, err))
+				case !ok:
+					probs = append(probs, fmt.Sprintf("mirror %q%s: release %q: no ChangeLog.txt", m.name(), at, rel.Name))
+				}
+			}
+		}
+	}
+	return probs
+}
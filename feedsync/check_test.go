@@ -0,0 +1,88 @@
+package feedsync
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-check.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{"ok", Config{Dest: filepath.Join(dir, "feeds", "new"), Mirrors: []Mirror{
+			{URL: "http://slackware.osuosl.org/", Releases: []string{"slackware64-current"}},
+			{URL: "http+unix:///run/mirror.sock:/slackware/", Releases: []string{"slackware64-15.0"}},
+			{URL: "file:///archive/slackware", Prefix: "archive-", Releases: []string{"slackware64-current"}},
+			{URL: "http://disabled.example/", Enabled: new(bool), Releases: []string{"slackware64-current"}},
+		}}, nil},
+		{"no dest or mirrors", Config{}, []string{"no Dest", "no Mirrors"}},
+		{"dest under a file", Config{Dest: filepath.Join(file, "feeds"), Mirrors: []Mirror{
+			{URL: "http://slackware.osuosl.org/", Releases: []string{"slackware64-current"}},
+		}}, []string{"not a directory"}},
+		{"bad URLs", Config{Dest: dir, Mirrors: []Mirror{
+			{Name: "typo", URL: "htp://slackware.osuosl.org/", Releases: []string{"slackware64-current"}},
+			{Name: "no host", URL: "http:///slackware/", Prefix: "a-", Releases: []string{"slackware64-current"}},
+			{Name: "none", Prefix: "b-", Releases: []string{"slackware64-current"}},
+		}}, []string{`mirror "typo": invalid URL`, `mirror "no host": invalid URL`, `mirror "none": no URL`}},
+		{"same feed", Config{Dest: dir, Mirrors: []Mirror{
+			{Name: "a", URL: "http://a.example/", Releases: []string{"slackware64-current"}},
+			{Name: "b", URL: "http://b.example/", Releases: []string{"slackware64-current"}},
+		}}, []string{`release "slackware64-current" of mirror "b": "slackware64-current.rss" is also written by the release "slackware64-current" of mirror "a"`}},
+		{"same feed as a security one", Config{Dest: dir, SecurityFeeds: true, Mirrors: []Mirror{
+			{Name: "a", URL: "http://a.example/", Releases: []string{"slackware64-current"}},
+			{Name: "b", URL: "http://b.example/", Prefix: "slackware64-current-", Releases: []string{"security"}},
+		}}, []string{`"slackware64-current-security.rss" is also written`}},
+		{"same rendered feed", Config{Dest: dir, Mirrors: []Mirror{
+			{Name: "a", URL: "http://a.example/", Releases: []string{"slackware64-current"}, FilenameTemplate: "{{slice .Release 9}}-changes.{{.Format}}"},
+			{Name: "b", URL: "http://b.example/", Prefix: "b-", Releases: []string{"64-current"}, FilenameTemplate: "{{.Release}}-changes.{{.Format}}"},
+		}}, []string{`"64-current-changes.rss" is also written by the release "slackware64-current" of mirror "a"`}},
+		{"same file for each format", Config{Dest: dir, Formats: []string{"rss", "atom"}, FilenameTemplate: "{{.Release}}.xml", Mirrors: []Mirror{
+			{Name: "a", URL: "http://a.example/", Releases: []string{"slackware64-current"}},
+		}}, []string{`"slackware64-current.xml" is written for more than one feed or format`}},
+	}
+	for _, c := range cases {
+		probs := c.config.Check()
+		if len(probs) != len(c.expected) {
+			t.Errorf("%s: expected %d problems; got %q", c.name, len(c.expected), probs)
+			continue
+		}
+		for i, p := range probs {
+			if !strings.Contains(p, c.expected[i]) {
+				t.Errorf("%s: expected %q; got %q", c.name, c.expected[i], p)
+			}
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{Name: "test", URL: server.URL, Releases: []string{"slackware64", "slackwre64"}})
+	defer cleanup()
+	probs := r.Probe()
+	expected := `mirror "test": release "slackwre64": no ChangeLog.txt`
+	if len(probs) != 1 || probs[0] != expected {
+		t.Errorf("expected %q; got %q", expected, probs)
+	}
+	if files, _ := ioutil.ReadDir(r.Dest); len(files) > 0 {
+		t.Errorf("expected nothing written; got %d files", len(files))
+	}
+}
@@ -0,0 +1,85 @@
+package feedsync
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// mirrorClient is the client for the requests to m (the Client, when set), or
+// nil for the default client when there is nothing to override
+func (r Syncer) mirrorClient(m Mirror) (*http.Client, error) {
+	if r.Client != nil {
+		return r.Client, nil
+	}
+	tlsConfig, err := mirrorTLSConfig(r.TLSConfig, m)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := parseProxy(r.Config.proxy(m))
+	if err != nil {
+		return nil, err
+	}
+	opts := fetch.ClientOptions{DialContext: r.DialContext, ServerName: m.ServerName, TLSConfig: tlsConfig, Proxy: proxy, NoRedirects: r.NoRedirects}
+	if socket, _, ok := fetch.SplitUnixURL(m.URL); ok {
+		opts.UnixSocket = socket
+	}
+	if m.ConnectTo != "" {
+		dial := opts.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		opts.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, network, m.ConnectTo)
+		}
+	}
+	if opts.DialContext == nil && opts.UnixSocket == "" && opts.ServerName == "" && opts.TLSConfig == nil && opts.Proxy == nil && !opts.NoRedirects {
+		return nil, nil
+	}
+	return fetch.NewClient(opts), nil
+}
+
+// mirrorTLSConfig is the TLS settings of the global flags (base, which may be
+// nil), with those of m in place of them
+func mirrorTLSConfig(base *tls.Config, m Mirror) (*tls.Config, error) {
+	if m.CA == "" && m.Insecure == nil && m.ClientCert == "" {
+		return base, nil
+	}
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	if m.Insecure != nil {
+		config.InsecureSkipVerify = *m.Insecure
+	}
+	if m.CA != "" {
+		pool, _ := x509.SystemCertPool()
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		certs, err := ioutil.ReadFile(os.ExpandEnv(m.CA))
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(certs) {
+			return nil, fmt.Errorf("no certificates in the CA %q", m.CA)
+		}
+		config.RootCAs = pool
+	}
+	if m.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(os.ExpandEnv(m.ClientCert), os.ExpandEnv(m.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
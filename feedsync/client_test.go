@@ -0,0 +1,155 @@
+package feedsync
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorClient(t *testing.T) {
+	if client, err := (Syncer{}).mirrorClient(Mirror{URL: "http://mirror.example/"}); client != nil || err != nil {
+		t.Errorf("expected the default client when nothing is overridden; got %v", err)
+	}
+
+	var host string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host = req.Host
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// trust the certificate of the test server, which is for example.com
+	r := Syncer{TLSConfig: server.Client().Transport.(*http.Transport).TLSClientConfig}
+
+	m := Mirror{URL: "https://mirror.invalid/", ConnectTo: u.Host, ServerName: "example.com"}
+	client, err := r.mirrorClient(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("https://mirror.invalid/slackware64-current/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if host != "mirror.invalid" {
+		t.Errorf("expected the Host header of the URL; got %q", host)
+	}
+	if resp.TLS == nil || resp.TLS.ServerName != "example.com" {
+		t.Errorf("expected to present the ServerName %q; got %+v", "example.com", resp.TLS)
+	}
+}
+
+func TestMirrorClientTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	// the failed handshakes are expected
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sl-feeds-tls.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	certs := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, certs, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(r Syncer, m Mirror) error {
+		m.URL = server.URL
+		client, err := r.mirrorClient(m)
+		if err != nil {
+			return err
+		}
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	yes, no := true, false
+	insecure := Syncer{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+
+	if err := get(Syncer{}, Mirror{}); err == nil {
+		t.Error("expected the certificate of the test server to be untrusted")
+	}
+	if err := get(Syncer{}, Mirror{Insecure: &yes}); err != nil {
+		t.Errorf("expected Insecure to skip the verification; got %v", err)
+	}
+	if err := get(insecure, Mirror{}); err != nil {
+		t.Errorf("expected the --insecure of the Syncer; got %v", err)
+	}
+	if err := get(insecure, Mirror{Insecure: &no}); err == nil {
+		t.Error("expected Insecure = false to override the --insecure of the Syncer")
+	}
+	// the certificate of the test server is for example.com
+	if err := get(Syncer{}, Mirror{CA: ca, ServerName: "example.com"}); err != nil {
+		t.Errorf("expected the CA to be trusted; got %v", err)
+	}
+	if _, err := (Syncer{}).mirrorClient(Mirror{CA: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("expected an error for a missing CA")
+	}
+
+	config := Config{Mirrors: []Mirror{
+		{URL: "https://internal.example/", Releases: []string{"slackware64-current"}, CA: ca},
+		{URL: "https://other.example/", Releases: []string{"slackware64-current"}, Prefix: "other-", CA: filepath.Join(dir, "missing.pem"), ClientCert: ca},
+	}}
+	probs := config.Problems()
+	if len(probs) != 2 || !strings.Contains(probs[0], "ClientCert and ClientKey") || !strings.Contains(probs[1], "CA: stat") {
+		t.Errorf("expected the problems of the second mirror; got %q", probs)
+	}
+}
+
+func TestMirrorClientProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = append(proxied, req.URL.String())
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer direct.Close()
+
+	r := Syncer{Config: Config{Proxy: proxy.URL}}
+	for _, m := range []Mirror{
+		{URL: "http://mirror.invalid/"},
+		{URL: direct.URL + "/", Proxy: "none"},
+	} {
+		client, err := r.mirrorClient(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(m.URL + "slackware64-current/ChangeLog.txt")
+		if err != nil {
+			t.Fatalf("%s: %v", m.URL, err)
+		}
+		resp.Body.Close()
+	}
+	if len(proxied) != 1 || proxied[0] != "http://mirror.invalid/slackware64-current/ChangeLog.txt" {
+		t.Errorf("expected only the first mirror through the proxy; got %q", proxied)
+	}
+
+	config := Config{Proxy: "ftp://proxy.example/", Mirrors: []Mirror{
+		{URL: "http://mirror.example/", Releases: []string{"slackware64-current"}, Proxy: "socks5://127.0.0.1:1080"},
+		{URL: "http://other.example/", Releases: []string{"slackware64-current"}, Prefix: "other-", Proxy: "proxy.example:3128"},
+	}}
+	probs := config.Problems()
+	if len(probs) != 2 || !strings.Contains(probs[0], `invalid Proxy "ftp://proxy.example/"`) || !strings.Contains(probs[1], `mirror "other.example": invalid Proxy`) {
+		t.Errorf("expected the problems of the global and the second mirror Proxy; got %q", probs)
+	}
+}
@@ -0,0 +1,128 @@
+package feedsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// writeCombinedFeed merges the cached entries of every release into the
+// CombinedFeed, returning the names of its files. It takes the time of the
+// newest ChangeLog, and is only rewritten when that is newer than the feed
+// (or --offline).
+func (r Syncer) writeCombinedFeed() ([]string, error) {
+	var (
+		parts    []*feeds.Feed
+		allCats  = changelog.Categories{}
+		allTexts = changelog.Texts{}
+		sources  = changelog.Sources{}
+		mtime    time.Time
+		link     string
+		seen     = map[string]bool{}
+	)
+	for _, mirror := range r.Config.Mirrors {
+		if !mirror.enabled() {
+			continue
+		}
+		for _, rel := range mirror.releases() {
+			name := mirror.feedName(rel)
+			entries, modTime, err := cachedRepo(r.Dest, name).ChangeLog()
+			if errors.Is(err, os.ErrNotExist) {
+				// not fetched yet
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			if modTime.After(mtime) {
+				mtime = modTime
+			}
+
+			// an entry that is the same in releases of the same mirror, like
+			// for both slackware and slackware64, is only in the feed once
+			unique := []changelog.Entry{}
+			for _, e := range changelog.FilterPackages(entries, mirror.IncludePackages, mirror.ExcludePackages) {
+				key := mirror.name() + "\n" + e.ToChangeLog()
+				if !seen[key] {
+					seen[key] = true
+					unique = append(unique, e)
+				}
+			}
+			unique = changelog.LimitEntries(unique, 0, r.Config.MaxAge.Duration, time.Now())
+
+			opts := changelog.FeedOptions{
+				Granularity: r.Config.granularity(mirror),
+				ItemFormat:  r.Config.itemFormat(mirror),
+				Reflow:      r.Config.reflow(mirror),
+				Release:     rel.Name,
+				ItemLink:    r.Config.itemLink(mirror, rel),
+			}
+			opts.MassRebuildThreshold, opts.MassRebuildShow = r.Config.massRebuild(mirror)
+			relLink := fetch.JoinURL(mirror.publicURL(), rel.Name)
+			feed, cats, texts, err := changelog.ToFeedTexts(relLink, unique, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			// always, for readers to tell the releases apart
+			source := &changelog.Source{Name: name, URL: relLink}
+			for _, item := range feed.Items {
+				sources[item] = source
+				item.Title = strings.TrimSpace(fmt.Sprintf("[%s] %s", name, item.Title))
+				if len(cats[item]) > 0 {
+					allCats[item] = cats[item]
+				}
+				allTexts[item] = texts[item]
+			}
+			parts = append(parts, feed)
+			if link == "" {
+				link = mirror.publicURL()
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	names := []string{}
+	current := !r.Offline
+	for _, f := range r.Config.formats(Mirror{}, Release{}) {
+		name := r.Config.CombinedFeed + changelog.Formats[f].Ext
+		names = append(names, name)
+		if r.Signer != nil {
+			names = append(names, name+SigExt)
+		}
+		if r.Config.CompressOutput {
+			names = append(names, name+GzExt)
+		}
+		if modTime, err := r.publisher().Stat(name); err != nil || modTime.Before(mtime) {
+			current = false
+		}
+	}
+	if current {
+		return names, nil
+	}
+
+	combined := changelog.MergeFeeds("ChangeLog.txt for "+r.Config.CombinedFeed, link, parts, r.Config.MaxItems)
+	if name, email, _ := parseAuthor(r.Config.Author); name != "" || email != "" {
+		combined.Author = &feeds.Author{Name: name, Email: email}
+	}
+	for _, f := range r.Config.formats(Mirror{}, Release{}) {
+		format := changelog.Formats[f]
+		render := r.Config.renderOptions(r.Config.CombinedFeed + format.Ext)
+		render.Categories, render.Texts, render.Sources, render.Indent = allCats, allTexts, sources, r.Config.Indent
+		data, _, err := changelog.RenderMaxBytes(combined, r.Config.MaxFeedBytes, format.Renderer(render))
+		if err != nil {
+			return nil, err
+		}
+		if err := r.writeOutput(r.Config.CombinedFeed+format.Ext, data, mtime); err != nil {
+			return nil, WriteError{err}
+		}
+	}
+	r.Infof(LogFields{Action: "combine"}, "%s: combined %d items of %d releases", r.Config.CombinedFeed, len(combined.Items), len(parts))
+	return names, nil
+}
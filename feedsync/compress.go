@@ -0,0 +1,39 @@
+package feedsync
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// GzExt is appended to the name of a generated file for its gzip compressed
+// copy, as served by a web server for clients that accept gzip (like nginx
+// gzip_static)
+const GzExt = ".gz"
+
+// writeCompressed publishes data, compressed as best it can be, as name with
+// GzExt and the same mtime as name, with CompressOutput. When that fails, any
+// previous copy is removed.
+func (r Syncer) writeCompressed(name string, data []byte, mtime time.Time) error {
+	if !r.Config.CompressOutput {
+		return nil
+	}
+	err := r.publishFile(name+GzExt, mtime, func(w io.Writer) error {
+		zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		zw.Name, zw.ModTime = filepath.Base(name), mtime
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+	if err != nil {
+		r.publisher().Remove(name + GzExt)
+		return fmt.Errorf("compressing %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package feedsync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCompressOutput(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.CompressOutput = true
+	if results := r.pass(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results %#v", results)
+	}
+
+	path := filepath.Join(r.Dest, "slackware64.rss")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := os.Open(path + GzExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	zr, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, uncompressed) {
+		t.Error("expected the compressed copy to be of the feed")
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstat, err := fh.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !zstat.ModTime().Equal(stat.ModTime()) {
+		t.Errorf("expected the mtime of the feed %s; got %s", stat.ModTime(), zstat.ModTime())
+	}
+
+	// a copy that can not be written is not left behind
+	if err := os.Remove(path + GzExt); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path+GzExt, 0755); err != nil {
+		t.Fatal(err)
+	}
+	r.Force = true
+	if results := r.pass(); results[0].Err == nil {
+		t.Error("expected the failed compression to be an error")
+	}
+	if _, err := os.Stat(path + GzExt); !os.IsNotExist(err) {
+		t.Errorf("expected no compressed copy; got %v", err)
+	}
+}
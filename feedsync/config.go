@@ -0,0 +1,1394 @@
+package feedsync
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/ftp"
+	"github.com/vbatts/sl-feeds/internal/cliutil"
+)
+
+// LoadConfig reads the TOML configuration at path. The warnings are keys in
+// the file that do not apply to any setting (like a misspelling).
+func LoadConfig(path string) (config Config, warnings []string, err error) {
+	warnings, err = cliutil.DecodeTOMLFile(path, &config)
+	if err != nil {
+		return config, nil, err
+	}
+	for i, m := range config.Mirrors {
+		config.Mirrors[i] = m.WithoutUserinfo()
+	}
+	return config, warnings, nil
+}
+
+// Config is read in to point to where RSS are written to, and the Mirrors to
+// be fetched from
+type Config struct {
+	Quiet bool
+	// Dest is the directory the feeds are written to, or an
+	// s3://bucket/prefix they are published to (with the S3 settings)
+	Dest    string
+	Mirrors []Mirror
+	// WorkDir is the local directory of the state, cache and lock, for a Dest
+	// that is not one
+	WorkDir string
+	// S3 are the settings of an s3:// Dest, which otherwise come from the
+	// environment ($AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY,
+	// $AWS_SESSION_TOKEN, $AWS_REGION and $AWS_ENDPOINT_URL)
+	S3 *S3
+	// LockFile is the file locked by a run, for another run not to overlap it
+	// (default .sl-feeds.lock in Dest)
+	LockFile string
+
+	// Jobs is how many releases are processed at once (default 4)
+	Jobs int
+	// Interval is how often --daemon processes the releases without a
+	// Schedule or Every of their own (default "30m", or the --interval)
+	Interval Duration
+
+	// ExtraDests each get a copy of the feeds written to Dest
+	ExtraDests []string
+	// OnUpdate are commands (run by sh -c) run after a feed is written with
+	// new entries, like to rebuild a site or notify a chat. See runHooks for
+	// what they are given.
+	OnUpdate []string
+	// Webhooks are URLs POSTed the new entries of a feed as JSON (see
+	// webhookPayload), signed with an HMAC-SHA256 by the WebhookSecret, when
+	// set
+	Webhooks      []string
+	WebhookSecret string
+	// FTPUpload, when set, is an FTP server the changed feeds are uploaded to
+	FTPUpload *FTPUpload
+
+	// Watch are the packages that get feeds of their own
+	Watch []Watch
+
+	// SignOutput writes a detached armored signature (.asc) for each
+	// generated file, using the unencrypted private key in SigningKey
+	SignOutput bool
+	SigningKey string
+	// CompressOutput writes a gzip compressed copy (.gz) of each generated
+	// feed, with the same mtime
+	CompressOutput bool
+	// Prune removes the files written for the feeds no longer of the config
+	// (as when a release or a mirror is removed from it), after a run with no
+	// failures
+	Prune bool
+
+	// Granularity of the feed items, either "entry" (default) or "package"
+	Granularity string
+	// SortOrder of the feed items, either "desc" (newest first, default) or "asc"
+	SortOrder string
+	// ItemFormat is the HTML of the item descriptions: "pre" (the ChangeLog
+	// text, default), "list" (the packages as a list) or "plain" (the text,
+	// unescaped, as before)
+	ItemFormat string
+	// TitleTemplate and Description are text/templates for the title and
+	// description of each feed, given {{.Release}}, {{.Prefix}} and
+	// {{.MirrorURL}}. The title is by default
+	// "ChangeLog.txt for {{.Prefix}}{{.Release}}".
+	TitleTemplate string
+	Description   string
+	// Author of the feeds, as a name, an email, or "Name <email>"
+	Author string
+	// LinkTemplate is a text/template for each item link, like to a ChangeLog
+	// web viewer, given the entry {{.Date}}, the {{.Package}} (for the
+	// "package" Granularity) and the release {{.Link}}, as well as what the
+	// TitleTemplate has. By default items link to their entry in the
+	// ChangeLog.txt.
+	LinkTemplate string
+	// FilenameTemplate is a text/template for each feed file name, given
+	// {{.Prefix}}, {{.Release}} (with any "/" as "-", and the suffix of a
+	// security or watched feed) and {{.Format}}. It is by default
+	// "{{.Prefix}}{{.Release}}.{{.Format}}".
+	FilenameTemplate string
+	// Formats are the outputs written for each release, like ["rss"] (the
+	// default)
+	Formats []string
+	// Reflow joins the hard-wrapped lines of the prose in the item
+	// descriptions, for readers with proportional fonts
+	Reflow bool
+	// Indent writes the feeds indented, with a line for each line of the
+	// item descriptions, so that diffs of them (like in git) show just the
+	// items that changed
+	Indent bool
+	// EmitSource writes the mirror each item is from as its <source>, for
+	// readers of feeds aggregating several
+	EmitSource bool
+	// SecurityFeeds also writes a feed of only the entries with a security
+	// fix for each release, as $prefix$release-security.rss
+	SecurityFeeds bool
+	// CombinedFeed, when set, is the name of one more feed, of the entries of
+	// every release merged (newest first, with each item titled with its
+	// release), as "$CombinedFeed.rss"
+	CombinedFeed string
+	// OPML writes an index.opml to the dest directory, listing every feed of
+	// the config for subscribing to them all at once, with their URLs under
+	// BaseURL (the public URL of the dest directory)
+	OPML    bool
+	BaseURL string
+	// TTL, when set, is the <ttl> of the RSS feeds (rounded up to minutes),
+	// for readers to not fetch them again any sooner
+	TTL Duration
+	// Language is that of the feeds (default DefaultLanguage, as that of the
+	// ChangeLogs)
+	Language string
+	// HTMLIndex writes an index.html to the dest directory, linking each of
+	// the feeds with its title and when it was last updated, from the
+	// IndexTemplate (an html/template, executed with the feeds) when set
+	HTMLIndex     bool
+	IndexTemplate string
+
+	// MassRebuildThreshold is the count of updates above which an entry is
+	// tagged as a mass rebuild (default 100, -1 to turn off)
+	MassRebuildThreshold int
+	// MassRebuildShow is how many updates of a mass rebuild are listed in its
+	// feed item (default 20, -1 to list them all)
+	MassRebuildShow int
+
+	// WarnUnparsedPercent warns when more than this percentage of the lines
+	// of a ChangeLog were not recognized, like when its format has changed.
+	// 0 never warns.
+	WarnUnparsedPercent float64
+
+	// StaleAfter warns when the newest entry of a feed is older than this,
+	// like "30d", as when the mirror path is no longer updated. 0 never
+	// warns.
+	StaleAfter Duration
+	// StaleFactor warns when the newest entry of a feed is older than this
+	// many times the longest gap between its entries so far. 0 never warns.
+	StaleFactor float64
+
+	// MaxFeedBytes drops the oldest items of a feed until it fits this many
+	// bytes (but always keeping at least one item). 0 is no limit.
+	MaxFeedBytes int
+	// MaxItems keeps only this many of the newest entries in a feed, and
+	// MaxAge only those newer than this, like "90d". 0 is no limit.
+	MaxItems int
+	MaxAge   Duration
+	// ShortRead stops reading a ChangeLog once it has the MaxItems newest
+	// entries, or at its first entry older than the MinDate, for mirrors
+	// that list them newest first. A ChangeLog read short is not cached (for
+	// --offline) nor checksummed, so this is false by default.
+	ShortRead bool
+	// MinDate drops the entries older than this from a feed as it is first
+	// written, either a time (RFC 3339) or how long before then, like "30d",
+	// so that a new feed does not start with the whole history of its
+	// ChangeLog. The feed keeps that cutoff from then on.
+	MinDate string
+	// PreserveItems keeps the items of a feed (as written before, in RSS)
+	// that are no longer of its ChangeLog, after the newer ones and up to the
+	// MaxItems, so that the feed loses them gradually
+	PreserveItems bool
+
+	// Retries is how many times a request is tried again after a connection
+	// error or a 5xx response (default 2, -1 to never retry)
+	Retries int
+	// RetryDelay is the wait before the first retry, doubling for each
+	// further one (default "1s")
+	RetryDelay Duration
+	// Timeout is the longest a request may take, including reading the whole
+	// of the ChangeLog (default "5m")
+	Timeout Duration
+	// Proxy is the URL (http://, https:// or socks5://) of the proxy for the
+	// requests to the mirrors, or "none" for connecting directly. When not
+	// set, it is from $HTTP_PROXY, $HTTPS_PROXY and $NO_PROXY.
+	Proxy string
+	// MetricsFile is where the prometheus metrics of each run are written,
+	// like for the textfile collector of node_exporter (or --metrics-file)
+	MetricsFile string
+
+	// UserAgent is the User-Agent of the requests to the mirrors (default
+	// "sl-feeds/<version> (+https://github.com/vbatts/sl-feeds)")
+	UserAgent string
+	// RequestDelay is the least time between the requests to one host, and
+	// MaxPerHost how many may be made to it at once (0 for no limit). The
+	// requests to other hosts do not wait on them.
+	RequestDelay Duration
+	MaxPerHost   int
+	// TailFetch fetches only the start of a ChangeLog that has changed, with
+	// a Range request, for its new entries, splicing them onto the ChangeLog
+	// last fetched (as cached). The whole of it is fetched when that can not
+	// be done. This is new, so it is false by default.
+	TailFetch bool
+
+	// BackoffAfter is how many runs in a row a mirror may fail entirely,
+	// before it is backed off from. 0 never backs off.
+	BackoffAfter int
+	// BackoffBase is the first backoff wait, doubling for each further
+	// failure (default "30m")
+	BackoffBase Duration
+	// BackoffMax is the longest backoff wait (default "24h")
+	BackoffMax Duration
+}
+
+// Duration is a time.Duration in the config, like "30m"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses the duration for the TOML decoder
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = parseDuration(string(text))
+	return err
+}
+
+// parseDuration is time.ParseDuration, also allowing a count of days first,
+// like "30d" or "1d12h"
+func parseDuration(s string) (time.Duration, error) {
+	if i := strings.Index(s, "d"); i > 0 {
+		if days, err := strconv.Atoi(s[:i]); err == nil {
+			d := time.Duration(days) * 24 * time.Hour
+			if rest := s[i+1:]; rest != "" {
+				r, err := time.ParseDuration(rest)
+				if err != nil {
+					return 0, fmt.Errorf("time: invalid duration %q", s)
+				}
+				d += r
+			}
+			return d, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// MarshalText formats the duration for the TOML encoder
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// ParseMinDate is the cutoff of a MinDate (or --since) as of now: either a
+// time (RFC 3339), or a duration before now like "30d"
+func ParseMinDate(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither a time (RFC 3339) nor a duration (like \"30d\")", s)
+	}
+	return now.Add(-d), nil
+}
+
+// minDate is the cutoff of the MinDate as of now, or zero for none
+func (c Config) minDate(now time.Time) time.Time {
+	// (as problems has it)
+	t, _ := ParseMinDate(c.MinDate, now)
+	return t
+}
+
+// backoff is the circuit breaker settings for the mirrors
+type backoff struct {
+	After     int
+	Base, Max time.Duration
+}
+
+func (c Config) backoff() backoff {
+	b := backoff{After: c.BackoffAfter, Base: c.BackoffBase.Duration, Max: c.BackoffMax.Duration}
+	if b.Base <= 0 {
+		b.Base = 30 * time.Minute
+	}
+	if b.Max <= 0 {
+		b.Max = 24 * time.Hour
+	}
+	return b
+}
+
+// retries are how many times and after how long a failed request is retried
+func (c Config) retries() (int, time.Duration) {
+	n, delay := c.Retries, c.RetryDelay.Duration
+	if n == 0 {
+		n = 2
+	} else if n < 0 {
+		n = 0
+	}
+	if delay <= 0 {
+		delay = time.Second
+	}
+	return n, delay
+}
+
+// timeout is the longest a request may take
+func (c Config) timeout() time.Duration {
+	if c.Timeout.Duration <= 0 {
+		return 5 * time.Minute
+	}
+	return c.Timeout.Duration
+}
+
+// Version is that of sl-feeds, in the default User-Agent
+var Version = "dev"
+
+// userAgent is the User-Agent of the requests to the mirrors
+func (c Config) userAgent() string {
+	if c.UserAgent == "" {
+		return "sl-feeds/" + Version + " (+https://github.com/vbatts/sl-feeds)"
+	}
+	return c.UserAgent
+}
+
+// hostLimiter is the throttling of the requests to each host, or nil for none
+func (c Config) hostLimiter() *fetch.HostLimiter {
+	if c.RequestDelay.Duration <= 0 && c.MaxPerHost <= 0 {
+		return nil
+	}
+	return &fetch.HostLimiter{Delay: c.RequestDelay.Duration, MaxPerHost: c.MaxPerHost}
+}
+
+// jobs is how many releases are processed at once
+func (c Config) jobs() int {
+	if c.Jobs <= 0 {
+		return 4
+	}
+	return c.Jobs
+}
+
+// delay is how long to back off after this many consecutive failures
+func (b backoff) delay(failures int) time.Duration {
+	d := b.Base
+	for i := b.After; i < failures && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// Mirror is where the release/ChangeLog.txt will be fetched from
+type Mirror struct {
+	// URL is of an HTTP mirror, or "iso:///path/to.iso" or "file:///path/to"
+	// to read the releases of an ISO image or tree on the local filesystem
+	URL string
+	// URLs are more URLs of the same mirror, tried in order (after the URL)
+	// when the one before can not be reached or answers with a 5xx
+	URLs     []string
+	Releases []string
+	Prefix   string
+	// PublicURL is the URL of the mirror for readers, in the links and
+	// sources of the feed items, when it is not the URL fetched from (like
+	// for an iso:// or file:// mirror)
+	PublicURL string
+
+	// Release are releases in the table form, for per-release settings
+	Release []Release
+
+	// Name identifies the mirror, like for --mirror. It defaults to the host
+	// of the URL.
+	Name string
+
+	// Enabled can be set to false to skip the mirror, without removing it
+	Enabled *bool
+	// Window is the time of day the mirror may be fetched from, like
+	// "22:00-06:00" or "22:00-06:00 America/Chicago" (default is local time).
+	// Outside of the window, the mirror is deferred.
+	Window string
+
+	// Granularity overrides the Config Granularity for this mirror
+	Granularity string
+	// SortOrder overrides the Config SortOrder for this mirror
+	SortOrder string
+	// ItemFormat overrides the Config ItemFormat for this mirror
+	ItemFormat string
+	// TitleTemplate, Description and Author override those of the Config for
+	// this mirror
+	TitleTemplate string
+	Description   string
+	Author        string
+	// LinkTemplate overrides the Config LinkTemplate for this mirror
+	LinkTemplate string
+	// FilenameTemplate overrides the Config FilenameTemplate for this mirror
+	FilenameTemplate string
+	// Formats overrides the Config Formats for this mirror
+	Formats []string
+	// Reflow overrides the Config Reflow for this mirror
+	Reflow *bool
+	// Indent overrides the Config Indent for this mirror
+	Indent *bool
+	// EmitSource overrides the Config EmitSource for this mirror
+	EmitSource *bool
+	// SecurityFeeds overrides the Config SecurityFeeds for this mirror
+	SecurityFeeds *bool
+	// ExcludePackages are glob patterns (like "kde*") of the packages whose
+	// updates are left out of the feeds, unless matching IncludePackages.
+	// With only IncludePackages, every other package is left out.
+	ExcludePackages []string
+	IncludePackages []string
+	// MassRebuildThreshold overrides the Config MassRebuildThreshold for this
+	// mirror
+	MassRebuildThreshold int
+	// MassRebuildShow overrides the Config MassRebuildShow for this mirror
+	MassRebuildShow int
+
+	// ConnectTo, like "1.2.3.4:443", is the address to connect to instead of
+	// the URL host, which is still used for the Host header and links
+	ConnectTo string
+	// ServerName is the TLS server name (SNI) to present and verify, instead
+	// of the URL host
+	ServerName string
+	// CA is a PEM file of CAs to trust for this mirror, in addition to the
+	// system ones, instead of the --ca
+	CA string
+	// Insecure overrides --insecure for this mirror, skipping the
+	// verification of its certificate when true
+	Insecure *bool
+	// ClientCert and ClientKey are PEM files of the certificate (and its key)
+	// to present to a mirror requiring one
+	ClientCert string
+	ClientKey  string
+	// Proxy overrides the Config Proxy for this mirror
+	Proxy string
+
+	// PreferCompressed fetches the ChangeLog.txt.gz or ChangeLog.txt.xz of a
+	// release when the mirror has one, instead of the plain ChangeLog.txt
+	PreferCompressed bool
+	// TailFetch overrides the Config TailFetch for this mirror
+	TailFetch *bool
+	// OnUpdate overrides the Config OnUpdate for this mirror (with [] for
+	// none)
+	OnUpdate []string
+	// Webhooks and WebhookSecret override those of the Config for this
+	// mirror (with [] for no Webhooks)
+	Webhooks      []string
+	WebhookSecret string
+
+	// Verify requires the ChangeLog.txt to be signed by a key of the Keyring,
+	// an armored public keyring file: either clearsigned, or with its md5 in
+	// the CHECKSUMS.md5 of the release, signed by CHECKSUMS.md5.asc
+	Verify  bool
+	Keyring string
+
+	// Username and Password are for a mirror requiring auth. When not set,
+	// they are looked up in $NETRC or ~/.netrc.
+	Username string
+	Password string
+	// PasswordFile is a file with the Password, to keep it out of the config
+	PasswordFile string
+	// BearerTokenFile is a file with a token sent as "Authorization: Bearer"
+	// instead of the Username and Password
+	BearerTokenFile string
+}
+
+func (c Config) granularity(m Mirror) string {
+	if m.Granularity != "" {
+		return m.Granularity
+	}
+	if c.Granularity != "" {
+		return c.Granularity
+	}
+	return changelog.GranularityEntry
+}
+
+func (c Config) reflow(m Mirror) bool {
+	if m.Reflow != nil {
+		return *m.Reflow
+	}
+	return c.Reflow
+}
+
+func (c Config) indent(m Mirror) bool {
+	if m.Indent != nil {
+		return *m.Indent
+	}
+	return c.Indent
+}
+
+// proxy is the mirror Proxy, or else the config one
+func (c Config) proxy(m Mirror) string {
+	if m.Proxy != "" {
+		return m.Proxy
+	}
+	return c.Proxy
+}
+
+// proxyNone is the Proxy for connecting directly, whatever the environment
+const proxyNone = "none"
+
+// parseProxy is the Proxy function of a transport for the proxy setting, or
+// nil for the one from the environment
+func parseProxy(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return nil, nil
+	case proxyNone:
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Proxy %q: %v", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid Proxy %q, expected an http://, https:// or socks5:// URL, or %q", proxy, proxyNone)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid Proxy %q, with no host", proxy)
+	}
+	return http.ProxyURL(u), nil
+}
+
+func (c Config) onUpdate(m Mirror) []string {
+	if m.OnUpdate != nil {
+		return m.OnUpdate
+	}
+	return c.OnUpdate
+}
+
+func (c Config) webhooks(m Mirror) []string {
+	if m.Webhooks != nil {
+		return m.Webhooks
+	}
+	return c.Webhooks
+}
+
+func (c Config) webhookSecret(m Mirror) string {
+	if m.WebhookSecret != "" {
+		return m.WebhookSecret
+	}
+	return c.WebhookSecret
+}
+
+func (c Config) tailFetch(m Mirror) bool {
+	if m.TailFetch != nil {
+		return *m.TailFetch
+	}
+	return c.TailFetch
+}
+
+// feedOnly is whether, with ShortRead, the ChangeLog of the release is only
+// needed for its feed, so that its fetching can stop at the MaxItems or
+// MinDate. The SecurityFeeds and Watch feeds may need older entries, and the
+// CombinedFeed and TailFetch need it cached whole.
+func (c Config) feedOnly(m Mirror, rel Release) bool {
+	return c.ShortRead && !c.securityFeeds(m) && len(c.watched(m, rel)) == 0 && c.CombinedFeed == "" && !c.tailFetch(m)
+}
+
+// DefaultLanguage is the Language of the feeds when none is set
+const DefaultLanguage = "en"
+
+// renderOptions are the RenderOptions of the channel of every feed: its
+// Language, its TTL, and (with a BaseURL) the URL of its file name
+func (c Config) renderOptions(name string) changelog.RenderOptions {
+	opts := changelog.RenderOptions{Language: c.Language}
+	if opts.Language == "" {
+		opts.Language = DefaultLanguage
+	}
+	if c.TTL.Duration > 0 {
+		opts.TTL = int((c.TTL.Duration + time.Minute - 1) / time.Minute)
+	}
+	if c.BaseURL != "" {
+		opts.Self = fetch.JoinURL(c.BaseURL, name)
+	}
+	return opts
+}
+
+func (c Config) emitSource(m Mirror) bool {
+	if m.EmitSource != nil {
+		return *m.EmitSource
+	}
+	return c.EmitSource
+}
+
+func (c Config) securityFeeds(m Mirror) bool {
+	if m.SecurityFeeds != nil {
+		return *m.SecurityFeeds
+	}
+	return c.SecurityFeeds
+}
+
+// massRebuild are the MassRebuildThreshold and MassRebuildShow for the
+// mirror, 0 being the defaults of the changelog package
+func (c Config) massRebuild(m Mirror) (threshold, show int) {
+	threshold, show = c.MassRebuildThreshold, c.MassRebuildShow
+	if m.MassRebuildThreshold != 0 {
+		threshold = m.MassRebuildThreshold
+	}
+	if m.MassRebuildShow != 0 {
+		show = m.MassRebuildShow
+	}
+	return threshold, show
+}
+
+func (c Config) sortOrder(m Mirror) string {
+	if m.SortOrder != "" {
+		return m.SortOrder
+	}
+	if c.SortOrder != "" {
+		return c.SortOrder
+	}
+	return changelog.SortDesc
+}
+
+// defaultTitleTemplate is the TitleTemplate, unless the config has another
+const defaultTitleTemplate = "ChangeLog.txt for {{.Prefix}}{{.Release}}"
+
+func (c Config) titleTemplate(m Mirror) string {
+	if m.TitleTemplate != "" {
+		return m.TitleTemplate
+	}
+	if c.TitleTemplate != "" {
+		return c.TitleTemplate
+	}
+	return defaultTitleTemplate
+}
+
+func (c Config) description(m Mirror) string {
+	if m.Description != "" {
+		return m.Description
+	}
+	return c.Description
+}
+
+func (c Config) author(m Mirror) string {
+	if m.Author != "" {
+		return m.Author
+	}
+	return c.Author
+}
+
+func (c Config) linkTemplate(m Mirror) string {
+	if m.LinkTemplate != "" {
+		return m.LinkTemplate
+	}
+	return c.LinkTemplate
+}
+
+// defaultFilenameTemplate is the FilenameTemplate, unless the config has
+// another
+const defaultFilenameTemplate = "{{.Prefix}}{{.Release}}.{{.Format}}"
+
+func (c Config) filenameTemplate(m Mirror) string {
+	if m.FilenameTemplate != "" {
+		return m.FilenameTemplate
+	}
+	if c.FilenameTemplate != "" {
+		return c.FilenameTemplate
+	}
+	return defaultFilenameTemplate
+}
+
+// filenameTemplate is what the FilenameTemplate has of a feed
+type filenameTemplate struct {
+	Prefix  string
+	Release string
+	Format  string
+}
+
+// feedFile is the file name for the feed base (a feedName, and any suffix) in
+// format, by the mirror's FilenameTemplate
+func (c Config) feedFile(m Mirror, base, format string) string {
+	name, err := c.renderFilename(m, base, format)
+	if err != nil {
+		// (as problems has it)
+		return base + changelog.Formats[format].Ext
+	}
+	return name
+}
+
+// feedFiles are the file names, relative to the dest dir, written for rel in
+// each of its Formats
+func (c Config) feedFiles(m Mirror, rel Release) []string {
+	names := []string{}
+	for _, f := range c.formats(m, rel) {
+		names = append(names, c.feedFile(m, m.feedName(rel), f))
+		if c.securityFeeds(m) {
+			names = append(names, c.feedFile(m, m.feedName(rel)+securitySuffix, f))
+		}
+		for _, pkg := range c.watched(m, rel) {
+			names = append(names, c.feedFile(m, m.feedName(rel)+"-"+pkg, f))
+		}
+	}
+	return names
+}
+
+// renderFilename runs the mirror's FilenameTemplate for the feed base in
+// format, checking that the result is a name in the dest directory
+func (c Config) renderFilename(m Mirror, base, format string) (string, error) {
+	text := c.filenameTemplate(m)
+	name, err := runTemplate("FilenameTemplate", text, filenameTemplate{Prefix: m.Prefix, Release: strings.TrimPrefix(base, m.Prefix), Format: format})
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case name == "", name == ".", name == "..":
+		return "", fmt.Errorf("FilenameTemplate %q is %q for the %s of %q, not a file name", text, name, format, base)
+	case strings.ContainsAny(name, `/\`):
+		return "", fmt.Errorf("FilenameTemplate %q is %q for the %s of %q, which is not to have a path separator", text, name, format, base)
+	}
+	return name, nil
+}
+
+// feedTemplate is what the TitleTemplate and Description have of a release
+type feedTemplate struct {
+	Release   string
+	Prefix    string
+	MirrorURL string
+}
+
+// linkTemplate is what the LinkTemplate has of the item of an entry
+type linkTemplate struct {
+	feedTemplate
+	// Link is the URL of the release
+	Link string
+	// Date of the entry, in UTC
+	Date time.Time
+	// Package is the item's package, if any
+	Package string
+}
+
+// executeTemplate runs the text/template text (of the setting name) for rel
+func executeTemplate(name, text string, m Mirror, rel Release) (string, error) {
+	return runTemplate(name, text, feedTemplate{Release: rel.Name, Prefix: m.Prefix, MirrorURL: m.publicURL()})
+}
+
+// runTemplate is the text of the text/template text (of the setting name),
+// executed with data
+func runTemplate(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &strings.Builder{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// itemLink runs the mirror's LinkTemplate for the items of rel, or is nil
+// when there is none
+func (c Config) itemLink(m Mirror, rel Release) func(changelog.Entry, string) string {
+	text := c.linkTemplate(m)
+	if text == "" {
+		return nil
+	}
+	release := feedTemplate{Release: rel.Name, Prefix: m.Prefix, MirrorURL: m.publicURL()}
+	link := fetch.JoinURL(m.publicURL(), rel.Name)
+	return func(e changelog.Entry, pkg string) string {
+		// an error (as problems has it) is the default link
+		href, _ := runTemplate("LinkTemplate", text, linkTemplate{feedTemplate: release, Link: link, Date: e.Date.UTC(), Package: pkg})
+		return href
+	}
+}
+
+// parseAuthor is the name and email of an Author, which is taken as a name
+// unless it has an email
+func parseAuthor(author string) (name, email string, err error) {
+	if !strings.Contains(author, "@") {
+		return author, "", nil
+	}
+	addr, err := mail.ParseAddress(author)
+	if err != nil {
+		return "", "", fmt.Errorf("Author %q should be a name, an email, or \"Name <email>\"", author)
+	}
+	return addr.Name, addr.Address, nil
+}
+
+func (c Config) itemFormat(m Mirror) string {
+	if m.ItemFormat != "" {
+		return m.ItemFormat
+	}
+	if c.ItemFormat != "" {
+		return c.ItemFormat
+	}
+	return changelog.ItemFormatPre
+}
+
+// formats are the output Formats for rel
+func (c Config) formats(m Mirror, rel Release) []string {
+	if len(rel.Formats) > 0 {
+		return rel.Formats
+	}
+	if len(m.Formats) > 0 {
+		return m.Formats
+	}
+	if len(c.Formats) > 0 {
+		return c.Formats
+	}
+	return []string{changelog.FormatRss}
+}
+
+// Release is the table form of a release of a mirror, like:
+//
+//	[[Mirrors.Release]]
+//	Name = "slackware64-current"
+//	Title = "Slackware64 -current updates"
+type Release struct {
+	Name string
+	// Title overrides the feed title
+	Title string
+	// Description overrides the feed description
+	Description string
+	// Formats overrides the Formats of the mirror for this release
+	Formats []string
+
+	// Schedule is when --daemon processes the release, as the five fields of
+	// a crontab line in local time like "*/15 * * * *", instead of every
+	// --interval
+	Schedule string
+	// Every is how often --daemon processes the release, like "12h", instead
+	// of every --interval
+	Every Duration
+	// StaleAfter overrides the Config StaleAfter for this release
+	StaleAfter Duration
+}
+
+// Watch is a feed for each of the Packages of a release, of only the entries
+// updating it, as $prefix$release-$package.rss, like:
+//
+//	[[Watch]]
+//	Release = "slackware64-current"
+//	Packages = ["openssl", "mozilla-firefox"]
+type Watch struct {
+	// Release is the name (or the feed name, with the Prefix) of the release
+	Release string
+	// Packages are the names of the packages, matched exactly
+	Packages []string
+}
+
+// watched are the packages of the release of m with feeds of their own
+func (c Config) watched(m Mirror, rel Release) []string {
+	pkgs := []string{}
+	seen := map[string]bool{}
+	for _, w := range c.Watch {
+		if w.Release != rel.Name && w.Release != m.feedName(rel) {
+			continue
+		}
+		for _, p := range w.Packages {
+			if !seen[p] {
+				seen[p] = true
+				pkgs = append(pkgs, p)
+			}
+		}
+	}
+	return pkgs
+}
+
+func (c Config) staleAfter(rel Release) time.Duration {
+	if rel.StaleAfter.Duration != 0 {
+		return rel.StaleAfter.Duration
+	}
+	return c.StaleAfter.Duration
+}
+
+// nextRun is when --daemon next processes the release, after a run at t
+func (rel Release) nextRun(t time.Time, interval time.Duration) time.Time {
+	if rel.Schedule != "" {
+		if c, err := parseCron(rel.Schedule); err == nil {
+			return c.next(t)
+		}
+	}
+	if rel.Every.Duration > 0 {
+		return t.Add(rel.Every.Duration)
+	}
+	return t.Add(interval)
+}
+
+// releases are both the Releases and the Release tables of the mirror
+func (m Mirror) releases() []Release {
+	rels := []Release{}
+	for _, name := range m.Releases {
+		rels = append(rels, Release{Name: name})
+	}
+	return append(rels, m.Release...)
+}
+
+// HasFeed is whether the feed of the name (Prefix+Release) is configured, on
+// an enabled mirror
+func (c Config) HasFeed(name string) bool {
+	_, ok := c.feedRelease(name)
+	return ok
+}
+
+// Feeds are the names (Prefix+Release) of the feeds on the enabled mirrors
+func (c Config) Feeds() []string {
+	names := []string{}
+	for _, m := range c.Mirrors {
+		if !m.enabled() {
+			continue
+		}
+		for _, rel := range m.releases() {
+			names = append(names, m.feedName(rel))
+		}
+	}
+	return names
+}
+
+// feedRelease finds the Release whose feed is name (Prefix+Release), on an
+// enabled mirror
+func (c Config) feedRelease(name string) (Release, bool) {
+	for _, m := range c.Mirrors {
+		if !m.enabled() {
+			continue
+		}
+		for _, rel := range m.releases() {
+			if m.feedName(rel) == name {
+				return rel, true
+			}
+		}
+	}
+	return Release{}, false
+}
+
+// MirrorNames are the names of the mirrors (see OnlyMirrors)
+func (c Config) MirrorNames() []string {
+	names := []string{}
+	for _, m := range c.Mirrors {
+		names = append(names, m.name())
+	}
+	return names
+}
+
+// ReleaseNames are the release names of all the mirrors (see Only)
+func (c Config) ReleaseNames() []string {
+	names := []string{}
+	for _, m := range c.Mirrors {
+		for _, rel := range m.releases() {
+			names = append(names, rel.Name)
+		}
+	}
+	return names
+}
+
+// FindRelease is the first enabled mirror with the release name, or with a
+// feed of that name (Prefix+Release)
+func (c Config) FindRelease(name string) (Mirror, Release, bool) {
+	for _, m := range c.Mirrors {
+		if !m.enabled() {
+			continue
+		}
+		for _, rel := range m.releases() {
+			if rel.Name == name || m.feedName(rel) == name {
+				return m, rel, true
+			}
+		}
+	}
+	return Mirror{}, Release{}, false
+}
+
+// enabled is whether the mirror is not disabled
+func (m Mirror) enabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// Problems are the reasons (if any) this Config can not be used
+func (c Config) Problems() []string {
+	probs := []string{}
+	if c.WarnUnparsedPercent < 0 || c.WarnUnparsedPercent > 100 {
+		probs = append(probs, fmt.Sprintf("WarnUnparsedPercent should be from 0 to 100 (%g)", c.WarnUnparsedPercent))
+	}
+	if c.StaleAfter.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("StaleAfter can not be negative (%s)", c.StaleAfter.Duration))
+	}
+	if c.StaleFactor < 0 {
+		probs = append(probs, fmt.Sprintf("StaleFactor can not be negative (%g)", c.StaleFactor))
+	}
+	if c.Jobs < 0 {
+		probs = append(probs, fmt.Sprintf("Jobs can not be negative (%d)", c.Jobs))
+	}
+	if c.Retries < -1 {
+		probs = append(probs, fmt.Sprintf("Retries should be -1 (never) or more (%d)", c.Retries))
+	}
+	if c.RetryDelay.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("RetryDelay can not be negative (%s)", c.RetryDelay.Duration))
+	}
+	if c.Timeout.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("Timeout can not be negative (%s)", c.Timeout.Duration))
+	}
+	if c.RequestDelay.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("RequestDelay can not be negative (%s)", c.RequestDelay.Duration))
+	}
+	if c.MaxPerHost < 0 {
+		probs = append(probs, fmt.Sprintf("MaxPerHost can not be negative (%d)", c.MaxPerHost))
+	}
+	if _, err := parseProxy(c.Proxy); err != nil {
+		probs = append(probs, err.Error())
+	}
+	if c.Interval.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("Interval can not be negative (%s)", c.Interval.Duration))
+	}
+	if c.TTL.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("TTL can not be negative (%s)", c.TTL.Duration))
+	}
+	if c.MaxItems < 0 {
+		probs = append(probs, fmt.Sprintf("MaxItems can not be negative (%d)", c.MaxItems))
+	}
+	if c.MaxAge.Duration < 0 {
+		probs = append(probs, fmt.Sprintf("MaxAge can not be negative (%s)", c.MaxAge.Duration))
+	}
+	if c.MinDate != "" {
+		if _, err := ParseMinDate(c.MinDate, time.Now()); err != nil {
+			probs = append(probs, fmt.Sprintf("MinDate: %v", err))
+		}
+	}
+	if c.MaxFeedBytes < 0 {
+		probs = append(probs, fmt.Sprintf("MaxFeedBytes can not be negative (%d)", c.MaxFeedBytes))
+	}
+	if c.OPML && c.BaseURL == "" {
+		probs = append(probs, "OPML needs the BaseURL of the feeds")
+	}
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			probs = append(probs, fmt.Sprintf("BaseURL %q should be an http:// or https:// URL", c.BaseURL))
+		}
+	}
+	if c.IndexTemplate != "" {
+		if _, err := htmlIndexTemplate(c.IndexTemplate); err != nil {
+			probs = append(probs, fmt.Sprintf("IndexTemplate: %v", err))
+		}
+	}
+	if c.CombinedFeed != "" {
+		if strings.ContainsAny(c.CombinedFeed, "/\\") || strings.HasPrefix(c.CombinedFeed, ".") {
+			probs = append(probs, fmt.Sprintf("CombinedFeed %q should be a file name, without an extension", c.CombinedFeed))
+		}
+		for _, m := range c.Mirrors {
+			for _, rel := range m.releases() {
+				if m.feedName(rel) == c.CombinedFeed {
+					probs = append(probs, fmt.Sprintf("CombinedFeed %q is also the feed of a release", c.CombinedFeed))
+				}
+			}
+		}
+	}
+	for _, w := range c.Watch {
+		if w.Release == "" {
+			probs = append(probs, "Watch with no Release")
+			continue
+		}
+		found := false
+		for _, m := range c.Mirrors {
+			for _, rel := range m.releases() {
+				found = found || w.Release == rel.Name || w.Release == m.feedName(rel)
+			}
+		}
+		if !found {
+			probs = append(probs, fmt.Sprintf("Watch: no release %q configured", w.Release))
+		}
+		if len(w.Packages) == 0 {
+			probs = append(probs, fmt.Sprintf("Watch of %q: no Packages", w.Release))
+		}
+		for _, p := range w.Packages {
+			if p == "" || strings.ContainsAny(p, "/ ") {
+				probs = append(probs, fmt.Sprintf("Watch of %q: %q is not a package name", w.Release, p))
+			}
+		}
+	}
+	if _, _, ok := c.S3Dest(); ok {
+		if c.WorkDir == "" {
+			probs = append(probs, fmt.Sprintf("Dest %q needs a WorkDir, for the state and cache", c.Dest))
+		}
+		if len(c.ExtraDests) > 0 || c.FTPUpload != nil {
+			probs = append(probs, fmt.Sprintf("ExtraDests and FTPUpload are copies of a local Dest, not of %q", c.Dest))
+		}
+		if bucket, _, _ := c.S3Dest(); bucket == "" {
+			probs = append(probs, fmt.Sprintf("Dest %q has no bucket", c.Dest))
+		}
+	}
+	if f := c.FTPUpload; f != nil {
+		if f.Host == "" {
+			probs = append(probs, "FTPUpload: no Host")
+		}
+		switch f.TLS {
+		case "", ftp.TLSNone, ftp.TLSExplicit, ftp.TLSImplicit:
+		default:
+			probs = append(probs, fmt.Sprintf("FTPUpload: unknown TLS %q, expected %q, %q or %q", f.TLS, ftp.TLSNone, ftp.TLSExplicit, ftp.TLSImplicit))
+		}
+	}
+	for _, m := range c.Mirrors {
+		switch c.granularity(m) {
+		case changelog.GranularityEntry, changelog.GranularityPackage:
+		default:
+			probs = append(probs, fmt.Sprintf("mirror %q: unknown Granularity %q", m.name(), c.granularity(m)))
+		}
+		switch c.sortOrder(m) {
+		case changelog.SortDesc, changelog.SortAsc:
+		default:
+			probs = append(probs, fmt.Sprintf("mirror %q: unknown SortOrder %q", m.name(), c.sortOrder(m)))
+		}
+		switch c.itemFormat(m) {
+		case changelog.ItemFormatPre, changelog.ItemFormatList, changelog.ItemFormatPlain:
+		default:
+			probs = append(probs, fmt.Sprintf("mirror %q: unknown ItemFormat %q", m.name(), c.itemFormat(m)))
+		}
+		// the templates are tried on a release, as a field they do not have
+		// is only an error when executed
+		for _, t := range []struct{ name, text string }{{"TitleTemplate", c.titleTemplate(m)}, {"Description", c.description(m)}} {
+			if _, err := executeTemplate(t.name, t.text, m, Release{Name: "slackware64-current"}); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+			}
+		}
+		if text := c.linkTemplate(m); text != "" {
+			sample := linkTemplate{feedTemplate: feedTemplate{Release: "slackware64-current"}, Date: time.Now().UTC()}
+			if _, err := runTemplate("LinkTemplate", text, sample); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+			}
+		}
+	filenames:
+		for _, rel := range m.releases() {
+			for _, f := range c.formats(m, rel) {
+				if _, err := c.renderFilename(m, m.feedName(rel), f); err != nil {
+					probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+					break filenames
+				}
+			}
+		}
+		if _, _, err := parseAuthor(c.author(m)); err != nil {
+			probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+		}
+		if m.Window != "" {
+			if _, err := parseWindow(m.Window); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+			}
+		}
+		if m.Verify && m.Keyring == "" {
+			probs = append(probs, fmt.Sprintf("mirror %q: Verify needs a Keyring", m.name()))
+		}
+		if m.Proxy != "" {
+			if _, err := parseProxy(m.Proxy); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+			}
+		}
+		for _, p := range append(append([]string{}, m.ExcludePackages...), m.IncludePackages...) {
+			if _, err := path.Match(p, ""); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: invalid package pattern %q", m.name(), p))
+			}
+		}
+		if (m.ClientCert == "") != (m.ClientKey == "") {
+			probs = append(probs, fmt.Sprintf("mirror %q: ClientCert and ClientKey are needed together", m.name()))
+		}
+		if m.Password != "" && m.PasswordFile != "" {
+			probs = append(probs, fmt.Sprintf("mirror %q: Password and PasswordFile can not both be set", m.name()))
+		}
+		if m.BearerTokenFile != "" && (m.Username != "" || m.Password != "" || m.PasswordFile != "") {
+			probs = append(probs, fmt.Sprintf("mirror %q: BearerTokenFile is instead of a Username and Password", m.name()))
+		}
+		for _, file := range []struct{ name, path string }{{"CA", m.CA}, {"ClientCert", m.ClientCert}, {"ClientKey", m.ClientKey}, {"PasswordFile", m.PasswordFile}, {"BearerTokenFile", m.BearerTokenFile}} {
+			if file.path == "" {
+				continue
+			}
+			if _, err := os.Stat(os.ExpandEnv(file.path)); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %s: %v", m.name(), file.name, err))
+			}
+		}
+		if m.ConnectTo != "" {
+			if _, _, err := net.SplitHostPort(m.ConnectTo); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: ConnectTo %q should be a host:port", m.name(), m.ConnectTo))
+			}
+		}
+		seen := map[string]bool{}
+		badFormats := map[string]bool{}
+		for _, rel := range m.releases() {
+			if rel.Name == "" {
+				probs = append(probs, fmt.Sprintf("mirror %q: release with no Name", m.name()))
+				continue
+			}
+			if err := fetch.CheckRelease(rel.Name); err != nil {
+				probs = append(probs, fmt.Sprintf("mirror %q: %v", m.name(), err))
+				continue
+			}
+			if seen[rel.Name] {
+				probs = append(probs, fmt.Sprintf("mirror %q: duplicate release %q", m.name(), rel.Name))
+			}
+			seen[rel.Name] = true
+			if rel.Schedule != "" && rel.Every.Duration != 0 {
+				probs = append(probs, fmt.Sprintf("mirror %q: release %q: only one of Schedule and Every can be set", m.name(), rel.Name))
+			} else if rel.Schedule != "" {
+				if _, err := parseCron(rel.Schedule); err != nil {
+					probs = append(probs, fmt.Sprintf("mirror %q: release %q: %v", m.name(), rel.Name, err))
+				}
+			} else if rel.Every.Duration < 0 {
+				probs = append(probs, fmt.Sprintf("mirror %q: release %q: Every can not be negative (%s)", m.name(), rel.Name, rel.Every.Duration))
+			}
+			for _, f := range c.formats(m, rel) {
+				if _, ok := changelog.Formats[f]; !ok && !badFormats[f] {
+					badFormats[f] = true
+					probs = append(probs, fmt.Sprintf("mirror %q: unknown Format %q, expected one of %q", m.name(), f, changelog.FormatNames()))
+				}
+			}
+		}
+	}
+	return append(probs, c.collisions()...)
+}
+
+// collisions are the files (as the FilenameTemplate has them) written by more
+// than one release, or for more than one feed or format, as they would
+// overwrite one another
+func (c Config) collisions() []string {
+	probs := []string{}
+	writers := map[string]string{}
+	for _, m := range c.Mirrors {
+		if !m.enabled() {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, rel := range m.releases() {
+			// a duplicate release is a problem of its own
+			if rel.Name == "" || seen[rel.Name] {
+				continue
+			}
+			seen[rel.Name] = true
+			writer := fmt.Sprintf("release %q of mirror %q", rel.Name, m.name())
+			for _, name := range c.feedFiles(m, rel) {
+				if other, ok := writers[name]; ok && other != writer {
+					probs = append(probs, fmt.Sprintf("%s: %q is also written by the %s, set a Prefix", writer, name, other))
+					continue
+				} else if ok {
+					probs = append(probs, fmt.Sprintf("%s: %q is written for more than one feed or format, set a FilenameTemplate with {{.Release}} and {{.Format}}", writer, name))
+					continue
+				}
+				writers[name] = writer
+			}
+		}
+	}
+	return probs
+}
+
+// S3 is the object storage of an s3:// Dest
+type S3 struct {
+	// Endpoint is the URL of the service, for one compatible with S3 (default
+	// that of AWS, in the Region)
+	Endpoint string
+	// Region of the bucket (default "us-east-1")
+	Region string
+	// AccessKeyID and SecretAccessKey are the credentials
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Dest is the bucket and prefix of an s3://bucket/prefix Dest, with ok
+// false for a local one
+func (c Config) S3Dest() (bucket, prefix string, ok bool) {
+	rest := strings.TrimPrefix(os.ExpandEnv(c.Dest), "s3://")
+	if rest == os.ExpandEnv(c.Dest) {
+		return "", "", false
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[:i], strings.Trim(rest[i+1:], "/"), true
+	}
+	return rest, "", true
+}
+
+// LocalDest is the local directory of the state, cache and lock, which is
+// that of the feeds too, unless they are published to an s3:// Dest
+func (c Config) LocalDest() string {
+	if _, _, ok := c.S3Dest(); ok {
+		return os.ExpandEnv(c.WorkDir)
+	}
+	return os.ExpandEnv(c.Dest)
+}
+
+// FTPUpload is an FTP (or FTPS) server for publishing the feeds
+type FTPUpload struct {
+	// Host is the host[:port] of the server. The port defaults to 21, or to
+	// 990 for implicit TLS.
+	Host string
+	// TLS is "none" (the default), "explicit" (AUTH TLS) or "implicit"
+	TLS string
+	// Username and Password are for logging in. When not set, they are looked
+	// up in $NETRC or ~/.netrc, or else are anonymous.
+	Username string
+	Password string
+	// Dir is the remote directory the feeds are uploaded to
+	Dir string
+	// Passive can be set to false for active mode data connections
+	Passive *bool
+}
+
+// addr is the host:port of the server
+func (f FTPUpload) addr() string {
+	if _, _, err := net.SplitHostPort(f.Host); err == nil {
+		return f.Host
+	}
+	if f.TLS == ftp.TLSImplicit {
+		return net.JoinHostPort(f.Host, "990")
+	}
+	return net.JoinHostPort(f.Host, "21")
+}
+
+func (f FTPUpload) passive() bool {
+	return f.Passive == nil || *f.Passive
+}
+
+// WithoutUserinfo moves any "user:pass@" of the URLs to the Username and
+// Password (unless those are already set, or taken from an earlier URL), so
+// that the URLs are safe to show in logs and feeds
+func (m Mirror) WithoutUserinfo() Mirror {
+	strip := func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil || u.User == nil {
+			return raw
+		}
+		if m.Username == "" && m.Password == "" {
+			m.Username = u.User.Username()
+			m.Password, _ = u.User.Password()
+		}
+		u.User = nil
+		return u.String()
+	}
+	m.URL = strip(m.URL)
+	if len(m.URLs) > 0 {
+		urls := make([]string, len(m.URLs))
+		for i, u := range m.URLs {
+			urls[i] = strip(u)
+		}
+		m.URLs = urls
+	}
+	return m
+}
+
+// urls are the URL and then the URLs of the mirror, in the order they are
+// tried
+func (m Mirror) urls() []string {
+	urls := []string{}
+	if m.URL != "" {
+		urls = append(urls, m.URL)
+	}
+	return append(urls, m.URLs...)
+}
+
+// withURL is the mirror with only the URL u, as when fetching from it
+func (m Mirror) withURL(u string) Mirror {
+	m.URL, m.URLs = u, nil
+	return m
+}
+
+// publicURL is the PublicURL of the mirror, or else its URL
+func (m Mirror) publicURL() string {
+	if m.PublicURL != "" {
+		return m.PublicURL
+	}
+	return m.URL
+}
+
+// feedName is the mirror Prefix and the release name, with a release in a
+// subdirectory (like "slackware64-15.0/patches") as "slackware64-15.0-patches"
+func (m Mirror) feedName(rel Release) string {
+	return m.Prefix + strings.Replace(strings.Trim(rel.Name, "/"), "/", "-", -1)
+}
+
+// name is the Name of the mirror, or the host of its URL
+func (m Mirror) name() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	urls := m.urls()
+	if len(urls) == 0 {
+		return ""
+	}
+	if u, err := url.Parse(urls[0]); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return urls[0]
+}
@@ -0,0 +1,176 @@
+package feedsync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron is a schedule in the five fields of a crontab(5) line: minute, hour,
+// day of month, month and day of week. Each is the set of its values matched,
+// as bits.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// anyDom and anyDow are whether those fields are "*". When both are
+	// restricted, a day matching either of them is matched, as with cron.
+	anyDom, anyDow bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	// names are the names of the values from min, like "jan"
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is also sunday
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a schedule like "*/15 * * * *" or "@daily"
+func parseCron(s string) (cron, error) {
+	spec := strings.TrimSpace(s)
+	if m, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return cron{}, fmt.Errorf("invalid Schedule %q, expected 5 fields like \"*/15 * * * *\"", s)
+	}
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := cronFields[i].parse(f)
+		if err != nil {
+			return cron{}, fmt.Errorf("invalid Schedule %q: %v", s, err)
+		}
+		sets[i] = set
+	}
+	c := cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	if c.next(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return cron{}, fmt.Errorf("invalid Schedule %q, it never matches", s)
+	}
+	return c, nil
+}
+
+// parse is the set of values of the field f, a list like "1,10-20/2,*/5"
+func (cf cronField) parse(f string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		span, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s %q has an invalid step", cf.name, part)
+			}
+			span, step = part[:i], n
+		}
+		lo, hi := cf.min, cf.max
+		if span != "*" {
+			bounds := strings.SplitN(span, "-", 2)
+			var err error
+			if lo, err = cf.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = cf.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// like "5/10", from 5 to the max
+				hi = cf.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s %q is a backwards range", cf.name, part)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (cf cronField) value(s string) (int, error) {
+	for i, name := range cf.names {
+		if strings.EqualFold(s, name) {
+			return cf.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < cf.min || n > cf.max {
+		return 0, fmt.Errorf("%s %q should be from %d to %d", cf.name, s, cf.min, cf.max)
+	}
+	return n, nil
+}
+
+// matchDay is whether the day of t is matched
+func (c cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// next is the first minute after t matched by the schedule, in the location of
+// t, or the zero time when none is within a few years (like for "0 0 30 2 *")
+func (c cron) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			// by elapsed time, so as to never go back over a change of offset
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
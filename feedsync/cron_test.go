@@ -0,0 +1,55 @@
+package feedsync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	from := time.Date(2024, time.January, 3, 10, 7, 30, 0, time.UTC) // a wednesday
+	cases := []struct {
+		spec, expected string
+	}{
+		{"*/15 * * * *", "2024-01-03T10:15:00Z"},
+		{"* * * * *", "2024-01-03T10:08:00Z"},
+		{"7 10 * * *", "2024-01-04T10:07:00Z"},
+		{"0 3 * * *", "2024-01-04T03:00:00Z"},
+		{"30 4 1 * *", "2024-02-01T04:30:00Z"},
+		{"0 0 * * sun", "2024-01-07T00:00:00Z"},
+		{"0 0 * * 7", "2024-01-07T00:00:00Z"},
+		{"0 0 * jun *", "2024-06-01T00:00:00Z"},
+		{"0 9-17/4 * * mon-fri", "2024-01-03T13:00:00Z"},
+		{"5,50 * * * *", "2024-01-03T10:50:00Z"},
+		{"0 0 29 2 *", "2024-02-29T00:00:00Z"},
+		// either the day of month or of week, when both are set
+		{"0 0 15 * fri", "2024-01-05T00:00:00Z"},
+		{"@daily", "2024-01-04T00:00:00Z"},
+		{"@hourly", "2024-01-03T11:00:00Z"},
+	}
+	for _, c := range cases {
+		s, err := parseCron(c.spec)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if got := s.next(from).Format(time.RFC3339); got != c.expected {
+			t.Errorf("%q: expected %s; got %s", c.spec, c.expected, got)
+		}
+	}
+
+	for _, c := range []struct {
+		spec, expected string
+	}{
+		{"*/15 * * *", "expected 5 fields"},
+		{"60 * * * *", `minute "60" should be from 0 to 59`},
+		{"*/0 * * * *", "invalid step"},
+		{"0 17-9 * * *", "backwards range"},
+		{"0 0 * foo *", `month "foo"`},
+		{"0 0 30 2 *", "never matches"},
+	} {
+		if _, err := parseCron(c.spec); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%q: expected an error with %q; got %v", c.spec, c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package feedsync
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FeedItem is the identity of one item of a written feed
+type FeedItem struct {
+	GUID string
+	Date time.Time
+}
+
+// delta is the items added to and removed from a feed, compared to the
+// previous version of it
+type delta struct {
+	Added   []FeedItem
+	Removed []FeedItem
+}
+
+// feedItems are the items of the RSS data
+func feedItems(data []byte) ([]FeedItem, error) {
+	var doc struct {
+		Items []struct {
+			Guid    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, err
+	}
+	items := []FeedItem{}
+	for _, i := range doc.Items {
+		item := FeedItem{GUID: i.Guid}
+		for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+			if d, err := time.Parse(layout, strings.TrimSpace(i.PubDate)); err == nil {
+				item.Date = d
+				break
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// diffItems is the delta from the prev items to the cur ones, by their GUID
+func diffItems(prev, cur []FeedItem) delta {
+	d := delta{}
+	seen := map[string]bool{}
+	for _, i := range prev {
+		seen[i.GUID] = true
+	}
+	now := map[string]bool{}
+	for _, i := range cur {
+		now[i.GUID] = true
+		if !seen[i.GUID] {
+			d.Added = append(d.Added, i)
+		}
+	}
+	for _, i := range prev {
+		if !now[i.GUID] {
+			d.Removed = append(d.Removed, i)
+		}
+	}
+	return d
+}
+
+// unexpectedRemovals are the Removed items that are not explained by the
+// oldest items being trimmed off the cur feed. Those still as new as the oldest
+// item kept usually mean a truncated ChangeLog or a misconfiguration.
+func (d delta) unexpectedRemovals(cur []FeedItem, trimmed int) []FeedItem {
+	if trimmed == 0 {
+		return d.Removed
+	}
+	var oldest time.Time
+	for _, i := range cur {
+		if oldest.IsZero() || i.Date.Before(oldest) {
+			oldest = i.Date
+		}
+	}
+	unexpected := []FeedItem{}
+	for _, i := range d.Removed {
+		if !i.Date.Before(oldest) {
+			unexpected = append(unexpected, i)
+		}
+	}
+	return unexpected
+}
+
+// maxDeltaDates is how many dates of the items are listed by describeItems
+const maxDeltaDates = 5
+
+// describeItems is the count of items with their dates, like "+2 items
+// (2024-06-01 20:12, 2024-06-02 03:41)"
+func describeItems(sign string, items []FeedItem) string {
+	itemWord := "items"
+	if len(items) == 1 {
+		itemWord = "item"
+	}
+	dates := []string{}
+	for i, item := range items {
+		if i == maxDeltaDates {
+			dates = append(dates, fmt.Sprintf("and %d more", len(items)-i))
+			break
+		}
+		dates = append(dates, item.Date.UTC().Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("%s%d %s (%s)", sign, len(items), itemWord, strings.Join(dates, ", "))
+}
+
+// String is the summary of the delta, like "+2 items (2024-06-01 20:12,
+// 2024-06-02 03:41)", or "" when nothing changed
+func (d delta) String() string {
+	parts := []string{}
+	if len(d.Added) > 0 {
+		parts = append(parts, describeItems("+", d.Added))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, describeItems("-", d.Removed))
+	}
+	return strings.Join(parts, ", ")
+}
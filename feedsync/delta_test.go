@@ -0,0 +1,61 @@
+package feedsync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedItems(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>t</title>
+<item><guid>a</guid><pubDate>Sun, 02 Jun 2024 03:41:00 +0000</pubDate></item>
+<item><guid>b</guid><pubDate>Sat, 01 Jun 2024 20:12:00 +0000</pubDate></item>
+</channel></rss>`)
+	items, err := feedItems(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].GUID != "a" || !items[1].Date.Equal(time.Date(2024, time.June, 1, 20, 12, 0, 0, time.UTC)) {
+		t.Errorf("unexpected items %#v", items)
+	}
+	if _, err := feedItems([]byte("<rss><channel>")); err == nil {
+		t.Error("expected an error for truncated RSS")
+	}
+}
+
+func TestDelta(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.June, d, 20, 12, 0, 0, time.UTC) }
+	prev := []FeedItem{{"c", day(3)}, {"b", day(2)}, {"a", day(1)}}
+	cur := []FeedItem{{"e", day(5)}, {"d", day(4)}, {"c", day(3)}, {"b", day(2)}}
+
+	d := diffItems(prev, cur)
+	if len(d.Added) != 2 || len(d.Removed) != 1 || d.Removed[0].GUID != "a" {
+		t.Fatalf("unexpected delta %#v", d)
+	}
+	if expected := "+2 items (2024-06-05 20:12, 2024-06-04 20:12), -1 item (2024-06-01 20:12)"; d.String() != expected {
+		t.Errorf("expected %q; got %q", expected, d.String())
+	}
+	if gone := d.unexpectedRemovals(cur, 1); len(gone) != 0 {
+		t.Errorf("expected the trimmed oldest item to be expected; got %#v", gone)
+	}
+	if gone := d.unexpectedRemovals(cur, 0); len(gone) != 1 {
+		t.Errorf("expected the removal without trimming to be unexpected; got %#v", gone)
+	}
+
+	// a newer item going missing is unexpected, even when trimming
+	d = diffItems(prev, []FeedItem{{"b", day(2)}})
+	if gone := d.unexpectedRemovals([]FeedItem{{"b", day(2)}}, 1); len(gone) != 1 || gone[0].GUID != "c" {
+		t.Errorf("expected %q to be unexpected; got %#v", "c", gone)
+	}
+
+	if s := diffItems(prev, prev).String(); s != "" {
+		t.Errorf("expected no delta; got %q", s)
+	}
+
+	many := []FeedItem{}
+	for i := 1; i <= 7; i++ {
+		many = append(many, FeedItem{string(rune('a' + i)), day(i)})
+	}
+	if expected := "+7 items (2024-06-01 20:12, 2024-06-02 20:12, 2024-06-03 20:12, 2024-06-04 20:12, 2024-06-05 20:12, and 2 more)"; describeItems("+", many) != expected {
+		t.Errorf("expected %q; got %q", expected, describeItems("+", many))
+	}
+}
@@ -0,0 +1,73 @@
+package feedsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+)
+
+// runHooks runs the mirror OnUpdate commands after the feed of rel was written
+// with new entries (those newer than since). Each is run by sh -c in the dest
+// directory, with the sl-feeds environment and:
+//
+//	SLFEEDS_RELEASE      the release name
+//	SLFEEDS_FEED         the feed name
+//	SLFEEDS_FILE         the feed path, in its first Format
+//	SLFEEDS_NEW_ENTRIES  the number of new entries
+//	SLFEEDS_MTIME        the time of the feed (RFC 3339)
+//
+// and the dates of the new entries (RFC 3339) on stdin, one per line, newest
+// first. A command that fails is logged and counted in res, without failing
+// the release.
+func (r Syncer) runHooks(mirror Mirror, rel Release, res *ReleaseResult, entries []changelog.Entry, since, mtime time.Time) {
+	hooks := r.Config.onUpdate(mirror)
+	if len(hooks) == 0 {
+		return
+	}
+	var stdin bytes.Buffer
+	for _, e := range entries {
+		if e.Date.After(since) {
+			fmt.Fprintln(&stdin, e.Date.UTC().Format(time.RFC3339))
+		}
+	}
+	env := append(os.Environ(),
+		"SLFEEDS_RELEASE="+rel.Name,
+		"SLFEEDS_FEED="+res.Name,
+		"SLFEEDS_FILE="+filepath.Join(r.Dest, r.Config.feedFiles(mirror, rel)[0]),
+		fmt.Sprintf("SLFEEDS_NEW_ENTRIES=%d", res.New),
+		"SLFEEDS_MTIME="+mtime.UTC().Format(time.RFC3339),
+	)
+	fields := LogFields{Release: res.Name, Mirror: res.Mirror, Action: "hook"}
+	for _, hook := range hooks {
+		// no longer than a request may take
+		ctx, cancel := context.WithTimeout(context.Background(), r.Config.timeout())
+		cmd := exec.CommandContext(ctx, "sh", "-c", hook)
+		cmd.Dir = r.Dest
+		cmd.Env = env
+		cmd.Stdin = bytes.NewReader(stdin.Bytes())
+		start := time.Now()
+		out, err := cmd.CombinedOutput()
+		cancel()
+		fields.Duration, fields.Err = time.Since(start), err
+		output := strings.TrimSpace(string(out))
+		if err != nil {
+			res.HookFailures++
+			if output != "" {
+				err = fmt.Errorf("%v: %s", err, output)
+			}
+			r.Errorf(fields, "OnUpdate %q failed: %v", hook, err)
+			continue
+		}
+		r.Infof(fields, "ran OnUpdate %q", hook)
+		if output != "" {
+			r.Debugf(fields, "OnUpdate %q: %s", hook, output)
+		}
+	}
+}
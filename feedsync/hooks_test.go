@@ -0,0 +1,76 @@
+package feedsync
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrors := []Mirror{
+		{URL: "file://" + dir, Releases: []string{"slackware64"}},
+		{URL: "file://" + dir, Releases: []string{"slackwarearm"}, OnUpdate: []string{}},
+	}
+	hooks := []string{
+		`cat > "$SLFEEDS_FEED.dates"; env | grep ^SLFEEDS_ | sort > "$SLFEEDS_FEED.env"`,
+		"echo broken >&2; exit 3",
+	}
+
+	r, cleanup := newTestRunner(t, mirrors...)
+	defer cleanup()
+	r.Config.OnUpdate = hooks
+	r.NoHooks = true
+	for _, res := range r.pass() {
+		if res.Err != nil || res.HookFailures != 0 {
+			t.Fatalf("%s: expected no hooks to run; got %v, %d failed", res.Name, res.Err, res.HookFailures)
+		}
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.env")); err == nil {
+		t.Fatal("expected no hooks to run with NoHooks")
+	}
+
+	r, cleanup = newTestRunner(t, mirrors...)
+	defer cleanup()
+	r.Config.OnUpdate = hooks
+
+	results := r.pass()
+	if len(results) != 2 || results[0].Err != nil || results[0].HookFailures != 1 || results[1].HookFailures != 0 {
+		t.Fatalf("expected a failed hook, not failing the release; got %#v", results)
+	}
+	env, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"SLFEEDS_FEED=slackware64\n",
+		"SLFEEDS_FILE=" + filepath.Join(r.Dest, "slackware64.rss") + "\n",
+		"SLFEEDS_MTIME=",
+		"SLFEEDS_NEW_ENTRIES=",
+		"SLFEEDS_RELEASE=slackware64\n",
+	} {
+		if !strings.Contains(string(env), expected) {
+			t.Errorf("expected the environment of the hook to have %q; got:\n%s", expected, env)
+		}
+	}
+	dates, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.dates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(dates)), "\n"); len(lines) != results[0].New || !strings.HasPrefix(lines[0], "2017-01-23T") {
+		t.Errorf("expected the %d dates of the new entries; got:\n%s", results[0].New, dates)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackwarearm.env")); err == nil {
+		t.Error("expected no hooks for the mirror with an OnUpdate of none")
+	}
+
+	// nor when the feed has nothing new
+	r.Force = true
+	if results := r.pass(); results[0].Err != nil || results[0].New != 0 || results[0].HookFailures != 0 {
+		t.Errorf("expected no hooks without new entries; got %#v", results[0])
+	}
+}
@@ -0,0 +1,124 @@
+package feedsync
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+)
+
+// HTMLIndexName is the file name of the HTML index in the dest directory
+const HTMLIndexName = "index.html"
+
+// defaultHTMLIndex is the template of the HTML index, unless the config has an
+// IndexTemplate. It is executed with an htmlIndex.
+const defaultHTMLIndex = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{- range .Feeds}}
+<li><a href="{{.Name}}">{{.Title}}</a> ({{.Format}}, updated {{.ModTime.UTC.Format "2006-01-02 15:04 MST"}})</li>
+{{- end}}
+</ul>
+{{- if .OPML}}
+<p><a href="{{.OPML}}">All of the feeds, as OPML</a></p>
+{{- end}}
+</body>
+</html>
+`
+
+type htmlIndex struct {
+	Title string
+	Feeds []htmlIndexFeed
+	// OPML is the file name of the OPML index, when it is written
+	OPML string
+}
+
+type htmlIndexFeed struct {
+	// Name is the file name of the feed, relative to the index
+	Name    string
+	Title   string
+	Format  string
+	ModTime time.Time
+}
+
+// htmlIndexTemplate is the template of the HTML index at path, or the default
+// one for ""
+func htmlIndexTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New(HTMLIndexName).Parse(defaultHTMLIndex)
+	}
+	data, err := ioutil.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return nil, err
+	}
+	return template.New(HTMLIndexName).Parse(string(data))
+}
+
+// htmlIndexFeeds are the feed files in the dest directory for the config,
+// followed by those only known from the state of prior runs (like a release
+// since removed from the config). Nothing else in the directory is listed.
+func (r Syncer) htmlIndexFeeds() []htmlIndexFeed {
+	list := []htmlIndexFeed{}
+	add := func(name, title, format string) {
+		if modTime, err := r.publisher().Stat(name); err == nil {
+			list = append(list, htmlIndexFeed{Name: name, Title: title, Format: format, ModTime: modTime})
+		}
+	}
+	known := map[string]bool{}
+	for _, feed := range r.configFeeds() {
+		known[feed.Base] = true
+		for _, f := range feed.Formats {
+			add(feed.Files[f], feed.Title, f)
+		}
+	}
+	if r.State != nil {
+		names := []string{}
+		for name := range r.State.Feeds {
+			if !known[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, f := range changelog.FormatNames() {
+				add(name+changelog.Formats[f].Ext, name, f)
+			}
+		}
+	}
+	return list
+}
+
+// writeHTMLIndex writes the HTML index of the feeds to the dest directory,
+// unless it is unchanged
+func (r Syncer) writeHTMLIndex() error {
+	tmpl, err := htmlIndexTemplate(r.Config.IndexTemplate)
+	if err != nil {
+		return err
+	}
+	index := htmlIndex{Title: "Slackware ChangeLog feeds", Feeds: r.htmlIndexFeeds()}
+	if r.Config.OPML {
+		index.OPML = OPMLName
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buf, index); err != nil {
+		return err
+	}
+
+	path := filepath.Join(r.Dest, HTMLIndexName)
+	if prev, err := ioutil.ReadFile(path); err == nil && bytes.Equal(prev, buf.Bytes()) {
+		return nil
+	}
+	return r.publishFile(HTMLIndexName, time.Time{}, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
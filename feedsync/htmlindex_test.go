@@ -0,0 +1,105 @@
+package feedsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLIndexFeeds(t *testing.T) {
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: "http://slackware.osuosl.org/", Formats: []string{"rss", "atom"}, Releases: []string{"slackware64-current", "slackware64-15.0"}},
+	)
+	defer cleanup()
+	r.State = &State{Feeds: map[string]*FeedState{
+		"slackware64-current": {},
+		"slackware64-14.2":    {},
+		"slackware64-14.1":    {},
+	}}
+
+	mtime := time.Date(2022, 2, 2, 20, 25, 57, 0, time.UTC)
+	// the feeds of the config that were written, one of a removed release in
+	// the state, and files that are not feeds of sl-feeds
+	for _, name := range []string{"slackware64-current.rss", "slackware64-current.atom", "slackware64-14.2.rss", "other.rss", "notes.txt"} {
+		path := filepath.Join(r.Dest, name)
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []htmlIndexFeed{
+		{"slackware64-current.rss", "ChangeLog.txt for slackware64-current", "rss", mtime},
+		{"slackware64-current.atom", "ChangeLog.txt for slackware64-current", "atom", mtime},
+		{"slackware64-14.2.rss", "slackware64-14.2", "rss", mtime},
+	}
+	got := r.htmlIndexFeeds()
+	for i := range got {
+		got[i].ModTime = got[i].ModTime.UTC()
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v; got %#v", expected, got)
+	}
+}
+
+func TestWriteHTMLIndex(t *testing.T) {
+	r, cleanup := newTestRunner(t, Mirror{URL: "http://slackware.osuosl.org/", Releases: []string{"slackware64-current"}})
+	defer cleanup()
+	if err := ioutil.WriteFile(filepath.Join(r.Dest, "slackware64-current.rss"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.writeHTMLIndex(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(r.Dest, HTMLIndexName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `<a href="slackware64-current.rss">ChangeLog.txt for slackware64-current</a>`) {
+		t.Errorf("expected a link to the feed; got %q", data)
+	}
+
+	// with the template of the config
+	tmpl := filepath.Join(r.Dest, "index.tmpl")
+	if err := ioutil.WriteFile(tmpl, []byte(`{{range .Feeds}}{{.Name}} {{.ModTime.IsZero}}{{"\n"}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.IndexTemplate = tmpl
+	if err := r.writeHTMLIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadFile(path); err != nil || string(data) != "slackware64-current.rss false\n" {
+		t.Errorf("expected the feeds in the IndexTemplate; got %q (%v)", data, err)
+	}
+}
+
+func TestConfigIndexTemplateProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-index.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bad := filepath.Join(dir, "bad.tmpl")
+	if err := ioutil.WriteFile(bad, []byte("{{range .Feeds}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		bad:                             "IndexTemplate: template:",
+		filepath.Join(dir, "none.tmpl"): "no such file",
+	} {
+		config := Config{Dest: dir, HTMLIndex: true, IndexTemplate: path}
+		probs := config.Problems()
+		if len(probs) != 1 || !strings.Contains(probs[0], expected) {
+			t.Errorf("%s: expected a problem of %q; got %q", path, expected, probs)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package feedsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// level is how severe a line of the log is
+type level int
+
+const (
+	levelDebug level = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[level]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+// LogFields are the details of a line of the log, which are fields of their
+// own in JSON, while in text they are only the Release leading the message
+type LogFields struct {
+	Release  string
+	Mirror   string
+	Action   string
+	Duration time.Duration
+	Err      error
+}
+
+// logLine is a line of the log in JSON, one object per line
+type logLine struct {
+	Time     string  `json:"time"`
+	Level    string  `json:"level"`
+	Release  string  `json:"release,omitempty"`
+	Mirror   string  `json:"mirror,omitempty"`
+	Action   string  `json:"action,omitempty"`
+	Msg      string  `json:"msg"`
+	Duration float64 `json:"duration,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// level is the least level logged: debug with Verbose, warn when Quiet, and
+// otherwise info
+func (r Syncer) level() level {
+	switch {
+	case r.Verbose:
+		return levelDebug
+	case r.Quiet:
+		return levelWarn
+	}
+	return levelInfo
+}
+
+func (r Syncer) Debugf(f LogFields, format string, v ...interface{}) {
+	r.logf(levelDebug, f, format, v...)
+}
+
+func (r Syncer) Infof(f LogFields, format string, v ...interface{}) {
+	r.logf(levelInfo, f, format, v...)
+}
+
+func (r Syncer) Warnf(f LogFields, format string, v ...interface{}) {
+	r.logf(levelWarn, f, format, v...)
+}
+
+func (r Syncer) Errorf(f LogFields, format string, v ...interface{}) {
+	r.logf(levelError, f, format, v...)
+}
+
+// Notice logs a message of the State (see RecordMirrors and RecordStale), as a
+// warning when it is one
+func (r Syncer) Notice(msg string) {
+	if w := strings.TrimPrefix(msg, "warning: "); w != msg {
+		r.Warnf(LogFields{Action: "state"}, "%s", w)
+		return
+	}
+	r.Infof(LogFields{Action: "state"}, "%s", msg)
+}
+
+// Printf logs the message whatever the level, even when Quiet
+func (r Syncer) Printf(f LogFields, format string, v ...interface{}) {
+	r.output(levelInfo, f, fmt.Sprintf(format, v...))
+}
+
+// logf logs the message to the Logger, unless it is below the level
+func (r Syncer) logf(l level, f LogFields, format string, v ...interface{}) {
+	if l < r.level() {
+		return
+	}
+	r.output(l, f, fmt.Sprintf(format, v...))
+}
+
+// output logs the message whatever the level, as text like "warning:
+// slackware64: ..." or with LogJSON, as a logLine
+func (r Syncer) output(l level, f LogFields, msg string) {
+	if r.Logger == nil {
+		return
+	}
+	if !r.LogJSON {
+		if f.Release != "" {
+			msg = f.Release + ": " + msg
+		}
+		switch l {
+		case levelDebug:
+			msg = "debug: " + msg
+		case levelWarn:
+			msg = "warning: " + msg
+		}
+		r.Logger.Print(msg)
+		return
+	}
+	line := logLine{
+		Time:     time.Now().UTC().Format(time.RFC3339Nano),
+		Level:    levelNames[l],
+		Release:  f.Release,
+		Mirror:   f.Mirror,
+		Action:   f.Action,
+		Msg:      msg,
+		Duration: f.Duration.Seconds(),
+	}
+	if f.Err != nil {
+		line.Error = f.Err.Error()
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		// (which a logLine can not be)
+		r.Logger.Print(msg)
+		return
+	}
+	r.Logger.Print(string(data))
+}
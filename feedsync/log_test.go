@@ -0,0 +1,86 @@
+package feedsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogLevels(t *testing.T) {
+	for _, tc := range []struct {
+		quiet, verbose bool
+		expected       string
+	}{
+		{false, false, "slackware64: processing\nwarning: slackware64: disappeared\nfailed\n"},
+		{true, false, "warning: slackware64: disappeared\nfailed\n"},
+		{false, true, "debug: slackware64: GET\nslackware64: processing\nwarning: slackware64: disappeared\nfailed\n"},
+	} {
+		buf := bytes.NewBuffer(nil)
+		r := Syncer{Logger: log.New(buf, "", 0), Quiet: tc.quiet, Verbose: tc.verbose}
+		f := LogFields{Release: "slackware64"}
+		r.Debugf(f, "GET")
+		r.Infof(f, "processing")
+		r.Warnf(f, "disappeared")
+		r.Errorf(LogFields{}, "failed")
+		if buf.String() != tc.expected {
+			t.Errorf("quiet %t, verbose %t: expected %q; got %q", tc.quiet, tc.verbose, tc.expected, buf.String())
+		}
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	r := Syncer{Logger: log.New(buf, "", 0), LogJSON: true}
+	err := errors.New("503 status")
+	r.Errorf(LogFields{Release: "slackware64", Mirror: "osuosl", Action: "fetch", Duration: 1500 * time.Millisecond, Err: err}, "failed (%v)", err)
+	r.Infof(LogFields{Action: "summary"}, "done")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines; got %q", buf.String())
+	}
+	var line logLine
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, line.Time); err != nil {
+		t.Errorf("expected the time; got %v", err)
+	}
+	line.Time = ""
+	expected := logLine{Level: "error", Release: "slackware64", Mirror: "osuosl", Action: "fetch", Msg: "failed (503 status)", Duration: 1.5, Error: "503 status"}
+	if line != expected {
+		t.Errorf("expected %#v; got %#v", expected, line)
+	}
+	if strings.Contains(lines[1], `"release"`) || strings.Contains(lines[1], `"error"`) {
+		t.Errorf("expected no empty fields; got %s", lines[1])
+	}
+}
+
+func TestRunVerbose(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	defer cleanup()
+	buf := bytes.NewBuffer(nil)
+	r.Logger = log.New(buf, "", 0)
+	r.Quiet = false
+	r.pass()
+	if strings.Contains(buf.String(), "debug: ") || !strings.Contains(buf.String(), "slackware64: processing ") {
+		t.Errorf("expected the text output, without debug; got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	r.Verbose, r.Force = true, true
+	r.pass()
+	expected := "debug: slackware64: GET " + server.URL + "/slackware64/ChangeLog.txt: 200 status, "
+	if !strings.Contains(buf.String(), expected) || !strings.Contains(buf.String(), " bytes in ") {
+		t.Errorf("expected the request with its bytes; got:\n%s", buf.String())
+	}
+}
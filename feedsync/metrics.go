@@ -0,0 +1,183 @@
+package feedsync
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// labelEscaper escapes label values for the prometheus text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes the results of a run in the prometheus text exposition
+// format, as used by the node_exporter textfile collector. The run started at
+// start and took duration, and runErr is any error that kept it from
+// completing.
+func WriteMetrics(w io.Writer, results []ReleaseResult, state *State, start time.Time, duration time.Duration, runErr error) error {
+	success := 1
+	if runErr != nil {
+		success = 0
+	}
+	lines := []string{
+		"# HELP sl_feeds_last_run_timestamp_seconds Time the last run of sl-feeds started.",
+		"# TYPE sl_feeds_last_run_timestamp_seconds gauge",
+		fmt.Sprintf("sl_feeds_last_run_timestamp_seconds %d", start.Unix()),
+		"# HELP sl_feeds_last_run_success Whether the last run of sl-feeds succeeded.",
+		"# TYPE sl_feeds_last_run_success gauge",
+		fmt.Sprintf("sl_feeds_last_run_success %d", success),
+		"# HELP sl_feeds_last_run_duration_seconds How long the last run of sl-feeds took.",
+		"# TYPE sl_feeds_last_run_duration_seconds gauge",
+		fmt.Sprintf("sl_feeds_last_run_duration_seconds %g", duration.Seconds()),
+	}
+
+	type metric struct {
+		name, help, kind string
+		value            func(r ReleaseResult, fs *FeedState) string
+	}
+	perFeed := []metric{
+		{"sl_feeds_feed_last_success_timestamp_seconds", "Time the feed was last successfully processed.", "gauge",
+			func(r ReleaseResult, fs *FeedState) string {
+				if fs.LastSuccess.IsZero() {
+					return "0"
+				}
+				return fmt.Sprint(fs.LastSuccess.Unix())
+			}},
+		{"sl_feeds_feed_new_entries", "Number of new ChangeLog entries in the last run.", "gauge",
+			func(r ReleaseResult, fs *FeedState) string { return fmt.Sprint(r.New) }},
+		{"sl_feeds_feed_failed", "Whether the feed failed in the last run.", "gauge",
+			func(r ReleaseResult, fs *FeedState) string {
+				if r.Failed() {
+					return "1"
+				}
+				return "0"
+			}},
+		{"sl_feeds_feed_hook_failures", "Number of the OnUpdate commands and Webhooks of the feed that failed in the last run.", "gauge",
+			func(r ReleaseResult, fs *FeedState) string { return fmt.Sprint(r.HookFailures) }},
+		{"sl_feeds_feed_consecutive_failures", "Number of consecutive runs the feed has failed.", "gauge",
+			func(r ReleaseResult, fs *FeedState) string { return fmt.Sprint(fs.ConsecutiveFailures) }},
+		{"sl_feeds_feed_stale", "Whether the newest entry of the feed is past StaleAfter or StaleFactor.", "gauge",
+			func(r ReleaseResult, fs *FeedState) string {
+				if r.Stale != "" {
+					return "1"
+				}
+				return "0"
+			}},
+	}
+	for _, m := range perFeed {
+		if len(results) == 0 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("# HELP %s %s", m.name, m.help), fmt.Sprintf("# TYPE %s %s", m.name, m.kind))
+		for _, r := range results {
+			lines = append(lines, fmt.Sprintf("%s{feed=\"%s\"} %s", m.name, labelEscaper.Replace(r.Name), m.value(r, state.Feed(r.Name))))
+		}
+	}
+
+	fetched := []ReleaseResult{}
+	for _, r := range results {
+		if len(r.Requests) > 0 {
+			fetched = append(fetched, r)
+		}
+	}
+	if len(fetched) > 0 {
+		lines = append(lines,
+			"# HELP sl_feeds_feed_fetch_duration_seconds How long the requests for the ChangeLog of the feed took, in the last run.",
+			"# TYPE sl_feeds_feed_fetch_duration_seconds gauge")
+		for _, r := range fetched {
+			var d time.Duration
+			for _, s := range r.Requests {
+				d += s.Duration
+			}
+			lines = append(lines, fmt.Sprintf("sl_feeds_feed_fetch_duration_seconds{feed=\"%s\"} %g", labelEscaper.Replace(r.Name), d.Seconds()))
+		}
+	}
+
+	scheduled := []ReleaseResult{}
+	for _, r := range results {
+		if !state.Feed(r.Name).NextRun.IsZero() {
+			scheduled = append(scheduled, r)
+		}
+	}
+	if len(scheduled) > 0 {
+		lines = append(lines,
+			"# HELP sl_feeds_feed_next_run_timestamp_seconds Time the feed is next to be processed, in --daemon mode.",
+			"# TYPE sl_feeds_feed_next_run_timestamp_seconds gauge")
+		for _, r := range scheduled {
+			lines = append(lines, fmt.Sprintf("sl_feeds_feed_next_run_timestamp_seconds{feed=\"%s\"} %d", labelEscaper.Replace(r.Name), state.Feed(r.Name).NextRun.Unix()))
+		}
+	}
+
+	parsed := []ReleaseResult{}
+	for _, r := range results {
+		if r.Parse != nil {
+			parsed = append(parsed, r)
+		}
+	}
+	perParse := []struct {
+		name, help string
+		value      func(s *changelog.ParseStats) string
+	}{
+		{"sl_feeds_feed_entries", "Number of entries in the ChangeLog of the feed, when last parsed.",
+			func(s *changelog.ParseStats) string { return fmt.Sprint(s.Entries) }},
+		{"sl_feeds_feed_newest_entry_timestamp_seconds", "Time of the newest entry in the ChangeLog of the feed, when last parsed.",
+			func(s *changelog.ParseStats) string { return fmt.Sprint(s.Newest.Unix()) }},
+		{"sl_feeds_feed_packages", "Number of distinct packages updated in the ChangeLog of the feed, when last parsed.",
+			func(s *changelog.ParseStats) string { return fmt.Sprint(s.Packages) }},
+		{"sl_feeds_feed_security_entries", "Number of entries with security fixes in the ChangeLog of the feed, when last parsed.",
+			func(s *changelog.ParseStats) string { return fmt.Sprint(s.SecurityEntries) }},
+		{"sl_feeds_feed_lines", "Number of non-blank lines in the ChangeLog of the feed, when last parsed.",
+			func(s *changelog.ParseStats) string { return fmt.Sprint(s.Lines) }},
+		{"sl_feeds_feed_unrecognized_lines", "Number of lines of the ChangeLog of the feed that were not recognized, when last parsed.",
+			func(s *changelog.ParseStats) string { return fmt.Sprint(s.Unrecognized) }},
+	}
+	for _, m := range perParse {
+		if len(parsed) == 0 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("# HELP %s %s", m.name, m.help), fmt.Sprintf("# TYPE %s gauge", m.name))
+		for _, r := range parsed {
+			lines = append(lines, fmt.Sprintf("%s{feed=\"%s\"} %s", m.name, labelEscaper.Replace(r.Name), m.value(r.Parse)))
+		}
+	}
+
+	mirrors := []string{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		if r.Mirror != "" && !seen[r.Mirror] {
+			seen[r.Mirror] = true
+			mirrors = append(mirrors, r.Mirror)
+		}
+	}
+	if len(mirrors) > 0 {
+		lines = append(lines,
+			"# HELP sl_feeds_mirror_backoff Whether the mirror is being backed off from after repeated failures.",
+			"# TYPE sl_feeds_mirror_backoff gauge")
+		for _, m := range mirrors {
+			backoff := 0
+			if state.Mirror(m).BackoffUntil.After(start) {
+				backoff = 1
+			}
+			lines = append(lines, fmt.Sprintf("sl_feeds_mirror_backoff{mirror=\"%s\"} %d", labelEscaper.Replace(m), backoff))
+		}
+		lines = append(lines,
+			"# HELP sl_feeds_mirror_consecutive_failures Number of consecutive runs every release of the mirror failed.",
+			"# TYPE sl_feeds_mirror_consecutive_failures gauge")
+		for _, m := range mirrors {
+			lines = append(lines, fmt.Sprintf("sl_feeds_mirror_consecutive_failures{mirror=\"%s\"} %d", labelEscaper.Replace(m), state.Mirror(m).ConsecutiveFailures))
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// WriteMetricsFile atomically writes the metrics to path, so the collector
+// never reads a partial file
+func WriteMetricsFile(path string, results []ReleaseResult, state *State, start time.Time, duration time.Duration, runErr error) error {
+	return util.WriteFileAtomic(path, time.Time{}, func(w io.Writer) error {
+		return WriteMetrics(w, results, state, start, duration, runErr)
+	})
+}
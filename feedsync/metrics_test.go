@@ -0,0 +1,66 @@
+package feedsync
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	state := NewState()
+	results := []ReleaseResult{
+		{Name: "slackware64-current", New: 2, Requests: []fetch.Stats{{Duration: 1500 * time.Millisecond}, {Duration: 500 * time.Millisecond}}, Parse: &changelog.ParseStats{Entries: 52, Newest: time.Unix(1485207013, 0), Lines: 100, Unrecognized: 3}, Stale: "no new entry since 2017-01-23"},
+		{Name: `odd"name\with/slash`, Err: errors.New("404 status")},
+	}
+	state.Record(results, time.Unix(1485207013, 0))
+	state.Feed("slackware64-current").NextRun = time.Unix(1485207900, 0)
+
+	buf := bytes.NewBuffer(nil)
+	if err := WriteMetrics(buf, results, state, time.Unix(1485207000, 0), 90*time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	expected := []string{
+		"sl_feeds_last_run_timestamp_seconds 1485207000\n",
+		"sl_feeds_last_run_success 1\n",
+		"sl_feeds_last_run_duration_seconds 90\n",
+		`sl_feeds_feed_fetch_duration_seconds{feed="slackware64-current"} 2` + "\n",
+		`sl_feeds_feed_last_success_timestamp_seconds{feed="slackware64-current"} 1485207013` + "\n",
+		`sl_feeds_feed_new_entries{feed="slackware64-current"} 2` + "\n",
+		`sl_feeds_feed_failed{feed="odd\"name\\with/slash"} 1` + "\n",
+		`sl_feeds_feed_consecutive_failures{feed="odd\"name\\with/slash"} 1` + "\n",
+		`sl_feeds_feed_stale{feed="slackware64-current"} 1` + "\n",
+		`sl_feeds_feed_stale{feed="odd\"name\\with/slash"} 0` + "\n",
+		`sl_feeds_feed_next_run_timestamp_seconds{feed="slackware64-current"} 1485207900` + "\n",
+		`sl_feeds_feed_entries{feed="slackware64-current"} 52` + "\n",
+		`sl_feeds_feed_newest_entry_timestamp_seconds{feed="slackware64-current"} 1485207013` + "\n",
+		`sl_feeds_feed_unrecognized_lines{feed="slackware64-current"} 3` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected metrics to include %q; got:\n%s", line, out)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteMetrics(buf, nil, state, time.Unix(1485207000, 0), 0, errors.New("bad config")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, `sl_feeds_feed_next_run_timestamp_seconds{feed="odd`) {
+		t.Error("expected no next run for a feed that is not scheduled")
+	}
+	if strings.Contains(out, `sl_feeds_feed_fetch_duration_seconds{feed="odd`) {
+		t.Error("expected no fetch duration for a feed without requests")
+	}
+	if strings.Contains(out, `sl_feeds_feed_entries{feed="odd`) {
+		t.Error("expected no parse figures for a feed that was not parsed")
+	}
+	if !strings.Contains(buf.String(), "sl_feeds_last_run_success 0\n") {
+		t.Errorf("expected a failed run; got:\n%s", buf.String())
+	}
+}
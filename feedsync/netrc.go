@@ -0,0 +1,204 @@
+package feedsync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// netrcEntry are the credentials of a machine in a netrc file
+type netrcEntry struct {
+	Login    string
+	Password string
+}
+
+// Netrc are the credentials from a netrc file, as used by curl and ftp, for
+// the mirrors without a Username
+type Netrc struct {
+	// Path is that of the file, for saying where credentials came from
+	Path     string
+	machines map[string]netrcEntry
+	def      *netrcEntry
+}
+
+// netrcPath is $NETRC, or else ~/.netrc
+func netrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	return filepath.Join(os.Getenv("HOME"), ".netrc")
+}
+
+// LoadNetrc reads the netrc file of $NETRC, or else ~/.netrc, which is nil
+// when there is none
+func LoadNetrc() (*Netrc, error) {
+	return loadNetrc(netrcPath())
+}
+
+// loadNetrc reads the netrc file at path. A missing file is not an error, but
+// is a nil netrc.
+func loadNetrc(path string) (*Netrc, error) {
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	n, err := parseNetrc(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	n.Path = path
+	return n, nil
+}
+
+// netrcToken is a word of a netrc file, with the line it is on
+type netrcToken struct {
+	word string
+	line int
+}
+
+func parseNetrc(r io.Reader) (*Netrc, error) {
+	tokens := []netrcToken{}
+	scanner := bufio.NewScanner(r)
+	inMacro := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if inMacro {
+			// a macdef runs to the next empty line
+			inMacro = strings.TrimSpace(text) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		words := strings.Fields(text)
+		for _, word := range words {
+			tokens = append(tokens, netrcToken{word: word, line: line})
+		}
+		inMacro = len(words) >= 2 && words[len(words)-2] == "macdef"
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	n := &Netrc{machines: map[string]netrcEntry{}}
+	var (
+		entry   *netrcEntry
+		machine string
+	)
+	done := func() {
+		if entry == nil {
+			return
+		}
+		if machine == "" {
+			n.def = entry
+		} else if _, ok := n.machines[machine]; !ok {
+			// like curl, the first entry for a machine wins
+			n.machines[machine] = *entry
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.word {
+		case "default":
+			done()
+			entry, machine = &netrcEntry{}, ""
+			continue
+		case "machine", "login", "password", "account", "macdef":
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", tok.line, tok.word)
+		}
+		if i+1 == len(tokens) {
+			return nil, fmt.Errorf("line %d: %q without a value", tok.line, tok.word)
+		}
+		i++
+		value := tokens[i].word
+		switch tok.word {
+		case "machine":
+			done()
+			entry, machine = &netrcEntry{}, value
+		case "login", "password":
+			if entry == nil {
+				return nil, fmt.Errorf("line %d: %q before any machine", tok.line, tok.word)
+			}
+			if tok.word == "login" {
+				entry.Login = value
+			} else {
+				entry.Password = value
+			}
+		}
+	}
+	done()
+	return n, nil
+}
+
+// lookup is the entry for host, or else the default entry
+func (n *Netrc) lookup(host string) (netrcEntry, bool) {
+	if n == nil {
+		return netrcEntry{}, false
+	}
+	if e, ok := n.machines[host]; ok {
+		return e, true
+	}
+	if n.def != nil {
+		return *n.def, true
+	}
+	return netrcEntry{}, false
+}
+
+// mirrorAuth sets the credentials for the repo requests: the BearerTokenFile
+// token, or else the Username with the PasswordFile, or else the mirror's
+// credentials. source is where they came from.
+func (r Syncer) mirrorAuth(m Mirror, repo *fetch.Repo) (source string, err error) {
+	if m.BearerTokenFile != "" {
+		repo.BearerToken, err = readSecretFile(m.BearerTokenFile)
+		return m.BearerTokenFile, err
+	}
+	if m.PasswordFile != "" {
+		repo.Username = m.Username
+		repo.Password, err = readSecretFile(m.PasswordFile)
+		return m.PasswordFile, err
+	}
+	repo.Username, repo.Password, source = r.credentials(m)
+	return source, nil
+}
+
+// readSecretFile is the content of the file at path, without the surrounding
+// whitespace (like its trailing newline). The errors never have the content.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+// credentials are the Username and Password of m, or else those from the
+// netrc for its host, along with where they came from
+func (r Syncer) credentials(m Mirror) (username, password, source string) {
+	if m.Username != "" || m.Password != "" {
+		return m.Username, m.Password, "the config"
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil || u.Hostname() == "" {
+		return "", "", ""
+	}
+	if e, ok := r.Netrc.lookup(u.Hostname()); ok {
+		return e.Login, e.Password, r.Netrc.Path
+	}
+	return "", "", ""
+}
@@ -0,0 +1,70 @@
+package feedsync
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	n, err := parseNetrc(strings.NewReader(`# private mirrors
+machine mirror.example login vbatts password sekrit
+machine other.example
+	login someone
+	password other
+macdef init
+cd /slackware
+ls
+
+default login anonymous password me@example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, expected := range map[string]netrcEntry{
+		"mirror.example":  {Login: "vbatts", Password: "sekrit"},
+		"other.example":   {Login: "someone", Password: "other"},
+		"unknown.example": {Login: "anonymous", Password: "me@example.com"},
+	} {
+		e, ok := n.lookup(host)
+		if !ok || e != expected {
+			t.Errorf("%s: expected %+v; got %+v (%t)", host, expected, e, ok)
+		}
+	}
+
+	if _, ok := (*Netrc)(nil).lookup("mirror.example"); ok {
+		t.Error("expected no entries from a nil netrc")
+	}
+}
+
+func TestParseNetrcMalformed(t *testing.T) {
+	for _, s := range []string{
+		"machine mirror.example login vbatts password",
+		"login vbatts",
+		"machine mirror.example user vbatts",
+	} {
+		if _, err := parseNetrc(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	n, err := parseNetrc(strings.NewReader("machine mirror.example login vbatts password sekrit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Path = "/home/vbatts/.netrc"
+	r := Syncer{Netrc: n}
+
+	user, pass, source := r.credentials(Mirror{URL: "https://mirror.example:8443/slackware/"})
+	if user != "vbatts" || pass != "sekrit" || source != n.Path {
+		t.Errorf("expected the netrc credentials; got %q, %q from %q", user, pass, source)
+	}
+	user, _, source = r.credentials(Mirror{URL: "https://mirror.example/", Username: "explicit", Password: "x"})
+	if user != "explicit" || source != "the config" {
+		t.Errorf("expected the configured credentials; got %q from %q", user, source)
+	}
+	if user, _, _ := r.credentials(Mirror{URL: "https://other.example/"}); user != "" {
+		t.Errorf("expected no credentials; got %q", user)
+	}
+}
@@ -0,0 +1,129 @@
+package feedsync
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// OPMLName is the file name of the OPML index in the dest directory
+const OPMLName = "index.opml"
+
+type opml struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Feeds   []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Type    string `xml:"type,attr"`
+	Text    string `xml:"text,attr"`
+	Title   string `xml:"title,attr"`
+	XMLURL  string `xml:"xmlUrl,attr"`
+	HTMLURL string `xml:"htmlUrl,attr,omitempty"`
+}
+
+// configFeed is a feed of the config, named as its files without the format
+// extension, with a file for each of its Formats
+type configFeed struct {
+	Base    string
+	Title   string
+	Link    string
+	Formats []string
+	Files   map[string]string
+}
+
+// configFeeds are the feeds of the enabled mirrors (and the CombinedFeed), in
+// config order
+func (r Syncer) configFeeds() []configFeed {
+	list := []configFeed{}
+	for _, mirror := range r.Config.Mirrors {
+		if !mirror.enabled() {
+			continue
+		}
+		for _, rel := range mirror.releases() {
+			base := mirror.feedName(rel)
+			link := fetch.JoinURL(mirror.publicURL(), rel.Name)
+			formats := r.Config.formats(mirror, rel)
+			files := func(base string) map[string]string {
+				names := map[string]string{}
+				for _, f := range formats {
+					names[f] = r.Config.feedFile(mirror, base, f)
+				}
+				return names
+			}
+			list = append(list, configFeed{base, r.Config.releaseTitle(mirror, rel), link, formats, files(base)})
+			if r.Config.securityFeeds(mirror) {
+				list = append(list, configFeed{base + securitySuffix, r.Config.securityTitle(mirror, rel), link, formats, files(base + securitySuffix)})
+			}
+			for _, pkg := range r.Config.watched(mirror, rel) {
+				list = append(list, configFeed{base + "-" + pkg, watchTitle(mirror, rel, pkg), link, formats, files(base + "-" + pkg)})
+			}
+		}
+	}
+	if name := r.Config.CombinedFeed; name != "" {
+		formats := r.Config.formats(Mirror{}, Release{})
+		list = append(list, configFeed{name, "ChangeLog.txt for " + name, "", formats, defaultFiles(name, formats)})
+	}
+	return list
+}
+
+// defaultFiles are the file names of the feed name in the formats, as its name
+// and their extension (as for the CombinedFeed)
+func defaultFiles(name string, formats []string) map[string]string {
+	files := map[string]string{}
+	for _, f := range formats {
+		files[f] = name + changelog.Formats[f].Ext
+	}
+	return files
+}
+
+// opmlFeeds are the outlines of every feed of the config, each in the RSS
+// format when it is written, or else in the first of its Formats
+func (r Syncer) opmlFeeds() []opmlOutline {
+	outlines := []opmlOutline{}
+	for _, feed := range r.configFeeds() {
+		format := feed.Formats[0]
+		for _, f := range feed.Formats {
+			if f == changelog.FormatRss {
+				format = f
+			}
+		}
+		outlines = append(outlines, opmlOutline{
+			Type:    "rss",
+			Text:    feed.Title,
+			Title:   feed.Title,
+			XMLURL:  fetch.JoinURL(r.Config.BaseURL, feed.Files[format]),
+			HTMLURL: feed.Link,
+		})
+	}
+	return outlines
+}
+
+// writeOPML writes the OPML index of the feeds to the dest directory, unless
+// it is unchanged
+func (r Syncer) writeOPML() error {
+	buf := bytes.NewBufferString(xml.Header)
+	e := xml.NewEncoder(buf)
+	e.Indent("", "  ")
+	if err := e.Encode(opml{Version: "2.0", Title: "sl-feeds", Feeds: r.opmlFeeds()}); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	path := filepath.Join(r.Dest, OPMLName)
+	if prev, err := ioutil.ReadFile(path); err == nil && bytes.Equal(prev, buf.Bytes()) {
+		return nil
+	}
+	return r.publishFile(OPMLName, time.Time{}, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
@@ -0,0 +1,78 @@
+package feedsync
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteOPML(t *testing.T) {
+	disabled := false
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: "http://slackware.osuosl.org/", Releases: []string{"slackware64-current"}},
+		Mirror{URL: "http://ftp.arm.slackware.com/slackwarearm/", Prefix: "arm-", Formats: []string{"atom", "json"}, Release: []Release{{Name: "slackwarearm-current", Title: "ARM current"}}},
+		Mirror{URL: "http://old.example/", Enabled: &disabled, Releases: []string{"slackware-14.0"}},
+	)
+	defer cleanup()
+	r.Config.OPML = true
+	r.Config.BaseURL = "https://example.com/feeds/"
+	r.Config.SecurityFeeds = true
+	r.Config.Watch = []Watch{{Release: "slackware64-current", Packages: []string{"openssl"}}}
+
+	if err := r.writeOPML(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(r.Dest, OPMLName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc opml
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []opmlOutline{
+		{"rss", "ChangeLog.txt for slackware64-current", "ChangeLog.txt for slackware64-current", "https://example.com/feeds/slackware64-current.rss", "http://slackware.osuosl.org/slackware64-current"},
+		{"rss", "Security fixes for slackware64-current", "Security fixes for slackware64-current", "https://example.com/feeds/slackware64-current-security.rss", "http://slackware.osuosl.org/slackware64-current"},
+		{"rss", "openssl updates in slackware64-current", "openssl updates in slackware64-current", "https://example.com/feeds/slackware64-current-openssl.rss", "http://slackware.osuosl.org/slackware64-current"},
+		{"rss", "ARM current", "ARM current", "https://example.com/feeds/arm-slackwarearm-current.atom", "http://ftp.arm.slackware.com/slackwarearm/slackwarearm-current"},
+		{"rss", "Security fixes for ARM current", "Security fixes for ARM current", "https://example.com/feeds/arm-slackwarearm-current-security.atom", "http://ftp.arm.slackware.com/slackwarearm/slackwarearm-current"},
+	}
+	if !reflect.DeepEqual(doc.Feeds, expected) {
+		t.Errorf("expected %#v; got %#v", expected, doc.Feeds)
+	}
+
+	// from the config, whatever is in the dest directory, and only written
+	// when changed
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.Dest, "slackware-14.0.rss"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.writeOPML(); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := os.Stat(path); err != nil || !os.SameFile(stat, again) {
+		t.Errorf("expected the unchanged index to be left alone (%v)", err)
+	}
+}
+
+func TestConfigOPMLProblems(t *testing.T) {
+	for _, c := range []struct {
+		config   Config
+		expected []string
+	}{
+		{Config{OPML: true, BaseURL: "https://example.com/feeds/"}, []string{}},
+		{Config{OPML: true}, []string{"OPML needs the BaseURL of the feeds"}},
+		{Config{BaseURL: "example.com/feeds"}, []string{`BaseURL "example.com/feeds" should be an http:// or https:// URL`}},
+	} {
+		if probs := c.config.Problems(); !reflect.DeepEqual(probs, c.expected) {
+			t.Errorf("expected %q; got %q", c.expected, probs)
+		}
+	}
+}
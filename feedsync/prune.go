@@ -0,0 +1,72 @@
+package feedsync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// prune removes the feed files (as recorded in the state) that no release of
+// the config writes any more, as when a release or mirror is removed, or a
+// format is no longer written. Their backups go with them, and the state
+// forgets those feeds. Only files recorded in the state are ever removed, and
+// with DryRun they are just listed.
+func (r Syncer) prune(state *State) error {
+	current := map[string]bool{}
+	configured := map[string]bool{}
+	for _, mirror := range r.Config.Mirrors {
+		for _, rel := range mirror.releases() {
+			configured[mirror.feedName(rel)] = true
+			for _, name := range r.outputs(mirror, rel) {
+				current[name] = true
+			}
+		}
+	}
+
+	feeds := []string{}
+	for feed := range state.Feeds {
+		feeds = append(feeds, feed)
+	}
+	sort.Strings(feeds)
+	for _, feed := range feeds {
+		fs := state.Feeds[feed]
+		kept := []string{}
+		for _, name := range fs.Files {
+			if current[name] || !prunable(name) {
+				kept = append(kept, name)
+				continue
+			}
+			fields := LogFields{Release: feed, Action: "prune"}
+			if r.DryRun {
+				r.output(levelInfo, fields, fmt.Sprintf("would prune %q", name))
+				continue
+			}
+			if err := r.publisher().Remove(name); err != nil {
+				return fmt.Errorf("pruning %q: %v", name, err)
+			}
+			if r.Publisher == nil {
+				if err := os.Remove(filepath.Join(r.Dest, name+backupExt)); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("pruning %q: %v", name+backupExt, err)
+				}
+			}
+			r.output(levelInfo, fields, fmt.Sprintf("pruned %q", name))
+		}
+		if r.DryRun {
+			continue
+		}
+		fs.Files = kept
+		if !configured[feed] {
+			delete(state.Feeds, feed)
+		}
+	}
+	return nil
+}
+
+// prunable is whether the file name of the state is within the dest, as a
+// state file that was edited by hand could have any path
+func prunable(name string) bool {
+	name = filepath.Clean(name)
+	return name != "." && !filepath.IsAbs(name) && name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
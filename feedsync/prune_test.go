@@ -0,0 +1,84 @@
+package feedsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+)
+
+func TestPrune(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}},
+		Mirror{URL: "file://" + dir, Prefix: "arm-", Releases: []string{"slackwarearm"}},
+	)
+	defer cleanup()
+	r.Config.Formats = []string{changelog.FormatRss, changelog.FormatAtom}
+	r.State = NewState()
+	results := r.pass()
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	r.State.Record(results, time.Now())
+	if files := r.State.Feeds["arm-slackwarearm"].Files; !reflect.DeepEqual(files, []string{"arm-slackwarearm.rss", "arm-slackwarearm.atom"}) {
+		t.Fatalf("expected the files of the feed recorded in the state; got %q", files)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(r.Dest, name))
+		return err == nil
+	}
+	// a file of the user's own, and one of the state edited to be outside
+	// the dest
+	if err := ioutil.WriteFile(filepath.Join(r.Dest, "notes.txt"), []byte("mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.Dest, "arm-slackwarearm.rss"+backupExt), []byte("backup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.State.Feeds["arm-slackwarearm"].Files = append(r.State.Feeds["arm-slackwarearm"].Files, "../outside.rss", "/etc/passwd")
+
+	// the mirror is removed, and the atom format
+	r.Config.Mirrors = r.Config.Mirrors[:1]
+	r.Config.Formats = []string{changelog.FormatRss}
+
+	r.DryRun = true
+	if err := r.prune(r.State); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("arm-slackwarearm.rss") || !exists("slackware64.atom") || r.State.Feeds["arm-slackwarearm"] == nil {
+		t.Fatal("expected nothing removed with DryRun")
+	}
+
+	r.DryRun = false
+	if err := r.prune(r.State); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"slackware64.rss":                  true,
+		"notes.txt":                        true,
+		"slackware64.atom":                 false,
+		"arm-slackwarearm.rss":             false,
+		"arm-slackwarearm.atom":            false,
+		"arm-slackwarearm.rss" + backupExt: false,
+	} {
+		if exists(name) != expected {
+			t.Errorf("%s: expected it to exist %v", name, expected)
+		}
+	}
+	if _, ok := r.State.Feeds["arm-slackwarearm"]; ok {
+		t.Error("expected the feed no longer of the config forgotten by the state")
+	}
+	if files := r.State.Feeds["slackware64"].Files; !reflect.DeepEqual(files, []string{"slackware64.rss"}) {
+		t.Errorf("expected the files of the feed still written; got %q", files)
+	}
+}
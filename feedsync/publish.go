@@ -0,0 +1,209 @@
+package feedsync
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/s3"
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// Publisher is where the generated files (the feeds, their signatures and
+// compressed copies, and the indexes) are published, by their names relative
+// to the Dest
+type Publisher interface {
+	// Stat is the mtime of the published file, or an error for which
+	// os.IsNotExist is true when there is none
+	Stat(name string) (time.Time, error)
+	// Open begins the publishing of the file, which is not seen until the
+	// Publication is committed
+	Open(name string) (Publication, error)
+	// Remove unpublishes the file, which is not an error when there is none
+	Remove(name string) error
+}
+
+// Publication is a file being published
+type Publication interface {
+	io.Writer
+	// Commit publishes what was written, as of mtime (or now, when it is
+	// zero)
+	Commit(mtime time.Time) error
+	// Abort discards what was written, leaving the file as it was
+	Abort()
+}
+
+// publisher is the Publisher of the Syncer, or else the Dest directory
+func (r Syncer) publisher() Publisher {
+	if r.Publisher != nil {
+		return r.Publisher
+	}
+	return dirPublisher(r.Dest)
+}
+
+// publishFile writes the file name by write, with the publisher of the Syncer
+func (r Syncer) publishFile(name string, mtime time.Time, write func(w io.Writer) error) error {
+	p, err := r.publisher().Open(name)
+	if err != nil {
+		return err
+	}
+	if err := write(p); err != nil {
+		p.Abort()
+		return err
+	}
+	return p.Commit(mtime)
+}
+
+// dirPublisher publishes to the local directory, atomically and with the mtime
+// of each file
+type dirPublisher string
+
+func (d dirPublisher) Stat(name string) (time.Time, error) {
+	stat, err := os.Stat(filepath.Join(string(d), name))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return stat.ModTime(), nil
+}
+
+func (d dirPublisher) Open(name string) (Publication, error) {
+	return util.CreateAtomic(filepath.Join(string(d), name))
+}
+
+func (d dirPublisher) Remove(name string) error {
+	err := os.Remove(filepath.Join(string(d), name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// s3LastModifiedHeader is the metadata of the objects of an s3Publisher with
+// their mtime, as the Last-Modified of S3 is when they were uploaded
+const s3LastModifiedHeader = "X-Amz-Meta-Last-Modified"
+
+// s3Publisher publishes to the objects under the prefix of the bucket
+type s3Publisher struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (p s3Publisher) key(name string) string {
+	return path.Join(p.prefix, filepath.ToSlash(name))
+}
+
+func (p s3Publisher) Stat(name string) (time.Time, error) {
+	header, err := p.client.Head(p.bucket, p.key(name))
+	if err == s3.ErrNotFound {
+		return time.Time{}, &os.PathError{Op: "stat", Path: p.client.URL(p.bucket, p.key(name)), Err: os.ErrNotExist}
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	if mtime, err := time.Parse(time.RFC3339Nano, header.Get(s3LastModifiedHeader)); err == nil {
+		return mtime, nil
+	}
+	// (an object not published by sl-feeds)
+	return http.ParseTime(header.Get("Last-Modified"))
+}
+
+func (p s3Publisher) Open(name string) (Publication, error) {
+	return &s3Publication{p: p, name: name}, nil
+}
+
+func (p s3Publisher) Remove(name string) error {
+	return p.client.Delete(p.bucket, p.key(name))
+}
+
+// s3Publication is buffered until it is committed, by a PUT of the object
+type s3Publication struct {
+	bytes.Buffer
+	p    s3Publisher
+	name string
+}
+
+func (o *s3Publication) Commit(mtime time.Time) error {
+	if mtime.IsZero() {
+		mtime = time.Now()
+	}
+	header := http.Header{}
+	header.Set(s3LastModifiedHeader, mtime.UTC().Format(time.RFC3339Nano))
+	if t := contentType(o.name); t != "" {
+		header.Set("Content-Type", t)
+	}
+	return o.p.client.Put(o.p.bucket, o.p.key(o.name), o.Bytes(), header)
+}
+
+func (o *s3Publication) Abort() {
+	o.Reset()
+}
+
+// contentTypes are those of the files that are published, by their extension
+var contentTypes = map[string]string{
+	".rss":  "application/rss+xml",
+	".atom": "application/atom+xml",
+	".json": "application/feed+json",
+	".asc":  "application/pgp-signature",
+	".gz":   "application/gzip",
+	".opml": "text/x-opml",
+	".html": "text/html; charset=utf-8",
+}
+
+// contentType is that of the file name, by its extension
+func contentType(name string) string {
+	if t, ok := contentTypes[filepath.Ext(name)]; ok {
+		return t
+	}
+	return mime.TypeByExtension(filepath.Ext(name))
+}
+
+// newPublisher is the Publisher for the config Dest, or nil for a local
+// directory
+func newPublisher(c Config, tlsConfig *tls.Config) (Publisher, error) {
+	bucket, prefix, ok := c.S3Dest()
+	if !ok {
+		return nil, nil
+	}
+	opts := S3{}
+	if c.S3 != nil {
+		opts = *c.S3
+	}
+	client := &s3.Client{
+		Endpoint:        firstNonEmpty(opts.Endpoint, os.Getenv("AWS_ENDPOINT_URL")),
+		Region:          firstNonEmpty(opts.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: opts.SecretAccessKey,
+	}
+	if client.AccessKeyID == "" && client.SecretAccessKey == "" {
+		client.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		client.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		client.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if client.AccessKeyID == "" || client.SecretAccessKey == "" {
+		return nil, errors.New("no S3 credentials, set the AccessKeyID and SecretAccessKey of S3, or $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	}
+	client.HTTPClient = fetch.NewClient(fetch.ClientOptions{TLSConfig: tlsConfig})
+	client.HTTPClient.Timeout = c.timeout()
+	return s3Publisher{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// errRemoteBackup is of rolling back the feeds of an s3:// Dest, which are
+// not backed up
+var errRemoteBackup = errors.New("the feeds of an s3:// Dest have no backups to roll back to")
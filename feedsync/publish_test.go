@@ -0,0 +1,102 @@
+package feedsync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/s3/s3test"
+)
+
+func TestS3Dest(t *testing.T) {
+	for _, tc := range []struct {
+		dest           string
+		bucket, prefix string
+		ok             bool
+	}{
+		{"/srv/feeds", "", "", false},
+		{"s3://feeds", "feeds", "", true},
+		{"s3://feeds/slackware/", "feeds", "slackware", true},
+	} {
+		c := Config{Dest: tc.dest, WorkDir: "/var/lib/sl-feeds"}
+		bucket, prefix, ok := c.S3Dest()
+		if bucket != tc.bucket || prefix != tc.prefix || ok != tc.ok {
+			t.Errorf("%q: expected %q, %q, %t; got %q, %q, %t", tc.dest, tc.bucket, tc.prefix, tc.ok, bucket, prefix, ok)
+		}
+		if expected := map[bool]string{false: tc.dest, true: c.WorkDir}[tc.ok]; c.LocalDest() != expected {
+			t.Errorf("%q: expected the local dest %q; got %q", tc.dest, expected, c.LocalDest())
+		}
+	}
+
+	probs := strings.Join(Config{Dest: "s3://feeds", ExtraDests: []string{"/srv/feeds"}}.Problems(), "; ")
+	if !strings.Contains(probs, "needs a WorkDir") || !strings.Contains(probs, "ExtraDests and FTPUpload") {
+		t.Errorf("expected the problems of the s3:// Dest; got %q", probs)
+	}
+}
+
+func TestRunS3Publisher(t *testing.T) {
+	server := s3test.NewServer("AKID")
+	defer server.Close()
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.Dest, r.Config.WorkDir = "s3://feeds/slackware", r.Dest
+	r.Config.S3 = &S3{Endpoint: server.URL, AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	r.Config.CompressOutput = true
+	if r.Publisher, err = newPublisher(r.Config, nil); err != nil {
+		t.Fatal(err)
+	}
+	if results := r.pass(); len(results) != 1 || results[0].Err != nil || results[0].New == 0 {
+		t.Fatalf("unexpected results %#v", results)
+	}
+
+	objects := server.Objects()
+	o, ok := objects["feeds/slackware/slackware64.rss"]
+	if !ok || !strings.Contains(string(o.Data), "<rss") {
+		t.Fatalf("expected the feed published; got %d objects", len(objects))
+	}
+	if _, ok := objects["feeds/slackware/slackware64.rss.gz"]; !ok {
+		t.Error("expected the compressed copy published")
+	}
+	if o.Header.Get("Content-Type") != "application/rss+xml" {
+		t.Errorf("expected the Content-Type of RSS; got %q", o.Header.Get("Content-Type"))
+	}
+	mtime, err := r.publisher().Stat("slackware64.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(filepath.Join(dir, "slackware64", "ChangeLog.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mtime.Equal(stat.ModTime()) {
+		t.Errorf("expected the mtime of the ChangeLog %s; got %s", stat.ModTime(), mtime)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "slackware64.rss")); !os.IsNotExist(err) {
+		t.Errorf("expected no feed in the WorkDir; got %v", err)
+	}
+	if _, err := r.publisher().Stat("missing.rss"); !os.IsNotExist(err) {
+		t.Errorf("expected a missing feed to not exist; got %v", err)
+	}
+
+	// the published feed is as new as the ChangeLog, so it is not put again
+	before := len(server.Requests())
+	if results := r.pass(); results[0].Err != fetch.ErrNotNewer {
+		t.Fatalf("expected the feed to not be newer; got %v", results[0].Err)
+	}
+	for _, req := range server.Requests()[before:] {
+		if strings.HasPrefix(req, "PUT ") {
+			t.Errorf("expected only the stat of the feed; got %q", req)
+		}
+	}
+
+	if err := r.Rollback("slackware64"); err != errRemoteBackup {
+		t.Errorf("expected no rollback of an s3:// Dest; got %v", err)
+	}
+}
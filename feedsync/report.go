@@ -0,0 +1,191 @@
+package feedsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// Report is the JSON report of a run
+type Report struct {
+	Start    time.Time
+	Duration string
+	Feeds    []ReportFeed
+	Transfer TransferTotals
+	// Notices are those of the State about the run, like of a mirror backing
+	// off or a feed gone stale, which are only given once
+	Notices []string `json:",omitempty"`
+	// Results are the outcome of each release, in the order of the Config
+	Results []ReleaseResult `json:"-"`
+}
+
+// ReportFeed is the outcome of one release in the Report
+type ReportFeed struct {
+	Feed       string
+	Mirror     string
+	Status     string
+	Error      string `json:",omitempty"`
+	NewEntries int
+	Entries    int
+	Retried    bool              `json:",omitempty"`
+	Dests      map[string]string `json:",omitempty"`
+	Requests   []fetch.Stats
+	// Added and Removed are the items that changed, compared to the
+	// previous feed
+	Added   []FeedItem `json:",omitempty"`
+	Removed []FeedItem `json:",omitempty"`
+	// Parse is the figures of the ChangeLog, when it was parsed
+	Parse *changelog.ParseStats `json:",omitempty"`
+	// NextRun is when --daemon is next to process the feed
+	NextRun *time.Time `json:",omitempty"`
+	// Stale is why the newest entry of the feed is unusually old, when it is
+	Stale string `json:",omitempty"`
+}
+
+// TransferTotals sums up the requests of a run
+type TransferTotals struct {
+	Requests int
+	Bytes    int64
+	// Saved is the bytes not transferred, compared to fetching the whole of
+	// each resource requested
+	Saved int64
+}
+
+// String is the totals for the user, like "fetched 1.2 MB in 3 requests (saved 9.4 MB vs full fetches)"
+func (t TransferTotals) String() string {
+	reqWord := "requests"
+	if t.Requests == 1 {
+		reqWord = "request"
+	}
+	return fmt.Sprintf("fetched %s in %d %s (saved %s vs full fetches)", humanBytes(t.Bytes), t.Requests, reqWord, humanBytes(t.Saved))
+}
+
+func transferTotals(results []ReleaseResult) TransferTotals {
+	t := TransferTotals{}
+	for _, r := range results {
+		for _, s := range r.Requests {
+			t.Requests++
+			t.Bytes += s.Bytes
+			t.Saved += s.Saved()
+		}
+	}
+	return t
+}
+
+// passSummary is the outcome of a run that took d for the user, like "3
+// feeds in 2.1s: 1 updated, 1 unchanged, 1 failed; fetched ..."
+func passSummary(results []ReleaseResult, d time.Duration) string {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status()]++
+	}
+	statuses := []string{}
+	for _, status := range []string{"updated", "unchanged", "failed", "skipped", "deferred", "backoff"} {
+		if counts[status] > 0 {
+			statuses = append(statuses, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	feedWord := "feeds"
+	if len(results) == 1 {
+		feedWord = "feed"
+	}
+	return fmt.Sprintf("%d %s in %s: %s; %s", len(results), feedWord, d.Round(100*time.Millisecond), strings.Join(statuses, ", "), transferTotals(results))
+}
+
+// runSummary is the passSummary of a run, followed by a line for each of the
+// failed feeds with the reason
+func runSummary(results []ReleaseResult, d time.Duration) string {
+	lines := []string{passSummary(results, d)}
+	for _, res := range results {
+		if res.Failed() {
+			lines = append(lines, fmt.Sprintf("  %s: %s", res.Name, res.Error()))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newReport is the Report of the results of a run that began at start
+func newReport(results []ReleaseResult, start time.Time) Report {
+	rep := Report{
+		Start:    start,
+		Duration: time.Since(start).String(),
+		Feeds:    []ReportFeed{},
+		Transfer: transferTotals(results),
+		Results:  results,
+	}
+	for _, r := range results {
+		f := ReportFeed{
+			Feed:       r.Name,
+			Mirror:     r.Mirror,
+			Status:     r.Status(),
+			Error:      r.Error(),
+			NewEntries: r.New,
+			Entries:    r.Entries,
+			Retried:    r.Retried,
+			Requests:   r.Requests,
+			Added:      r.Delta.Added,
+			Removed:    r.Delta.Removed,
+			Parse:      r.Parse,
+			Stale:      r.Stale,
+		}
+		if f.Requests == nil {
+			f.Requests = []fetch.Stats{}
+		}
+		if len(r.Dests) > 0 {
+			f.Dests = map[string]string{}
+			for dest, err := range r.Dests {
+				f.Dests[dest] = "ok"
+				if err != nil {
+					f.Dests[dest] = err.Error()
+				}
+			}
+		}
+		rep.Feeds = append(rep.Feeds, f)
+	}
+	return rep
+}
+
+// WriteReportFile atomically writes the JSON Report to path
+func WriteReportFile(path string, rep Report) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, time.Time{}, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// humanDuration formats d in days when it is more than a couple of them,
+// like "30d", and otherwise to the hour or minute like "12h0m0s"
+func humanDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d >= 2*day:
+		return fmt.Sprintf("%dd", int(d.Round(day)/day))
+	case d >= time.Hour:
+		return d.Round(time.Hour).String()
+	}
+	return d.Round(time.Minute).String()
+}
+
+// humanBytes formats n like "9.4 MB"
+func humanBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,95 @@
+package feedsync
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+func TestReport(t *testing.T) {
+	results := []ReleaseResult{
+		{Name: "slackware64-current", Mirror: "mirror.example", New: 2, Entries: 10, Requests: []fetch.Stats{
+			{Method: "HEAD", StatusCode: 200, ContentLength: 9400000},
+			{Method: "GET", StatusCode: 200, Bytes: 1000, ContentLength: 1000},
+		}},
+		{Name: "slackware64-14.2", Mirror: "mirror.example", Err: fetch.ErrNotNewer, Requests: []fetch.Stats{
+			{Method: "HEAD", StatusCode: 200, ContentLength: 500},
+		}},
+		{Name: "slackwarearm-current", Mirror: "mirror.example", Err: errors.New("404 status")},
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteReportFile(path, newReport(results, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rep.Feeds) != len(results) {
+		t.Fatalf("expected %d feeds; got %d", len(results), len(rep.Feeds))
+	}
+	for i, status := range []string{"updated", "unchanged", "failed"} {
+		if rep.Feeds[i].Status != status {
+			t.Errorf("%s: expected status %q; got %q", rep.Feeds[i].Feed, status, rep.Feeds[i].Status)
+		}
+	}
+	if rep.Feeds[2].Error != "404 status" {
+		t.Errorf("expected the error to be reported; got %q", rep.Feeds[2].Error)
+	}
+	expected := TransferTotals{Requests: 3, Bytes: 1000, Saved: 9400500}
+	if rep.Transfer != expected {
+		t.Errorf("expected totals %+v; got %+v", expected, rep.Transfer)
+	}
+	if s := rep.Transfer.String(); s != "fetched 1.0 kB in 3 requests (saved 9.4 MB vs full fetches)" {
+		t.Errorf("unexpected summary %q", s)
+	}
+}
+
+func TestPassSummary(t *testing.T) {
+	results := []ReleaseResult{
+		{Name: "slackware64-current", Requests: []fetch.Stats{{Method: "GET", StatusCode: 200, Bytes: 1000, ContentLength: 1000}}},
+		{Name: "slackware64-14.2", Err: fetch.ErrNotNewer, Requests: []fetch.Stats{{Method: "GET", StatusCode: 304}}},
+		{Name: "slackwarearm-current", Err: errors.New("404 status")},
+	}
+	expected := "3 feeds in 2.1s: 1 updated, 1 unchanged, 1 failed; fetched 1.0 kB in 2 requests (saved 0 B vs full fetches)"
+	if s := passSummary(results, 2140*time.Millisecond); s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	results := []ReleaseResult{
+		{Name: "slackware64-current"},
+		{Name: "slackwarearm-current", Err: errors.New("404 status")},
+		{Name: "slackware-current", Err: ErrFailFast},
+	}
+	expected := "3 feeds in 1s: 1 updated, 1 failed, 1 skipped; fetched 0 B in 0 requests (saved 0 B vs full fetches)\n  slackwarearm-current: 404 status"
+	if s := runSummary(results, time.Second); s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	for n, expected := range map[int64]string{
+		0:          "0 B",
+		999:        "999 B",
+		1000:       "1.0 kB",
+		9400000:    "9.4 MB",
+		1500000000: "1.5 GB",
+	} {
+		if got := humanBytes(n); got != expected {
+			t.Errorf("%d: expected %q; got %q", n, expected, got)
+		}
+	}
+}
@@ -0,0 +1,1137 @@
+package feedsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/util"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Syncer does a pass over all the configured mirrors and their releases
+type Syncer struct {
+	Config Config
+	Dest   string
+	Quiet  bool
+	// Logger is where the per-release output goes
+	Logger *log.Logger
+	// Verbose also logs the debug details, like each request made
+	Verbose bool
+	// LogJSON logs each line as a JSON object (see logLine), rather than text
+	LogJSON bool
+	// Signer, when set, produces a detached signature for each generated file
+	Signer *openpgp.Entity
+	// Statsd, when set, gets the metrics of the run
+	Statsd *Statsd
+	// Trace, when set, logs the low-level details of every request
+	Trace *log.Logger
+	// Netrc, when set, has the credentials for mirrors without a Username
+	Netrc *Netrc
+	// DialContext, when set, makes the connections to the mirrors
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// TLSConfig, when set, is for the connections to the mirrors and of the
+	// FTP upload, like with the --ca and --insecure
+	TLSConfig *tls.Config
+	// Client, when set, makes the requests to every mirror, in place of the
+	// clients of their TLS, proxy and connection settings
+	Client *http.Client
+	// State, when set, is used for the circuit breakers of the mirrors. Run
+	// loads it from the Dest when it is not.
+	State *State
+	// Only, when set, limits the run to these releases (or feed names)
+	Only []string
+	// OnlyMirrors, when set, limits the run to the mirrors of these names
+	OnlyMirrors []string
+	// Offline regenerates the feeds from the cached ChangeLogs, without
+	// making any requests
+	Offline bool
+	// FailFast stops the run at the first release that fails, leaving the
+	// rest unattempted
+	FailFast bool
+	// DryRun fetches and renders the feeds, logging what would change, but
+	// writes nothing to the dest directories
+	DryRun bool
+	// Force fetches the ChangeLog of every release and writes its feeds,
+	// regardless of the State and the times of the files
+	Force bool
+	// NoRedirects fails a release whose mirror redirects, rather than
+	// following it
+	NoRedirects bool
+	// NoHooks does not run the OnUpdate commands, nor send to the Webhooks
+	NoHooks bool
+	// Limiter, when set, throttles the requests to each host. Otherwise Run
+	// has one of its own, by the RequestDelay and MaxPerHost of the Config.
+	Limiter *fetch.HostLimiter
+	// Publisher, when set, is where the feeds are published, rather than the
+	// Dest directory (which then has only the state and cache)
+	Publisher Publisher
+	// Interval, when set, is how often Run is done (as by a daemon), for when
+	// each feed is next due, in the State and the Report
+	Interval time.Duration
+
+	// ctx is that of the Run (or SyncRelease) in progress, after which no
+	// more releases are attempted
+	ctx context.Context
+}
+
+// selected is whether the release of mirror is to be processed this run
+func (r Syncer) selected(mirror Mirror, rel Release) bool {
+	if len(r.OnlyMirrors) > 0 && !contains(r.OnlyMirrors, mirror.name()) {
+		return false
+	}
+	if len(r.Only) > 0 && !contains(r.Only, rel.Name) && !contains(r.Only, mirror.feedName(rel)) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseResult is the outcome of processing one release of a mirror
+type ReleaseResult struct {
+	// Name is the name of the feed, that is Prefix+Release
+	Name string
+	// Mirror is the name of the mirror the release is from
+	Mirror string
+	// Err is nil when the feed was written, and fetch.ErrNotNewer when it was
+	// left unchanged
+	Err error
+	// New is the number of new ChangeLog entries written to the feed
+	New int
+	// Created is whether any feed file did not exist before
+	Created bool
+	// Entries is the number of ChangeLog entries parsed
+	Entries int
+	// Retried is whether this is the result of a second attempt
+	Retried bool
+	// Requests are the stats of each request made for the release
+	Requests []fetch.Stats
+	// Dests is the outcome of copying the feed to each of the ExtraDests
+	Dests map[string]error
+	// Delta is the items added and removed, compared to the previous feed
+	Delta delta
+	// Parse is the figures of the ChangeLog, when it was parsed
+	Parse *changelog.ParseStats
+	// Stale is why the newest entry of the feed is unusually old, when it is
+	Stale string
+	// ETag and LastModified are of the ChangeLog, when it was fetched
+	ETag         string
+	LastModified time.Time
+	// Checksum is the sha256 of the ChangeLog, when it was fetched
+	Checksum string
+	// Redirect is the URL the ChangeLog was fetched from in the end, when the
+	// mirror redirected to it
+	Redirect string
+	// HookFailures is how many of the OnUpdate commands and Webhooks failed
+	HookFailures int
+	// MinDate is the cutoff of the entries written to the feed, when it has
+	// one
+	MinDate time.Time
+	// Files are the feed files, when it was written
+	Files []string
+}
+
+// ErrDeferred is the result of a release whose mirror is outside its Window
+var ErrDeferred = errors.New("deferred until the mirror's window")
+
+// ErrBackoff is the result of a release whose mirror is backing off after
+// repeated failures
+var ErrBackoff = errors.New("backing off the mirror after repeated failures")
+
+// Skipped is whether the release was not attempted this run, because of its
+// mirror's Window or backing off
+func (r ReleaseResult) Skipped() bool {
+	return r.Err == ErrDeferred || r.Err == ErrBackoff || r.Err == ErrFailFast
+}
+
+// Status is a one word summary of the result
+func (r ReleaseResult) Status() string {
+	switch {
+	case r.Err == ErrDeferred:
+		return "deferred"
+	case r.Err == ErrBackoff:
+		return "backoff"
+	case r.Err == ErrFailFast:
+		return "skipped"
+	case r.Failed():
+		return "failed"
+	case r.Err == fetch.ErrNotNewer:
+		return "unchanged"
+	}
+	return "updated"
+}
+
+// dryRun is what writing the feed would have done, for a dry run
+func (r ReleaseResult) dryRun() string {
+	switch {
+	case r.Err == fetch.ErrNotNewer:
+		return "would be left alone, the ChangeLog is not newer than the feed"
+	case r.Created:
+		return fmt.Sprintf("would be created, with %d entries", r.Entries)
+	}
+	return fmt.Sprintf("would be updated, with %d new entries", r.New)
+}
+
+// Failed is whether this release had a problem (not just being unchanged or
+// skipped)
+func (r ReleaseResult) Failed() bool {
+	return r.Error() != ""
+}
+
+// Error is the problems (if any) with this release, including those from
+// copying to the ExtraDests
+func (r ReleaseResult) Error() string {
+	msgs := []string{}
+	if r.Err != nil && r.Err != fetch.ErrNotNewer && !r.Skipped() {
+		msgs = append(msgs, r.Err.Error())
+	}
+	for _, dest := range sortedKeys(r.Dests) {
+		if r.Dests[dest] != nil {
+			msgs = append(msgs, fmt.Sprintf("copying to %q: %s", dest, r.Dests[dest]))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func sortedKeys(m map[string]error) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pass processes every release of every mirror:
+//   - if there is not a $release.RSS file, then fetch the whole ChangeLog
+//   - if there is a $release.RSS file, then only fetch remote if it is newer than the ChangeLog last written from (by the State), or else than the local RSS file
+//   - if the remote returns any error (404, 503, etc) then print a warning but continue
+//
+// Up to the Jobs of the Config are processed at once, and the results are in
+// the order of the Config regardless.
+func (r Syncer) pass() []ReleaseResult {
+	type job struct {
+		mirror Mirror
+		rel    Release
+		res    ReleaseResult
+	}
+	jobs, pending := []*job{}, []*job{}
+	now := time.Now()
+	if r.Limiter == nil {
+		r.Limiter = r.Config.hostLimiter()
+	}
+	for _, mirror := range r.Config.Mirrors {
+		if !mirror.enabled() {
+			continue
+		}
+		var skip error
+		if mirror.Window != "" && !r.Offline {
+			// the config has already been validated
+			if w, _ := parseWindow(mirror.Window); !w.contains(now) {
+				skip = ErrDeferred
+			}
+		}
+		if r.State != nil && !r.Offline {
+			if ms, ok := r.State.Mirrors[mirror.name()]; ok && now.Before(ms.BackoffUntil) {
+				skip = ErrBackoff
+			}
+		}
+		for _, rel := range mirror.releases() {
+			if !r.selected(mirror, rel) {
+				continue
+			}
+			j := &job{mirror: mirror, rel: rel, res: ReleaseResult{Name: mirror.feedName(rel), Mirror: mirror.name()}}
+			if skip != nil {
+				j.res.Err = skip
+				r.Infof(LogFields{Release: j.res.Name, Mirror: j.res.Mirror, Action: "skip", Err: j.res.Err}, "%v", j.res.Err)
+			} else {
+				pending = append(pending, j)
+			}
+			jobs = append(jobs, j)
+		}
+	}
+
+	// each job is processed by one of the workers, and a failure of one has
+	// no bearing on the others, unless with FailFast
+	halt := make(chan struct{})
+	var haltOnce sync.Once
+	halted := func() bool {
+		select {
+		case <-halt:
+			return true
+		default:
+			return false
+		}
+	}
+	work := func(pending []*job, retried bool) {
+		sem := make(chan struct{}, r.Config.jobs())
+		var wg sync.WaitGroup
+		for _, j := range pending {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(j *job) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if halted() {
+					j.res.Err = ErrFailFast
+					return
+				}
+				j.res = r.process(j.mirror, j.rel)
+				j.res.Retried = retried
+				if r.FailFast && j.res.Failed() {
+					haltOnce.Do(func() {
+						r.Errorf(LogFields{Release: j.res.Name, Mirror: j.res.Mirror, Action: "stop", Err: j.res.Err}, "failed, not attempting the rest")
+						close(halt)
+					})
+				}
+			}(j)
+		}
+		wg.Wait()
+	}
+	work(pending, false)
+
+	// give transient failures one more try, now that everything else is done
+	retries := []*job{}
+	for _, j := range jobs {
+		if !fetch.Retryable(j.res.Err) || r.pastDeadline() || r.stopped() || halted() {
+			continue
+		}
+		r.Infof(LogFields{Release: j.res.Name, Mirror: j.res.Mirror, Action: "retry", Err: j.res.Err}, "retrying")
+		retries = append(retries, j)
+	}
+	work(retries, true)
+
+	var up *uploader
+	if r.Config.FTPUpload != nil && !r.DryRun {
+		up = &uploader{r: r, conf: *r.Config.FTPUpload}
+		defer up.close()
+	}
+
+	results := []ReleaseResult{}
+	for _, j := range jobs {
+		res := j.res
+		if !res.Skipped() && !r.DryRun {
+			if len(r.Config.ExtraDests) > 0 || up != nil {
+				res.Dests = r.copyToExtraDests(r.outputs(j.mirror, j.rel))
+				if up != nil {
+					for dest, err := range up.upload(r.outputs(j.mirror, j.rel)) {
+						res.Dests[dest] = err
+					}
+				}
+				for _, dest := range sortedKeys(res.Dests) {
+					if res.Dests[dest] != nil {
+						r.Errorf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "upload", Err: res.Dests[dest]}, "%s: %v", dest, res.Dests[dest])
+					}
+				}
+			}
+			r.Statsd.Count("feed."+statsdName(res.Name)+".entries", int64(res.Entries))
+			if res.Err == nil {
+				r.Statsd.Count("feeds_updated", 1)
+			}
+			if res.Failed() {
+				r.Statsd.Count("failures", 1)
+				r.Statsd.Count("feed."+statsdName(res.Name)+".failures", 1)
+			}
+		}
+		res.Stale = r.staleness(j.rel, res, now)
+		results = append(results, res)
+	}
+
+	// the combined feed is of what was fetched this run, or before
+	if r.Config.CombinedFeed != "" && !r.DryRun && !r.stopped() {
+		names, err := r.writeCombinedFeed()
+		if err != nil {
+			r.Errorf(LogFields{Action: "combine", Err: err}, "%s: %v", r.Config.CombinedFeed, err)
+		}
+		r.publish(r.Config.CombinedFeed, names, up)
+	}
+	if r.Config.OPML && !r.DryRun {
+		if err := r.writeOPML(); err != nil {
+			r.Errorf(LogFields{Action: "write", Err: err}, "%s: %v", OPMLName, err)
+		} else {
+			r.publish(OPMLName, []string{OPMLName}, up)
+		}
+	}
+	if r.Config.HTMLIndex && !r.DryRun {
+		if err := r.writeHTMLIndex(); err != nil {
+			r.Errorf(LogFields{Action: "write", Err: err}, "%s: %v", HTMLIndexName, err)
+		} else {
+			r.publish(HTMLIndexName, []string{HTMLIndexName}, up)
+		}
+	}
+	return results
+}
+
+// publish copies the files names (of the feed name) to the ExtraDests, and
+// uploads them, logging any failures
+func (r Syncer) publish(name string, names []string, up *uploader) {
+	if len(names) == 0 || (len(r.Config.ExtraDests) == 0 && up == nil) {
+		return
+	}
+	dests := r.copyToExtraDests(names)
+	if up != nil {
+		for dest, err := range up.upload(names) {
+			dests[dest] = err
+		}
+	}
+	for _, dest := range sortedKeys(dests) {
+		if dests[dest] != nil {
+			r.Errorf(LogFields{Action: "upload", Err: dests[dest]}, "%s: %s: %v", name, dest, dests[dest])
+		}
+	}
+}
+
+// ErrDeadline is the result of a release not attempted before the run's
+// deadline
+var ErrDeadline = errors.New("not attempted before the run deadline")
+
+func (r Syncer) pastDeadline() bool {
+	return r.ctx != nil && r.ctx.Err() == context.DeadlineExceeded
+}
+
+// ErrInterrupted is the result of a release not attempted before the context
+// of the run was canceled
+var ErrInterrupted = errors.New("not attempted before the run was interrupted")
+
+// ErrFailFast is the result of a release not attempted, with FailFast, after
+// another one failed
+var ErrFailFast = errors.New("not attempted after another release failed")
+
+func (r Syncer) stopped() bool {
+	return r.ctx != nil && r.ctx.Err() == context.Canceled
+}
+
+// runContext is the ctx of the run, for the requests of its releases to be
+// cancelled along with it
+func (r Syncer) runContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WriteError is an error writing the outputs of a release, as opposed to
+// fetching or parsing its ChangeLog
+type WriteError struct {
+	Err error
+}
+
+func (e WriteError) Error() string { return e.Err.Error() }
+func (e WriteError) Unwrap() error { return e.Err }
+
+// process is the result of fetching and writing one release
+func (r Syncer) process(mirror Mirror, rel Release) ReleaseResult {
+	res := ReleaseResult{Name: mirror.feedName(rel), Mirror: mirror.name()}
+	if r.stopped() {
+		res.Err = ErrInterrupted
+	} else if r.pastDeadline() {
+		res.Err = ErrDeadline
+	} else {
+		res.Err = r.release(mirror, rel, &res)
+	}
+	fields := LogFields{Release: res.Name, Mirror: res.Mirror, Action: "release", Err: res.Err}
+	if res.Err == fetch.ErrNotNewer {
+		if !r.DryRun {
+			r.Infof(fields, "%v", res.Err)
+		}
+	} else if res.Err != nil {
+		r.Errorf(fields, "%v", res.Err)
+	}
+	if r.DryRun && !res.Failed() {
+		// even when quiet, as it is what the dry run is for
+		r.output(levelInfo, fields, res.dryRun())
+	}
+	return res
+}
+
+// outputs are the file names, relative to the dest dir, that are produced for
+// this release
+func (r Syncer) outputs(mirror Mirror, rel Release) []string {
+	feeds := r.Config.feedFiles(mirror, rel)
+	names := append([]string{}, feeds...)
+	for _, name := range feeds {
+		if r.Signer != nil {
+			names = append(names, name+SigExt)
+		}
+		if r.Config.CompressOutput {
+			names = append(names, name+GzExt)
+		}
+	}
+	return names
+}
+
+// copyToExtraDests copies the named outputs from the Dest dir into each of the
+// ExtraDests, whenever the copy there is missing or differs in mtime or size.
+// Each destination is attempted regardless of the others failing.
+func (r Syncer) copyToExtraDests(names []string) map[string]error {
+	errs := map[string]error{}
+	for _, extra := range r.Config.ExtraDests {
+		extra = os.ExpandEnv(extra)
+		errs[extra] = nil
+		for _, name := range names {
+			src := filepath.Join(r.Dest, name)
+			srcStat, err := os.Stat(src)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				errs[extra] = err
+				break
+			}
+			dst := filepath.Join(extra, name)
+			dstStat, err := os.Stat(dst)
+			if err == nil && dstStat.Size() == srcStat.Size() && dstStat.ModTime().Equal(srcStat.ModTime()) {
+				continue
+			}
+			if err := util.CopyFileAtomic(src, dst); err != nil {
+				errs[extra] = err
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// release fetches and writes the feed for one release of the mirror, noting
+// the counts of entries in res
+func (r Syncer) release(mirror Mirror, rel Release, res *ReleaseResult) error {
+	release := rel.Name
+
+	// the feed is only as new as the oldest of its files
+	var (
+		entries []changelog.Entry
+		mtime   time.Time
+		since   time.Time
+		missing bool
+		exists  bool
+	)
+	for _, name := range r.Config.feedFiles(mirror, rel) {
+		modTime, err := r.publisher().Stat(name)
+		if os.IsNotExist(err) {
+			missing = true
+			continue
+		} else if err != nil {
+			return WriteError{err}
+		}
+		exists = true
+		if since.IsZero() || modTime.Before(since) {
+			since = modTime
+		}
+	}
+	// the State is trusted over the times of the files, that are not kept by
+	// every copy or restore of them
+	fs := r.feedState(res.Name)
+	if fs != nil && !fs.LastModified.IsZero() {
+		since = fs.LastModified
+	}
+	res.MinDate = r.minDate(res.Name, exists)
+	var err error
+	if r.Offline {
+		repo := cachedRepo(r.Dest, res.Name)
+		repo.Parsed = r.parsed(res)
+		r.Infof(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "fetch"}, "processing %q", fetch.JoinURL(mirror.URL, release))
+		// every feed is regenerated, whether or not the cache is newer
+		entries, mtime, err = repo.ChangeLogContext(r.runContext())
+		if err != nil {
+			return cachedError(res.Name, err)
+		}
+	} else {
+		// the feed links to whichever mirror URL it is from
+		entries, mtime, mirror, err = r.fetchChangeLog(mirror, rel, res, since, missing || r.Force)
+		if err != nil {
+			return err
+		}
+		if !missing && !r.Force && fs != nil && fs.Checksum != "" && fs.Checksum == res.Checksum {
+			r.Infof(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "fetch"}, "the ChangeLog is unchanged, only its last-modified is newer")
+			return fetch.ErrNotNewer
+		}
+	}
+	link := fetch.JoinURL(mirror.publicURL(), release)
+	if res.Redirect != "" {
+		link = r.redirected(mirror, rel, res)
+	}
+
+	res.Entries = len(entries)
+	res.Created = missing
+	if !res.MinDate.IsZero() {
+		entries = entriesSince(entries, res.MinDate)
+	}
+
+	// write out each format and chtime it to be mtime
+	opts := changelog.FeedOptions{
+		Granularity: r.Config.granularity(mirror),
+		SortOrder:   r.Config.sortOrder(mirror),
+		ItemFormat:  r.Config.itemFormat(mirror),
+		Reflow:      r.Config.reflow(mirror),
+		Title:       r.Config.releaseTitle(mirror, rel),
+		Description: r.Config.releaseDescription(mirror, rel),
+		Release:     release,
+		ItemLink:    r.Config.itemLink(mirror, rel),
+	}
+	// (as problems has it)
+	opts.Author, opts.AuthorEmail, _ = parseAuthor(r.Config.author(mirror))
+	opts.MassRebuildThreshold, opts.MassRebuildShow = r.Config.massRebuild(mirror)
+	filtered := changelog.FilterPackages(entries, mirror.IncludePackages, mirror.ExcludePackages)
+	if err := r.writeFeeds(mirror, rel, mirror.feedName(rel), link, filtered, opts, mtime, res); err != nil {
+		return err
+	}
+	if r.Config.securityFeeds(mirror) {
+		opts.Title = r.Config.securityTitle(mirror, rel)
+		security := changelog.SecurityFixes(filtered)
+		if err := r.writeFeeds(mirror, rel, mirror.feedName(rel)+securitySuffix, link, security, opts, mtime, nil); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range r.Config.watched(mirror, rel) {
+		// an item per entry, for the package to be in the feed once per entry
+		pkgOpts := opts
+		pkgOpts.Granularity = changelog.GranularityEntry
+		pkgOpts.Title = watchTitle(mirror, rel, pkg)
+		pkgEntries := changelog.PackageEntries(entries, pkg)
+		if err := r.writeFeeds(mirror, rel, mirror.feedName(rel)+"-"+pkg, link, pkgEntries, pkgOpts, mtime, nil); err != nil {
+			return err
+		}
+	}
+	res.New = countNewer(entries, since)
+	res.Files = r.outputs(mirror, rel)
+	if res.New > 0 && !r.DryRun && !r.NoHooks {
+		r.runHooks(mirror, rel, res, entries, since, mtime)
+		r.sendWebhooks(mirror, rel, res, entries, since)
+	}
+	return nil
+}
+
+// FetchEntries fetches the ChangeLog entries of rel as for its feeds, but
+// regardless of how new it is
+func (r Syncer) FetchEntries(mirror Mirror, rel Release) ([]changelog.Entry, error) {
+	res := ReleaseResult{Name: mirror.feedName(rel), Mirror: mirror.name()}
+	entries, _, _, err := r.fetchChangeLog(mirror, rel, &res, time.Time{}, true)
+	return entries, err
+}
+
+// fetchChangeLog fetches the ChangeLog of rel (only when newer than since,
+// unless a feed file is missing) from the first reachable mirror URL, falling
+// back to the next on a network error or a 5xx response. The mirror is
+// returned with the URL fetched from.
+func (r Syncer) fetchChangeLog(mirror Mirror, rel Release, res *ReleaseResult, since time.Time, missing bool) ([]changelog.Entry, time.Time, Mirror, error) {
+	var (
+		entries []changelog.Entry
+		mtime   time.Time
+		err     error
+	)
+	urls := mirror.urls()
+	if len(urls) == 0 {
+		return nil, mtime, mirror, errors.New("no URL")
+	}
+	for i, u := range urls {
+		m := mirror.withURL(u)
+		if i > 0 {
+			r.Errorf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "fetch", Err: err}, "falling back to %q, as %q failed (%v)", u, urls[i-1], err)
+		}
+		var repo fetch.Repo
+		if repo, err = r.mirrorRepo(m, rel.Name, res); err != nil {
+			return nil, mtime, m, err
+		}
+		repo.Parsed = r.parsed(res)
+		limited := r.Config.feedOnly(m, rel)
+		if limited {
+			repo.MaxEntries, repo.MinDate = r.Config.MaxItems, res.MinDate
+		}
+		r.Infof(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "fetch"}, "processing %q", fetch.JoinURL(m.URL, rel.Name))
+		if missing {
+			entries, mtime, err = repo.ChangeLogContext(r.runContext())
+		} else {
+			// compare times
+			entries, mtime, err = repo.NewerChangeLogContext(r.runContext(), since)
+		}
+		if err == nil && limited && res.Checksum == "" && !r.DryRun {
+			// read short, so not cached, and the cache is of an older one
+			if err := removeCache(r.Dest, res.Name); err != nil {
+				r.Warnf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "cache", Err: err}, "removing the cached ChangeLog: %v", err)
+			}
+		}
+		if !fetch.Retryable(err) || r.runContext().Err() != nil {
+			return entries, mtime, m, err
+		}
+	}
+	return nil, mtime, mirror, err
+}
+
+// parsed is the Parsed of the Repo of a release, noting the figures in res
+func (r Syncer) parsed(res *ReleaseResult) func(changelog.ParseStats) {
+	return func(stats changelog.ParseStats) {
+		res.Parse = &stats
+		r.logParseStats(res.Name, stats)
+	}
+}
+
+// releaseTitle is the feed title for rel: its Title, or else the
+// TitleTemplate
+func (c Config) releaseTitle(mirror Mirror, rel Release) string {
+	if rel.Title != "" {
+		return rel.Title
+	}
+	title, err := executeTemplate("TitleTemplate", c.titleTemplate(mirror), mirror, rel)
+	if err != nil {
+		// (as problems has it)
+		return fmt.Sprintf("ChangeLog.txt for %s%s", mirror.Prefix, rel.Name)
+	}
+	return title
+}
+
+// releaseDescription is the feed description for rel: its Description, or
+// else the config one (when either is set)
+func (c Config) releaseDescription(mirror Mirror, rel Release) string {
+	if rel.Description != "" {
+		return rel.Description
+	}
+	desc, _ := executeTemplate("Description", c.description(mirror), mirror, rel)
+	return desc
+}
+
+// securityTitle is the title of the security fixes feed for rel
+func (c Config) securityTitle(mirror Mirror, rel Release) string {
+	if rel.Title != "" || c.titleTemplate(mirror) != defaultTitleTemplate {
+		return "Security fixes for " + c.releaseTitle(mirror, rel)
+	}
+	return fmt.Sprintf("Security fixes for %s%s", mirror.Prefix, rel.Name)
+}
+
+// watchTitle is the title of the Watch feed for pkg
+func watchTitle(mirror Mirror, rel Release, pkg string) string {
+	return fmt.Sprintf("%s updates in %s%s", pkg, mirror.Prefix, rel.Name)
+}
+
+// securitySuffix names the feed of only the security fix entries, like
+// "slackware64-current-security.rss"
+const securitySuffix = "-security"
+
+// writeFeeds renders entries (within the MaxItems and MaxAge) in each of the
+// release Formats, writing them as base plus the format extension. The changes
+// to the RSS feed are logged in res, when it is set.
+func (r Syncer) writeFeeds(mirror Mirror, rel Release, base, link string, entries []changelog.Entry, opts changelog.FeedOptions, mtime time.Time, res *ReleaseResult) error {
+	entries = changelog.LimitEntries(entries, r.Config.MaxItems, r.Config.MaxAge.Duration, time.Now())
+	feeds, cats, texts, err := changelog.ToFeedTexts(link, entries, opts)
+	if err != nil {
+		return err
+	}
+	// the RSS as it was, for what the feed has lost
+	rssPath := filepath.Join(r.Dest, r.Config.feedFile(mirror, base, changelog.FormatRss))
+	var prevRss []byte
+	if contains(r.Config.formats(mirror, rel), changelog.FormatRss) {
+		// a previous feed that can not be read is no different to none
+		prevRss, _ = ioutil.ReadFile(rssPath)
+	}
+	if r.Config.PreserveItems && prevRss != nil {
+		n, err := changelog.PreserveItems(feeds, cats, prevRss, r.Config.MaxItems)
+		if err != nil {
+			r.Warnf(LogFields{Release: base, Mirror: mirror.name(), Action: "preserve", Err: err}, "overwriting %q, as its items can not be preserved: %v", rssPath, err)
+		} else if n > 0 {
+			r.Infof(LogFields{Release: base, Mirror: mirror.name(), Action: "preserve"}, "preserved %d items no longer of the ChangeLog", n)
+		}
+	}
+
+	var source *changelog.Source
+	if r.Config.emitSource(mirror) {
+		source = &changelog.Source{Name: mirror.name(), URL: mirror.publicURL()}
+	}
+	for _, name := range r.Config.formats(mirror, rel) {
+		format := changelog.Formats[name]
+		dest := r.Config.feedFile(mirror, base, name)
+		render := r.Config.renderOptions(dest)
+		render.Categories, render.Texts, render.Indent, render.Source = cats, texts, r.Config.indent(mirror), source
+		data, trimmed, err := changelog.RenderMaxBytes(feeds, r.Config.MaxFeedBytes, format.Renderer(render))
+		if err != nil {
+			return err
+		}
+		if trimmed > 0 {
+			r.Infof(LogFields{Release: base, Mirror: mirror.name(), Action: "trim"}, "trimmed %d oldest items of the %s to fit MaxFeedBytes", trimmed, name)
+		}
+		var prev []FeedItem
+		if name == changelog.FormatRss && res != nil && prevRss != nil {
+			prev, _ = feedItems(prevRss)
+		}
+		if !r.DryRun {
+			if err := r.writeOutput(dest, data, mtime); err != nil {
+				return WriteError{err}
+			}
+		}
+		if name == changelog.FormatRss && res != nil {
+			r.logDelta(res, prev, data, trimmed)
+		}
+	}
+	return nil
+}
+
+// staleness is why the feed of the release is stale at now (or "" when it is
+// not), by the newest entry of its ChangeLog as parsed in res or else as last
+// recorded in the State
+func (r Syncer) staleness(rel Release, res ReleaseResult, now time.Time) string {
+	var (
+		newest time.Time
+		gap    time.Duration
+	)
+	if res.Parse != nil {
+		newest, gap = res.Parse.Newest, res.Parse.LongestGap
+	} else if r.State != nil {
+		if fs, ok := r.State.Feeds[res.Name]; ok {
+			newest, gap = fs.NewestEntry, fs.LongestGap
+		}
+	}
+	if newest.IsZero() {
+		return ""
+	}
+	age := now.Sub(newest)
+	past := []string{}
+	if after := r.Config.staleAfter(rel); after > 0 && age > after {
+		past = append(past, fmt.Sprintf("StaleAfter (%s)", humanDuration(after)))
+	}
+	if f := r.Config.StaleFactor; f > 0 && gap > 0 && age > time.Duration(f*float64(gap)) {
+		past = append(past, fmt.Sprintf("%g times its longest gap between entries (%s)", f, humanDuration(gap)))
+	}
+	if len(past) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("no new entry since %s, longer than %s", newest.UTC().Format("2006-01-02"), strings.Join(past, " and "))
+}
+
+// logParseStats logs the parse figures of a ChangeLog, and warns when more of
+// its lines were not understood than WarnUnparsedPercent
+func (r Syncer) logParseStats(name string, stats changelog.ParseStats) {
+	fields := LogFields{Release: name, Action: "parse"}
+	r.Infof(fields, "parsed %d entries (%s to %s), %d packages, %d with security fixes, %d of %d lines unrecognized",
+		stats.Entries, stats.Oldest.Format("2006-01-02"), stats.Newest.Format("2006-01-02"),
+		stats.Packages, stats.SecurityEntries, stats.Unrecognized, stats.Lines)
+	if limit := r.Config.WarnUnparsedPercent; limit > 0 && stats.UnrecognizedPercent() > limit {
+		r.Warnf(fields, "%.1f%% of the ChangeLog lines were unrecognized (more than WarnUnparsedPercent %g), its format may have changed",
+			stats.UnrecognizedPercent(), limit)
+	}
+}
+
+// logDelta notes in res the items added to and removed from the feed, compared
+// to the prev items, and logs them. Items disappearing other than by trimming
+// are warned about.
+func (r Syncer) logDelta(res *ReleaseResult, prev []FeedItem, data []byte, trimmed int) {
+	cur, err := feedItems(data)
+	if err != nil {
+		return
+	}
+	res.Delta = diffItems(prev, cur)
+	fields := LogFields{Release: res.Name, Mirror: res.Mirror, Action: "write"}
+	if s := res.Delta.String(); s != "" {
+		r.Infof(fields, "%s", s)
+	}
+	if gone := res.Delta.unexpectedRemovals(cur, trimmed); len(gone) > 0 {
+		r.Warnf(fields, "%s disappeared, which usually means a truncated ChangeLog or a misconfiguration", describeItems("", gone))
+	}
+}
+
+// mirrorRepo is the Repo of release, with its requests noted in res and the
+// fetched ChangeLog cached
+func (r Syncer) mirrorRepo(mirror Mirror, release string, res *ReleaseResult) (fetch.Repo, error) {
+	client, err := r.mirrorClient(mirror)
+	if err != nil {
+		return fetch.Repo{}, err
+	}
+	repo := fetch.Repo{
+		URL:     mirror.URL,
+		Release: release,
+		Client:  client,
+
+		PreferCompressed: mirror.PreferCompressed,
+
+		UserAgent: r.Config.userAgent(),
+		Limiter:   r.Limiter,
+	}
+	if r.Trace != nil {
+		repo.Trace = r.Trace.Printf
+	}
+	retries, delay := r.Config.retries()
+	repo.Retries, repo.RetryDelay = retries, delay
+	repo.Timeout = r.Config.timeout()
+	repo.Retrying = func(attempt int, err error, delay time.Duration) {
+		r.Infof(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "retry", Duration: delay, Err: err},
+			"attempt %d of %d failed (%v), retrying in %s", attempt, retries+1, err, delay.Round(time.Millisecond))
+	}
+	if mirror.Verify {
+		keyring, err := loadKeyring(os.ExpandEnv(mirror.Keyring))
+		if err != nil {
+			return repo, err
+		}
+		repo.Keyring = keyring
+	}
+	source, err := r.mirrorAuth(mirror, &repo)
+	if err != nil {
+		return repo, err
+	}
+	if source != "" && r.Trace != nil {
+		r.Trace.Printf("%s: using credentials from %s", mirror.name(), source)
+	}
+	host := "unknown"
+	if u, err := url.Parse(mirror.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	repo.Observe = func(s fetch.Stats) {
+		res.Requests = append(res.Requests, s)
+		r.Debugf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "request", Duration: s.Duration},
+			"%s %s: %d status, %d bytes in %s", s.Method, s.URL, s.StatusCode, s.Bytes, s.Duration.Round(time.Millisecond))
+		r.Statsd.Timing("mirror."+statsdName(host)+".fetch", s.Duration)
+		r.Statsd.Count("mirror."+statsdName(host)+".bytes", s.Bytes)
+	}
+	repo.Fetched = func(data []byte, mtime time.Time) {
+		res.Checksum = fmt.Sprintf("%x", sha256.Sum256(data))
+		if r.DryRun {
+			return
+		}
+		if err := writeCache(r.Dest, res.Name, data, mtime); err != nil {
+			r.Warnf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "cache", Err: err}, "caching the ChangeLog: %v", err)
+		}
+	}
+	if fs := r.feedState(res.Name); fs != nil {
+		repo.ETag = fs.ETag
+		if r.Config.tailFetch(mirror) && fs.Checksum != "" {
+			// only when the cache is of the ChangeLog the feed was last
+			// written from
+			prev, err := readCache(r.Dest, res.Name)
+			if err == nil && fmt.Sprintf("%x", sha256.Sum256(prev)) == fs.Checksum {
+				repo.Previous, repo.HeadBytes = prev, tailFetchBytes
+			}
+		}
+	}
+	repo.Validators = func(etag string, mtime time.Time) {
+		res.ETag, res.LastModified = etag, mtime
+	}
+	repo.Redirected = func(u string) {
+		res.Redirect = u
+	}
+	repo.LastModifiedFallback = func(file, from string) {
+		r.Warnf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "fetch"}, "no valid Last-Modified for %s, taking it from %s", file, from)
+	}
+	return repo, nil
+}
+
+// redirected is the feed link after the mirror redirected the ChangeLog to
+// res.Redirect: the release URL it was redirected to, unless the mirror has a
+// PublicURL. A redirect to another host or path, as of a mirror whose layout
+// has changed, is warned about.
+func (r Syncer) redirected(mirror Mirror, rel Release, res *ReleaseResult) string {
+	requested, err := url.Parse(fetch.JoinURL(mirror.URL, rel.Name))
+	if err != nil {
+		return fetch.JoinURL(mirror.publicURL(), rel.Name)
+	}
+	final, err := url.Parse(res.Redirect)
+	if err != nil {
+		return fetch.JoinURL(mirror.publicURL(), rel.Name)
+	}
+	// the directory of the ChangeLog
+	final.Path = path.Dir(final.Path)
+	final.RawPath, final.RawQuery, final.Fragment = "", "", ""
+	if final.Host != requested.Host || strings.Trim(final.Path, "/") != strings.Trim(requested.Path, "/") {
+		r.Warnf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "fetch"}, "%q redirects to %q, the URL of the mirror in the config may need updating", requested, final)
+	}
+	if mirror.PublicURL != "" {
+		return fetch.JoinURL(mirror.PublicURL, rel.Name)
+	}
+	return final.String()
+}
+
+// tailFetchBytes is how much of the start of a ChangeLog TailFetch fetches.
+// Most entries are much smaller, but a mass rebuild of -current can be several
+// hundred KB.
+const tailFetchBytes = 256 << 10
+
+// feedState is the State of the feed name, or nil when there is none (or it is
+// to be ignored, for Force)
+func (r Syncer) feedState(name string) *FeedState {
+	if r.State == nil || r.Force {
+		return nil
+	}
+	return r.State.Feeds[name]
+}
+
+// minDate is the entry cutoff for a feed: the config MinDate for a new feed,
+// or else the one it was first written with (as recorded in the State), so
+// that a feed is bounded when it is created, and grows from there
+func (r Syncer) minDate(name string, exists bool) time.Time {
+	if !exists {
+		return r.Config.minDate(time.Now())
+	}
+	if r.State != nil {
+		if fs, ok := r.State.Feeds[name]; ok {
+			return fs.MinDate
+		}
+	}
+	return time.Time{}
+}
+
+// entriesSince is those of entries newer than the cutoff
+func entriesSince(entries []changelog.Entry, cutoff time.Time) []changelog.Entry {
+	newer := []changelog.Entry{}
+	for _, e := range entries {
+		if e.Date.After(cutoff) {
+			newer = append(newer, e)
+		}
+	}
+	return newer
+}
+
+// countNewer is the number of entries dated after since
+func countNewer(entries []changelog.Entry, since time.Time) int {
+	n := 0
+	for _, e := range entries {
+		if e.Date.After(since) {
+			n++
+		}
+	}
+	return n
+}
+
+// writeOutput publishes data as the file name (atomically), as of mtime.
+// When signing is enabled, the detached signature is published alongside it,
+// and name is never left published without a signature. With CompressOutput,
+// its compressed copy is published once it is valid, or removed when that
+// fails, to never be left out of step with name. Feeds in a local Dest are
+// backed up before, and validated after. A local file that already has the
+// content is left alone (but for Force), times and all, so that a mirror
+// bumping the last-modified of an unchanged ChangeLog is no update to feed
+// readers (or to an rsync of them).
+func (r Syncer) writeOutput(name string, data []byte, mtime time.Time) error {
+	path := filepath.Join(r.Dest, name)
+	local := r.Publisher == nil
+	if local && !r.Force && r.unchanged(name, data) {
+		r.Debugf(LogFields{Action: "write"}, "%s: unchanged content, not rewritten", name)
+		return nil
+	}
+	var sig []byte
+	if r.Signer != nil {
+		prev, err := ioutil.ReadFile(path)
+		if !local {
+			err = os.ErrNotExist
+		}
+		_, sigErr := r.publisher().Stat(name + SigExt)
+		if err != nil || sigErr != nil || !bytes.Equal(prev, data) {
+			sig, err = signDetached(r.Signer, data)
+			if err != nil {
+				return fmt.Errorf("signing %q: %v", path, err)
+			}
+		}
+	}
+
+	if local {
+		if err := backup(path); err != nil {
+			return fmt.Errorf("backing up %q: %v", path, err)
+		}
+	}
+	// readers (or a crash) never see a half-written feed
+	err := r.publishFile(name, mtime, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if sig != nil {
+		err := r.publishFile(name+SigExt, mtime, func(w io.Writer) error {
+			_, err := w.Write(sig)
+			return err
+		})
+		if err != nil {
+			r.publisher().Remove(name)
+			return fmt.Errorf("writing signature of %q: %v", name, err)
+		}
+	} else if r.Signer != nil {
+		// the content and signature are unchanged, so only the times are updated
+		if err := os.Chtimes(path+SigExt, mtime, mtime); err != nil {
+			return err
+		}
+	}
+
+	if !local {
+		return r.writeCompressed(name, data, mtime)
+	}
+	if err := validate(path); err != nil {
+		if rerr := restore(path); rerr != nil && rerr != errNoBackup {
+			return fmt.Errorf("%v, and restoring the backup failed: %v", err, rerr)
+		}
+		return fmt.Errorf("%v, restored the previous feed", err)
+	}
+	return r.writeCompressed(name, data, mtime)
+}
+
+// unchanged is whether the file name of the local Dest has the content data
+// already, along with its signature and compressed copy (when those are
+// written). The feeds are rendered only from their entries (even their
+// lastBuildDate), so the same entries are the same content.
+func (r Syncer) unchanged(name string, data []byte) bool {
+	path := filepath.Join(r.Dest, name)
+	prev, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Equal(prev, data) {
+		return false
+	}
+	if r.Signer != nil {
+		if _, err := os.Stat(path + SigExt); err != nil {
+			return false
+		}
+	}
+	if r.Config.CompressOutput {
+		if _, err := os.Stat(path + GzExt); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Rollback restores the backed up feeds of a release (or feed name)
+func (r Syncer) Rollback(release string) error {
+	if r.Publisher != nil {
+		return errRemoteBackup
+	}
+	found := false
+	for _, mirror := range r.Config.Mirrors {
+		for _, rel := range mirror.releases() {
+			if rel.Name != release && mirror.feedName(rel) != release {
+				continue
+			}
+			found = true
+			for _, name := range r.Config.feedFiles(mirror, rel) {
+				path := filepath.Join(r.Dest, name)
+				if err := restore(path); err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				r.output(levelInfo, LogFields{Action: "rollback"}, fmt.Sprintf("restored %q from %q", path, path+backupExt))
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("no release %q configured", release)
+	}
+	return nil
+}
@@ -0,0 +1,1576 @@
+package feedsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+	"github.com/vbatts/sl-feeds/ftp/ftptest"
+	"github.com/vbatts/sl-feeds/iso9660/isotest"
+)
+
+// newTestRunner is a Syncer writing to a temporary dest dir, for the mirrors
+func newTestRunner(t *testing.T, mirrors ...Mirror) (r Syncer, cleanup func()) {
+	dir, err := ioutil.TempDir("", "sl-feeds-run.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = Syncer{
+		Config: Config{Dest: dir, Mirrors: mirrors, RetryDelay: Duration{time.Millisecond}},
+		Dest:   dir,
+		Quiet:  true,
+		Logger: log.New(ioutil.Discard, "", 0),
+	}
+	return r, func() { os.RemoveAll(dir) }
+}
+
+func TestRunRetry(t *testing.T) {
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts[req.URL.Path]++
+		if req.URL.Path == "/slackware64/ChangeLog.txt" && attempts[req.URL.Path] == 1 {
+			http.Error(w, "try later", http.StatusBadGateway)
+			return
+		}
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64", "missing"}})
+	defer cleanup()
+	// only the retry at the end of the run
+	r.Config.Retries = -1
+
+	results := r.pass()
+	if len(results) != 2 {
+		t.Fatalf("expected %d results; got %d", 2, len(results))
+	}
+	if results[0].Err != nil || !results[0].Retried {
+		t.Errorf("expected slackware64 to succeed on a retry; got %v (retried %t)", results[0].Err, results[0].Retried)
+	}
+	if !results[1].Failed() || results[1].Retried {
+		t.Errorf("expected the 404 to fail without a retry; got %v (retried %t)", results[1].Err, results[1].Retried)
+	}
+	if attempts["/missing/ChangeLog.txt"] != 1 {
+		t.Errorf("expected %d request for the 404; got %d", 1, attempts["/missing/ChangeLog.txt"])
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if attempts++; attempts == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	defer cleanup()
+	buf := bytes.NewBuffer(nil)
+	r.Quiet, r.Logger = false, log.New(buf, "", 0)
+
+	results := r.pass()
+	if len(results) != 1 || results[0].Err != nil || results[0].Retried {
+		t.Fatalf("expected slackware64 to succeed on its second attempt; got %#v", results)
+	}
+	if !strings.Contains(buf.String(), "slackware64: attempt 1 of 3 failed (503 status from ") {
+		t.Errorf("expected the retry to be logged; got %q", buf.String())
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		inFlight, max int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if strings.HasPrefix(req.URL.Path, "/broken") {
+			http.NotFound(w, req)
+			return
+		}
+		http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+
+	releases := []string{"a", "b", "broken", "c", "d", "e"}
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: releases})
+	defer cleanup()
+	r.Config.Jobs = 2
+
+	results := r.pass()
+	if max != 2 {
+		t.Errorf("expected %d releases at once; got %d", 2, max)
+	}
+	if len(results) != len(releases) {
+		t.Fatalf("expected %d results; got %d", len(releases), len(results))
+	}
+	for i, res := range results {
+		if res.Name != releases[i] {
+			t.Errorf("expected the results in the order of the config; got %s for %s", res.Name, releases[i])
+		}
+		if failed := res.Name == "broken"; res.Failed() != failed {
+			t.Errorf("%s: expected failed to be %v; got %v", res.Name, failed, res.Err)
+		}
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	r, cleanup := newTestRunner(t, Mirror{URL: "http://127.0.0.1:0", Releases: []string{"slackware64"}})
+	defer cleanup()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Minute))
+	defer cancel()
+
+	rep, err := r.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Err != ErrDeadline {
+		t.Errorf("expected the release to not be attempted; got %#v", rep.Results)
+	}
+}
+
+func TestRunBackoff(t *testing.T) {
+	r, cleanup := newTestRunner(t, Mirror{URL: "http://127.0.0.1:0", Name: "down", Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.State = NewState()
+	r.State.Mirror("down").BackoffUntil = time.Now().Add(time.Hour)
+
+	results := r.pass()
+	if len(results) != 1 || results[0].Err != ErrBackoff || results[0].Failed() {
+		t.Errorf("expected the mirror to be backed off from; got %#v", results)
+	}
+}
+
+// pipeListener is an in-process net.Listener, with dial making the
+// connections to it, so tests need no TCP
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.done)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+func (l *pipeListener) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func TestRunInProcess(t *testing.T) {
+	l := newPipeListener()
+	server := &http.Server{Handler: http.FileServer(http.Dir("../changelog/testdata/"))}
+	go server.Serve(l)
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: "http://mirror.invalid", Releases: []string{"slackware64", "missing"}})
+	defer cleanup()
+	r.DialContext = l.dial
+
+	results := r.pass()
+	if len(results) != 2 {
+		t.Fatalf("expected %d results; got %d", 2, len(results))
+	}
+	if results[0].Err != nil || results[0].New == 0 {
+		t.Errorf("expected slackware64 to have new entries; got %v (%d new)", results[0].Err, results[0].New)
+	}
+	if !results[1].Failed() {
+		t.Error("expected the missing release to fail")
+	}
+	if len(results[0].Delta.Added) != results[0].New || len(results[0].Delta.Removed) != 0 {
+		t.Errorf("expected %d items added; got %#v", results[0].New, results[0].Delta)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "slackware64.rss")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunLocalISO(t *testing.T) {
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2022, time.February, 2, 21, 45, 10, 0, time.UTC)
+	iso, err := ioutil.TempFile("", "sl-feeds-iso.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(iso.Name())
+	iso.Write(isotest.Image(map[string][]byte{"slackware64-15.0/ChangeLog.txt": plain}, mtime, true))
+	iso.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: "iso://" + iso.Name(), Releases: []string{"slackware64-15.0"}})
+	defer cleanup()
+
+	results := r.pass()
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the release to be written; got %#v", results)
+	}
+	stat, err := os.Stat(filepath.Join(r.Dest, "slackware64-15.0.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.ModTime().Equal(mtime) {
+		t.Errorf("expected the feed to have the mtime recorded in the ISO %s; got %s", mtime, stat.ModTime())
+	}
+	if results = r.pass(); len(results) != 1 || results[0].Status() != "unchanged" {
+		t.Errorf("expected the release to be unchanged on another run; got %#v", results)
+	}
+}
+
+func TestRunEmitSource(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{
+		URL:       "file://" + dir,
+		PublicURL: "http://mirrors.example.com/slackware",
+		Name:      "example",
+		Releases:  []string{"slackware64"},
+	})
+	defer cleanup()
+	r.Config.EmitSource = true
+
+	if results := r.pass(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the release to be written; got %#v", results)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `<source url="http://mirrors.example.com/slackware">example</source>`) {
+		t.Errorf("expected the items to have the mirror as their source; got:\n%s", data)
+	}
+	if strings.Contains(string(data), "file://") || !strings.Contains(string(data), "<link>http://mirrors.example.com/slackware/slackware64/ChangeLog.txt#") {
+		t.Errorf("expected the links to be to the PublicURL; got:\n%s", data)
+	}
+}
+
+func TestRunChannel(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.BaseURL = "https://feeds.example/slackware/"
+	r.Config.TTL = Duration{89*time.Minute + time.Second}
+	r.Config.Formats = []string{changelog.FormatRss, changelog.FormatAtom}
+
+	if results := r.pass(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the release to be written; got %#v", results)
+	}
+	for name, expected := range map[string][]string{
+		"slackware64.rss": {
+			`<atom:link href="https://feeds.example/slackware/slackware64.rss" rel="self" type="application/rss+xml"></atom:link>`,
+			"<ttl>90</ttl>",
+			"<language>en</language>",
+			"<pubDate>Mon, 23 Jan 2017 21:30:13 +0000</pubDate>",
+		},
+		"slackware64.atom": {
+			`<link href="https://feeds.example/slackware/slackware64.atom" rel="self" type="application/atom+xml"></link>`,
+			`xml:lang="en"`,
+		},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(r.Dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range expected {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s: expected %s; got:\n%s", name, s, data)
+			}
+		}
+	}
+
+	// the channel is of the entries, so the same on another run
+	feed := filepath.Join(r.Dest, "slackware64.rss")
+	if err := os.Chtimes(feed, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if results := r.pass(); results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if stat, err := os.Stat(feed); err != nil || !stat.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected the feed of the same content left as it was; got %v", err)
+	}
+}
+
+func TestRunSecurityFeeds(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	no := false
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}},
+		Mirror{URL: "file://" + dir, Releases: []string{"slackwarearm"}, SecurityFeeds: &no},
+	)
+	defer cleanup()
+	r.Config.SecurityFeeds = true
+	r.Config.Formats = []string{"rss", "json"}
+
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	all, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	security, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64-security.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(security), "<title>Security fixes for slackware64</title>") {
+		t.Errorf("expected the title of the security feed; got:\n%.200s", security)
+	}
+	if n, m := strings.Count(string(security), "<item>"), strings.Count(string(all), "<item>"); n == 0 || n >= m {
+		t.Errorf("expected fewer items in the security feed than the %d of the feed; got %d", m, n)
+	}
+	for _, item := range strings.Split(string(security), "<item>")[1:] {
+		if !strings.Contains(item, "Security fix") {
+			t.Errorf("expected every item of the security feed to have a security fix; got:\n%.200s", item)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "slackware64-security.json")); err != nil {
+		t.Errorf("expected the security feed in each format; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "slackwarearm-security.rss")); !os.IsNotExist(err) {
+		t.Errorf("expected no security feed for the mirror turning it off; got %v", err)
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.Watch = []Watch{{Release: "slackware64", Packages: []string{"openssl", "no-such-package"}}}
+
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64-openssl.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<title>openssl updates in slackware64</title>") {
+		t.Errorf("expected the title of the package feed; got:\n%.200s", data)
+	}
+	if n := strings.Count(string(data), "<item>"); n != 2 {
+		t.Errorf("expected the %d entries updating openssl; got %d", 2, n)
+	}
+	if strings.Contains(string(data), "openssl-solibs") {
+		t.Error("expected only the updates of openssl, not of openssl-solibs")
+	}
+	data, err = ioutil.ReadFile(filepath.Join(r.Dest, "slackware64-no-such-package.rss"))
+	if err != nil || strings.Contains(string(data), "<item>") {
+		t.Errorf("expected an empty feed for a package never updated; got %v:\n%s", err, data)
+	}
+}
+
+func TestRunMaxItems(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64", "slackwarearm"}})
+	defer cleanup()
+	r.Config.MaxItems = 1
+	// the ChangeLog of slackware64 is older than this, and two entries of
+	// slackwarearm are newer
+	r.Config.MaxAge = Duration{time.Since(time.Date(2017, time.February, 1, 0, 0, 0, 0, time.UTC))}
+
+	items := func() {
+		for name, expected := range map[string]int{"slackware64.rss": 0, "slackwarearm.rss": 1} {
+			data, err := ioutil.ReadFile(filepath.Join(r.Dest, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(string(data), "<item>"); n != expected {
+				t.Errorf("%s: expected %d items; got %d", name, expected, n)
+			}
+		}
+	}
+
+	// the whole of the ChangeLog is read and cached, for --offline
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+		if res.Entries <= 1 || res.Checksum == "" {
+			t.Errorf("%s: expected the whole ChangeLog read; got %d entries", res.Name, res.Entries)
+		}
+	}
+	items()
+	offline := r
+	offline.Offline = true
+	for _, res := range offline.pass() {
+		if res.Err != nil {
+			t.Errorf("%s: expected the cached ChangeLog; got %v", res.Name, res.Err)
+		}
+	}
+	items()
+
+	// with ShortRead, the ChangeLog is read no further than the MaxItems, so
+	// not cached
+	r.Config.ShortRead = true
+	r.Force = true
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+		if res.Entries != 1 {
+			t.Errorf("%s: expected 1 entry read; got %d", res.Name, res.Entries)
+		}
+		if _, err := readCache(r.Dest, res.Name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no cache of a ChangeLog read short; got %v", res.Name, err)
+		}
+	}
+	items()
+}
+
+func TestRunMinDate(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.State = NewState()
+	feed := filepath.Join(r.Dest, "slackware64.rss")
+	items := func() int {
+		data, err := ioutil.ReadFile(feed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "<item>")
+	}
+	run := func() ReleaseResult {
+		results := r.pass()
+		if len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("expected the feed written; got %#v", results)
+		}
+		r.State.Record(results, time.Now())
+		return results[0]
+	}
+
+	// the 8 entries of 2017, of the 52
+	r.Config.MinDate = "2017-01-01T00:00:00Z"
+	if res := run(); res.New != 8 || items() != 8 {
+		t.Fatalf("expected the 8 entries after the MinDate; got %d new, and %d items", res.New, items())
+	}
+	cutoff := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if fs := r.State.Feeds["slackware64"]; fs == nil || !fs.MinDate.Equal(cutoff) {
+		t.Fatalf("expected the cutoff recorded in the state; got %#v", fs)
+	}
+
+	// the feed keeps its cutoff, whatever the MinDate is now
+	r.Force = true
+	r.Config.MinDate = "2017-01-20T00:00:00Z"
+	if run(); items() != 8 {
+		t.Errorf("expected the cutoff the feed was created with; got %d items", items())
+	}
+	r.Config.MinDate = ""
+	if run(); items() != 8 {
+		t.Errorf("expected the cutoff the feed was created with; got %d items", items())
+	}
+
+	// the strictest of the MinDate, MaxItems and MaxAge wins
+	r.Config.MaxItems = 3
+	if run(); items() != 3 {
+		t.Errorf("expected the MaxItems, fewer than after the MinDate; got %d items", items())
+	}
+	r.Config.MaxItems = 0
+	r.Config.MaxAge = Duration{time.Since(time.Date(2017, time.January, 19, 0, 0, 0, 0, time.UTC))}
+	if run(); items() != 2 {
+		t.Errorf("expected the MaxAge, newer than the MinDate; got %d items", items())
+	}
+	r.Config.MaxItems, r.Config.MaxAge = 20, Duration{time.Since(time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC))}
+	if run(); items() != 8 {
+		t.Errorf("expected the MinDate, stricter than the MaxItems and MaxAge; got %d items", items())
+	}
+
+	// an existing feed that was written without one is left without one
+	r.Config.MaxItems, r.Config.MaxAge = 0, Duration{}
+	delete(r.State.Feeds, "slackware64")
+	r.Config.MinDate = "30d"
+	if run(); items() != 52 {
+		t.Errorf("expected no MinDate for a feed that exists; got %d items", items())
+	}
+
+	// and one created anew is bounded by the MinDate again
+	os.Remove(feed)
+	r.Config.MinDate = "2017-01-20T00:00:00Z"
+	if res := run(); res.New != 2 || items() != 2 {
+		t.Errorf("expected the MinDate of the feed created anew; got %d new, and %d items", res.New, items())
+	}
+}
+
+func TestRunAtomicWrite(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	feed := filepath.Join(r.Dest, "slackware64.rss")
+	if err := ioutil.WriteFile(feed, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a reader with the previous feed open, as a link to it
+	if err := os.Link(feed, filepath.Join(r.Dest, "reader")); err != nil {
+		t.Skip(err)
+	}
+	// older than the ChangeLog, to be written again
+	if err := os.Chtimes(feed, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(r.Dest, "reader")); err != nil || string(data) != "previous" {
+		t.Errorf("expected the previous feed to be replaced, not overwritten; got %q, %v", data, err)
+	}
+	infos, err := ioutil.ReadDir(r.Dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".slackware64.rss.") {
+			t.Errorf("expected no temporary file left; got %q", info.Name())
+		}
+	}
+}
+
+func TestRunFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	up := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer up.Close()
+
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: down.URL, URLs: []string{up.URL + "/"}, Releases: []string{"slackware64"}},
+		// a 404 is not for falling back
+		Mirror{URL: missing.URL, URLs: []string{up.URL + "/"}, Releases: []string{"slackwarearm"}},
+		Mirror{Prefix: "all-down-", URLs: []string{down.URL, down.URL}, Releases: []string{"slackware64"}},
+	)
+	defer cleanup()
+	r.Config.Retries = -1
+	buf := bytes.NewBuffer(nil)
+	r.Logger = log.New(buf, "", 0)
+
+	results := r.pass()
+	if results[0].Err != nil {
+		t.Errorf("expected the release from the fallback URL; got %v", results[0].Err)
+	}
+	if !results[1].Failed() || !results[2].Failed() {
+		t.Errorf("expected the other releases to fail; got %v and %v", results[1].Err, results[2].Err)
+	}
+	if expected := fmt.Sprintf("slackware64: falling back to %q", up.URL+"/"); !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q logged; got %q", expected, buf.String())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<link>"+up.URL+"/slackware64") {
+		t.Errorf("expected the feed to link to the URL it is from")
+	}
+
+	// and the fallback is asked whether the feed is not newer
+	buf.Reset()
+	if results := r.pass(); results[0].Err != fetch.ErrNotNewer {
+		t.Errorf("expected the release to be unchanged; got %v", results[0].Err)
+	}
+}
+
+func TestRunCombinedFeed(t *testing.T) {
+	// the same ChangeLog for both releases, as for slackware and slackware64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+	arm := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer arm.Close()
+
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: server.URL, Releases: []string{"a", "b"}},
+		Mirror{URL: arm.URL, Releases: []string{"slackwarearm"}},
+	)
+	defer cleanup()
+	r.Config.CombinedFeed = "slackware-all"
+	r.Config.Formats = []string{"rss", "atom"}
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+
+	combinedItems := func() (titles []string, mtime time.Time) {
+		path := filepath.Join(r.Dest, "slackware-all.rss")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Titles []string `xml:"channel>item>title"`
+		}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc.Titles, stat.ModTime()
+	}
+	counts := map[string]int{}
+	titles, mtime := combinedItems()
+	for _, title := range titles {
+		counts[strings.SplitN(title, " ", 2)[0]]++
+	}
+	entries := func(release string) int {
+		fh, err := os.Open(filepath.Join("../changelog/testdata", release, "ChangeLog.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+		e, err := changelog.Parse(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(e)
+	}
+	if counts["[a]"] != entries("slackware64") || counts["[b]"] != 0 || counts["[slackwarearm]"] != entries("slackwarearm") {
+		t.Errorf("expected each entry of the releases once, titled with its release; got %v", counts)
+	}
+	// slackwarearm has the newest entry
+	if !strings.HasPrefix(titles[0], "[slackwarearm] ") {
+		t.Errorf("expected the newest entry first; got %q", titles[0])
+	}
+
+	// each item has the release it is from as its source
+	data, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware-all.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rss struct {
+		Items []struct {
+			Title  string `xml:"title"`
+			Source struct {
+				URL  string `xml:"url,attr"`
+				Name string `xml:",chardata"`
+			} `xml:"source"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(data, &rss); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range rss.Items {
+		if !strings.HasPrefix(item.Title, "["+item.Source.Name+"] ") || !strings.HasSuffix(item.Source.URL, "/"+item.Source.Name) {
+			t.Errorf("expected the source of %q to be its release; got %q of %q", item.Title, item.Source.Name, item.Source.URL)
+		}
+	}
+	if len(rss.Items) == 0 || rss.Items[0].Source.URL != arm.URL+"/slackwarearm" {
+		t.Errorf("expected the source of the newest item to be slackwarearm; got %#v", rss.Items)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(r.Dest, "slackware-all.atom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var atom struct {
+		Entries []struct {
+			Title  string `xml:"title"`
+			Source string `xml:"source>title"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &atom); err != nil {
+		t.Fatal(err)
+	}
+	if len(atom.Entries) != len(rss.Items) {
+		t.Errorf("expected %d Atom entries; got %d", len(rss.Items), len(atom.Entries))
+	}
+	for _, e := range atom.Entries {
+		if !strings.HasPrefix(e.Title, "["+e.Source+"] ") {
+			t.Errorf("expected the source of %q to be its release; got %q", e.Title, e.Source)
+		}
+	}
+
+	stat, err := os.Stat(filepath.Join(r.Dest, "slackwarearm.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mtime.Equal(stat.ModTime()) {
+		t.Errorf("expected the time of the newest ChangeLog %s; got %s", stat.ModTime(), mtime)
+	}
+
+	// MaxItems is of the merged feed
+	r.Config.MaxItems = 5
+	r.Offline = true
+	r.pass()
+	if titles, _ := combinedItems(); len(titles) != 5 {
+		t.Errorf("expected %d items; got %d", 5, len(titles))
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64", "slackwarearm"}})
+	defer cleanup()
+	buf := bytes.NewBuffer(nil)
+	r.Logger = log.New(buf, "", 0)
+
+	// with one feed already written, and older than its ChangeLog
+	feed := filepath.Join(r.Dest, "slackwarearm.rss")
+	if err := ioutil.WriteFile(feed, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(feed, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	r.DryRun = true
+	results := r.pass()
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	if !results[0].Created || results[1].Created || results[1].New != results[1].Entries {
+		t.Errorf("expected the first feed to be created and the second updated; got %#v", results)
+	}
+	for _, expected := range []string{"slackware64: would be created, with", "slackwarearm: would be updated, with"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q, even when quiet; got %q", expected, buf.String())
+		}
+	}
+	infos, err := ioutil.ReadDir(r.Dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("expected nothing but the previous feed; got %d files", len(infos))
+	}
+	if data, err := ioutil.ReadFile(feed); err != nil || string(data) != "previous" {
+		t.Errorf("expected the previous feed to be left alone; got %q, %v", data, err)
+	}
+
+	// and a feed not older than its ChangeLog is left alone
+	r.DryRun = false
+	r.pass()
+	buf.Reset()
+	r.DryRun = true
+	r.pass()
+	if expected := "slackware64: would be left alone"; !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q; got %q", expected, buf.String())
+	}
+}
+
+func TestRunOffline(t *testing.T) {
+	requests := 0
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	defer cleanup()
+	if results := r.pass(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the release to be fetched; got %#v", results)
+	}
+	path := filepath.Join(r.Dest, "slackware64.rss")
+	fetched, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests = 0
+	r.Offline = true
+	r.Config.Mirrors[0].Releases = append(r.Config.Mirrors[0].Releases, "slackwarearm")
+	r.Config.MaxFeedBytes = 10000
+	results := r.pass()
+	if requests != 0 {
+		t.Errorf("expected no requests offline; got %d", requests)
+	}
+	if len(results) != 2 || results[0].Err != nil {
+		t.Fatalf("expected slackware64 to be regenerated; got %#v", results)
+	}
+	if !results[1].Failed() || !strings.Contains(results[1].Error(), "no cached ChangeLog") {
+		t.Errorf("expected slackwarearm to fail for having nothing cached; got %v", results[1].Err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() == fetched.Size() {
+		t.Error("expected the feed to be regenerated with the new MaxFeedBytes")
+	}
+	if !stat.ModTime().Equal(fetched.ModTime()) {
+		t.Errorf("expected the mtime %s to be kept; got %s", fetched.ModTime(), stat.ModTime())
+	}
+}
+
+func TestRunFormats(t *testing.T) {
+	changelog.Formats["test"] = changelog.Format{Ext: ".test", Renderer: func(opts changelog.RenderOptions) changelog.RenderFunc {
+		return func(f *feeds.Feed) ([]byte, error) {
+			return []byte(fmt.Sprintf("%d items\n", len(f.Items))), nil
+		}
+	}}
+	defer delete(changelog.Formats, "test")
+
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{
+		URL:     server.URL,
+		Formats: []string{"test"},
+		Release: []Release{{Name: "slackware64", Formats: []string{"rss", "atom", "json", "test"}}, {Name: "slackwarearm"}},
+	})
+	defer cleanup()
+
+	results := r.pass()
+	if len(results) != 2 || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("expected both releases to be written; got %#v", results)
+	}
+	for name, expected := range map[string]bool{
+		"slackware64.rss":   true,
+		"slackware64.atom":  true,
+		"slackware64.json":  true,
+		"slackware64.test":  true,
+		"slackwarearm.rss":  false,
+		"slackwarearm.test": true,
+	} {
+		if _, err := os.Stat(filepath.Join(r.Dest, name)); (err == nil) != expected {
+			t.Errorf("%s: expected to exist %t; got %v", name, expected, err)
+		}
+	}
+
+	rss, err := os.Stat(filepath.Join(r.Dest, "slackware64.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	atom, err := os.Stat(filepath.Join(r.Dest, "slackware64.atom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !atom.ModTime().Equal(rss.ModTime()) {
+		t.Errorf("expected each format to have the mtime of the ChangeLog; got %s and %s", rss.ModTime(), atom.ModTime())
+	}
+
+	// a missing format is written, even though the ChangeLog is not newer
+	os.Remove(filepath.Join(r.Dest, "slackware64.test"))
+	results = r.pass()
+	if results[0].Status() != "updated" || results[1].Status() != "unchanged" {
+		t.Errorf("expected only slackware64 to be updated; got %s and %s", results[0].Status(), results[1].Status())
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "slackware64.test")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunFilenameTemplate(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}, Formats: []string{"rss", "atom"}})
+	defer cleanup()
+	r.Config.FilenameTemplate = "{{slice .Release 9}}-changes.{{.Format}}"
+	r.Config.SecurityFeeds = true
+
+	if results := r.pass(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results %#v", results)
+	}
+	files, err := ioutil.ReadDir(r.Dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) != backupExt && fi.Name() != stateFileName && !strings.HasPrefix(fi.Name(), ".") {
+			names = append(names, fi.Name())
+		}
+	}
+	expected := []string{"64-changes.atom", "64-changes.rss", "64-security-changes.atom", "64-security-changes.rss"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %q; got %q", expected, names)
+	}
+	// and by those names, the feeds are current
+	if results := r.pass(); results[0].Status() != "unchanged" {
+		t.Errorf("expected the feeds to be unchanged; got %s", results[0].Status())
+	}
+}
+
+func TestRunWarnUnparsed(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64", "alien/kde"}})
+	defer cleanup()
+	logs := bytes.NewBuffer(nil)
+	r.Logger = log.New(logs, "", 0)
+	r.Config.WarnUnparsedPercent = 5
+
+	results := r.pass()
+	if len(results) != 2 || results[0].Parse == nil || results[1].Parse == nil {
+		t.Fatalf("expected the figures of both releases; got %#v", results)
+	}
+	if strings.Contains(logs.String(), "warning: slackware64:") {
+		t.Errorf("expected no warning for slackware64; got:\n%s", logs)
+	}
+	if !strings.Contains(logs.String(), "warning: alien-kde:") {
+		t.Errorf("expected a warning for the unrecognized lines of alien/kde; got:\n%s", logs)
+	}
+}
+
+func TestRunReleasePath(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"alien/kde"}})
+	defer cleanup()
+
+	results := r.pass()
+	if len(results) != 1 || results[0].Failed() || results[0].Name != "alien-kde" {
+		t.Fatalf("expected the feed alien-kde; got %#v", results)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "alien-kde.rss")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "alien")); !os.IsNotExist(err) {
+		t.Errorf("expected no directory for the path of the release; got %v", err)
+	}
+}
+
+func TestRunStale(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{
+		URL:     server.URL,
+		Release: []Release{{Name: "slackware64"}, {Name: "slackwarearm", StaleAfter: Duration{100000 * 24 * time.Hour}}},
+	})
+	defer cleanup()
+	r.Config.StaleAfter = Duration{30 * 24 * time.Hour}
+	state := NewState()
+	r.State = state
+
+	results := r.pass()
+	if len(results) != 2 || !strings.Contains(results[0].Stale, "longer than StaleAfter (30d)") || results[1].Stale != "" {
+		t.Fatalf("expected only slackware64 to be stale; got %#v", results)
+	}
+	msgs := state.RecordStale(results)
+	state.Record(results, time.Now())
+	if len(msgs) != 1 || !strings.HasPrefix(msgs[0], "warning: slackware64 is stale: no new entry since 2017-01-23") {
+		t.Errorf("expected a warning for slackware64; got %q", msgs)
+	}
+
+	// unchanged, so not parsed, but still stale by the state, and not warned
+	// about again
+	results = r.pass()
+	if results[0].Err != fetch.ErrNotNewer || results[0].Stale == "" {
+		t.Fatalf("expected slackware64 to be unchanged and stale; got %#v", results[0])
+	}
+	if msgs := state.RecordStale(results); len(msgs) != 0 {
+		t.Errorf("expected no repeated warning; got %q", msgs)
+	}
+
+	r.Config.StaleAfter = Duration{}
+	r.Config.StaleFactor = 1000
+	if msgs := state.RecordStale(r.pass()); len(msgs) != 1 || msgs[0] != "slackware64 is no longer stale" {
+		t.Errorf("expected slackware64 to no longer be stale; got %q", msgs)
+	}
+}
+
+func TestRunETag(t *testing.T) {
+	data, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like a CDN, with a last-modified that never changes but a stable ETag
+	etag := `"v1"`
+	sent := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sent = append(sent, req.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, req, "ChangeLog.txt", time.Unix(1000000000, 0), bytes.NewReader(data))
+	}))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.State = NewState()
+
+	run := func(expected error) {
+		t.Helper()
+		results := r.pass()
+		if len(results) != 1 || results[0].Err != expected {
+			t.Fatalf("expected %v; got %#v", expected, results)
+		}
+		r.State.Record(results, time.Now())
+	}
+	run(nil)
+	if fs := r.State.Feed("slackware64"); fs.ETag != `"v1"` || !fs.LastModified.Equal(time.Unix(1000000000, 0)) {
+		t.Errorf("expected the ETag and last-modified in the state; got %#v", fs)
+	}
+	run(fetch.ErrNotNewer)
+	etag = `"v2"`
+	data = append(data, '\n')
+	run(nil)
+	// another ETag, for the same ChangeLog
+	etag = `"v3"`
+	run(fetch.ErrNotNewer)
+	run(fetch.ErrNotNewer)
+	if expected := []string{"", `"v1"`, `"v1"`, `"v2"`, `"v3"`}; fmt.Sprint(sent) != fmt.Sprint(expected) {
+		t.Errorf("expected If-None-Match of %q; got %q", expected, sent)
+	}
+
+	// without the state, it is by the last-modified
+	r.State = NewState()
+	run(fetch.ErrNotNewer)
+}
+
+func TestRunState(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.State = NewState()
+	run := func(expected error) {
+		t.Helper()
+		results := r.pass()
+		if len(results) != 1 || results[0].Err != expected {
+			t.Fatalf("expected %v; got %#v", expected, results)
+		}
+		r.State.Record(results, time.Now())
+	}
+
+	run(nil)
+	if fs := r.State.Feed("slackware64"); fs.LastModified.IsZero() || len(fs.Checksum) != 64 {
+		t.Errorf("expected the last-modified and checksum of the ChangeLog in the state; got %#v", fs)
+	}
+	// the feed files copied without their times, as by a restore
+	feed := filepath.Join(r.Dest, "slackware64.rss")
+	if err := os.Chtimes(feed, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	run(fetch.ErrNotNewer)
+
+	// a ChangeLog touched, but unchanged
+	r.State.Feed("slackware64").LastModified = time.Unix(0, 0)
+	run(fetch.ErrNotNewer)
+	if fs := r.State.Feed("slackware64"); fs.LastModified.Equal(time.Unix(0, 0)) {
+		t.Error("expected the newer last-modified in the state")
+	}
+
+	r.Force = true
+	run(nil)
+	if stat, err := os.Stat(feed); err != nil || stat.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected the feed to be written again; got %v", err)
+	}
+}
+
+func TestRunUnchangedContent(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}})
+	defer cleanup()
+	if results := r.pass(); results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	feed := filepath.Join(r.Dest, "slackware64.rss")
+	data, err := ioutil.ReadFile(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (of the newest entry, not of when it was written)
+	if !strings.Contains(string(data), "<lastBuildDate>Mon, 23 Jan 2017 21:30:13 +0000</lastBuildDate>") {
+		t.Fatalf("expected the lastBuildDate of the newest entry; got:\n%s", data)
+	}
+
+	// the feed older than the ChangeLog, as when its last-modified is bumped
+	if err := os.Chtimes(feed, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r.Logger = log.New(&buf, "", 0)
+	r.Quiet, r.Verbose = false, true
+	if results := r.pass(); results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if stat, err := os.Stat(feed); err != nil || !stat.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected the feed of the same content left as it was; got %v", err)
+	}
+	if !strings.Contains(buf.String(), "slackware64.rss: unchanged content") {
+		t.Errorf("expected the unchanged content logged; got:\n%s", buf.String())
+	}
+
+	// but written when it differs
+	r.Config.MaxItems = 1
+	if results := r.pass(); results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if stat, err := os.Stat(feed); err != nil || stat.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected the feed of new content written; got %v", err)
+	}
+}
+
+func TestRunTailFetch(t *testing.T) {
+	data, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	divider := "+--------------------------+\n"
+	// the ChangeLog before its newest entry
+	serving := data[strings.Index(string(data), divider)+len(divider):]
+	mtime := time.Unix(1000000000, 0)
+	ranges := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		http.ServeContent(w, req, "ChangeLog.txt", mtime, bytes.NewReader(serving))
+	}))
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.TailFetch = true
+	r.State = NewState()
+	run := func() ReleaseResult {
+		t.Helper()
+		results := r.pass()
+		if len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("expected the feed to be written; got %#v", results)
+		}
+		r.State.Record(results, time.Now())
+		return results[0]
+	}
+
+	run()
+	serving, mtime = data, mtime.Add(time.Hour)
+	res := run()
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=0-262143" {
+		t.Errorf("expected only the second request to be of a range; got %q", ranges)
+	}
+	if res.Entries != 52 || len(res.Requests) != 1 || res.Requests[0].StatusCode != http.StatusPartialContent {
+		t.Errorf("expected the entries of the whole ChangeLog, from a %d; got %d entries, of %#v", http.StatusPartialContent, res.Entries, res.Requests)
+	}
+	if cached, err := readCache(r.Dest, "slackware64"); err != nil || string(cached) != string(data) {
+		t.Errorf("expected the whole ChangeLog to be cached; got %d bytes (%v)", len(cached), err)
+	}
+}
+
+func TestRunRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old/", http.RedirectHandler("/slackware/slackware64/ChangeLog.txt", http.StatusMovedPermanently))
+	mux.Handle("/slackware/", http.StripPrefix("/slackware/", http.FileServer(http.Dir("../changelog/testdata/"))))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL + "/old/", Releases: []string{"slackware64"}})
+	defer cleanup()
+	logs := bytes.NewBuffer(nil)
+	r.Logger = log.New(logs, "", 0)
+
+	results := r.pass()
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the redirect to be followed; got %#v", results)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(r.Dest, "slackware64.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<link>"+server.URL+"/slackware/slackware64</link>") {
+		t.Errorf("expected the link of the URL redirected to; got:\n%.400s", data)
+	}
+	if !strings.Contains(logs.String(), "warning: slackware64: \""+server.URL+"/old/slackware64\" redirects to \""+server.URL+"/slackware/slackware64\"") {
+		t.Errorf("expected a warning of the redirect; got:\n%s", logs)
+	}
+
+	if err := os.Remove(filepath.Join(r.Dest, "slackware64.rss")); err != nil {
+		t.Fatal(err)
+	}
+	r.NoRedirects = true
+	results = r.pass()
+	if len(results) != 1 || results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "301 status") {
+		t.Errorf("expected the redirect to fail the release; got %#v", results)
+	}
+}
+
+func TestRunUserinfoNotLeaked(t *testing.T) {
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "vbatts" || pass != "sekrit" {
+			http.Error(w, "who are you", http.StatusUnauthorized)
+			return
+		}
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	path, cleanupConfig := writeTestConfig(t, `[[Mirrors]]
+URL = "`+strings.Replace(server.URL, "http://", "http://vbatts:sekrit@", 1)+`"
+Releases = ["slackware64", "missing"]
+`)
+	defer cleanupConfig()
+	config, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, cleanup := newTestRunner(t, config.Mirrors...)
+	defer cleanup()
+	logs := bytes.NewBuffer(nil)
+	r.Quiet = false
+	r.Logger = log.New(logs, "", 0)
+	results := r.pass()
+	if results[0].Err != nil {
+		t.Fatalf("expected the credentials to be used; got %v", results[0].Err)
+	}
+	for _, res := range results {
+		logs.WriteString(res.Error())
+	}
+	if err := WriteReportFile(filepath.Join(r.Dest, "report.json"), newReport(results, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(logs.String(), "sekrit") {
+		t.Errorf("expected no password in the logs; got:\n%s", logs)
+	}
+	err = filepath.Walk(r.Dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte("sekrit")) {
+			t.Errorf("expected no password in %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunAuthFiles(t *testing.T) {
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		if req.Header.Get("Authorization") != "Bearer t0ken" && (!ok || user != "vbatts" || pass != "sekrit") {
+			http.Error(w, "who are you", http.StatusUnauthorized)
+			return
+		}
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sl-feeds-auth.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile, tokenFile, wrongFile := filepath.Join(dir, "password"), filepath.Join(dir, "token"), filepath.Join(dir, "wrong")
+	for path, content := range map[string]string{passwordFile: "sekrit\n", tokenFile: "t0ken\n", wrongFile: "nope\n"} {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, m := range []Mirror{
+		{URL: server.URL, Username: "vbatts", PasswordFile: passwordFile},
+		{URL: server.URL, BearerTokenFile: tokenFile},
+	} {
+		m.Releases = []string{"slackware64"}
+		r, cleanup := newTestRunner(t, m)
+		defer cleanup()
+		logs := bytes.NewBuffer(nil)
+		r.Quiet, r.Verbose = false, true
+		r.Logger = log.New(logs, "", 0)
+		if results := r.pass(); results[0].Err != nil {
+			t.Errorf("%s: expected the credentials to be used; got %v", m.URL, results[0].Err)
+		}
+		if strings.Contains(logs.String(), "sekrit") || strings.Contains(logs.String(), "t0ken") {
+			t.Errorf("expected no credentials in the logs; got:\n%s", logs)
+		}
+	}
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}, BearerTokenFile: wrongFile})
+	defer cleanup()
+	results := r.pass()
+	if results[0].Err == nil || !errors.Is(results[0].Err, fetch.ErrAuthFailed) || !strings.Contains(results[0].Err.Error(), "authentication failed") {
+		t.Errorf("expected the authentication to fail; got %v", results[0].Err)
+	}
+
+	r, cleanup = newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}, BearerTokenFile: filepath.Join(dir, "missing")})
+	defer cleanup()
+	if results := r.pass(); results[0].Err == nil {
+		t.Error("expected an error of the missing BearerTokenFile")
+	}
+
+	config := Config{Mirrors: []Mirror{
+		{URL: "https://internal.example/", Releases: []string{"slackware64"}, Username: "vbatts", Password: "sekrit", PasswordFile: passwordFile},
+		{URL: "https://other.example/", Releases: []string{"slackware64"}, Prefix: "other-", Username: "vbatts", BearerTokenFile: tokenFile},
+	}}
+	probs := config.Problems()
+	if len(probs) != 2 || !strings.Contains(probs[0], "Password and PasswordFile") || !strings.Contains(probs[1], "BearerTokenFile is instead") {
+		t.Errorf("expected the problems of the credentials of the mirrors; got %q", probs)
+	}
+}
+
+func TestRunFTPUpload(t *testing.T) {
+	for _, noRename := range []bool{false, true} {
+		server, err := ftptest.NewServer("vbatts", "sekrit")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		server.NoRename = noRename
+		mirror := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+		defer mirror.Close()
+
+		r, cleanup := newTestRunner(t, Mirror{URL: mirror.URL, Releases: []string{"slackware64"}})
+		defer cleanup()
+		r.Config.FTPUpload = &FTPUpload{Host: server.Addr, Username: "vbatts", Password: "sekrit", Dir: "/feeds"}
+
+		results := r.pass()
+		dest := "ftp://" + server.Addr + "/feeds/slackware64.rss"
+		if err, ok := results[0].Dests[dest]; !ok || err != nil {
+			t.Fatalf("expected %s to be uploaded; got %v", dest, results[0].Dests)
+		}
+		local, err := os.Stat(filepath.Join(r.Dest, "slackware64.rss"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := server.Files()
+		f, ok := files["/feeds/slackware64.rss"]
+		if !ok || int64(len(f.Data)) != local.Size() || len(files) != 1 {
+			t.Fatalf("expected only the uploaded feed; got %d files", len(files))
+		}
+		if !f.ModTime.Equal(local.ModTime().Truncate(time.Second)) {
+			t.Errorf("expected the mtime %s to be kept; got %s", local.ModTime(), f.ModTime)
+		}
+
+		// nothing changed, so nothing more is uploaded
+		r.pass()
+		stors := 0
+		for _, cmd := range server.Commands() {
+			if strings.HasPrefix(cmd, "STOR ") {
+				stors++
+			}
+		}
+		expected := 1
+		if noRename {
+			// the temporary name, and then directly
+			expected = 2
+		}
+		if stors != expected {
+			t.Errorf("noRename %t: expected %d STOR; got %d", noRename, expected, stors)
+		}
+	}
+}
+
+func TestRunPreserveItems(t *testing.T) {
+	full, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror, err := ioutil.TempDir("", "sl-feeds-mirror.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mirror)
+	if err := os.Mkdir(filepath.Join(mirror, "slackware64"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	changeLog := filepath.Join(mirror, "slackware64", "ChangeLog.txt")
+	// the ChangeLog as of the time, started anew with only its newest entries
+	writeChangeLog := func(data []byte, mtime time.Time) {
+		t.Helper()
+		if err := ioutil.WriteFile(changeLog, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(changeLog, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeChangeLog(full, time.Now().Add(-time.Hour))
+
+	r, cleanup := newTestRunner(t, Mirror{URL: "file://" + mirror, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.PreserveItems = true
+	r.Config.MaxItems = 10
+	logs := bytes.NewBuffer(nil)
+	r.Logger = log.New(logs, "", 0)
+	r.Quiet = false
+	feed := filepath.Join(r.Dest, "slackware64.rss")
+	items := func() int {
+		t.Helper()
+		data, err := ioutil.ReadFile(feed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "<item>")
+	}
+
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	if n := items(); n != 10 {
+		t.Fatalf("expected the MaxItems of items; got %d", n)
+	}
+
+	divider := "+--------------------------+\n"
+	newest := full[:strings.Index(string(full), divider)+len(divider)]
+	writeChangeLog(newest, time.Now().Add(-time.Minute))
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	if n := items(); n != 10 {
+		t.Errorf("expected the items of the feed to be preserved; got %d", n)
+	}
+	if !strings.Contains(logs.String(), "slackware64: preserved 9 items no longer of the ChangeLog") {
+		t.Errorf("expected the preserved items to be logged; got:\n%s", logs)
+	}
+
+	// a feed that can not be read is overwritten
+	if err := ioutil.WriteFile(feed, []byte("<rss><channel><item>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(feed, time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+	if n := items(); n != 1 {
+		t.Errorf("expected only the item of the ChangeLog; got %d", n)
+	}
+	if !strings.Contains(logs.String(), "warning: slackware64: overwriting") {
+		t.Errorf("expected a warning for the feed overwritten; got:\n%s", logs)
+	}
+}
+
+func TestRunPolite(t *testing.T) {
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	var (
+		mu     sync.Mutex
+		agents []string
+		starts []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		agents = append(agents, req.UserAgent())
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64", "slackwarearm"}})
+	defer cleanup()
+	delay := 200 * time.Millisecond
+	r.Config.RequestDelay = Duration{delay}
+	r.Config.MaxPerHost = 1
+	for _, res := range r.pass() {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Name, res.Err)
+		}
+	}
+
+	if len(agents) != 2 || !strings.HasPrefix(agents[0], "sl-feeds/") || agents[0] != agents[1] {
+		t.Errorf("expected a User-Agent of sl-feeds on each request; got %q", agents)
+	}
+	// (less a little, for the first having connected first)
+	if len(starts) == 2 && starts[1].Sub(starts[0]) < delay-delay/10 {
+		t.Errorf("expected the requests %s apart; got %s", delay, starts[1].Sub(starts[0]))
+	}
+
+	r.Config.UserAgent = "mirror-bot/1.0"
+	r.Force = true
+	agents = nil
+	r.pass()
+	if len(agents) != 2 || agents[0] != "mirror-bot/1.0" {
+		t.Errorf("expected the User-Agent of the config; got %q", agents)
+	}
+}
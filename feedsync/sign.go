@@ -0,0 +1,60 @@
+package feedsync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// SigExt is appended to the name of a generated file for its detached signature
+const SigExt = ".asc"
+
+// loadSigningKey reads the first private key from an armored keyring file
+func loadSigningKey(path string) (*openpgp.Entity, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(fh)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key %q: %v", path, err)
+	}
+	for _, e := range keyring {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("signing key %q is passphrase protected, which is not supported", path)
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("no private key found in %q", path)
+}
+
+// signDetached produces the ASCII armored detached signature of data
+func signDetached(signer *openpgp.Entity, data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := openpgp.ArmoredDetachSign(buf, signer, bytes.NewReader(data), nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// loadKeyring reads the public keys of an armored keyring file, for verifying
+func loadKeyring(path string) (openpgp.EntityList, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(fh)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring %q: %v", path, err)
+	}
+	return keyring, nil
+}
@@ -0,0 +1,61 @@
+package feedsync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestSignDetached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-sign.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e, err := openpgp.NewEntity("sl-feeds test", "", "sl-feeds@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "key.asc")
+	fh, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := armor.Encode(fh, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	fh.Close()
+
+	signer, err := loadSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("<rss></rss>")
+	sig, err := signDetached(signer, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := openpgp.EntityList{e}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig)); err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader([]byte("<rss/>")), bytes.NewReader(sig)); err == nil {
+		t.Error("expected the signature to not verify different content")
+	}
+
+	if _, err := loadSigningKey(filepath.Join(dir, "missing.asc")); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
@@ -0,0 +1,217 @@
+package feedsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/util"
+)
+
+// stateFileName is the name of the state file kept in the dest directory
+const stateFileName = ".sl-feeds-state.json"
+
+// State is what is remembered between runs, keyed by the feed name (and the
+// mirror name, for Mirrors)
+type State struct {
+	Feeds   map[string]*FeedState
+	Mirrors map[string]*MirrorState `json:",omitempty"`
+}
+
+// MirrorState is what is remembered about one mirror between runs
+type MirrorState struct {
+	// ConsecutiveFailures is the number of runs where every release
+	// attempted from the mirror failed
+	ConsecutiveFailures int
+	// BackoffUntil is when the mirror is next attempted, while backing off
+	BackoffUntil time.Time `json:",omitempty"`
+}
+
+// FeedState is what is remembered about one feed between runs
+type FeedState struct {
+	LastSuccess         time.Time
+	LastError           string `json:",omitempty"`
+	ConsecutiveFailures int    `json:",omitempty"`
+	// NextRun is when --daemon is next to process the feed
+	NextRun time.Time `json:",omitempty"`
+	// NewestEntry and LongestGap are of the ChangeLog, when it was last
+	// parsed, for noticing a stale feed when it is not parsed
+	NewestEntry time.Time     `json:",omitempty"`
+	LongestGap  time.Duration `json:",omitempty"`
+	// Stale is the warning last given about the feed being stale
+	Stale string `json:",omitempty"`
+	// ETag and LastModified are of the ChangeLog the feed was last written
+	// from, for only fetching it again once it has changed. The files of the
+	// feed are only compared by their times when there is no LastModified.
+	ETag         string    `json:",omitempty"`
+	LastModified time.Time `json:",omitempty"`
+	// Checksum is the sha256 of the ChangeLog the feed was last written from,
+	// for leaving the feed alone when only the last-modified has changed
+	Checksum string `json:",omitempty"`
+	// MinDate is the entry cutoff, from the MinDate (or --since) when the
+	// feed was first written
+	MinDate time.Time `json:",omitempty"`
+	// Files are the names (relative to the dest) of the files last written
+	// for the feed, for --prune to only ever remove the files of sl-feeds
+	Files []string `json:",omitempty"`
+}
+
+// LoadState reads the state file from the dest dir. A missing or corrupt state
+// file is not an error, and just produces an empty State.
+func LoadState(dest string) *State {
+	s := NewState()
+	data, err := ioutil.ReadFile(filepath.Join(dest, stateFileName))
+	if err != nil {
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return NewState()
+	}
+	if s.Feeds == nil {
+		s.Feeds = map[string]*FeedState{}
+	}
+	if s.Mirrors == nil {
+		s.Mirrors = map[string]*MirrorState{}
+	}
+	return s
+}
+
+// NewState is an empty State, of no feeds nor mirrors yet
+func NewState() *State {
+	return &State{Feeds: map[string]*FeedState{}, Mirrors: map[string]*MirrorState{}}
+}
+
+// Feed returns the FeedState for name, creating it if needed
+func (s *State) Feed(name string) *FeedState {
+	fs, ok := s.Feeds[name]
+	if !ok {
+		fs = &FeedState{}
+		s.Feeds[name] = fs
+	}
+	return fs
+}
+
+// Record updates the state with the results of a run
+func (s *State) Record(results []ReleaseResult, now time.Time) {
+	for _, r := range results {
+		if r.Skipped() {
+			continue
+		}
+		fs := s.Feed(r.Name)
+		if r.Parse != nil {
+			fs.NewestEntry, fs.LongestGap = r.Parse.Newest, r.Parse.LongestGap
+		}
+		if r.Failed() {
+			fs.ConsecutiveFailures++
+			fs.LastError = r.Error()
+			continue
+		}
+		fs.ConsecutiveFailures = 0
+		fs.LastError = ""
+		fs.LastSuccess = now
+		if !r.LastModified.IsZero() {
+			// only once the feed is written (or the ChangeLog is found to be
+			// unchanged), so that a failure fetches it again
+			fs.ETag, fs.LastModified = r.ETag, r.LastModified
+		}
+		if r.Err == nil && r.Checksum != "" {
+			fs.Checksum = r.Checksum
+		}
+		if r.Err == nil {
+			fs.MinDate = r.MinDate
+			fs.Files = r.Files
+		}
+	}
+}
+
+// Mirror returns the MirrorState for name, creating it if needed
+func (s *State) Mirror(name string) *MirrorState {
+	ms, ok := s.Mirrors[name]
+	if !ok {
+		ms = &MirrorState{}
+		s.Mirrors[name] = ms
+	}
+	return ms
+}
+
+// RecordMirrors updates the circuit breaker of each mirror in the results,
+// returning messages about mirrors starting or stopping to back off
+func (s *State) RecordMirrors(results []ReleaseResult, now time.Time, b backoff) []string {
+	attempted := map[string]bool{}
+	succeeded := map[string]bool{}
+	names := []string{}
+	for _, r := range results {
+		if r.Skipped() {
+			continue
+		}
+		if !attempted[r.Mirror] {
+			names = append(names, r.Mirror)
+		}
+		attempted[r.Mirror] = true
+		if !r.Failed() {
+			succeeded[r.Mirror] = true
+		}
+	}
+
+	msgs := []string{}
+	for _, name := range names {
+		ms := s.Mirror(name)
+		if succeeded[name] {
+			if !ms.BackoffUntil.IsZero() {
+				msgs = append(msgs, fmt.Sprintf("mirror %q recovered, no longer backing off", name))
+			}
+			ms.ConsecutiveFailures = 0
+			ms.BackoffUntil = time.Time{}
+			continue
+		}
+		ms.ConsecutiveFailures++
+		if b.After <= 0 || ms.ConsecutiveFailures < b.After {
+			continue
+		}
+		d := b.delay(ms.ConsecutiveFailures)
+		ms.BackoffUntil = now.Add(d)
+		msgs = append(msgs, fmt.Sprintf("mirror %q failed %d runs in a row, backing off for %s", name, ms.ConsecutiveFailures, d))
+	}
+	return msgs
+}
+
+// RecordStale notes which feeds are stale, returning a warning for each
+// feed that has become stale or crossed a further threshold since the last
+// run, and a note for each that is no longer stale. Warnings are not repeated
+// while the feed stays stale.
+func (s *State) RecordStale(results []ReleaseResult) []string {
+	msgs := []string{}
+	for _, r := range results {
+		fs := s.Feed(r.Name)
+		switch {
+		case r.Stale == fs.Stale:
+		case r.Stale == "":
+			msgs = append(msgs, fmt.Sprintf("%s is no longer stale", r.Name))
+		default:
+			msgs = append(msgs, fmt.Sprintf("warning: %s is stale: %s", r.Name, r.Stale))
+		}
+		fs.Stale = r.Stale
+	}
+	return msgs
+}
+
+// ResetBackoff clears the circuit breakers of all mirrors
+func (s *State) ResetBackoff() {
+	s.Mirrors = map[string]*MirrorState{}
+}
+
+// Save writes the state file to the dest dir, by way of a temporary file so
+// that the state is never half written.
+func (s *State) Save(dest string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(dest, stateFileName), time.Time{}, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,79 @@
+package feedsync
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+func TestStateSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-state.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// missing and corrupt state files are just empty
+	if s := LoadState(dir); len(s.Feeds) != 0 {
+		t.Errorf("expected an empty state; got %#v", s)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, stateFileName), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s := LoadState(dir); len(s.Feeds) != 0 || s.Mirrors == nil {
+		t.Errorf("expected an empty state; got %#v", s)
+	}
+
+	s := LoadState(dir)
+	s.Record([]ReleaseResult{{Name: "slackware64-current", Err: errors.New("404 status")}}, time.Now())
+	if err := s.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	s = LoadState(dir)
+	if s.Feed("slackware64-current").ConsecutiveFailures != 1 {
+		t.Errorf("expected %d failure; got %d", 1, s.Feed("slackware64-current").ConsecutiveFailures)
+	}
+}
+
+func TestStateBackoff(t *testing.T) {
+	b := backoff{After: 2, Base: 30 * time.Minute, Max: 24 * time.Hour}
+	s := NewState()
+	now := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	failing := []ReleaseResult{{Name: "slackware64-current", Mirror: "mirror.example", Err: errors.New("404 status")}}
+
+	if msgs := s.RecordMirrors(failing, now, b); len(msgs) != 0 {
+		t.Errorf("expected no backoff after the first failure; got %q", msgs)
+	}
+	expected := []time.Duration{30 * time.Minute, time.Hour, 2 * time.Hour}
+	for _, d := range expected {
+		if msgs := s.RecordMirrors(failing, now, b); len(msgs) != 1 {
+			t.Errorf("expected a backoff message; got %q", msgs)
+		}
+		if until := s.Mirror("mirror.example").BackoffUntil; !until.Equal(now.Add(d)) {
+			t.Errorf("expected to back off for %s; got %s", d, until.Sub(now))
+		}
+	}
+	if d := b.delay(100); d != b.Max {
+		t.Errorf("expected the delay to be capped at %s; got %s", b.Max, d)
+	}
+
+	// skipped releases do not count either way
+	s.RecordMirrors([]ReleaseResult{{Name: "slackware64-current", Mirror: "mirror.example", Err: ErrBackoff}}, now, b)
+	if s.Mirror("mirror.example").ConsecutiveFailures != 4 {
+		t.Errorf("expected %d failures; got %d", 4, s.Mirror("mirror.example").ConsecutiveFailures)
+	}
+
+	// an unchanged feed is a success, which resets the breaker
+	ok := []ReleaseResult{{Name: "slackware64-current", Mirror: "mirror.example", Err: fetch.ErrNotNewer}}
+	if msgs := s.RecordMirrors(ok, now, b); len(msgs) != 1 {
+		t.Errorf("expected a recovered message; got %q", msgs)
+	}
+	if ms := s.Mirror("mirror.example"); ms.ConsecutiveFailures != 0 || !ms.BackoffUntil.IsZero() {
+		t.Errorf("expected the breaker to be reset; got %#v", ms)
+	}
+}
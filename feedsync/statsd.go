@@ -0,0 +1,62 @@
+package feedsync
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// statsdNameReg matches what may not appear in one part of a statsd metric name
+var statsdNameReg = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// statsdName sanitizes s to be a single dot separated part of a metric name,
+// so a release like "slackware64-14.2" becomes "slackware64-14_2"
+func statsdName(s string) string {
+	return statsdNameReg.ReplaceAllString(s, "_")
+}
+
+// Statsd emits metrics over UDP. Emitting is fire-and-forget, so errors are
+// ignored and a nil *Statsd does nothing.
+type Statsd struct {
+	conn   net.Conn
+	prefix string
+}
+
+// DialStatsd sets up the UDP socket for the statsd daemon at addr
+func DialStatsd(addr, prefix string) (*Statsd, error) {
+	conn, err := net.DialTimeout("udp", addr, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+	return &Statsd{conn: conn, prefix: prefix}, nil
+}
+
+func (s *Statsd) send(name, value, kind string) {
+	if s == nil {
+		return
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	fmt.Fprintf(s.conn, "%s%s:%s|%s", s.prefix, name, value, kind)
+}
+
+// Count adds n to the counter name
+func (s *Statsd) Count(name string, n int64) {
+	s.send(name, fmt.Sprint(n), "c")
+}
+
+// Timing records d for the timer name
+func (s *Statsd) Timing(name string, d time.Duration) {
+	s.send(name, fmt.Sprint(d.Nanoseconds()/int64(time.Millisecond)), "ms")
+}
+
+// Close the socket
+func (s *Statsd) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
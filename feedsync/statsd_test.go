@@ -0,0 +1,45 @@
+package feedsync
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := DialStatsd(conn.LocalAddr().String(), "sl-feeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Count("feed."+statsdName("slackware64-14.2")+".entries", 52)
+	s.Timing("mirror."+statsdName("slackware.osuosl.org")+".fetch", 1500*time.Millisecond)
+
+	expected := []string{
+		"sl-feeds.feed.slackware64-14_2.entries:52|c",
+		"sl-feeds.mirror.slackware_osuosl_org.fetch:1500|ms",
+	}
+	buf := make([]byte, 512)
+	for _, e := range expected {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != e {
+			t.Errorf("expected %q; got %q", e, string(buf[:n]))
+		}
+	}
+
+	// a nil statsd is a no-op
+	var none *Statsd
+	none.Count("failures", 1)
+	none.Close()
+}
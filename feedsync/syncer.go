@@ -0,0 +1,151 @@
+// Package feedsync keeps the RSS (and Atom and JSON) feeds of the ChangeLog.txt
+// of Slackware releases up to date, from the mirrors of a Config. It is what
+// the sl-feeds command runs, for it to be embedded in other services too:
+//
+//	config, _, err := feedsync.LoadConfig("/etc/sl-feeds.toml")
+//	...
+//	s, err := feedsync.New(config, nil)
+//	...
+//	rep, err := s.Run(ctx)
+package feedsync
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// New is a Syncer for config, after checking its Problems. It writes to the
+// local Dest (or WorkDir), publishes to the Dest, and signs the feeds with
+// SignOutput. tlsConfig, when set, is for connecting to the mirrors and for
+// publishing, like with --ca and --insecure. Any credentials in the mirror
+// URLs are moved out of them, as LoadConfig does, so they are never logged.
+func New(config Config, tlsConfig *tls.Config) (Syncer, error) {
+	mirrors := make([]Mirror, len(config.Mirrors))
+	for i, m := range config.Mirrors {
+		mirrors[i] = m.WithoutUserinfo()
+	}
+	config.Mirrors = mirrors
+	if probs := config.Problems(); len(probs) > 0 {
+		return Syncer{}, errors.New(strings.Join(probs, "; "))
+	}
+	r := Syncer{
+		Config:    config,
+		Dest:      config.LocalDest(),
+		Quiet:     config.Quiet,
+		Logger:    log.New(os.Stderr, "", log.LstdFlags),
+		TLSConfig: tlsConfig,
+	}
+	var err error
+	if r.Publisher, err = newPublisher(config, tlsConfig); err != nil {
+		return Syncer{}, err
+	}
+	if config.SignOutput {
+		if r.Signer, err = loadSigningKey(os.ExpandEnv(config.SigningKey)); err != nil {
+			return Syncer{}, err
+		}
+	}
+	return r, nil
+}
+
+// Run does a pass over every release of every mirror (see pass), attempting no
+// more of them once ctx is done: those are the ErrInterrupted, or the
+// ErrDeadline past the deadline of ctx. The outcome of each release is in the
+// Report, and recorded in the State, which is saved to the Dest unless
+// DryRun, and the files of feeds no longer configured are removed with the
+// Prune of the Config (when no release failed). The error is of saving the
+// State, and is not of any release.
+func (r Syncer) Run(ctx context.Context) (Report, error) {
+	r.ctx = ctx
+	if r.State == nil {
+		r.State = LoadState(r.Dest)
+	}
+	start := time.Now()
+	results := r.pass()
+	now := time.Now()
+	r.Statsd.Timing("run", now.Sub(start))
+	if len(results) > 0 {
+		r.Infof(LogFields{Action: "summary", Duration: now.Sub(start)}, "%s", runSummary(results, now.Sub(start)))
+	}
+
+	notices := r.State.RecordMirrors(results, now, r.Config.backoff())
+	notices = append(notices, r.State.RecordStale(results)...)
+	for _, msg := range notices {
+		r.Notice(msg)
+	}
+	failed := 0
+	for _, res := range results {
+		if res.Failed() {
+			failed++
+		}
+	}
+	save := len(results) > 0 && !r.DryRun
+	if save {
+		r.State.Record(results, now)
+	}
+	if r.Interval > 0 {
+		for _, res := range results {
+			rel, ok := r.Config.feedRelease(res.Name)
+			if !ok {
+				rel = Release{Name: res.Name}
+			}
+			r.State.Feed(res.Name).NextRun = rel.nextRun(now, r.Interval)
+		}
+	}
+	if r.Config.Prune {
+		if failed > 0 {
+			r.Warnf(LogFields{Action: "prune"}, "not pruning, as not every release succeeded")
+		} else {
+			if err := r.prune(r.State); err != nil {
+				r.Errorf(LogFields{Action: "prune", Err: err}, "%v", err)
+			}
+			// (for the state to forget the files pruned)
+			save = !r.DryRun
+		}
+	}
+
+	rep := newReport(results, start)
+	rep.Notices = notices
+	if r.Interval > 0 {
+		for i, f := range rep.Feeds {
+			next := r.State.Feed(f.Feed).NextRun
+			rep.Feeds[i].NextRun = &next
+		}
+	}
+	if save {
+		if err := r.State.Save(r.Dest); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+// SyncRelease fetches the ChangeLog of release and writes its feeds, as Run
+// does for each release, but without recording the State, copying to the
+// ExtraDests, uploading, or writing the combined feed and indexes. The error
+// is the Err of the ReleaseResult, except nil for an unchanged feed.
+func (r Syncer) SyncRelease(ctx context.Context, mirror Mirror, release string) (ReleaseResult, error) {
+	r.ctx = ctx
+	mirror = mirror.WithoutUserinfo()
+	if r.Limiter == nil {
+		r.Limiter = r.Config.hostLimiter()
+	}
+	rel := Release{Name: release}
+	for _, mr := range mirror.releases() {
+		if mr.Name == release {
+			rel = mr
+			break
+		}
+	}
+	res := r.process(mirror, rel)
+	if res.Err == fetch.ErrNotNewer {
+		return res, nil
+	}
+	return res, res.Err
+}
@@ -0,0 +1,220 @@
+package feedsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport counts the requests made through it
+type countingTransport struct {
+	n int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewProblems(t *testing.T) {
+	_, err := New(Config{Jobs: -1}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Jobs") {
+		t.Errorf("expected the problem of the config; got %v", err)
+	}
+
+	_, err = New(Config{FilenameTemplate: "feed.{{.Format}}", Mirrors: []Mirror{{URL: "http://mirror.example", Releases: []string{"slackware64-14.2", "slackware64-current"}}}}, nil)
+	if err == nil || !strings.Contains(err.Error(), `"feed.rss" is also written by the release "slackware64-14.2"`) {
+		t.Errorf("expected the feed files of the releases to collide; got %v", err)
+	}
+
+	dir := t.TempDir()
+	s, err := New(Config{Dest: dir, Mirrors: []Mirror{{URL: "http://mirror.example"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Dest != dir || s.Logger == nil {
+		t.Errorf("expected the Dest %q and a Logger; got %q and %v", dir, s.Dest, s.Logger)
+	}
+}
+
+func TestSyncerRun(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64", "missing"}})
+	defer cleanup()
+	transport := &countingTransport{}
+	r.Client = &http.Client{Transport: transport}
+
+	rep, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Results) != 2 || len(rep.Feeds) != 2 {
+		t.Fatalf("expected 2 results; got %#v", rep.Results)
+	}
+	if s := rep.Results[0].Status(); s != "updated" {
+		t.Errorf("expected slackware64 to be updated; got %s (%v)", s, rep.Results[0].Err)
+	}
+	if s := rep.Results[1].Status(); s != "failed" {
+		t.Errorf("expected missing to have failed; got %s", s)
+	}
+	if atomic.LoadInt32(&transport.n) == 0 {
+		t.Error("expected the requests to be of the Client")
+	}
+
+	state := LoadState(r.Dest)
+	if state.Feed("slackware64").LastSuccess.IsZero() {
+		t.Error("expected the state to be saved with the success of slackware64")
+	}
+	if state.Feed("missing").ConsecutiveFailures != 1 {
+		t.Errorf("expected the state to be saved with the failure of missing; got %#v", state.Feed("missing"))
+	}
+}
+
+func TestSyncerRunCanceled(t *testing.T) {
+	r, cleanup := newTestRunner(t, Mirror{URL: "http://127.0.0.1:0", Releases: []string{"slackware64"}})
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rep, err := r.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Err != ErrInterrupted {
+		t.Errorf("expected the release to not be attempted; got %#v", rep.Results)
+	}
+}
+
+func TestSyncerRunCanceledMidBody(t *testing.T) {
+	data, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// half of the ChangeLog, and then nothing more
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-req.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t, Mirror{URL: server.URL, Releases: []string{"slackware64"}})
+	defer cleanup()
+	r.Config.Timeout = Duration{time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	rep, err := r.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("expected the stalled download to be stopped with the run; took %s", d)
+	}
+	if len(rep.Results) != 1 || !errors.Is(rep.Results[0].Err, context.DeadlineExceeded) {
+		t.Errorf("expected the release to fail with the run deadline; got %#v", rep.Results)
+	}
+}
+
+func TestSyncRelease(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+
+	mirror := Mirror{URL: server.URL, Releases: []string{"slackware64"}}
+	r, cleanup := newTestRunner(t, mirror)
+	defer cleanup()
+	r.State = NewState()
+
+	res, err := r.SyncRelease(context.Background(), mirror, "slackware64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status() != "updated" || res.Entries == 0 {
+		t.Errorf("expected the feed to be written; got %#v", res)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dest, "slackware64.rss")); err != nil {
+		t.Error(err)
+	}
+
+	// the ChangeLog is no newer than the feed now written
+	res, err = r.SyncRelease(context.Background(), mirror, "slackware64")
+	if err != nil {
+		t.Errorf("expected no error of an unchanged feed; got %v", err)
+	}
+	if res.Status() != "unchanged" {
+		t.Errorf("expected the feed to be unchanged; got %s", res.Status())
+	}
+
+	if _, err := r.SyncRelease(context.Background(), mirror, "missing"); err == nil {
+		t.Error("expected the error of a missing release")
+	}
+}
+
+func TestSyncerUserinfoNotLogged(t *testing.T) {
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "vbatts" || pass != "sekrit" {
+			http.Error(w, "who are you", http.StatusUnauthorized)
+			return
+		}
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	mirror := Mirror{URL: strings.Replace(server.URL, "http://", "http://vbatts:sekrit@", 1), Releases: []string{"slackware64", "missing"}}
+	s, err := New(Config{Dest: t.TempDir(), Mirrors: []Mirror{mirror}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(mirror.URL, "sekrit") == strings.Contains(s.Config.Mirrors[0].URL, "sekrit") {
+		t.Errorf("expected the credentials moved out of the Syncer's URL, and the caller's left alone; got %q", s.Config.Mirrors[0].URL)
+	}
+	logs := &bytes.Buffer{}
+	s.Logger = log.New(logs, "", 0)
+	s.Quiet, s.Verbose = false, true
+
+	rep, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Results) != 2 || rep.Results[0].Err != nil {
+		t.Fatalf("expected the credentials to be used; got %#v", rep.Results)
+	}
+	res, err := s.SyncRelease(context.Background(), mirror, "missing")
+	if err == nil {
+		t.Error("expected the error of a missing release")
+	}
+	rep.Results = append(rep.Results, res)
+	for _, res := range rep.Results {
+		logs.WriteString(res.Error())
+	}
+	data, err := json.Marshal(newReport(rep.Results, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.Write(data)
+	if strings.Contains(logs.String(), "sekrit") {
+		t.Errorf("expected no password in the logs or the report; got:\n%s", logs)
+	}
+}
@@ -0,0 +1,154 @@
+package feedsync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/ftp"
+)
+
+// uploader puts the outputs on the FTPUpload server, over one connection for
+// the whole run
+type uploader struct {
+	r    Syncer
+	conf FTPUpload
+	c    *ftp.Client
+	// noRename is set once the server turns out to not support RNFR/RNTO
+	noRename bool
+}
+
+// connect logs in to the server, unless already connected
+func (u *uploader) connect() error {
+	if u.c != nil {
+		return nil
+	}
+	opts := ftp.Options{TLS: u.conf.TLS, Active: !u.conf.passive(), Timeout: 30 * time.Second}
+	if u.r.TLSConfig != nil {
+		// the same --insecure and --ca as for the mirrors
+		opts.TLSConfig = u.r.TLSConfig
+	}
+	c, err := ftp.Dial(u.conf.addr(), opts)
+	if err != nil {
+		return err
+	}
+	user, password := u.credentials()
+	if err := c.Login(user, password); err != nil {
+		c.Quit()
+		return err
+	}
+	u.c = c
+	return nil
+}
+
+// credentials are the configured ones, or else those from the netrc, or else
+// anonymous
+func (u *uploader) credentials() (user, password string) {
+	if u.conf.Username != "" || u.conf.Password != "" {
+		return u.conf.Username, u.conf.Password
+	}
+	host, _, err := net.SplitHostPort(u.conf.addr())
+	if err == nil {
+		if e, ok := u.r.Netrc.lookup(host); ok {
+			return e.Login, e.Password
+		}
+	}
+	return "anonymous", "anonymous@"
+}
+
+// close ends the session, if there is one
+func (u *uploader) close() {
+	if u.c != nil {
+		u.c.Quit()
+		u.c = nil
+	}
+}
+
+// upload puts each of the named outputs from the Dest dir on the server,
+// whenever the copy there is missing or differs in mtime or size. The status
+// is by the URL of each file.
+func (u *uploader) upload(names []string) map[string]error {
+	errs := map[string]error{}
+	for _, name := range names {
+		src := filepath.Join(u.r.Dest, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		remote := path.Join(u.conf.Dir, name)
+		dest := "ftp://" + u.conf.addr() + path.Join("/", remote)
+		uploaded, err := u.uploadFile(src, remote)
+		errs[dest] = err
+		if _, ok := err.(*textproto.Error); err != nil && !ok {
+			// the connection is likely gone, so try a new one for the next
+			u.c = nil
+		}
+		if uploaded {
+			u.r.Infof(LogFields{Action: "upload"}, "uploaded %s", dest)
+		}
+	}
+	return errs
+}
+
+// uploadFile stores src at remote, unless it is already there
+func (u *uploader) uploadFile(src, remote string) (uploaded bool, err error) {
+	if err := u.connect(); err != nil {
+		return false, err
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if u.c.HasFeature("SIZE") && u.c.HasFeature("MDTM") {
+		size, err := u.c.Size(remote)
+		if err == nil && size == stat.Size() {
+			mtime, err := u.c.ModTime(remote)
+			if err == nil && mtime.Equal(stat.ModTime().Truncate(time.Second)) {
+				return false, nil
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return false, err
+	}
+	if err := u.store(remote, data); err != nil {
+		return false, err
+	}
+	if u.c.HasFeature("MFMT") {
+		if err := u.c.SetModTime(remote, stat.ModTime()); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// store puts data at remote by way of a temporary name and a rename, so that
+// the file is never seen partly uploaded, or directly when the server does
+// not support renames
+func (u *uploader) store(remote string, data []byte) error {
+	if !u.noRename {
+		tmp := path.Join(path.Dir(remote), "."+path.Base(remote)+".tmp")
+		if err := u.c.Store(tmp, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		err := u.c.Rename(tmp, remote)
+		if err == nil {
+			return nil
+		}
+		protoErr, ok := err.(*textproto.Error)
+		if !ok {
+			return err
+		}
+		if protoErr.Code == 500 || protoErr.Code == 502 || protoErr.Code == 504 {
+			u.noRename = true
+		}
+		u.c.Delete(tmp)
+	}
+	return u.c.Store(remote, bytes.NewReader(data))
+}
@@ -0,0 +1,170 @@
+package feedsync
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
+	"github.com/vbatts/sl-feeds/fetch"
+)
+
+// webhookTimeout is the longest each delivery to a webhook may take, so that
+// one that is down can not hold up the run
+const webhookTimeout = 10 * time.Second
+
+// webhookSignatureHeader carries the HMAC-SHA256 of a delivery body, keyed by
+// the WebhookSecret, as "sha256=" and its hex
+const webhookSignatureHeader = "X-Sl-Feeds-Signature"
+
+// webhookPayload is the JSON POSTed to the Webhooks of a mirror
+type webhookPayload struct {
+	Release string         `json:"release"`
+	Feed    string         `json:"feed"`
+	Mirror  string         `json:"mirror"`
+	File    string         `json:"file"`
+	Entries []webhookEntry `json:"entries"`
+}
+
+// webhookEntry is a new entry of a webhookPayload, with its text as in the
+// ChangeLog, and the packages of its updates
+type webhookEntry struct {
+	Date        string           `json:"date"`
+	Text        string           `json:"text"`
+	SecurityFix bool             `json:"security_fix"`
+	Packages    []webhookPackage `json:"packages"`
+}
+
+type webhookPackage struct {
+	File    string `json:"file"`
+	Action  string `json:"action"`
+	Series  string `json:"series,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// sendWebhooks POSTs the entries newer than since to each of the mirror
+// Webhooks, with the mirror TLS and proxy settings. A delivery with a 5xx response (or none)
+// is tried once more, and one that fails is logged and counted in res,
+// without failing the release.
+func (r Syncer) sendWebhooks(mirror Mirror, rel Release, res *ReleaseResult, entries []changelog.Entry, since time.Time) {
+	hooks := r.Config.webhooks(mirror)
+	if len(hooks) == 0 {
+		return
+	}
+	payload := webhookPayload{
+		Release: rel.Name,
+		Feed:    res.Name,
+		Mirror:  fetch.JoinURL(mirror.publicURL(), rel.Name),
+		File:    filepath.Join(r.Dest, r.Config.feedFiles(mirror, rel)[0]),
+		Entries: []webhookEntry{},
+	}
+	for _, e := range entries {
+		if !e.Date.After(since) {
+			continue
+		}
+		we := webhookEntry{Date: e.Date.UTC().Format(time.RFC3339), Text: e.ToChangeLog(), SecurityFix: e.SecurityFix(), Packages: []webhookPackage{}}
+		for _, u := range e.Updates {
+			p := u.Package()
+			we.Packages = append(we.Packages, webhookPackage{File: u.Name, Action: u.Action, Series: p.Series, Name: p.Name, Version: p.Version})
+		}
+		payload.Entries = append(payload.Entries, we)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		res.HookFailures += len(hooks)
+		r.Errorf(LogFields{Release: res.Name, Mirror: res.Mirror, Action: "webhook", Err: err}, "%v", err)
+		return
+	}
+
+	fields := LogFields{Release: res.Name, Mirror: res.Mirror, Action: "webhook"}
+	client, err := r.webhookClient(mirror)
+	if err != nil {
+		res.HookFailures += len(hooks)
+		fields.Err = err
+		r.Errorf(fields, "%v", err)
+		return
+	}
+	_, delay := r.Config.retries()
+	secret := r.Config.webhookSecret(mirror)
+	for _, hook := range hooks {
+		start := time.Now()
+		err := deliverWebhook(client, hook, body, secret, r.Config.userAgent())
+		if err != nil && retryWebhook(err) {
+			time.Sleep(delay)
+			err = deliverWebhook(client, hook, body, secret, r.Config.userAgent())
+		}
+		fields.Duration, fields.Err = time.Since(start), err
+		if err != nil {
+			res.HookFailures++
+			r.Errorf(fields, "webhook failed: %v", err)
+			continue
+		}
+		r.Infof(fields, "sent %d new entries to webhook %s", len(payload.Entries), hook)
+	}
+}
+
+// webhookClient is the client of the deliveries to the webhooks of the mirror,
+// with its TLS and proxy settings (but not its ConnectTo or ServerName, that
+// are for the mirror itself)
+func (r Syncer) webhookClient(m Mirror) (*http.Client, error) {
+	tlsConfig, err := mirrorTLSConfig(r.TLSConfig, m)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := parseProxy(r.Config.proxy(m))
+	if err != nil {
+		return nil, err
+	}
+	client := fetch.NewClient(fetch.ClientOptions{DialContext: r.DialContext, TLSConfig: tlsConfig, Proxy: proxy})
+	client.Timeout = webhookTimeout
+	return client, nil
+}
+
+// deliverWebhook POSTs the body to the URL, signed by the secret (when set)
+func deliverWebhook(client *http.Client, url string, body []byte, secret, userAgent string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(body, secret))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// (for the connection to be reused)
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &fetch.StatusError{StatusCode: resp.StatusCode, URL: url}
+	}
+	return nil
+}
+
+// retryWebhook is whether a failed delivery is tried once more: on a 5xx
+// response, or none at all
+func retryWebhook(err error) bool {
+	if statusErr, ok := err.(*fetch.StatusError); ok {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// signWebhook is the webhookSignatureHeader value for body
+func signWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
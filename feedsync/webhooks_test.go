@@ -0,0 +1,74 @@
+package feedsync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSendWebhooks(t *testing.T) {
+	dir, err := filepath.Abs("../changelog/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		attempts  int
+		payloads  []webhookPayload
+		signature string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if req.URL.Path == "/down" || attempts == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		signature = req.Header.Get(webhookSignatureHeader)
+		if signature != signWebhook(body, "s3cret") {
+			t.Errorf("expected the signature of the body; got %q", signature)
+		}
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	r, cleanup := newTestRunner(t,
+		Mirror{URL: "file://" + dir, Releases: []string{"slackware64"}, Webhooks: []string{server.URL + "/hook", server.URL + "/down"}},
+		Mirror{URL: "file://" + dir, Releases: []string{"slackwarearm"}, Webhooks: []string{}},
+	)
+	defer cleanup()
+	r.Config.Webhooks = []string{server.URL + "/hook"}
+	r.Config.WebhookSecret = "s3cret"
+
+	results := r.pass()
+	if len(results) != 2 || results[0].Err != nil || results[0].HookFailures != 1 || results[1].HookFailures != 0 {
+		t.Fatalf("expected a failed webhook, not failing the release; got %#v", results)
+	}
+	// the first 503, its retry, and twice for the /down
+	if attempts != 4 {
+		t.Errorf("expected 4 requests; got %d", attempts)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("expected the payload once; got %d", len(payloads))
+	}
+	p := payloads[0]
+	if p.Release != "slackware64" || p.Feed != "slackware64" || p.File != filepath.Join(r.Dest, "slackware64.rss") {
+		t.Errorf("unexpected payload %#v", p)
+	}
+	if len(p.Entries) != results[0].New || len(p.Entries[0].Packages) == 0 || p.Entries[0].Text == "" {
+		t.Fatalf("expected the %d new entries, with their packages; got %#v", results[0].New, p.Entries)
+	}
+	if pkg := p.Entries[0].Packages[0]; pkg.File == "" || pkg.Action == "" {
+		t.Errorf("expected the package of the update; got %#v", pkg)
+	}
+}
@@ -0,0 +1,62 @@
+package feedsync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// window is a daily span of time, which may wrap past midnight
+type window struct {
+	// start and end are minutes past midnight
+	start, end int
+	loc        *time.Location
+}
+
+// parseWindow parses a window like "22:00-06:00", optionally followed by the
+// name of a time zone like "22:00-06:00 UTC"
+func parseWindow(s string) (window, error) {
+	w := window{loc: time.Local}
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("invalid window %q, expected like \"22:00-06:00\"", s)
+	}
+	if len(fields) == 2 {
+		loc, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return w, fmt.Errorf("invalid window %q: %v", s, err)
+		}
+		w.loc = loc
+	}
+	span := strings.Split(fields[0], "-")
+	if len(span) != 2 {
+		return w, fmt.Errorf("invalid window %q, expected like \"22:00-06:00\"", s)
+	}
+	for i, p := range span {
+		t, err := time.Parse("15:04", p)
+		if err != nil {
+			return w, fmt.Errorf("invalid window %q: %q is not like \"22:00\"", s, p)
+		}
+		minutes := t.Hour()*60 + t.Minute()
+		if i == 0 {
+			w.start = minutes
+		} else {
+			w.end = minutes
+		}
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("invalid window %q, it is empty", s)
+	}
+	return w, nil
+}
+
+// contains is whether t falls within the window
+func (w window) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	minutes := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minutes >= w.start && minutes < w.end
+	}
+	// wraps past midnight
+	return minutes >= w.start || minutes < w.end
+}
@@ -0,0 +1,50 @@
+package feedsync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	w, err := parseWindow("22:00-06:00 UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		t        string
+		expected bool
+	}{
+		{"2024-01-03T21:59:00Z", false},
+		{"2024-01-03T22:00:00Z", true},
+		{"2024-01-03T23:30:00Z", true},
+		{"2024-01-04T00:00:00Z", true},
+		{"2024-01-04T05:59:00Z", true},
+		{"2024-01-04T06:00:00Z", false},
+		{"2024-01-04T12:00:00Z", false},
+		// 22:30 UTC, in another zone
+		{"2024-01-03T17:30:00-05:00", true},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.contains(tm); got != c.expected {
+			t.Errorf("%s: expected %t; got %t", c.t, c.expected, got)
+		}
+	}
+
+	w, err = parseWindow("09:00-17:00 UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.contains(time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)) || w.contains(time.Date(2024, 1, 3, 18, 0, 0, 0, time.UTC)) {
+		t.Error("unexpected daytime window")
+	}
+
+	for _, bad := range []string{"", "22:00", "22-06", "25:00-06:00", "22:00-06:00 Nowhere/Special", "06:00-06:00"} {
+		if _, err := parseWindow(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// unixScheme is the scheme of Repo URLs that are reached over a Unix socket,
+// like "http+unix:///run/mirror-proxy.sock:/slackware/"
+const unixScheme = "http+unix://"
+
+// ClientOptions are the customizations of a client from NewClient
+type ClientOptions struct {
+	// DialContext, when set, makes the connections instead of a net.Dialer
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// UnixSocket, when set, is the path of the socket every connection is
+	// made to (using DialContext, if that is also set)
+	UnixSocket string
+	// ServerName, when set, is the TLS server name to present and verify
+	// instead of the host of the URL
+	ServerName string
+	// TLSConfig, when set, is a template of the TLS settings (like the
+	// trusted CAs) of the connections
+	TLSConfig *tls.Config
+	// Proxy, when set, is the proxy of each request (nil for none), instead
+	// of the one from the environment
+	Proxy func(*http.Request) (*url.URL, error)
+	// NoRedirects gives a 3xx response as it is (so that it is a
+	// StatusError), rather than following it
+	NoRedirects bool
+}
+
+// NewClient is a client like http.DefaultClient, with the opts applied to
+// its copy of http.DefaultTransport
+func NewClient(opts ClientOptions) *http.Client {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		base = &http.Transport{}
+	}
+	transport := base.Clone()
+
+	dial := opts.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if opts.UnixSocket != "" {
+		socket := opts.UnixSocket
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, "unix", socket)
+		}
+	} else {
+		transport.DialContext = dial
+	}
+
+	if opts.Proxy != nil {
+		transport.Proxy = opts.Proxy
+	}
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig.Clone()
+	}
+	if opts.ServerName != "" {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.ServerName = opts.ServerName
+	}
+	client := &http.Client{Transport: transport}
+	if opts.NoRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+// SplitUnixURL splits a URL like "http+unix:///run/mirror-proxy.sock:/slackware/"
+// into the path of the socket ("/run/mirror-proxy.sock") and the URL to
+// request over it ("http://mirror-proxy.sock/slackware/"), which has the name
+// of the socket as a synthetic host. ok is false for any other URL.
+func SplitUnixURL(u string) (socket, httpURL string, ok bool) {
+	if !strings.HasPrefix(u, unixScheme) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(u, unixScheme)
+	i := strings.Index(rest, ":")
+	if i < 0 {
+		return rest, "http://" + filepath.Base(rest), rest != ""
+	}
+	socket = rest[:i]
+	if socket == "" {
+		return "", "", false
+	}
+	return socket, "http://" + filepath.Base(socket) + rest[i+1:], true
+}
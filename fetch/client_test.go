@@ -0,0 +1,61 @@
+package fetch
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitUnixURL(t *testing.T) {
+	cases := []struct {
+		url, socket, httpURL string
+		ok                   bool
+	}{
+		{"http+unix:///run/mirror-proxy.sock:/slackware/", "/run/mirror-proxy.sock", "http://mirror-proxy.sock/slackware/", true},
+		{"http+unix:///run/mirror-proxy.sock", "/run/mirror-proxy.sock", "http://mirror-proxy.sock", true},
+		{"http+unix://:/slackware/", "", "", false},
+		{"http://slackware.osuosl.org/", "", "", false},
+	}
+	for _, c := range cases {
+		socket, httpURL, ok := SplitUnixURL(c.url)
+		if socket != c.socket || httpURL != c.httpURL || ok != c.ok {
+			t.Errorf("%q: expected %q, %q, %t; got %q, %q, %t", c.url, c.socket, c.httpURL, c.ok, socket, httpURL, ok)
+		}
+	}
+}
+
+func TestFetchUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-fetch.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "mirror.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not available: %v", err)
+	}
+	var host string
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host = req.Host
+		files.ServeHTTP(w, req)
+	})}
+	go server.Serve(l)
+	defer server.Close()
+
+	r := Repo{URL: "http+unix://" + socket + ":", Release: "slackware64"}
+	e, _, err := r.ChangeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e) == 0 {
+		t.Error("expected entries from over the socket")
+	}
+	if host != "mirror.sock" {
+		t.Errorf("expected the synthetic host %q; got %q", "mirror.sock", host)
+	}
+}
@@ -0,0 +1,130 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestFetchCompressed(t *testing.T) {
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(gz)
+	gw.Write(plain)
+	gw.Close()
+	xzBuf := bytes.NewBuffer(nil)
+	xw, err := xz.NewWriter(xzBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xw.Write(plain)
+	xw.Close()
+	corrupt := append([]byte{}, gz.Bytes()...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	dir, err := ioutil.TempDir("", "sl-feeds-compressed.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"gz/ChangeLog.txt":         []byte("not what should be fetched"),
+		"gz/ChangeLog.txt.gz":      gz.Bytes(),
+		"xz/ChangeLog.txt.xz":      xzBuf.Bytes(),
+		"plain/ChangeLog.txt":      plain,
+		"corrupt/ChangeLog.txt":    plain,
+		"corrupt/ChangeLog.txt.gz": corrupt,
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetched := []string{}
+	fs := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// (the ones tried and not found are not fetched)
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(req.URL.Path))); err == nil && req.Method == http.MethodGet {
+			fetched = append(fetched, req.URL.Path)
+		}
+		fs.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	expected, _, err := Repo{URL: server.URL, Release: "plain"}.ChangeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for release, file := range map[string]string{"gz": "/gz/ChangeLog.txt.gz", "xz": "/xz/ChangeLog.txt.xz", "plain": "/plain/ChangeLog.txt"} {
+		fetched = fetched[:0]
+		r := Repo{URL: server.URL, Release: release, PreferCompressed: true}
+		e, _, err := r.NewerChangeLog(time.Unix(0, 0))
+		if err != nil {
+			t.Errorf("%s: %v", release, err)
+			continue
+		}
+		if len(e) != len(expected) {
+			t.Errorf("%s: expected %d entries; got %d", release, len(expected), len(e))
+		}
+		if len(fetched) != 1 || fetched[0] != file {
+			t.Errorf("%s: expected to fetch %s; got %q", release, file, fetched)
+		}
+	}
+
+	if _, _, err := (Repo{URL: server.URL, Release: "corrupt", PreferCompressed: true}).ChangeLog(); err == nil {
+		t.Error("expected an error for the corrupt ChangeLog.txt.gz")
+	}
+	if _, _, err := (Repo{URL: server.URL, Release: "missing", PreferCompressed: true}).ChangeLog(); err == nil {
+		t.Error("expected an error for a release with no ChangeLog")
+	}
+}
+
+func TestFetchContentEncoding(t *testing.T) {
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(gz)
+	gw.Write(plain)
+	gw.Close()
+	mtime := time.Date(2017, time.January, 23, 21, 30, 13, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// whether or not it was asked for, like some servers do
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Last-Modified", mtime.Format(http.TimeFormat))
+		w.Write(gz.Bytes())
+	}))
+	defer server.Close()
+
+	for _, client := range []*http.Client{
+		http.DefaultClient,
+		{Transport: &http.Transport{DisableCompression: true}},
+	} {
+		for _, prefer := range []bool{false, true} {
+			r := Repo{URL: server.URL, Release: "slackware64", Client: client, PreferCompressed: prefer}
+			e, m, err := r.ChangeLog()
+			if err != nil {
+				t.Errorf("prefer %v: %v", prefer, err)
+				continue
+			}
+			if len(e) != 52 || !m.Equal(mtime) {
+				t.Errorf("prefer %v: expected %d entries of %s; got %d of %s", prefer, 52, mtime, len(e), m)
+			}
+		}
+	}
+}
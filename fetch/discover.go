@@ -0,0 +1,68 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// KnownReleases are the release directories commonly found on slackware mirrors
+var KnownReleases = []string{
+	"slackware-14.0",
+	"slackware-14.1",
+	"slackware-14.2",
+	"slackware-15.0",
+	"slackware-current",
+	"slackware64-14.0",
+	"slackware64-14.1",
+	"slackware64-14.2",
+	"slackware64-15.0",
+	"slackware64-current",
+	"slackwarearm-14.2",
+	"slackwarearm-15.0",
+	"slackwarearm-current",
+	"slackwareaarch64-current",
+}
+
+// HasChangeLog is whether the Repo has a ChangeLog.txt to fetch
+func (r Repo) HasChangeLog() (bool, error) {
+	if r.local() {
+		rc, _, err := r.openLocal("ChangeLog.txt")
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		rc.Close()
+		return true, nil
+	}
+	resp, _, err := r.do(context.Background(), http.MethodHead, "ChangeLog.txt", time.Time{}, "", "")
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Discover probes the mirror at url for which of the candidate releases it
+// carries. Releases that can not be reached are left out, and err is only the
+// last problem encountered (if none were found).
+func Discover(url string, candidates []string) (releases []string, err error) {
+	releases = []string{}
+	for _, release := range candidates {
+		ok, e := Repo{URL: url, Release: release}.HasChangeLog()
+		if e != nil {
+			err = e
+			continue
+		}
+		if ok {
+			releases = append(releases, release)
+		}
+	}
+	if len(releases) > 0 {
+		err = nil
+	}
+	return releases, err
+}
@@ -0,0 +1,26 @@
+package fetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/")))
+	defer server.Close()
+
+	releases, err := Discover(server.URL+"/", []string{"slackware64", "slackware-current", "slackwarearm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"slackware64", "slackwarearm"}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("expected %q; got %q", expected, releases)
+	}
+
+	if _, err := Discover("http://127.0.0.1:0", []string{"slackware64"}); err == nil {
+		t.Error("expected an error for an unreachable mirror")
+	}
+}
@@ -1,48 +1,484 @@
 package fetch
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/ulikunitz/xz"
 	"github.com/vbatts/sl-feeds/changelog"
+	"golang.org/x/crypto/openpgp"
 )
 
 // Repo represents a remote slackware software repo
 type Repo struct {
 	URL     string
 	Release string
+
+	// PreferCompressed fetches ChangeLog.txt.gz or ChangeLog.txt.xz when the
+	// Repo has them, rather than the plain ChangeLog.txt
+	PreferCompressed bool
+
+	// Keyring, when set, has the keys the ChangeLog.txt must be signed by,
+	// either clearsigned or (like on the Slackware mirrors) listed with its md5
+	// in the CHECKSUMS.md5 of the release, signed by its CHECKSUMS.md5.asc
+	Keyring openpgp.KeyRing
+
+	// Username and Password, when set, are sent with basic auth
+	Username string
+	Password string
+	// BearerToken, when set, is sent as the Authorization of each request
+	// instead, as "Bearer" and the token
+	BearerToken string
+	// UserAgent, when set, is sent as the User-Agent of each request,
+	// instead of that of Go
+	UserAgent string
+	// Limiter, when set, throttles the requests to each host
+	Limiter *HostLimiter
+
+	// Client makes the requests, or http.DefaultClient when nil. For a URL
+	// over a Unix socket (see SplitUnixURL), the default is a new client for
+	// the socket on each request, so set this to reuse the connections.
+	Client *http.Client
+
+	// Retries is how many times a request is tried again after a connection
+	// error or a 5xx response (but not any other status), waiting RetryDelay
+	// and doubling that for each further retry
+	Retries    int
+	RetryDelay time.Duration
+	// Timeout, when set, is the longest each request may take, including
+	// reading and parsing the whole of the response
+	Timeout time.Duration
+
+	// Retrying, if set, is called with each failed attempt (from 1) that is
+	// to be tried again, and how long until it is
+	Retrying func(attempt int, err error, delay time.Duration)
+
+	// Observe, if set, is called with the Stats of each request made
+	Observe func(Stats)
+
+	// Fetched, if set, is called with the content of each ChangeLog that is
+	// parsed (decompressed, and without any clearsigning), along with its
+	// last-modified
+	Fetched func(data []byte, mtime time.Time)
+
+	// ETag, when set, is the entity tag of the ChangeLog last fetched, which
+	// NewerChangeLog sends as the If-None-Match. A response with this ETag is
+	// not newer, whatever its last-modified, and one with another ETag is.
+	ETag string
+
+	// Previous, when set, is the ChangeLog as last fetched (as given to
+	// Fetched), for NewerChangeLog to fetch just the HeadBytes at the start of
+	// the ChangeLog.txt with a Range request, as the ChangeLog grows from its
+	// top, and splice them onto Previous. The whole of it is fetched instead
+	// when the Repo ignores the Range, or the head does not reach back to the
+	// first entry of Previous, or the two do not add up to the size of the
+	// ChangeLog (as when an older entry was changed). It is not used for a
+	// compressed ChangeLog, nor one to be verified with a Keyring.
+	Previous  []byte
+	HeadBytes int64
+
+	// Redirected, if set, is called with the URL a ChangeLog was fetched from
+	// when that is not the one requested, after redirects
+	Redirected func(url string)
+
+	// LastModifiedFallback, if set, is called with the file and what its
+	// last-modified was taken from ("the Date of the response", "the newest
+	// entry" or "the time now"), when the response had none that could be
+	// parsed. NewerChangeLog then compares the newest entry to its time,
+	// after fetching and parsing the whole of the ChangeLog.
+	LastModifiedFallback func(file, from string)
+
+	// Validators, if set, is called with the ETag (if any) and last-modified
+	// of each ChangeLog that is fetched (or read, for a local Repo) and parsed
+	Validators func(etag string, mtime time.Time)
+
+	// Parsed, if set, is called with the changelog.ParseStats of each
+	// ChangeLog that is parsed
+	Parsed func(changelog.ParseStats)
+
+	// MaxEntries and MinDate, when set, stop the reading of a ChangeLog once
+	// that many entries are read, or at its first entry older than MinDate,
+	// as the ChangeLog is newest first. A ChangeLog read short of its end is
+	// not given to Fetched. They do not apply to a ChangeLog verified with a
+	// Keyring, which is read whole.
+	MaxEntries int
+	MinDate    time.Time
+
+	// Trace, if set, is called with the low-level details of each request,
+	// like DNS, connecting, TLS and the headers sent and received. Credentials
+	// in the headers are redacted.
+	Trace func(format string, v ...interface{})
+}
+
+// Stats are the details of one completed request to the Repo
+type Stats struct {
+	URL        string
+	Method     string
+	StatusCode int
+	// Bytes is the size of the response body that was read
+	Bytes int64
+	// ContentLength is the size of the resource the response advertised, or
+	// -1 when unknown
+	ContentLength int64
+	// Reused is whether the request went over an already open connection
+	Reused bool
+	// TLSResumed is whether a new TLS connection resumed a previous session
+	TLSResumed bool
+	Duration   time.Duration
 }
 
-func (r Repo) head(file string) (*http.Response, error) {
-	return http.Head(r.URL + "/" + r.Release + "/" + file)
+// Saved is how many bytes were not transferred for this request, compared to
+// fetching the whole of the resource
+func (s Stats) Saved() int64 {
+	if s.ContentLength <= s.Bytes {
+		return 0
+	}
+	return s.ContentLength - s.Bytes
 }
-func (r Repo) get(file string) (*http.Response, error) {
-	return http.Get(r.URL + "/" + r.Release + "/" + file)
+
+// request is a request to the Repo, tracing the Stats of it
+type request struct {
+	start time.Time
+	// attempts is how many times it was made, for the errors
+	attempts int
+	// mu guards stats, as the trace hooks may be called from the transport's
+	// own goroutines
+	mu    sync.Mutex
+	stats Stats
 }
 
-// NewerChangeLog checks the last-modified time of the remote ChangeLog.txt and
-// only fetches it if the remote is newer than the provided time.
-func (r Repo) NewerChangeLog(than time.Time) (e []changelog.Entry, mtime time.Time, err error) {
-	resp, err := r.head("ChangeLog.txt")
-	if err != nil {
-		return nil, time.Unix(0, 0), err
+// do makes the request for the file of the Repo, trying it again (up to the
+// Retries) after a connection error or a 5xx response. When since is not
+// zero, it is sent as the If-Modified-Since, when etag is not empty, as the
+// If-None-Match, and when rng is not empty, as the Range.
+func (r Repo) do(ctx context.Context, method, file string, since time.Time, etag, rng string) (*http.Response, *request, error) {
+	if err := CheckRelease(r.Release); err != nil {
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
+	for attempt := 1; ; attempt++ {
+		resp, t, err := r.attempt(ctx, method, file, since, etag, rng)
+		if t != nil {
+			t.attempts = attempt
+		}
+		var failure error
+		if err != nil && Retryable(err) {
+			failure = err
+		} else if err == nil && resp.StatusCode >= 500 {
+			failure = &StatusError{StatusCode: resp.StatusCode, URL: resp.Request.URL.String()}
+		}
+		if failure == nil || attempt > r.Retries || ctx.Err() != nil {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return resp, t, err
+		}
+		if resp != nil {
+			r.observe(t, resp, 0)
+			resp.Body.Close()
+		}
+		delay := r.retryDelay(attempt)
+		if r.Retrying != nil {
+			r.Retrying(attempt, failure, delay)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, t, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, time.Unix(0, 0), fmt.Errorf("%d status from %s", resp.StatusCode, resp.Request.URL)
+// retryDelay is how long to wait after the failed attempt (from 1): the
+// RetryDelay doubling with each attempt, less a random jitter of up to half
+// of it so that retries of many releases are spread out
+func (r Repo) retryDelay(attempt int) time.Duration {
+	d := r.RetryDelay << uint(attempt-1)
+	if d <= 0 {
+		return 0
 	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1))
+}
 
-	mtime, err = http.ParseTime(resp.Header.Get("last-modified"))
+// attempt makes one request for the file of the Repo, within the Timeout
+func (r Repo) attempt(ctx context.Context, method, file string, since time.Time, etag, rng string) (*http.Response, *request, error) {
+	base, client := r.URL, r.Client
+	if socket, httpURL, ok := SplitUnixURL(r.URL); ok {
+		base = httpURL
+		if client == nil {
+			client = NewClient(ClientOptions{UnixSocket: socket})
+		}
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(method, JoinURL(base, r.Release, file), nil)
 	if err != nil {
-		return nil, time.Unix(0, 0), err
+		return nil, nil, err
+	}
+	username, password := r.Username, r.Password
+	if u := req.URL.User; u != nil {
+		// a "user:pass@" of the URL is sent as basic auth, and otherwise
+		// never shown, like in the Stats or the errors
+		if username == "" && password == "" {
+			username = u.Username()
+			password, _ = u.Password()
+		}
+		req.URL.User = nil
+	}
+	if r.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.BearerToken)
+	} else if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+	if !since.IsZero() {
+		req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if rng != "" {
+		// (the transport then does not ask for it gzipped, either)
+		req.Header.Set("Range", rng)
+	}
+	t := &request{start: time.Now(), stats: Stats{URL: req.URL.String(), Method: method, ContentLength: -1}}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.stats.Reused = info.Reused
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.mu.Lock()
+			t.stats.TLSResumed = state.DidResume
+			t.mu.Unlock()
+		},
+	}
+	prefix := method + " " + req.URL.String()
+	if r.Trace != nil {
+		r.traceHooks(trace, prefix)
+	}
+	release, err := r.Limiter.wait(ctx, req.URL.Host)
+	if err != nil {
+		return nil, t, err
+	}
+	cancel := release
+	if r.Timeout > 0 {
+		var timeout context.CancelFunc
+		ctx, timeout = context.WithTimeout(ctx, r.Timeout)
+		cancel = func() {
+			timeout()
+			release()
+		}
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	resp, err := client.Do(req)
+	if r.Trace != nil {
+		r.traceResponse(prefix, resp, err)
+	}
+	if err != nil {
+		cancel()
+		return resp, t, err
+	}
+	// the Timeout (and the request to the Limiter) goes on until the body is
+	// closed
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, t, nil
+}
+
+// cancelBody is a response body that cancels its request once closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// JoinURL joins the elements onto the base URL with one "/" between each,
+// whether or not the base has a trailing slash, and skipping empty elements
+// (like the Release of a Repo that has the ChangeLog.txt at its top).
+func JoinURL(base string, elem ...string) string {
+	u := strings.TrimRight(base, "/")
+	for _, e := range elem {
+		if e = strings.Trim(e, "/"); e != "" {
+			u += "/" + e
+		}
+	}
+	return u
+}
+
+// CheckRelease is an error for a Release that is not a path within the Repo,
+// like one with a ".." element. A Release may be in a subdirectory of the
+// Repo, like "slackware64-15.0/patches" or "slackware64-current/extra".
+func CheckRelease(release string) error {
+	if strings.Contains(release, "\\") {
+		return fmt.Errorf("release %q: expected \"/\" between the directories", release)
+	}
+	if release = strings.Trim(release, "/"); release == "" {
+		return nil
+	}
+	for _, elem := range strings.Split(release, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return fmt.Errorf("release %q is not a path within the repo", release)
+		}
+	}
+	return nil
+}
+
+// observe reports the Stats of the finished request, having read n bytes of
+// the response body
+func (r Repo) observe(t *request, resp *http.Response, n int64) {
+	if r.Observe == nil || resp == nil {
+		return
+	}
+	t.mu.Lock()
+	s := t.stats
+	t.mu.Unlock()
+	s.URL = resp.Request.URL.String()
+	s.StatusCode = resp.StatusCode
+	s.ContentLength = resp.ContentLength
+	s.Bytes = n
+	s.Duration = time.Since(t.start)
+	r.Observe(s)
+}
+
+// countingReader tallies the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewerChangeLog fetches the ChangeLog.txt only if it was modified after than
+// (or, when the Repo has an ETag, only if its ETag is another). It is one GET
+// with an If-Modified-Since (and If-None-Match), and a 304 Not Modified is
+// ErrNotNewer. For a mirror that ignores those, the ETag or last-modified of
+// its response is compared before parsing, or without a last-modified, the
+// newest entry after parsing.
+func (r Repo) NewerChangeLog(than time.Time) (e []changelog.Entry, mtime time.Time, err error) {
+	return r.NewerChangeLogContext(context.Background(), than)
+}
+
+// NewerChangeLogContext is NewerChangeLog, with the requests (including the
+// reading of the response) cancelled along with ctx
+func (r Repo) NewerChangeLogContext(ctx context.Context, than time.Time) (e []changelog.Entry, mtime time.Time, err error) {
+	if r.local() {
+		file, mtime, err := r.headLocal(r.changeLogFiles())
+		if err != nil {
+			return nil, time.Unix(0, 0), err
+		}
+		if !mtime.After(than) {
+			return nil, time.Unix(0, 0), ErrNotNewer
+		}
+		return r.changeLog(ctx, file)
+	}
+	return r.getChangeLog(ctx, than, r.ETag)
+}
+
+// changeLogFiles are the names the ChangeLog may be found as, in the order
+// they are tried
+func (r Repo) changeLogFiles() []string {
+	if r.PreferCompressed {
+		return []string{"ChangeLog.txt.gz", "ChangeLog.txt.xz", "ChangeLog.txt"}
 	}
+	return []string{"ChangeLog.txt"}
+}
+
+// getChangeLog fetches the first of the changeLogFiles that the Repo has,
+// only if it was modified after since (unless since is zero) or no longer has
+// the etag (unless it is empty)
+func (r Repo) getChangeLog(ctx context.Context, since time.Time, etag string) (e []changelog.Entry, mtime time.Time, err error) {
+	files := r.changeLogFiles()
+	for i, file := range files {
+		e, mtime, err = r.changeLogSince(ctx, file, since, etag)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound && i < len(files)-1 {
+			continue
+		}
+		return e, mtime, err
+	}
+	return nil, time.Unix(0, 0), fmt.Errorf("no ChangeLog.txt")
+}
+
+// StatusError is a response from the Repo that was not OK
+type StatusError struct {
+	StatusCode int
+	URL        string
+	// Attempts is how many times the request was made, when more than once
+	Attempts int
+	// Location is where a redirect (not followed) was to
+	Location string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%d status from %s", e.StatusCode, e.URL)
+	if e.authFailed() {
+		msg = fmt.Sprintf("%v: %s", ErrAuthFailed, msg)
+	}
+	if e.Location != "" {
+		msg += fmt.Sprintf(", redirecting to %s", e.Location)
+	}
+	if e.Attempts > 1 {
+		msg += fmt.Sprintf(" (after %d attempts)", e.Attempts)
+	}
+	return msg
+}
 
-	if mtime.After(than) {
-		return r.ChangeLog()
+// Is makes errors.Is(err, ErrAuthFailed) true of a 401 or 403 status
+func (e *StatusError) Is(target error) bool {
+	return target == ErrAuthFailed && e.authFailed()
+}
+
+func (e *StatusError) authFailed() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// ErrAuthFailed is (by errors.Is) a StatusError of a 401 or 403 status, as for
+// credentials that are missing or wrong
+var ErrAuthFailed = errors.New("authentication failed")
+
+// Retryable is whether err is likely transient, so that trying again later may
+// succeed. This is network errors (including timeouts) and 5xx responses, but
+// not other statuses (like a 404), problems parsing the ChangeLog, nor
+// problems reading a local Repo (like it not having the release).
+func Retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
 	}
-	return nil, time.Unix(0, 0), ErrNotNewer
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		// its errno would otherwise pass for a net.Error
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
 // ErrNotNewer is a status error usage to indicate that the remote file is not newer
@@ -51,23 +487,285 @@ var ErrNotNewer = fmt.Errorf("Remote file is not newer than provided time")
 // ChangeLog fetches the ChangeLog.txt for this remote Repo, along with the
 // last-modified (for comparisons).
 func (r Repo) ChangeLog() (e []changelog.Entry, mtime time.Time, err error) {
-	resp, err := r.get("ChangeLog.txt")
+	return r.ChangeLogContext(context.Background())
+}
+
+// ChangeLogContext is ChangeLog, with the requests (including the reading of
+// the response) cancelled along with ctx
+func (r Repo) ChangeLogContext(ctx context.Context) (e []changelog.Entry, mtime time.Time, err error) {
+	if !r.local() {
+		return r.getChangeLog(ctx, time.Time{}, "")
+	}
+	file := "ChangeLog.txt"
+	if r.PreferCompressed {
+		if file, _, err = r.headLocal(r.changeLogFiles()); err != nil {
+			return nil, time.Unix(0, 0), err
+		}
+	}
+	return r.changeLog(ctx, file)
+}
+
+// changeLog reads and parses the file of a local Repo
+func (r Repo) changeLog(ctx context.Context, file string) (e []changelog.Entry, mtime time.Time, err error) {
+	rc, mtime, err := r.openLocal(file)
 	if err != nil {
 		return nil, time.Unix(0, 0), err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, time.Unix(0, 0), fmt.Errorf("%d status from %s", resp.StatusCode, resp.Request.URL)
+	defer rc.Close()
+	e, mtime, err = r.parse(ctx, file, rc, false, mtime)
+	if err == nil && r.Validators != nil {
+		r.Validators("", mtime)
 	}
+	return e, mtime, err
+}
 
-	mtime, err = http.ParseTime(resp.Header.Get("last-modified"))
+// changeLogSince fetches and parses the file, decompressing it by its
+// extension, unless it is unchanged from the etag (when not empty) or was not
+// modified after since (when not zero). It is parsed as it is read, up to
+// the MaxEntries or MinDate (when set), and an error reading it fails the
+// fetch, so that a truncated or corrupt download is an error rather than a
+// partial ChangeLog.
+func (r Repo) changeLogSince(ctx context.Context, file string, since time.Time, etag string) (e []changelog.Entry, mtime time.Time, err error) {
+	rng := ""
+	if r.splicing(file) {
+		rng = fmt.Sprintf("bytes=0-%d", r.HeadBytes-1)
+	}
+	resp, t, err := r.do(ctx, http.MethodGet, file, since, etag, rng)
 	if err != nil {
 		return nil, time.Unix(0, 0), err
 	}
+	defer resp.Body.Close()
+	body := &countingReader{r: resp.Body}
+	defer func() { r.observe(t, resp, body.n) }()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, time.Unix(0, 0), ErrNotNewer
+	}
+	partial := rng != "" && resp.StatusCode == http.StatusPartialContent
+	if resp.StatusCode != http.StatusOK && !partial {
+		statusErr := &StatusError{StatusCode: resp.StatusCode, URL: resp.Request.URL.String(), Attempts: t.attempts}
+		if loc, err := resp.Location(); err == nil {
+			statusErr.Location = loc.String()
+		}
+		return nil, time.Unix(0, 0), statusErr
+	}
+
+	// a mirror (or a proxy in front of it) may leave out or mangle the
+	// last-modified, when the newest entry is compared to since instead, and
+	// the time of the response (or else, that of the newest entry) is taken
+	mtime, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+	unknown := err != nil
+	if unknown {
+		if mtime, err = http.ParseTime(resp.Header.Get("Date")); err == nil {
+			r.lastModifiedFrom(file, "the Date of the response")
+		} else {
+			mtime = time.Time{}
+		}
+	}
+	// for a mirror that ignored the conditions, the body is left unread
+	current := resp.Header.Get("ETag")
+	byETag := etag != "" && current != ""
+	if byETag {
+		// the ETag is trusted over a last-modified that may be unreliable
+		if current == etag {
+			return nil, time.Unix(0, 0), ErrNotNewer
+		}
+	} else if !unknown && !since.IsZero() && !mtime.After(since) {
+		return nil, time.Unix(0, 0), ErrNotNewer
+	}
+	var rdr io.Reader = body
+	uncompressed := resp.Uncompressed
+	if partial {
+		head, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, time.Unix(0, 0), fmt.Errorf("%s: %v", file, err)
+		}
+		data, err := splice(head, r.Previous, resp.Header)
+		if err != nil {
+			if r.Trace != nil {
+				r.Trace("%s: %v, fetching the whole of it", file, err)
+			}
+			whole := r
+			whole.Previous = nil
+			return whole.changeLogSince(ctx, file, since, etag)
+		}
+		rdr = bytes.NewReader(data)
+	} else if !uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		// a Content-Encoding the transport did not undo, as when it did not
+		// ask for it (like with DisableCompression)
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, time.Unix(0, 0), fmt.Errorf("%s: %v", file, err)
+		}
+		rdr, uncompressed = gz, true
+	}
+	e, mtime, err = r.parse(ctx, file, rdr, uncompressed, mtime)
+	if err == nil && unknown && !byETag && !since.IsZero() && !newestEntry(e).After(since) {
+		return nil, time.Unix(0, 0), ErrNotNewer
+	}
+	if err == nil && r.Validators != nil {
+		r.Validators(current, mtime)
+	}
+	t.mu.Lock()
+	requested := t.stats.URL
+	t.mu.Unlock()
+	if err == nil && r.Redirected != nil && resp.Request.URL.String() != requested {
+		r.Redirected(resp.Request.URL.String())
+	}
+	return e, mtime, err
+}
+
+// splicing is whether the file is fetched by its head, spliced onto the
+// Previous
+func (r Repo) splicing(file string) bool {
+	return len(r.Previous) > 0 && r.HeadBytes > 0 && r.Keyring == nil && file == "ChangeLog.txt"
+}
+
+// entryDivider is the line after each entry of a ChangeLog
+const entryDivider = "+--------------------------+\n"
+
+// splice is the ChangeLog of its head (the start of it, as of the header of a
+// response to a Range request), up to the first entry of prev, followed by
+// prev. It is an error when the head does not reach back to that entry, or
+// the two do not add up to the size of the ChangeLog.
+func splice(head, prev []byte, header http.Header) ([]byte, error) {
+	if header.Get("Content-Encoding") != "" {
+		return nil, fmt.Errorf("a range of a Content-Encoding of %q", header.Get("Content-Encoding"))
+	}
+	var start, end, size int64
+	cr := header.Get("Content-Range")
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil || start != 0 || end+1 != int64(len(head)) {
+		return nil, fmt.Errorf("unexpected Content-Range %q, for %d bytes", cr, len(head))
+	}
+	i := bytes.Index(prev, []byte("\n"+entryDivider))
+	if i < 0 {
+		return nil, errors.New("no entry in the previous ChangeLog")
+	}
+	first := prev[:i+1+len(entryDivider)]
+	at := bytes.Index(head, first)
+	if at < 0 || (at > 0 && head[at-1] != '\n') {
+		return nil, fmt.Errorf("the first %d bytes do not reach back to the previous ChangeLog", len(head))
+	}
+	if int64(at+len(prev)) != size {
+		return nil, fmt.Errorf("%d new bytes and the %d of the previous ChangeLog are not its size of %d", at, len(prev), size)
+	}
+	return append(head[:at:at], prev...), nil
+}
+
+// parse reads the file from rdr, decompressing it by its extension (unless it
+// is already uncompressed), and parses it. A zero mtime (its last-modified
+// being unknown) is that of the newest entry, or else now.
+func (r Repo) parse(ctx context.Context, file string, rdr io.Reader, uncompressed bool, mtime time.Time) ([]changelog.Entry, time.Time, error) {
+	var err error
+	switch {
+	case strings.HasSuffix(file, ".gz") && !uncompressed:
+		// (unless the transport already did, for a Content-Encoding of gzip)
+		if rdr, err = gzip.NewReader(rdr); err != nil {
+			return nil, mtime, fmt.Errorf("%s: %v", file, err)
+		}
+	case strings.HasSuffix(file, ".xz"):
+		if rdr, err = xz.NewReader(rdr); err != nil {
+			return nil, mtime, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	br := bufio.NewReader(rdr)
+	if head, _ := br.Peek(512); r.Keyring != nil || clearsigned(head) {
+		return r.parseSigned(ctx, file, br, mtime)
+	}
+
+	// the entries are parsed as they are read, so that a large ChangeLog is
+	// not held whole, and the rest of it is left unread once past the
+	// MaxEntries or MinDate
+	var data *bytes.Buffer
+	var src io.Reader = br
+	if r.Fetched != nil {
+		data = &bytes.Buffer{}
+		src = io.TeeReader(br, data)
+	}
+	e := []changelog.Entry{}
+	s := changelog.NewScanner(src)
+	short := false
+	for s.Scan() {
+		entry := s.Entry()
+		if !r.MinDate.IsZero() && !entry.Date.IsZero() && !entry.Date.After(r.MinDate) {
+			short = true
+			break
+		}
+		e = append(e, entry)
+		if r.MaxEntries > 0 && len(e) >= r.MaxEntries {
+			short = true
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, mtime, err
+	}
+	var whole []byte
+	if short {
+		if r.Trace != nil {
+			r.Trace("%s: stopped reading after %d entries", file, len(e))
+		}
+	} else if data != nil {
+		whole = data.Bytes()
+	}
+	return r.finish(file, e, s.Stats(), whole, mtime)
+}
 
-	e, err = changelog.Parse(resp.Body)
+// parseSigned reads the whole of the file from rdr, as its signature (or that
+// of the CHECKSUMS.md5 listing it) is of the whole of it, and parses it
+func (r Repo) parseSigned(ctx context.Context, file string, rdr io.Reader, mtime time.Time) ([]changelog.Entry, time.Time, error) {
+	data, err := ioutil.ReadAll(rdr)
 	if err != nil {
+		return nil, mtime, fmt.Errorf("%s: %v", file, err)
+	}
+	if r.Keyring != nil && !clearsigned(data) {
+		if err := r.verifyChecksum(ctx, data); err != nil {
+			return nil, mtime, err
+		}
+	} else if data, err = unwrapSigned(data, r.Keyring); err != nil {
 		return nil, mtime, err
 	}
+	e, stats, err := changelog.ParseWithStats(bytes.NewReader(data))
+	if err != nil {
+		return nil, mtime, err
+	}
+	return r.finish(file, e, stats, data, mtime)
+}
+
+// finish is the entries of the file with its mtime (when unknown, that of the
+// newest entry or else now), calling Fetched with its data (when it was read
+// whole) and Parsed with its stats
+func (r Repo) finish(file string, e []changelog.Entry, stats changelog.ParseStats, data []byte, mtime time.Time) ([]changelog.Entry, time.Time, error) {
+	if mtime.IsZero() {
+		if mtime = stats.Newest; !mtime.IsZero() {
+			r.lastModifiedFrom(file, "the newest entry")
+		} else {
+			mtime = time.Now()
+			r.lastModifiedFrom(file, "the time now")
+		}
+	}
+	if r.Fetched != nil && data != nil {
+		r.Fetched(data, mtime)
+	}
+	if r.Parsed != nil {
+		r.Parsed(stats)
+	}
 	return e, mtime, nil
 }
+
+// lastModifiedFrom calls LastModifiedFallback, if set
+func (r Repo) lastModifiedFrom(file, from string) {
+	if r.LastModifiedFallback != nil {
+		r.LastModifiedFallback(file, from)
+	}
+}
+
+// newestEntry is the date of the newest of the entries
+func newestEntry(entries []changelog.Entry) time.Time {
+	var newest time.Time
+	for _, e := range entries {
+		if e.Date.After(newest) {
+			newest = e.Date
+		}
+	}
+	return newest
+}
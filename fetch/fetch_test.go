@@ -1,10 +1,19 @@
 package fetch
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/changelog"
 )
 
 func TestFetchChangeLog(t *testing.T) {
@@ -34,3 +43,625 @@ func TestFetchChangeLog(t *testing.T) {
 		t.Errorf("time stamps not the same: expected %d; got %d", stat.ModTime().Unix(), mtime.Unix())
 	}
 }
+
+func TestFetchObserve(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/slackware64/")))
+	defer server.Close()
+
+	stats := []Stats{}
+	r := Repo{
+		URL:     server.URL,
+		Observe: func(s Stats) { stats = append(stats, s) },
+	}
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected %d observed request; got %d", 1, len(stats))
+	}
+	if stats[0].Bytes != stat.Size() {
+		t.Errorf("expected %d bytes; got %d", stat.Size(), stats[0].Bytes)
+	}
+	if stats[0].Method != http.MethodGet || stats[0].StatusCode != http.StatusOK {
+		t.Errorf("expected a %s with status %d; got %s with %d", http.MethodGet, http.StatusOK, stats[0].Method, stats[0].StatusCode)
+	}
+}
+
+func TestFetchStopsShort(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/slackware64/")))
+	defer server.Close()
+	stat, err := os.Stat("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _, err := Repo{URL: server.URL}.ChangeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []Repo{
+		{URL: server.URL, MaxEntries: 2},
+		{URL: server.URL, MinDate: all[2].Date},
+	} {
+		var n int64
+		fetched := false
+		r.Observe = func(s Stats) { n = s.Bytes }
+		r.Fetched = func([]byte, time.Time) { fetched = true }
+		e, _, err := r.ChangeLog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(e) != 2 || !e[0].Date.Equal(all[0].Date) || !e[1].Date.Equal(all[1].Date) {
+			t.Errorf("expected the 2 newest entries; got %d", len(e))
+		}
+		if n >= stat.Size() {
+			t.Errorf("expected the rest of the %d bytes left unread; got %d", stat.Size(), n)
+		}
+		if fetched {
+			t.Error("expected no Fetched of a ChangeLog read short")
+		}
+	}
+
+	// a limit not reached reads it whole
+	var data []byte
+	r := Repo{URL: server.URL, MaxEntries: 100, Fetched: func(d []byte, _ time.Time) { data = d }}
+	if e, _, err := r.ChangeLog(); err != nil || len(e) != len(all) {
+		t.Fatalf("expected %d entries; got %d (%v)", len(all), len(e), err)
+	}
+	if int64(len(data)) != stat.Size() {
+		t.Errorf("expected Fetched with the %d bytes; got %d", stat.Size(), len(data))
+	}
+}
+
+func TestFetchObserveNotNewer(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("../changelog/testdata/slackware64/")))
+	defer server.Close()
+
+	stats := []Stats{}
+	r := Repo{
+		URL:     server.URL,
+		Observe: func(s Stats) { stats = append(stats, s) },
+	}
+	if _, _, err := r.NewerChangeLog(time.Now().Add(time.Hour)); err != ErrNotNewer {
+		t.Fatalf("expected %v; got %v", ErrNotNewer, err)
+	}
+
+	if len(stats) != 1 {
+		t.Fatalf("expected %d observed request; got %d", 1, len(stats))
+	}
+	if stats[0].Method != http.MethodGet || stats[0].StatusCode != http.StatusNotModified || stats[0].Bytes != 0 {
+		t.Errorf("expected a %s of no bytes with status %d; got %s of %d with %d", http.MethodGet, http.StatusNotModified, stats[0].Method, stats[0].Bytes, stats[0].StatusCode)
+	}
+}
+
+func TestFetchIgnoresIfModifiedSince(t *testing.T) {
+	stat, err := os.Stat("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers = append(headers, req.Header.Get("If-Modified-Since"))
+		// always the whole of it, as though If-Modified-Since were not known
+		req.Header.Del("If-Modified-Since")
+		http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+
+	stats := []Stats{}
+	r := Repo{
+		URL:     server.URL,
+		Observe: func(s Stats) { stats = append(stats, s) },
+	}
+	since := stat.ModTime().Add(time.Hour)
+	if _, _, err := r.NewerChangeLog(since); err != ErrNotNewer {
+		t.Fatalf("expected %v; got %v", ErrNotNewer, err)
+	}
+	if len(headers) != 1 || headers[0] != since.UTC().Format(http.TimeFormat) {
+		t.Errorf("expected one request with an If-Modified-Since of %s; got %q", since.UTC().Format(http.TimeFormat), headers)
+	}
+	if len(stats) != 1 || stats[0].StatusCode != http.StatusOK || stats[0].Saved() == 0 {
+		t.Errorf("expected the body of the %d to be left unread; got %#v", http.StatusOK, stats)
+	}
+
+	e, _, err := r.NewerChangeLog(stat.ModTime().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e) == 0 {
+		t.Error("expected the entries of the newer ChangeLog")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slackware64-current/ChangeLog.txt":
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	_, _, err := Repo{URL: server.URL, Release: "slackware64-current"}.ChangeLog()
+	if err == nil || !Retryable(err) {
+		t.Errorf("expected a retryable error for a 503; got %v", err)
+	}
+	_, _, err = Repo{URL: server.URL, Release: "slackware64-14.2"}.ChangeLog()
+	if err == nil || Retryable(err) {
+		t.Errorf("expected a non-retryable error for a 404; got %v", err)
+	}
+	_, _, err = Repo{URL: "http://127.0.0.1:0", Release: "slackware64-14.2"}.ChangeLog()
+	if err == nil || !Retryable(err) {
+		t.Errorf("expected a retryable error for a failed connection; got %v", err)
+	}
+	if Retryable(ErrNotNewer) {
+		t.Error("expected ErrNotNewer to not be retryable")
+	}
+}
+
+func TestFetchPath(t *testing.T) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.ServeFile(w, r, "../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		url, release string
+		expected     string
+	}{
+		{server.URL, "slackware64-14.2", "/slackware64-14.2/ChangeLog.txt"},
+		{server.URL + "/", "slackware64-14.2", "/slackware64-14.2/ChangeLog.txt"},
+		{server.URL + "/pub/slackware", "slackware64-14.2", "/pub/slackware/slackware64-14.2/ChangeLog.txt"},
+		{server.URL + "/pub/slackware/", "slackware64-14.2", "/pub/slackware/slackware64-14.2/ChangeLog.txt"},
+		{server.URL + "/pub/slackware//", "/slackware64-14.2/", "/pub/slackware/slackware64-14.2/ChangeLog.txt"},
+		{server.URL + "/slackware64-14.2/", "", "/slackware64-14.2/ChangeLog.txt"},
+		{server.URL, "slackware64-14.2/patches", "/slackware64-14.2/patches/ChangeLog.txt"},
+	} {
+		paths = paths[:0]
+		r := Repo{URL: c.url, Release: c.release}
+		if _, _, err := r.NewerChangeLog(time.Unix(0, 0)); err != nil {
+			t.Fatalf("%q %q: %v", c.url, c.release, err)
+		}
+		if len(paths) != 1 || paths[0] != c.expected {
+			t.Errorf("%q %q: expected a request of %q; got %q", c.url, c.release, c.expected, paths)
+		}
+	}
+}
+
+func TestCheckRelease(t *testing.T) {
+	for release, ok := range map[string]bool{
+		"":                         true,
+		"slackware64-current":      true,
+		"slackware64-14.2/patches": true,
+		"/slackware64-current/":    true,
+		"..":                       false,
+		"slackware64-14.2/../..":   false,
+		"./slackware64-current":    false,
+		"slackware64-14.2//extra":  false,
+		`slackware64-14.2\patches`: false,
+	} {
+		if err := CheckRelease(release); (err == nil) != ok {
+			t.Errorf("%q: expected ok %v; got %v", release, ok, err)
+		}
+	}
+
+	// nor is one requested
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+	if _, _, err := (Repo{URL: server.URL + "/pub/slackware/", Release: "../../etc"}).ChangeLog(); err == nil || requested {
+		t.Errorf("expected an error and no request; got %v", err)
+	}
+	if _, _, err := (Repo{URL: "file:///srv/slackware/", Release: "../etc"}).ChangeLog(); err == nil || !strings.Contains(err.Error(), "not a path within the repo") {
+		t.Errorf("expected an error for the local path; got %v", err)
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	for _, c := range []struct {
+		base     string
+		elem     []string
+		expected string
+	}{
+		{"http://slackware.osuosl.org", []string{"slackware64-14.2"}, "http://slackware.osuosl.org/slackware64-14.2"},
+		{"http://slackware.osuosl.org/", []string{"slackware64-14.2"}, "http://slackware.osuosl.org/slackware64-14.2"},
+		{"http://slackware.osuosl.org/", []string{"slackware64-14.2/", "ChangeLog.txt"}, "http://slackware.osuosl.org/slackware64-14.2/ChangeLog.txt"},
+		{"http://slackware.osuosl.org/", []string{"", "ChangeLog.txt"}, "http://slackware.osuosl.org/ChangeLog.txt"},
+	} {
+		if got := JoinURL(c.base, c.elem...); got != c.expected {
+			t.Errorf("%q %q: expected %q; got %q", c.base, c.elem, c.expected, got)
+		}
+	}
+}
+
+func TestFetchETag(t *testing.T) {
+	stat, err := os.Stat("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the ETag is stable, while If-None-Match is not known
+		w.Header().Set("ETag", `"v1"`)
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+
+	var etag string
+	r := Repo{
+		URL:        server.URL,
+		Validators: func(e string, mtime time.Time) { etag = e },
+	}
+	if _, _, err := r.ChangeLog(); err != nil || etag != `"v1"` {
+		t.Fatalf("expected the ETag to be given; got %q, %v", etag, err)
+	}
+
+	// the same ETag is not newer, whatever the last-modified
+	r.ETag = `"v1"`
+	if _, _, err := r.NewerChangeLog(stat.ModTime().Add(-time.Hour)); err != ErrNotNewer {
+		t.Errorf("expected %v for the same ETag; got %v", ErrNotNewer, err)
+	}
+	// and another is
+	r.ETag = `"v0"`
+	if _, _, err := r.NewerChangeLog(stat.ModTime().Add(time.Hour)); err != nil {
+		t.Errorf("expected another ETag to be newer; got %v", err)
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts[req.URL.Path]++
+		switch {
+		case req.URL.Path == "/flaky/ChangeLog.txt" && attempts[req.URL.Path] < 3:
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		case req.URL.Path == "/down/ChangeLog.txt":
+			http.Error(w, "try later", http.StatusBadGateway)
+		case req.URL.Path == "/flaky/ChangeLog.txt":
+			http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	retried := []int{}
+	r := Repo{
+		URL:        server.URL,
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+		Retrying:   func(attempt int, err error, delay time.Duration) { retried = append(retried, attempt) },
+	}
+
+	r.Release = "flaky"
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Errorf("expected the third attempt to succeed; got %v", err)
+	}
+	if len(retried) != 2 || retried[0] != 1 || retried[1] != 2 {
+		t.Errorf("expected attempts 1 and 2 to be retried; got %v", retried)
+	}
+
+	r.Release = "down"
+	_, _, err := r.ChangeLog()
+	if err == nil || !Retryable(err) || !strings.HasSuffix(err.Error(), "(after 3 attempts)") {
+		t.Errorf("expected a retryable error after 3 attempts; got %v", err)
+	}
+
+	r.Release = "missing"
+	if _, _, err := r.ChangeLog(); err == nil || attempts["/missing/ChangeLog.txt"] != 1 {
+		t.Errorf("expected a 404 to not be retried; got %d attempts", attempts["/missing/ChangeLog.txt"])
+	}
+
+	r.URL, r.Release = "http://127.0.0.1:0", "slackware64"
+	if _, _, err := r.ChangeLog(); err == nil || !Retryable(err) || !strings.HasSuffix(err.Error(), "(after 3 attempts)") {
+		t.Errorf("expected a retryable connection error after 3 attempts; got %v", err)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	data, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// half of the ChangeLog, and then nothing until the client gives up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-req.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	r := Repo{URL: server.URL, Release: "slackware64", Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if _, _, err := r.ChangeLog(); err == nil {
+		t.Error("expected the stalled body to time out")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected the Timeout to abort the read; took %s", d)
+	}
+
+	r.Timeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, _, err := r.NewerChangeLogContext(ctx, time.Time{}); err == nil {
+		t.Error("expected the stalled body to be cancelled with the context")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected the context to abort the read; took %s", d)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFetchClient(t *testing.T) {
+	// a mirror that is only reachable through the Client
+	files := http.FileServer(http.Dir("../changelog/testdata/"))
+	requested := []string{}
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		w := httptest.NewRecorder()
+		files.ServeHTTP(w, req)
+		return w.Result(), nil
+	})}
+
+	r := Repo{URL: "http://mirror.invalid/", Release: "slackware64", Client: client}
+	e, _, err := r.ChangeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e) == 0 {
+		t.Error("expected the entries of the ChangeLog from the Client")
+	}
+	if len(requested) != 1 || requested[0] != "http://mirror.invalid/slackware64/ChangeLog.txt" {
+		t.Errorf("expected the one request to go through the Client; got %q", requested)
+	}
+}
+
+func TestFetchHead(t *testing.T) {
+	data, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ChangeLog as last fetched, before its newest 2 entries
+	prev := data
+	for i := 0; i < 2; i++ {
+		prev = prev[strings.Index(string(prev), entryDivider)+len(entryDivider):]
+	}
+	mtime := time.Date(2017, time.January, 24, 0, 0, 0, 0, time.UTC)
+	ranges := []string{}
+	ignoreRange := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		if ignoreRange {
+			req.Header.Del("Range")
+		}
+		http.ServeContent(w, req, "ChangeLog.txt", mtime, strings.NewReader(string(data)))
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name        string
+		headBytes   int64
+		prev        []byte
+		ignoreRange bool
+		ranges      int
+		bytes       int64
+	}{
+		{"head", 4096, prev, false, 1, 4096},
+		{"head shorter than the new entries", 100, prev, false, 2, 100 + int64(len(data))},
+		{"an older entry changed", 4096, append([]byte{}, prev[:len(prev)-1]...), false, 2, 4096 + int64(len(data))},
+		{"range ignored", 4096, prev, true, 1, int64(len(data))},
+	} {
+		ranges, ignoreRange = nil, tc.ignoreRange
+		var (
+			fetched []byte
+			read    int64
+		)
+		r := Repo{
+			URL:       server.URL,
+			Previous:  tc.prev,
+			HeadBytes: tc.headBytes,
+			Fetched:   func(d []byte, _ time.Time) { fetched = d },
+			Observe:   func(s Stats) { read += s.Bytes },
+		}
+		e, _, err := r.NewerChangeLog(mtime.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(e) != 52 || string(fetched) != string(data) {
+			t.Errorf("%s: expected the whole of the ChangeLog; got %d entries, of %d bytes", tc.name, len(e), len(fetched))
+		}
+		if len(ranges) != tc.ranges || ranges[0] != fmt.Sprintf("bytes=0-%d", tc.headBytes-1) {
+			t.Errorf("%s: expected %d requests, the first of a range; got %q", tc.name, tc.ranges, ranges)
+		}
+		if read != tc.bytes {
+			t.Errorf("%s: expected %d bytes read; got %d", tc.name, tc.bytes, read)
+		}
+	}
+
+	// not newer, whether or not by its head
+	r := Repo{URL: server.URL, Previous: prev, HeadBytes: 4096}
+	if _, _, err := r.NewerChangeLog(mtime); err != ErrNotNewer {
+		t.Errorf("expected %v; got %v", ErrNotNewer, err)
+	}
+}
+
+func TestFetchRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old/", http.RedirectHandler("/slackware/slackware64/ChangeLog.txt", http.StatusMovedPermanently))
+	mux.Handle("/slackware/", http.StripPrefix("/slackware/", http.FileServer(http.Dir("../changelog/testdata/"))))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var redirected string
+	r := Repo{
+		URL:        server.URL + "/old/",
+		Release:    "slackware64",
+		Redirected: func(u string) { redirected = u },
+	}
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := server.URL + "/slackware/slackware64/ChangeLog.txt"; redirected != expected {
+		t.Errorf("expected the URL redirected to, %q; got %q", expected, redirected)
+	}
+
+	// not redirected
+	redirected = ""
+	r.URL = server.URL + "/slackware/"
+	if _, _, err := r.ChangeLog(); err != nil || redirected != "" {
+		t.Errorf("expected no redirect; got %q (%v)", redirected, err)
+	}
+
+	r.URL = server.URL + "/old/"
+	r.Client = NewClient(ClientOptions{NoRedirects: true})
+	_, _, err := r.ChangeLog()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusMovedPermanently || statusErr.Location != server.URL+"/slackware/slackware64/ChangeLog.txt" {
+		t.Errorf("expected the redirect as an error; got %v", err)
+	}
+}
+
+func TestFetchLastModifiedFallback(t *testing.T) {
+	data, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := changelog.Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := entries[0].Date
+	date := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name         string
+		lastModified []string
+		date         []string
+		from         string
+		mtime        time.Time
+	}{
+		{"missing", nil, []string{date.Format(http.TimeFormat)}, "the Date of the response", date},
+		{"garbage", []string{"yesterday"}, []string{date.Format(http.TimeFormat)}, "the Date of the response", date},
+		{"garbage, without a Date", []string{"yesterday"}, nil, "the newest entry", newest},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// whatever the If-Modified-Since
+			w.Header()["Last-Modified"] = tc.lastModified
+			w.Header()["Date"] = tc.date
+			w.Write(data)
+		}))
+
+		var from string
+		r := Repo{
+			URL:                  server.URL,
+			LastModifiedFallback: func(file, f string) { from = f },
+		}
+		e, mtime, err := r.ChangeLog()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if len(e) != len(entries) || !mtime.Equal(tc.mtime) || from != tc.from {
+			t.Errorf("%s: expected %d entries, last modified %s from %q; got %d, %s from %q", tc.name, len(entries), tc.mtime, tc.from, len(e), mtime, from)
+		}
+
+		// the newest entry is compared instead of the last-modified
+		if _, _, err := r.NewerChangeLog(newest); err != ErrNotNewer {
+			t.Errorf("%s: expected %v for the newest entry; got %v", tc.name, ErrNotNewer, err)
+		}
+		if _, _, err := r.NewerChangeLog(newest.Add(-time.Second)); err != nil {
+			t.Errorf("%s: expected to be newer than before the newest entry; got %v", tc.name, err)
+		}
+		server.Close()
+	}
+}
+
+func TestFetchUserAgent(t *testing.T) {
+	agents := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		agents = append(agents, req.UserAgent())
+		http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+	}))
+	defer server.Close()
+
+	r := Repo{URL: server.URL, UserAgent: "sl-feeds/test"}
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0] != "sl-feeds/test" {
+		t.Errorf("expected a User-Agent of %q; got %q", "sl-feeds/test", agents)
+	}
+}
+
+func TestFetchAuth(t *testing.T) {
+	auths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auths = append(auths, req.Method+" "+req.Header.Get("Authorization"))
+		switch req.Header.Get("Authorization") {
+		case "Basic dXNlcjpzM2NyZXQ=", "Bearer t0ken":
+			http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+		default:
+			http.Error(w, "who are you", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	// the conditional requests too
+	r := Repo{URL: server.URL, Username: "user", Password: "s3cret"}
+	if _, _, err := r.NewerChangeLog(time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.HasChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+	r = Repo{URL: server.URL, BearerToken: "t0ken"}
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+	for _, auth := range auths {
+		if !strings.HasSuffix(auth, " Basic dXNlcjpzM2NyZXQ=") && !strings.HasSuffix(auth, " Bearer t0ken") {
+			t.Errorf("expected the credentials with every request; got %q", auths)
+			break
+		}
+	}
+
+	// the userinfo of the URL is sent, but never shown
+	r = Repo{URL: strings.Replace(server.URL, "http://", "http://user:s3cret@", 1)}
+	var urls []string
+	r.Observe = func(s Stats) { urls = append(urls, s.URL) }
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || strings.Contains(urls[0], "s3cret") {
+		t.Errorf("expected the URL without its userinfo; got %q", urls)
+	}
+
+	r = Repo{URL: strings.Replace(server.URL, "http://", "http://user:wrong@", 1)}
+	_, _, err := r.ChangeLog()
+	if !errors.Is(err, ErrAuthFailed) || !strings.HasPrefix(err.Error(), "authentication failed: 401 status") || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("expected an authentication failure, without the password; got %v", err)
+	}
+	if errors.Is(&StatusError{StatusCode: http.StatusNotFound}, ErrAuthFailed) {
+		t.Error("expected a 404 not to be an authentication failure")
+	}
+}
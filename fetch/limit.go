@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HostLimiter throttles the requests to each host, to be polite to mirrors
+// when many releases are fetched at once. Each host has a bucket of one token
+// refilled every Delay, so that its requests are started at least that far
+// apart, while the requests to different hosts do not wait on each other. One
+// HostLimiter is shared by the Repos it is to throttle together.
+type HostLimiter struct {
+	// Delay is the least time between the starts of requests to one host
+	Delay time.Duration
+	// MaxPerHost, when more than 0, is how many requests to one host may be
+	// open at once (until their responses are closed)
+	MaxPerHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+// hostLimit is the throttling of one host
+type hostLimit struct {
+	// next is when the token is next available
+	next  time.Time
+	slots chan struct{}
+}
+
+// wait blocks until a request may be made to the host, and is the func to call
+// once it is done with. A nil HostLimiter does not wait.
+func (l *HostLimiter) wait(ctx context.Context, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	if l.hosts == nil {
+		l.hosts = map[string]*hostLimit{}
+	}
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimit{}
+		if l.MaxPerHost > 0 {
+			h.slots = make(chan struct{}, l.MaxPerHost)
+		}
+		l.hosts[host] = h
+	}
+	l.mu.Unlock()
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			if h.slots != nil {
+				<-h.slots
+			}
+		})
+	}
+
+	// the token is taken now, for when it is available
+	l.mu.Lock()
+	at := time.Now()
+	if h.next.After(at) {
+		at = h.next
+	}
+	h.next = at.Add(l.Delay)
+	l.mu.Unlock()
+	if d := time.Until(at); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			done()
+			return nil, ctx.Err()
+		}
+	}
+	return done, nil
+}
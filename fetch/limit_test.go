@@ -0,0 +1,76 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		starts = map[string][]time.Time{}
+	)
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			starts[name] = append(starts[name], time.Now())
+			mu.Unlock()
+			http.ServeFile(w, req, "../changelog/testdata/slackware64/ChangeLog.txt")
+		})
+	}
+	one := httptest.NewServer(handler("one"))
+	defer one.Close()
+	other := httptest.NewServer(handler("other"))
+	defer other.Close()
+
+	delay := 200 * time.Millisecond
+	limiter := &HostLimiter{Delay: delay, MaxPerHost: 1}
+	var wg sync.WaitGroup
+	for _, u := range []string{one.URL, one.URL, other.URL} {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			r := Repo{URL: u, Limiter: limiter}
+			if _, _, err := r.ChangeLog(); err != nil {
+				t.Error(err)
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	if len(starts["one"]) != 2 || len(starts["other"]) != 1 {
+		t.Fatalf("expected 2 requests to one server and 1 to the other; got %v", starts)
+	}
+	// (less a little, for the first having connected first)
+	if gap := starts["one"][1].Sub(starts["one"][0]); gap < delay-delay/10 {
+		t.Errorf("expected the requests to one host %s apart; got %s", delay, gap)
+	}
+}
+
+func TestHostLimiterHosts(t *testing.T) {
+	limiter := &HostLimiter{Delay: time.Hour, MaxPerHost: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done, err := limiter.wait(ctx, "one.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another host does not wait on the first
+	if _, err := limiter.wait(ctx, "other.example.com"); err != nil {
+		t.Errorf("expected no wait for another host; got %v", err)
+	}
+	// while the same one does, for its token (and its slot)
+	if _, err := limiter.wait(ctx, "one.example.com"); err != context.DeadlineExceeded {
+		t.Errorf("expected a wait for the same host; got %v", err)
+	}
+	done()
+
+	var none *HostLimiter
+	if _, err := none.wait(ctx, "one.example.com"); err != nil {
+		t.Errorf("expected no wait without a HostLimiter; got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vbatts/sl-feeds/iso9660"
+)
+
+// The schemes of Repo URLs that are read from the local filesystem, rather
+// than fetched: "iso:///archive/slackware64-15.0-install-dvd.iso" is an ISO
+// image, and "file:///archive/slackware/" is a tree of extracted releases.
+const (
+	isoScheme  = "iso://"
+	fileScheme = "file://"
+)
+
+// localPath is the path of the ISO image or tree of a local URL, and whether
+// it is an ISO. ok is false for any other URL.
+func localPath(u string) (p string, iso, ok bool) {
+	switch {
+	case strings.HasPrefix(u, isoScheme):
+		return filePath(strings.TrimPrefix(u, isoScheme)), true, true
+	case strings.HasPrefix(u, fileScheme):
+		return filePath(strings.TrimPrefix(u, fileScheme)), false, true
+	}
+	return "", false, false
+}
+
+// filePath is the path of the rest of a local URL after its scheme, which
+// may name the "localhost" (as in "file://localhost/srv/slackware/"), and
+// have escapes (like "%20") of its own
+func filePath(rest string) string {
+	if strings.HasPrefix(rest, "localhost/") {
+		rest = strings.TrimPrefix(rest, "localhost")
+	}
+	if p, err := url.PathUnescape(rest); err == nil {
+		rest = p
+	}
+	return filepath.Clean(filepath.FromSlash(rest))
+}
+
+// local is whether the Repo is read from the local filesystem
+func (r Repo) local() bool {
+	_, _, ok := localPath(r.URL)
+	return ok
+}
+
+// openLocal opens the file of the release, along with its recorded
+// modification time. The error is os.ErrNotExist (wrapped) when the release
+// does not have the file.
+func (r Repo) openLocal(file string) (io.ReadCloser, time.Time, error) {
+	if err := CheckRelease(r.Release); err != nil {
+		return nil, time.Unix(0, 0), err
+	}
+	p, iso, _ := localPath(r.URL)
+	if !iso {
+		fh, err := os.Open(filepath.Join(p, r.Release, file))
+		if err != nil {
+			return nil, time.Unix(0, 0), err
+		}
+		stat, err := fh.Stat()
+		if err != nil {
+			fh.Close()
+			return nil, time.Unix(0, 0), err
+		}
+		return fh, stat.ModTime(), nil
+	}
+
+	fh, err := os.Open(p)
+	if err != nil {
+		return nil, time.Unix(0, 0), err
+	}
+	img, err := iso9660.Open(fh)
+	if err != nil {
+		fh.Close()
+		return nil, time.Unix(0, 0), fmt.Errorf("%s: %v", p, err)
+	}
+	name := path.Join(r.Release, file)
+	dirs := strings.SplitN(r.Release, "/", 2)
+	if _, err := img.Stat(dirs[0]); errors.Is(err, os.ErrNotExist) && strings.HasPrefix(filepath.Base(p), dirs[0]) {
+		// an install DVD (like slackware64-15.0-install-dvd.iso) is the tree
+		// of its one release, with any subdirectory (like "patches") at its top
+		name = path.Join(append(dirs[1:], file)...)
+	}
+	rdr, f, err := img.Open(name)
+	if err != nil {
+		fh.Close()
+		return nil, time.Unix(0, 0), fmt.Errorf("%s: %w", p, err)
+	}
+	return readCloser{Reader: rdr, Closer: fh}, f.ModTime, nil
+}
+
+// headLocal is the first of the files that the release has, along with its
+// recorded modification time
+func (r Repo) headLocal(files []string) (file string, mtime time.Time, err error) {
+	for i, file := range files {
+		rc, mtime, err := r.openLocal(file)
+		if errors.Is(err, os.ErrNotExist) && i < len(files)-1 {
+			continue
+		}
+		if err != nil {
+			return "", time.Unix(0, 0), err
+		}
+		rc.Close()
+		return file, mtime, nil
+	}
+	return "", time.Unix(0, 0), fmt.Errorf("no ChangeLog.txt")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
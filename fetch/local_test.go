@@ -0,0 +1,123 @@
+package fetch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/iso9660/isotest"
+)
+
+func TestLocal(t *testing.T) {
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, err := Repo{URL: "file://../changelog/testdata", Release: "slackware64"}.ChangeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("expected entries from the tree")
+	}
+
+	dir, err := ioutil.TempDir("", "sl-feeds-local.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mtime := time.Date(2022, time.February, 2, 21, 45, 10, 0, time.UTC)
+	archive := filepath.Join(dir, "archive.iso")
+	dvd := filepath.Join(dir, "slackware64-15.0-install-dvd.iso")
+	if err := ioutil.WriteFile(archive, isotest.Image(map[string][]byte{"slackware64-15.0/ChangeLog.txt": plain}, mtime, true), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dvd, isotest.Image(map[string][]byte{"ChangeLog.txt": plain}, mtime, true), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{"iso://" + archive, "iso://" + dvd} {
+		r := Repo{URL: url, Release: "slackware64-15.0"}
+		e, m, err := r.ChangeLog()
+		if err != nil {
+			t.Errorf("%s: %v", url, err)
+			continue
+		}
+		if len(e) != len(expected) {
+			t.Errorf("%s: expected %d entries; got %d", url, len(expected), len(e))
+		}
+		if !m.Equal(mtime) {
+			t.Errorf("%s: expected mtime %s; got %s", url, mtime, m)
+		}
+		if _, _, err := r.NewerChangeLog(mtime); err != ErrNotNewer {
+			t.Errorf("%s: expected %v; got %v", url, ErrNotNewer, err)
+		}
+		if e, _, err := r.NewerChangeLog(mtime.Add(-time.Hour)); err != nil || len(e) != len(expected) {
+			t.Errorf("%s: expected %d newer entries; got %d, %v", url, len(expected), len(e), err)
+		}
+	}
+
+	if _, _, err := (Repo{URL: "iso://" + archive, Release: "slackware64-14.2"}).ChangeLog(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist for a release not in the ISO; got %v", err)
+	}
+	if ok, err := (Repo{URL: "iso://" + dvd, Release: "slackware-15.0"}).HasChangeLog(); ok || err != nil {
+		t.Errorf("expected the DVD of slackware64-15.0 to not have slackware-15.0; got %t, %v", ok, err)
+	}
+	if _, _, err := (Repo{URL: "iso://" + filepath.Join(dir, "missing.iso"), Release: "slackware64-15.0"}).ChangeLog(); err == nil {
+		t.Error("expected an error for a missing ISO")
+	}
+}
+
+func TestLocalTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-tree.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tree := filepath.Join(dir, "slackware mirror")
+	if err := os.MkdirAll(filepath.Join(tree, "slackware64-current"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeLog := filepath.Join(tree, "slackware64-current", "ChangeLog.txt")
+	if err := ioutil.WriteFile(changeLog, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(changeLog, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{
+		"file://" + tree,
+		"file://" + tree + "/",
+		"file://" + tree + "//",
+		"file://localhost" + tree,
+		"file://" + strings.Replace(tree, " ", "%20", -1) + "/",
+	} {
+		r := Repo{URL: url, Release: "slackware64-current"}
+		e, m, err := r.ChangeLog()
+		if err != nil || len(e) == 0 || !m.Equal(mtime) {
+			t.Errorf("%s: expected the entries as of %s; got %d as of %s, %v", url, mtime, len(e), m, err)
+		}
+		if _, _, err := r.NewerChangeLog(mtime); err != ErrNotNewer {
+			t.Errorf("%s: expected %v; got %v", url, ErrNotNewer, err)
+		}
+		if e, _, err := r.NewerChangeLog(mtime.Add(-time.Minute)); err != nil || len(e) == 0 {
+			t.Errorf("%s: expected the newer entries; got %d, %v", url, len(e), err)
+		}
+	}
+
+	// like a 404, a release that is not in the tree is not retried
+	_, _, err = Repo{URL: "file://" + tree, Release: "slackware64-15.0"}.ChangeLog()
+	if !errors.Is(err, os.ErrNotExist) || Retryable(err) {
+		t.Errorf("expected a not exist error that is not retried; got %v", err)
+	}
+}
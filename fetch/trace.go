@@ -0,0 +1,118 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"time"
+)
+
+// redactedHeaders are the headers whose values are not traced
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// redactHeader is value, unless the header called name carries credentials
+func redactHeader(name, value string) string {
+	if redactedHeaders[http.CanonicalHeaderKey(name)] {
+		return "[redacted]"
+	}
+	return value
+}
+
+func sortedHeaderNames(h http.Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tlsVersionName is the name of a TLS version, like "TLS 1.3"
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return "unknown"
+}
+
+// traceHooks adds to trace the hooks that pass the details of the request,
+// described by prefix, to r.Trace. The hooks already on trace are kept.
+func (r Repo) traceHooks(trace *httptrace.ClientTrace, prefix string) {
+	gotConn, tlsDone := trace.GotConn, trace.TLSHandshakeDone
+
+	trace.DNSStart = func(info httptrace.DNSStartInfo) {
+		r.Trace("%s: resolving %s", prefix, info.Host)
+	}
+	trace.DNSDone = func(info httptrace.DNSDoneInfo) {
+		if info.Err != nil {
+			r.Trace("%s: resolving failed: %v", prefix, info.Err)
+			return
+		}
+		addrs := make([]string, len(info.Addrs))
+		for i, a := range info.Addrs {
+			addrs[i] = a.String()
+		}
+		r.Trace("%s: resolved to %v", prefix, addrs)
+	}
+	trace.ConnectStart = func(network, addr string) {
+		r.Trace("%s: connecting to %s %s", prefix, network, addr)
+	}
+	trace.ConnectDone = func(network, addr string, err error) {
+		if err != nil {
+			r.Trace("%s: connecting to %s %s failed: %v", prefix, network, addr, err)
+			return
+		}
+		r.Trace("%s: connected to %s %s", prefix, network, addr)
+	}
+	trace.GotConn = func(info httptrace.GotConnInfo) {
+		gotConn(info)
+		r.Trace("%s: got connection to %s (reused: %t)", prefix, info.Conn.RemoteAddr(), info.Reused)
+	}
+	trace.TLSHandshakeStart = func() {
+		r.Trace("%s: TLS handshake", prefix)
+	}
+	trace.TLSHandshakeDone = func(state tls.ConnectionState, err error) {
+		tlsDone(state, err)
+		if err != nil {
+			r.Trace("%s: TLS handshake failed: %v", prefix, err)
+			return
+		}
+		r.Trace("%s: TLS handshake done: %s, %s, server name %q (resumed: %t)", prefix, tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.ServerName, state.DidResume)
+		if len(state.PeerCertificates) > 0 {
+			cert := state.PeerCertificates[0]
+			r.Trace("%s: peer certificate %q, expires %s", prefix, cert.Subject.String(), cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	trace.WroteHeaderField = func(key string, value []string) {
+		for _, v := range value {
+			r.Trace("%s: > %s: %s", prefix, key, redactHeader(key, v))
+		}
+	}
+}
+
+// traceResponse passes the status and headers of the response to r.Trace
+func (r Repo) traceResponse(prefix string, resp *http.Response, err error) {
+	if err != nil {
+		r.Trace("%s: %v", prefix, err)
+		return
+	}
+	r.Trace("%s: %s %s", prefix, resp.Proto, resp.Status)
+	for _, name := range sortedHeaderNames(resp.Header) {
+		for _, v := range resp.Header[name] {
+			r.Trace("%s: < %s: %s", prefix, name, redactHeader(name, v))
+		}
+	}
+}
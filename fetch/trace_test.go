@@ -0,0 +1,46 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceRedacts(t *testing.T) {
+	fs := http.FileServer(http.Dir("../changelog/testdata/slackware64/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "sekrit"})
+		fs.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	lines := []string{}
+	r := Repo{
+		URL:   server.URL,
+		Trace: func(format string, v ...interface{}) { lines = append(lines, fmt.Sprintf(format, v...)) },
+	}
+	if _, _, err := r.ChangeLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := strings.Join(lines, "\n")
+	for _, expected := range []string{"connected to tcp", "> User-Agent: ", "200 OK", "< Set-Cookie: [redacted]"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the trace to include %q; got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "sekrit") {
+		t.Errorf("expected the cookie to be redacted; got:\n%s", out)
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	if got := redactHeader("authorization", "Basic Zm9vOmJhcg=="); got != "[redacted]" {
+		t.Errorf("expected the authorization to be redacted; got %q", got)
+	}
+	if got := redactHeader("Accept", "*/*"); got != "*/*" {
+		t.Errorf("expected %q; got %q", "*/*", got)
+	}
+}
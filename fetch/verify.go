@@ -0,0 +1,141 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	// x/crypto/openpgp is frozen and deprecated upstream. Its maintained
+	// fork, github.com/ProtonMail/go-crypto/openpgp, has the same API, and
+	// is to replace it (in the imports and the vendor directory) together.
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// ErrNotSigned is the error of a Repo with a Keyring, for a ChangeLog.txt
+// that is not clearsigned
+var ErrNotSigned = errors.New("ChangeLog.txt is not signed")
+
+// ErrChecksumMismatch is the error of a Repo with a Keyring, for a ChangeLog.txt
+// that is not the one of the signed CHECKSUMS.md5
+var ErrChecksumMismatch = errors.New("ChangeLog.txt does not match the md5 of the signed CHECKSUMS.md5, it may have been tampered with")
+
+// clearsignHeader begins a PGP clearsigned document
+var clearsignHeader = []byte("-----BEGIN PGP SIGNED MESSAGE-----")
+
+// checksumsFile lists the md5 of each file of a release, and checksumsSigFile
+// is its detached signature
+const (
+	checksumsFile    = "CHECKSUMS.md5"
+	checksumsSigFile = "CHECKSUMS.md5.asc"
+)
+
+// clearsigned is whether the ChangeLog.txt data is clearsigned
+func clearsigned(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), clearsignHeader)
+}
+
+// unwrapSigned is the text of a ChangeLog.txt, without the armor and
+// dash-escaping when it is clearsigned. With a keyring the signature is
+// verified, and a ChangeLog.txt that is not signed is an error.
+func unwrapSigned(data []byte, keyring openpgp.KeyRing) ([]byte, error) {
+	if !clearsigned(data) {
+		if keyring != nil {
+			return nil, ErrNotSigned
+		}
+		return data, nil
+	}
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, errors.New("malformed clearsigned ChangeLog.txt")
+	}
+	if keyring != nil {
+		if err := verifySignature(keyring, block.Bytes, block.ArmoredSignature.Body); err != nil {
+			return nil, err
+		}
+	}
+	return block.Plaintext, nil
+}
+
+// verifySignature checks that sig is a signature of signed, by a key of the
+// keyring
+func verifySignature(keyring openpgp.KeyRing, signed []byte, sig io.Reader) error {
+	if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(signed), sig); err != nil {
+		return fmt.Errorf("verifying the signature of ChangeLog.txt: %v", err)
+	}
+	return nil
+}
+
+// verifyChecksum checks that data, of a ChangeLog.txt that is not clearsigned,
+// has the md5 listed in the CHECKSUMS.md5 of the release, after checking the
+// signature of that with the Keyring
+func (r Repo) verifyChecksum(ctx context.Context, data []byte) error {
+	sums, err := r.readFile(ctx, checksumsFile)
+	if err != nil {
+		return fmt.Errorf("%w, and no %s to verify it with: %v", ErrNotSigned, checksumsFile, err)
+	}
+	sig, err := r.readFile(ctx, checksumsSigFile)
+	if err != nil {
+		return fmt.Errorf("%w, and no %s to verify it with: %v", ErrNotSigned, checksumsSigFile, err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(r.Keyring, bytes.NewReader(sums), bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("verifying the signature of %s: %v", checksumsFile, err)
+	}
+	expected, ok := parseChecksums(sums)["ChangeLog.txt"]
+	if !ok {
+		return fmt.Errorf("ChangeLog.txt is not listed in the %s", checksumsFile)
+	}
+	sum := md5.Sum(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("%w (md5 %s, expected %s)", ErrChecksumMismatch, actual, expected)
+	}
+	return nil
+}
+
+// parseChecksums is the md5 of each file listed in a CHECKSUMS.md5, by its path
+// in the release (without the leading "./")
+func parseChecksums(data []byte) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != md5.Size*2 {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "./")] = strings.ToLower(fields[0])
+	}
+	return sums
+}
+
+// readFile is the whole of the file of the release
+func (r Repo) readFile(ctx context.Context, file string) ([]byte, error) {
+	if r.local() {
+		rc, _, err := r.openLocal(file)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	resp, t, err := r.do(ctx, http.MethodGet, file, time.Time{}, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := &countingReader{r: resp.Body}
+	defer func() { r.observe(t, resp, body.n) }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: resp.Request.URL.String(), Attempts: t.attempts}
+	}
+	return ioutil.ReadAll(body)
+}
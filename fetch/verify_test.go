@@ -0,0 +1,171 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func TestFetchClearsigned(t *testing.T) {
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := openpgp.NewEntity("sl-feeds test", "", "sl-feeds@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("someone else", "", "else@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	w, err := clearsign.Encode(buf, signer.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	w.Close()
+	signed := buf.Bytes()
+	tampered := bytes.Replace(signed, []byte("Upgraded."), []byte("Removed."), 1)
+
+	dir, err := ioutil.TempDir("", "sl-feeds-verify.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for release, data := range map[string][]byte{"plain": plain, "signed": signed, "tampered": tampered} {
+		if err := os.MkdirAll(filepath.Join(dir, release), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, release, "ChangeLog.txt"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	expected, _, err := Repo{URL: server.URL, Release: "plain"}.ChangeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		release string
+		keyring openpgp.KeyRing
+		ok      bool
+	}{
+		{"signed", nil, true},
+		{"signed", openpgp.EntityList{signer}, true},
+		{"signed", openpgp.EntityList{other}, false},
+		{"tampered", openpgp.EntityList{signer}, false},
+		{"plain", openpgp.EntityList{signer}, false},
+	}
+	for _, c := range cases {
+		e, _, err := Repo{URL: server.URL, Release: c.release, Keyring: c.keyring}.ChangeLog()
+		if !c.ok {
+			if err == nil {
+				t.Errorf("%s (keyring %t): expected verifying to fail", c.release, c.keyring != nil)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s (keyring %t): %v", c.release, c.keyring != nil, err)
+			continue
+		}
+		if len(e) != len(expected) || e[0].Comment != expected[0].Comment {
+			t.Errorf("%s: expected the same %d entries as the plain ChangeLog; got %d", c.release, len(expected), len(e))
+		}
+	}
+}
+
+func TestFetchChecksums(t *testing.T) {
+	plain, err := ioutil.ReadFile("../changelog/testdata/slackware64/ChangeLog.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := openpgp.NewEntity("sl-feeds test", "", "sl-feeds@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("someone else", "", "else@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(plain)
+	checksums := []byte("These are the MD5 message digests for the files in this directory.\n\nMD5 message digest                Filename\n" +
+		"d41d8cd98f00b204e9800998ecf8427e  ./ANNOUNCE.15_0\n" +
+		hex.EncodeToString(sum[:]) + "  ./ChangeLog.txt\n")
+	sign := func(e *openpgp.Entity, data []byte) []byte {
+		buf := bytes.NewBuffer(nil)
+		if err := openpgp.ArmoredDetachSign(buf, e, bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tampered := bytes.Replace(plain, []byte("Upgraded."), []byte("Removed."), 1)
+
+	dir, err := ioutil.TempDir("", "sl-feeds-checksums.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for release, files := range map[string]map[string][]byte{
+		"good":     {"ChangeLog.txt": plain, checksumsFile: checksums, checksumsSigFile: sign(signer, checksums)},
+		"tampered": {"ChangeLog.txt": tampered, checksumsFile: checksums, checksumsSigFile: sign(signer, checksums)},
+		"other":    {"ChangeLog.txt": plain, checksumsFile: checksums, checksumsSigFile: sign(other, checksums)},
+		"unsigned": {"ChangeLog.txt": plain, checksumsFile: checksums},
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, release), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, release, name), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	keyring := openpgp.EntityList{signer}
+	for _, url := range []string{server.URL, "file://" + dir} {
+		for release, expected := range map[string]string{
+			"good":     "",
+			"tampered": ErrChecksumMismatch.Error(),
+			"other":    "verifying the signature of CHECKSUMS.md5",
+			"unsigned": ErrNotSigned.Error(),
+		} {
+			e, _, err := Repo{URL: url, Release: release, Keyring: keyring}.ChangeLog()
+			if expected == "" && (err != nil || len(e) == 0) {
+				t.Errorf("%s %s: expected the entries; got %v", url, release, err)
+			} else if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+				t.Errorf("%s %s: expected an error of %q; got %v", url, release, expected, err)
+			}
+		}
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	sums := parseChecksums([]byte("MD5 message digest                Filename\n" +
+		"0123456789ABCDEF0123456789abcdef  ./ChangeLog.txt\n" +
+		"not-an-md5  ./FILELIST.TXT\n" +
+		"fedcba9876543210fedcba9876543210  ./patches/packages/openssl-1.1.1w-x86_64-1_slack15.0.txz\n"))
+	expected := map[string]string{
+		"ChangeLog.txt": "0123456789abcdef0123456789abcdef",
+		"patches/packages/openssl-1.1.1w-x86_64-1_slack15.0.txz": "fedcba9876543210fedcba9876543210",
+	}
+	if !reflect.DeepEqual(sums, expected) {
+		t.Errorf("expected %q; got %q", expected, sums)
+	}
+}
@@ -0,0 +1,349 @@
+// Package ftp is a small FTP client, with just the parts of RFC 959 (and the
+// extensions of RFC 2428, 3659 and 4217) needed to upload files.
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The TLS modes of a connection
+const (
+	// TLSNone is plain FTP
+	TLSNone = "none"
+	// TLSExplicit is FTPS by "AUTH TLS" on the plain control connection
+	TLSExplicit = "explicit"
+	// TLSImplicit is FTPS with TLS from the start, usually on port 990
+	TLSImplicit = "implicit"
+)
+
+// Options are the settings of a connection from Dial
+type Options struct {
+	// TLS is one of TLSNone (the default when empty), TLSExplicit or
+	// TLSImplicit
+	TLS string
+	// TLSConfig, when set, is the base for the TLS of the control and data
+	// connections
+	TLSConfig *tls.Config
+	// Active is to have the server connect back for data connections, instead
+	// of the default of passive mode
+	Active bool
+	// Timeout is for making each connection, and for the server to connect
+	// back in active mode
+	Timeout time.Duration
+}
+
+// Client is a logged in connection to an FTP server
+type Client struct {
+	opts     Options
+	conn     net.Conn
+	text     *textproto.Conn
+	host     string
+	tls      *tls.Config
+	dataTLS  bool
+	features map[string]string
+}
+
+// Dial connects to the FTP server at addr (a host:port), doing the TLS
+// handshake for the TLS mode of opts
+func Dial(addr string, opts Options) (*Client, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.TLS {
+	case "", TLSNone, TLSExplicit, TLSImplicit:
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q", opts.TLS)
+	}
+	config := &tls.Config{}
+	if opts.TLSConfig != nil {
+		config = opts.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if config.ClientSessionCache == nil {
+		// many servers require the data connections to resume the session of
+		// the control connection
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	if opts.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, config)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{opts: opts, conn: conn, text: textproto.NewConn(conn), host: host, tls: config}
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if opts.TLS == TLSExplicit {
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tconn := tls.Client(conn, config)
+		if err := tconn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.conn, c.text = tconn, textproto.NewConn(tconn)
+	}
+	return c, nil
+}
+
+// cmd sends the command, reading the reply that must match expectCode (like
+// textproto.Reader.ReadResponse)
+func (c *Client) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expectCode)
+}
+
+// Login authenticates as user, then sets up binary transfers (protected, when
+// using TLS) and asks for the features of the server
+func (c *Client) Login(user, password string) error {
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	switch code / 100 {
+	case 2:
+	case 3:
+		if _, _, err := c.cmd(2, "PASS %s", password); err != nil {
+			return err
+		}
+	default:
+		return &textproto.Error{Code: code, Msg: "USER not accepted"}
+	}
+
+	if c.opts.TLS == TLSExplicit || c.opts.TLS == TLSImplicit {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+		c.dataTLS = true
+	}
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		return err
+	}
+
+	c.features = map[string]string{}
+	if _, msg, err := c.cmd(2, "FEAT"); err == nil {
+		lines := strings.Split(msg, "\n")
+		for _, line := range lines[1:] {
+			fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+			if len(fields) == 0 || fields[0] == "" || strings.HasPrefix(line, "End") {
+				continue
+			}
+			params := ""
+			if len(fields) > 1 {
+				params = fields[1]
+			}
+			c.features[strings.ToUpper(fields[0])] = params
+		}
+	}
+	return nil
+}
+
+// HasFeature is whether the server listed the feature (like "MFMT") in its
+// reply to FEAT
+func (c *Client) HasFeature(name string) bool {
+	_, ok := c.features[strings.ToUpper(name)]
+	return ok
+}
+
+// Store uploads the content of r to path
+func (c *Client) Store(path string, r io.Reader) error {
+	accept, err := c.openData()
+	if err != nil {
+		return err
+	}
+	if _, _, err := c.cmd(1, "STOR %s", path); err != nil {
+		accept(false)
+		return err
+	}
+	conn, err := accept(true)
+	if err != nil {
+		c.text.ReadResponse(0)
+		return err
+	}
+	if tconn, ok := conn.(*tls.Conn); ok {
+		err = tconn.Handshake()
+	}
+	if err == nil {
+		_, err = io.Copy(conn, r)
+	}
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	if _, _, rerr := c.text.ReadResponse(2); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// openData prepares a data connection in the passive or active mode. The
+// returned accept is called after the transfer command, for the connection
+// (or with false, to just close it).
+func (c *Client) openData() (accept func(bool) (net.Conn, error), err error) {
+	wrap := func(conn net.Conn) net.Conn {
+		if c.dataTLS {
+			return tls.Client(conn, c.tls)
+		}
+		return conn
+	}
+
+	if c.opts.Active {
+		local := c.conn.LocalAddr().(*net.TCPAddr)
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local.IP})
+		if err != nil {
+			return nil, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		if ip4 := local.IP.To4(); ip4 != nil {
+			_, _, err = c.cmd(2, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+		} else {
+			_, _, err = c.cmd(2, "EPRT |2|%s|%d|", local.IP, port)
+		}
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		return func(ok bool) (net.Conn, error) {
+			defer l.Close()
+			if !ok {
+				return nil, nil
+			}
+			if c.opts.Timeout > 0 {
+				l.SetDeadline(time.Now().Add(c.opts.Timeout))
+			}
+			conn, err := l.Accept()
+			if err != nil {
+				return nil, err
+			}
+			return wrap(conn), nil
+		}, nil
+	}
+
+	port, err := c.passivePort()
+	if err != nil {
+		return nil, err
+	}
+	// like the EPSV reply, the address of a PASV reply is not used, but the
+	// host of the control connection, as it is so often wrong behind NAT
+	conn, err := (&net.Dialer{Timeout: c.opts.Timeout}).Dial("tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return func(ok bool) (net.Conn, error) {
+		if !ok {
+			conn.Close()
+			return nil, nil
+		}
+		return wrap(conn), nil
+	}, nil
+}
+
+// passivePort is the port the server is listening on for the data
+// connection, from EPSV or else PASV
+func (c *Client) passivePort() (int, error) {
+	if _, msg, err := c.cmd(2, "EPSV"); err == nil {
+		// like "229 Entering Extended Passive Mode (|||6446|)"
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			return 0, fmt.Errorf("unexpected EPSV reply %q", msg)
+		}
+		return strconv.Atoi(msg[start+4 : end])
+	}
+	_, msg, err := c.cmd(2, "PASV")
+	if err != nil {
+		return 0, err
+	}
+	// like "227 Entering Passive Mode (192,168,1,2,25,46)"
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	parts := strings.Split(msg[start+1:end], ",")
+	if len(parts) != 6 {
+		return 0, fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	hi, err1 := strconv.Atoi(parts[4])
+	lo, err2 := strconv.Atoi(parts[5])
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	return hi<<8 | lo, nil
+}
+
+// Rename renames from to to, with RNFR and RNTO
+func (c *Client) Rename(from, to string) error {
+	if _, _, err := c.cmd(3, "RNFR %s", from); err != nil {
+		return err
+	}
+	_, _, err := c.cmd(2, "RNTO %s", to)
+	return err
+}
+
+// Delete removes path
+func (c *Client) Delete(path string) error {
+	_, _, err := c.cmd(2, "DELE %s", path)
+	return err
+}
+
+// mdtmFormat is the time format of MDTM and MFMT, always in UTC
+const mdtmFormat = "20060102150405"
+
+// ModTime is the modification time of path, with MDTM
+func (c *Client) ModTime(path string) (time.Time, error) {
+	_, msg, err := c.cmd(2, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// drop any fraction of a second
+	if i := strings.Index(msg, "."); i >= 0 {
+		msg = msg[:i]
+	}
+	return time.ParseInLocation(mdtmFormat, strings.TrimSpace(msg), time.UTC)
+}
+
+// SetModTime sets the modification time of path, with MFMT
+func (c *Client) SetModTime(path string, t time.Time) error {
+	_, _, err := c.cmd(2, "MFMT %s %s", t.UTC().Format(mdtmFormat), path)
+	return err
+}
+
+// Size is the size of path, with SIZE
+func (c *Client) Size(path string) (int64, error) {
+	_, msg, err := c.cmd(2, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// Quit ends the session and closes the connection
+func (c *Client) Quit() error {
+	_, _, err := c.cmd(2, "QUIT")
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package ftp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/ftp/ftptest"
+)
+
+func TestUpload(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		opts   Options
+		noEPSV bool
+	}{
+		{name: "passive"},
+		{name: "pasv", noEPSV: true},
+		{name: "active", opts: Options{Active: true}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			server, err := ftptest.NewServer("vbatts", "sekrit")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+			server.NoEPSV = c.noEPSV
+			testUpload(t, server, c.opts)
+		})
+	}
+}
+
+func TestUploadExplicitTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	server, err := ftptest.NewServer("vbatts", "sekrit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.TLS = ts.TLS
+
+	testUpload(t, server, Options{TLS: TLSExplicit, TLSConfig: ts.Client().Transport.(*http.Transport).TLSClientConfig})
+}
+
+func testUpload(t *testing.T, server *ftptest.Server, opts Options) {
+	opts.Timeout = 5 * time.Second
+	c, err := Dial(server.Addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Login("vbatts", "wrong"); err == nil {
+		t.Error("expected the wrong password to fail")
+	}
+	if err := c.Login("vbatts", "sekrit"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.HasFeature("mfmt") {
+		t.Error("expected the MFMT feature")
+	}
+
+	data := []byte("<rss></rss>\n")
+	if err := c.Store("/feeds/.a.rss.tmp", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rename("/feeds/.a.rss.tmp", "/feeds/a.rss"); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2017, 1, 23, 21, 30, 13, 0, time.UTC)
+	if err := c.SetModTime("/feeds/a.rss", mtime); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.ModTime("/feeds/a.rss"); err != nil || !got.Equal(mtime) {
+		t.Errorf("expected the mtime %s; got %s (%v)", mtime, got, err)
+	}
+	if got, err := c.Size("/feeds/a.rss"); err != nil || got != int64(len(data)) {
+		t.Errorf("expected the size %d; got %d (%v)", len(data), got, err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Error(err)
+	}
+
+	files := server.Files()
+	if len(files) != 1 || !bytes.Equal(files["/feeds/a.rss"].Data, data) {
+		t.Errorf("expected only /feeds/a.rss with %q; got %v", data, files)
+	}
+}
@@ -0,0 +1,344 @@
+// Package ftptest is an in-memory FTP server, for testing uploads
+package ftptest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File is an uploaded file
+type File struct {
+	Data    []byte
+	ModTime time.Time
+}
+
+// Server is an FTP server, listening on the loopback interface
+type Server struct {
+	// Addr is the host:port of the server
+	Addr string
+	// User and Password are the only credentials accepted
+	User     string
+	Password string
+	// NoRename, NoMFMT and NoEPSV turn off the commands, like on an older
+	// server
+	NoRename bool
+	NoMFMT   bool
+	NoEPSV   bool
+	// TLS, when set, allows "AUTH TLS"
+	TLS *tls.Config
+
+	l     net.Listener
+	mu    sync.Mutex
+	files map[string]File
+	log   []string
+}
+
+// NewServer starts a Server accepting the user and password
+func NewServer(user, password string) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Addr: l.Addr().String(), User: user, Password: password, l: l, files: map[string]File{}}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// Files are the files on the server, by path
+func (s *Server) Files() map[string]File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := map[string]File{}
+	for path, f := range s.files {
+		files[path] = f
+	}
+	return files
+}
+
+// SetFile puts a file on the server
+func (s *Server) SetFile(path string, f File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = f
+}
+
+// Commands are the commands received, excluding any password
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.log...)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn)
+	}
+}
+
+// session is the state of one control connection
+type session struct {
+	s      *Server
+	conn   net.Conn
+	r      *bufio.Reader
+	user   string
+	authed bool
+	prot   bool
+	pasv   net.Listener
+	port   string
+	rnfr   string
+}
+
+func (s *Server) session(conn net.Conn) {
+	ss := &session{s: s, conn: conn, r: bufio.NewReader(conn)}
+	defer func() { ss.conn.Close() }()
+	ss.reply(220, "ftptest ready")
+	for {
+		line, err := ss.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+		verb = strings.ToUpper(verb)
+		if verb == "PASS" {
+			s.record("PASS")
+		} else {
+			s.record(line)
+		}
+		if !ss.handle(verb, arg) {
+			return
+		}
+	}
+}
+
+func (s *Server) record(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, line)
+}
+
+func (ss *session) reply(code int, msg string) {
+	fmt.Fprintf(ss.conn, "%d %s\r\n", code, msg)
+}
+
+// handle runs the command, and is whether the session continues
+func (ss *session) handle(verb, arg string) bool {
+	s := ss.s
+	if !ss.authed {
+		switch verb {
+		case "USER", "PASS", "AUTH", "QUIT":
+		default:
+			ss.reply(530, "not logged in")
+			return true
+		}
+	}
+	switch verb {
+	case "AUTH":
+		if s.TLS == nil || strings.ToUpper(arg) != "TLS" {
+			ss.reply(502, "not implemented")
+			return true
+		}
+		ss.reply(234, "proceed")
+		tconn := tls.Server(ss.conn, s.TLS)
+		if err := tconn.Handshake(); err != nil {
+			return false
+		}
+		ss.conn, ss.r = tconn, bufio.NewReader(tconn)
+	case "USER":
+		ss.user = arg
+		ss.reply(331, "password please")
+	case "PASS":
+		if ss.user != s.User || arg != s.Password {
+			ss.reply(530, "wrong credentials")
+			return true
+		}
+		ss.authed = true
+		ss.reply(230, "logged in")
+	case "PBSZ":
+		ss.reply(200, "ok")
+	case "PROT":
+		ss.prot = strings.ToUpper(arg) == "P"
+		ss.reply(200, "ok")
+	case "TYPE":
+		ss.reply(200, "ok")
+	case "FEAT":
+		feats := []string{"SIZE", "MDTM"}
+		if !s.NoMFMT {
+			feats = append(feats, "MFMT")
+		}
+		fmt.Fprintf(ss.conn, "211-Features:\r\n")
+		for _, f := range feats {
+			fmt.Fprintf(ss.conn, " %s\r\n", f)
+		}
+		ss.reply(211, "End")
+	case "EPSV", "PASV":
+		if verb == "EPSV" && s.NoEPSV {
+			ss.reply(502, "not implemented")
+			return true
+		}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			ss.reply(425, err.Error())
+			return true
+		}
+		ss.closeData()
+		ss.pasv = l
+		port := l.Addr().(*net.TCPAddr).Port
+		if verb == "EPSV" {
+			ss.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		} else {
+			ss.reply(227, fmt.Sprintf("Entering Passive Mode (127,0,0,1,%d,%d)", port>>8, port&0xff))
+		}
+	case "PORT":
+		parts := strings.Split(arg, ",")
+		if len(parts) != 6 {
+			ss.reply(501, "bad PORT")
+			return true
+		}
+		hi, _ := strconv.Atoi(parts[4])
+		lo, _ := strconv.Atoi(parts[5])
+		ss.closeData()
+		ss.port = net.JoinHostPort(strings.Join(parts[:4], "."), strconv.Itoa(hi<<8|lo))
+		ss.reply(200, "ok")
+	case "STOR":
+		conn, err := ss.data()
+		if err != nil {
+			ss.reply(425, err.Error())
+			return true
+		}
+		ss.reply(150, "send it")
+		data, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			ss.reply(426, err.Error())
+			return true
+		}
+		s.SetFile(arg, File{Data: data, ModTime: time.Now().UTC().Truncate(time.Second)})
+		ss.reply(226, "stored")
+	case "RNFR":
+		if s.NoRename {
+			ss.reply(502, "not implemented")
+			return true
+		}
+		if _, ok := s.Files()[arg]; !ok {
+			ss.reply(550, "no such file")
+			return true
+		}
+		ss.rnfr = arg
+		ss.reply(350, "ready for RNTO")
+	case "RNTO":
+		s.mu.Lock()
+		f, ok := s.files[ss.rnfr]
+		if ok {
+			delete(s.files, ss.rnfr)
+			s.files[arg] = f
+		}
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(503, "RNFR first")
+			return true
+		}
+		ss.reply(250, "renamed")
+	case "DELE":
+		s.mu.Lock()
+		_, ok := s.files[arg]
+		delete(s.files, arg)
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "no such file")
+			return true
+		}
+		ss.reply(250, "deleted")
+	case "MFMT":
+		if s.NoMFMT {
+			ss.reply(502, "not implemented")
+			return true
+		}
+		fields := strings.SplitN(arg, " ", 2)
+		t, err := time.Parse("20060102150405", fields[0])
+		if err != nil || len(fields) != 2 {
+			ss.reply(501, "bad MFMT")
+			return true
+		}
+		s.mu.Lock()
+		f, ok := s.files[fields[1]]
+		f.ModTime = t
+		if ok {
+			s.files[fields[1]] = f
+		}
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "no such file")
+			return true
+		}
+		ss.reply(213, "Modify="+fields[0]+"; "+fields[1])
+	case "MDTM", "SIZE":
+		f, ok := s.Files()[arg]
+		if !ok {
+			ss.reply(550, "no such file")
+			return true
+		}
+		if verb == "MDTM" {
+			ss.reply(213, f.ModTime.UTC().Format("20060102150405"))
+		} else {
+			ss.reply(213, strconv.Itoa(len(f.Data)))
+		}
+	case "QUIT":
+		ss.reply(221, "bye")
+		return false
+	default:
+		ss.reply(502, "not implemented")
+	}
+	return true
+}
+
+// data is the data connection from the last EPSV, PASV or PORT
+func (ss *session) data() (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch {
+	case ss.pasv != nil:
+		conn, err = ss.pasv.Accept()
+		ss.closeData()
+	case ss.port != "":
+		conn, err = net.Dial("tcp", ss.port)
+		ss.port = ""
+	default:
+		return nil, fmt.Errorf("no PASV or PORT")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ss.prot && ss.s.TLS != nil {
+		return tls.Server(conn, ss.s.TLS), nil
+	}
+	return conn, nil
+}
+
+func (ss *session) closeData() {
+	if ss.pasv != nil {
+		ss.pasv.Close()
+		ss.pasv = nil
+	}
+}
@@ -8,5 +8,7 @@ require (
 	github.com/gorilla/feeds v1.1.1
 	github.com/kr/pretty v0.2.1 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
+	github.com/ulikunitz/xz v0.5.11
 	github.com/urfave/cli v1.22.5
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
 )
@@ -0,0 +1,55 @@
+// Package cliutil is the setup shared by the commands of sl-feeds: loading
+// their TOML configuration, the TLS settings and logger of the flags, and the
+// lookup of the flags given before or after a subcommand.
+package cliutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// TLSConfig is the TLS settings of the requests for an additional CA cert
+// file (like from --ca) and insecure (--insecure), or nil for the defaults
+func TLSConfig(ca string, insecure bool) (*tls.Config, error) {
+	if ca == "" && !insecure {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if ca != "" {
+		rootCAs, _ := x509.SystemCertPool()
+		if rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		certs, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("failed to append %q to RootCAs: %v", ca, err)
+		}
+		// Append our cert to the system pool
+		if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
+			log.Println("No certs appended, using system certs only")
+		}
+		config.RootCAs = rootCAs
+	}
+	return config, nil
+}
+
+// LogFormats are the formats of NewLogger (the values of --log-format)
+var LogFormats = []string{"text", "json"}
+
+// NewLogger is the logger to w in the format, which for "json" has no prefix
+// of its own (as each line is an object, with its time), and is whether it is
+// that
+func NewLogger(w io.Writer, format string) (logger *log.Logger, json bool, err error) {
+	switch format {
+	case "", "text":
+		return log.New(w, "", log.LstdFlags), false, nil
+	case "json":
+		return log.New(w, "", 0), true, nil
+	}
+	return nil, false, fmt.Errorf("--log-format should be one of %s", strings.Join(LogFormats, ", "))
+}
@@ -0,0 +1,140 @@
+package cliutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func TestDecodeTOMLFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cliutil.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conf.toml")
+
+	var v struct {
+		Dest string
+		Jobs int
+	}
+	if err := ioutil.WriteFile(path, []byte("Dest = \"/srv\"\nJbos = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := DecodeTOMLFile(path, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Dest != "/srv" || len(warnings) != 1 || !strings.Contains(warnings[0], `unknown key "Jbos"`) || !strings.Contains(warnings[0], "line 2") {
+		t.Errorf("expected the Dest, and a warning of the unknown key on line 2; got %#v, %q", v, warnings)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("Dest = \"/srv\"\nJobs = \"4\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeTOMLFile(path, &v); err == nil || !strings.Contains(err.Error(), "Jobs") || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error of the type of Jobs on line 2; got %v", err)
+	}
+
+	var w struct {
+		Interval textDuration
+		Enabled  *bool
+		Jobs     int
+	}
+	for _, c := range []struct {
+		data, expected string
+	}{
+		{"Interval = \"30m\"\nJobs = \"4\"\n", `"Jobs" should be an integer, but found a string (line 2)`},
+		{"Interval = 30\n", `"Interval" should be a string, but found an integer (line 1)`},
+		{"Interval = \"30m\"\nEnabled = \"yes\"\n", `"Enabled" should be a boolean, but found a string (line 2)`},
+	} {
+		if err := ioutil.WriteFile(path, []byte(c.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeTOMLFile(path, &w); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%q: expected %s; got %v", c.data, c.expected, err)
+		}
+	}
+}
+
+// textDuration is a duration of the config, as a string
+type textDuration struct {
+	time.Duration
+}
+
+func (d *textDuration) UnmarshalText(text []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, json, err := NewLogger(&buf, "json")
+	if err != nil || !json {
+		t.Fatalf("expected a json logger; got %v, %v", json, err)
+	}
+	logger.Print("hi")
+	if buf.String() != "hi\n" {
+		t.Errorf("expected no prefix of the json logger; got %q", buf.String())
+	}
+	if _, json, err := NewLogger(&buf, "text"); err != nil || json {
+		t.Errorf("expected a text logger; got %v, %v", json, err)
+	}
+	if _, _, err := NewLogger(&buf, "xml"); err == nil || !strings.Contains(err.Error(), "text, json") {
+		t.Errorf("expected an error of the formats; got %v", err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	if config, err := TLSConfig("", false); config != nil || err != nil {
+		t.Errorf("expected the defaults; got %v, %v", config, err)
+	}
+	if config, err := TLSConfig("", true); err != nil || config == nil || !config.InsecureSkipVerify {
+		t.Errorf("expected an insecure config; got %v, %v", config, err)
+	}
+	if _, err := TLSConfig("/nonexistent/ca.pem", false); err == nil {
+		t.Error("expected an error of a missing CA file")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	flags := []cli.Flag{
+		cli.StringFlag{Name: "config, c"},
+		cli.BoolFlag{Name: "quiet"},
+		cli.IntFlag{Name: "jobs", Value: 4},
+	}
+	for _, args := range [][]string{
+		{"app", "-c", "a.toml", "--quiet", "--jobs", "2", "cmd"},
+		{"app", "cmd", "-c", "a.toml", "--quiet", "--jobs", "2"},
+		{"app", "--jobs", "1", "cmd", "-c", "a.toml", "--quiet", "--jobs", "2"},
+	} {
+		var (
+			config    string
+			quiet, ok bool
+			jobs      int
+		)
+		app := cli.NewApp()
+		app.Flags = flags
+		app.Commands = []cli.Command{{
+			Name:  "cmd",
+			Flags: flags,
+			Action: func(c *cli.Context) error {
+				f := Flags{Context: c}
+				config, quiet, jobs, ok = f.String("config"), f.Bool("quiet"), f.Int("jobs"), f.IsSet("jobs")
+				return nil
+			},
+		}}
+		if err := app.Run(args); err != nil {
+			t.Fatal(err)
+		}
+		if config != "a.toml" || !quiet || jobs != 2 || !ok {
+			t.Errorf("%q: expected the flags of either context; got %q, %v, %d, %v", args, config, quiet, jobs, ok)
+		}
+	}
+}
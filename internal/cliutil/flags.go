@@ -0,0 +1,57 @@
+package cliutil
+
+import (
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Flags looks up the flags of a command in its own context, or else in that of
+// the app, for flags that may be given either before the command or after it
+// (like "sl-feeds --dry-run" and "sl-feeds run --dry-run")
+type Flags struct {
+	*cli.Context
+}
+
+// global is whether the flag is to be taken from the app, when it is only set
+// there
+func (f Flags) global(name string) bool {
+	return !f.Context.IsSet(name) && f.Context.GlobalIsSet(name)
+}
+
+// IsSet is whether the flag is set in either context
+func (f Flags) IsSet(name string) bool {
+	return f.Context.IsSet(name) || f.Context.GlobalIsSet(name)
+}
+
+func (f Flags) Bool(name string) bool {
+	return f.Context.Bool(name) || f.Context.GlobalBool(name)
+}
+
+func (f Flags) String(name string) string {
+	if f.global(name) {
+		return f.Context.GlobalString(name)
+	}
+	return f.Context.String(name)
+}
+
+func (f Flags) StringSlice(name string) []string {
+	if f.global(name) {
+		return f.Context.GlobalStringSlice(name)
+	}
+	return f.Context.StringSlice(name)
+}
+
+func (f Flags) Int(name string) int {
+	if f.global(name) {
+		return f.Context.GlobalInt(name)
+	}
+	return f.Context.Int(name)
+}
+
+func (f Flags) Duration(name string) time.Duration {
+	if f.global(name) {
+		return f.Context.GlobalDuration(name)
+	}
+	return f.Context.Duration(name)
+}
@@ -0,0 +1,192 @@
+package cliutil
+
+import (
+	"encoding"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DecodeTOMLFile decodes the TOML file at path into v (a pointer to a
+// struct), describing a value of the wrong type by its key and line. The
+// warnings are keys in the file that do not apply to any field of v (like a
+// misspelling).
+func DecodeTOMLFile(path string, v interface{}) (warnings []string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	md, err := toml.Decode(string(data), v)
+	if err != nil {
+		if mismatch := typeMismatch(data, reflect.TypeOf(v).Elem()); mismatch != "" {
+			return nil, fmt.Errorf("%s: %s", path, mismatch)
+		}
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, key := range md.Undecoded() {
+		warnings = append(warnings, fmt.Sprintf("%s: unknown key %q%s", path, key.String(), linesOf(data, key)))
+	}
+	return warnings, nil
+}
+
+// typeMismatch finds the first key in the TOML data that does not match the
+// type of its setting in t, describing it (with its line) for the user
+func typeMismatch(data []byte, t reflect.Type) string {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return ""
+	}
+	return mismatchIn(data, nil, raw, t)
+}
+
+func mismatchIn(data []byte, path []string, raw map[string]interface{}, t reflect.Type) string {
+	keys := []string{}
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := fieldByName(t, k)
+		if !ok {
+			// unknown keys are warned about separately
+			continue
+		}
+		key := append(append([]string{}, path...), k)
+		ft := indirect(f.Type)
+		expected, found := kindName(ft), valueKindName(raw[k])
+		switch v := raw[k].(type) {
+		case map[string]interface{}:
+			if ft.Kind() == reflect.Struct && !isText(ft) {
+				if m := mismatchIn(data, key, v, ft); m != "" {
+					return m
+				}
+				continue
+			}
+		case []map[string]interface{}:
+			if ft.Kind() == reflect.Slice && indirect(ft.Elem()).Kind() == reflect.Struct {
+				for _, table := range v {
+					if m := mismatchIn(data, key, table, indirect(ft.Elem())); m != "" {
+						return m
+					}
+				}
+				continue
+			}
+		default:
+			if expected == found || (expected == "number" && found == "integer") {
+				continue
+			}
+		}
+		return fmt.Sprintf("%q should be %s, but found %s%s", strings.Join(key, "."), expected, found, linesOf(data, toml.Key(key)))
+	}
+	return ""
+}
+
+// fieldByName matches the TOML key to a field the way the decoder does, being
+// case insensitive
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	if f, ok := t.FieldByName(name); ok {
+		return f, true
+	}
+	return t.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, name) })
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isText is whether t is decoded from a string by its UnmarshalText (like a
+// duration)
+func isText(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// indirect is the type t points to, for an optional setting
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func kindName(t reflect.Type) string {
+	t = indirect(t)
+	if isText(t) {
+		return "a string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return "an integer"
+	case reflect.Float64, reflect.Float32:
+		return "a number"
+	case reflect.Slice:
+		if elem := indirect(t.Elem()); elem.Kind() == reflect.Struct && !isText(elem) {
+			return "a list of tables"
+		}
+		return "a list"
+	case reflect.Struct, reflect.Map:
+		return "a table"
+	}
+	return t.String()
+}
+
+func valueKindName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int64:
+		return "an integer"
+	case float64:
+		return "a number"
+	case []interface{}:
+		return "a list"
+	case []map[string]interface{}:
+		return "a list of tables"
+	case map[string]interface{}:
+		return "a table"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+var (
+	tableHeaderReg = regexp.MustCompile(`^\[\[?\s*([^\]]+?)\s*\]\]?`)
+	keyLineReg     = regexp.MustCompile(`^"?([A-Za-z0-9_-]+)"?\s*=`)
+)
+
+// linesOf finds the line numbers (for the user) where the key is set in the
+// TOML data, formatted like " (line 3, 9)"
+func linesOf(data []byte, key toml.Key) string {
+	if len(key) == 0 {
+		return ""
+	}
+	table := strings.Join(key[:len(key)-1], ".")
+	name := key[len(key)-1]
+	cur := ""
+	lines := []string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if m := tableHeaderReg.FindStringSubmatch(line); m != nil {
+			cur = m[1]
+			if cur == strings.Join(key, ".") {
+				lines = append(lines, strconv.Itoa(i+1))
+			}
+			continue
+		}
+		if m := keyLineReg.FindStringSubmatch(line); m != nil && m[1] == name && cur == table {
+			lines = append(lines, strconv.Itoa(i+1))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return " (line " + strings.Join(lines, ", ") + ")"
+}
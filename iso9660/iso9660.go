@@ -0,0 +1,207 @@
+// Package iso9660 is a small reader of ISO 9660 images, with just enough (the
+// primary volume descriptor, directories and the Rock Ridge names) to find and
+// read a file like the ChangeLog.txt of a release DVD.
+package iso9660
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// sectorSize is the logical block size of the images read
+const sectorSize = 2048
+
+// File is a file or directory of the image
+type File struct {
+	// Name is the Rock Ridge name when there is one, otherwise the ISO 9660
+	// name without its ";1" version
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+
+	extent    uint32
+	rockRidge bool
+}
+
+// Image is an opened ISO 9660 image
+type Image struct {
+	r    io.ReaderAt
+	root File
+}
+
+// ErrNotISO is returned for data that has no ISO 9660 primary volume
+// descriptor
+var ErrNotISO = errors.New("not an ISO 9660 image")
+
+// Open reads the primary volume descriptor of the image in r
+func Open(r io.ReaderAt) (*Image, error) {
+	// the volume descriptors start at sector 16, and end with a terminator
+	for sector := int64(16); ; sector++ {
+		buf := make([]byte, sectorSize)
+		if _, err := r.ReadAt(buf, sector*sectorSize); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrNotISO
+			}
+			return nil, err
+		}
+		if string(buf[1:6]) != "CD001" {
+			return nil, ErrNotISO
+		}
+		switch buf[0] {
+		case 1:
+			root, _, err := parseRecord(buf[156:190])
+			if err != nil {
+				return nil, err
+			}
+			return &Image{r: r, root: root}, nil
+		case 255:
+			return nil, ErrNotISO
+		}
+	}
+}
+
+// Stat finds the file at the slash separated name, matching the Rock Ridge
+// names exactly and the plain ISO 9660 names case-insensitively. The error
+// is os.ErrNotExist (wrapped) when there is no such file.
+func (img *Image) Stat(name string) (File, error) {
+	f := img.root
+	for _, part := range strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if !f.IsDir {
+			return File{}, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+		files, err := img.readDir(f)
+		if err != nil {
+			return File{}, err
+		}
+		found := false
+		for _, child := range files {
+			if child.Name == part || (!child.rockRidge && strings.EqualFold(child.Name, part)) {
+				f, found = child, true
+				break
+			}
+		}
+		if !found {
+			return File{}, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+	}
+	return f, nil
+}
+
+// Open is a reader of the content of the file at name
+func (img *Image) Open(name string) (io.Reader, File, error) {
+	f, err := img.Stat(name)
+	if err != nil {
+		return nil, File{}, err
+	}
+	if f.IsDir {
+		return nil, File{}, fmt.Errorf("%s: is a directory", name)
+	}
+	return io.NewSectionReader(img.r, int64(f.extent)*sectorSize, f.Size), f, nil
+}
+
+// readDir is the files of the directory dir, without "." and ".."
+func (img *Image) readDir(dir File) ([]File, error) {
+	data := make([]byte, dir.Size)
+	if _, err := img.r.ReadAt(data, int64(dir.extent)*sectorSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	files := []File{}
+	for off := 0; off < len(data); {
+		n := int(data[off])
+		if n == 0 {
+			// records do not cross sectors, so the rest of this one is padding
+			off = (off/sectorSize + 1) * sectorSize
+			continue
+		}
+		if off+n > len(data) {
+			return nil, fmt.Errorf("directory record at %d overruns the directory", off)
+		}
+		f, special, err := parseRecord(data[off : off+n])
+		if err != nil {
+			return nil, err
+		}
+		if !special {
+			files = append(files, f)
+		}
+		off += n
+	}
+	return files, nil
+}
+
+// parseRecord reads a directory record. special is whether it is the "." or
+// ".." of a directory.
+func parseRecord(rec []byte) (f File, special bool, err error) {
+	if len(rec) < 34 || int(rec[0]) > len(rec) {
+		return File{}, false, fmt.Errorf("short directory record")
+	}
+	rec = rec[:rec[0]]
+	nameLen := int(rec[32])
+	if 33+nameLen > len(rec) {
+		return File{}, false, fmt.Errorf("directory record name overruns the record")
+	}
+	f = File{
+		Size:    int64(binary.LittleEndian.Uint32(rec[10:14])),
+		ModTime: recordTime(rec[18:25]),
+		IsDir:   rec[25]&2 != 0,
+		extent:  binary.LittleEndian.Uint32(rec[2:6]),
+	}
+	name := rec[33 : 33+nameLen]
+	if nameLen == 1 && (name[0] == 0 || name[0] == 1) {
+		return f, true, nil
+	}
+	f.Name = string(name)
+	if i := strings.IndexByte(f.Name, ';'); i >= 0 {
+		f.Name = f.Name[:i]
+	}
+	if !f.IsDir {
+		f.Name = strings.TrimSuffix(f.Name, ".")
+	}
+	// the system use area (after the padding to an even offset) may have a
+	// Rock Ridge name
+	su := 33 + nameLen
+	if su%2 == 1 {
+		su++
+	}
+	if su < len(rec) {
+		if rr := rockRidgeName(rec[su:]); rr != "" {
+			f.Name, f.rockRidge = rr, true
+		}
+	}
+	return f, false, nil
+}
+
+// rockRidgeName is the name of the "NM" entries in the system use area, or
+// "" when there are none. Continuation areas are not followed.
+func rockRidgeName(su []byte) string {
+	name := ""
+	for len(su) >= 4 {
+		n := int(su[2])
+		if n < 4 || n > len(su) {
+			break
+		}
+		if string(su[:2]) == "NM" && n >= 5 {
+			// flags of 2 and 4 are "." and "..", not names
+			if su[4]&6 == 0 {
+				name += string(su[5:n])
+			}
+		}
+		su = su[n:]
+	}
+	return name
+}
+
+// recordTime is the 7 byte recording time of a directory record
+func recordTime(b []byte) time.Time {
+	offset := int(int8(b[6])) * 15 * 60
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, time.FixedZone("", offset))
+}
@@ -0,0 +1,73 @@
+package iso9660
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vbatts/sl-feeds/iso9660/isotest"
+)
+
+func TestImage(t *testing.T) {
+	mtime := time.Date(2022, time.February, 2, 21, 45, 10, 0, time.FixedZone("", -6*60*60))
+	files := map[string][]byte{
+		"slackware64-15.0/ChangeLog.txt":  []byte("Wed Feb  2 21:45:10 UTC 2022\nSlackware 15.0 x86_64 stable is released!\n"),
+		"slackware64-15.0/README.initrd":  []byte("initrd"),
+		"slackware64-15.0/kernels/README": bytes.Repeat([]byte("kernel "), 1000),
+		"ChangeLog.txt":                   []byte("top level"),
+	}
+	for _, rockRidge := range []bool{true, false} {
+		img, err := Open(bytes.NewReader(isotest.Image(files, mtime, rockRidge)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range files {
+			r, f, err := img.Open(name)
+			if err != nil {
+				t.Errorf("rockRidge %t: %s: %v", rockRidge, name, err)
+				continue
+			}
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Errorf("rockRidge %t: %s: expected %q; got %q", rockRidge, name, expected, data)
+			}
+			if !f.ModTime.Equal(mtime) {
+				t.Errorf("rockRidge %t: %s: expected mtime %s; got %s", rockRidge, name, mtime, f.ModTime)
+			}
+		}
+		if f, err := img.Stat("slackware64-15.0/kernels"); err != nil || !f.IsDir {
+			t.Errorf("rockRidge %t: expected a directory; got %#v, %v", rockRidge, f, err)
+		}
+		if _, _, err := img.Open("slackware64-15.0"); err == nil {
+			t.Errorf("rockRidge %t: expected an error opening a directory", rockRidge)
+		}
+		for _, name := range []string{"slackware64-14.2/ChangeLog.txt", "ChangeLog.txt/nope"} {
+			if _, err := img.Stat(name); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("rockRidge %t: %s: expected not exist; got %v", rockRidge, name, err)
+			}
+		}
+	}
+
+	// with Rock Ridge, the names are exact
+	img, err := Open(bytes.NewReader(isotest.Image(files, mtime, true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := img.Stat("SLACKWARE64-15.0/CHANGELOG.TXT"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist; got %v", err)
+	}
+}
+
+func TestNotISO(t *testing.T) {
+	for _, data := range [][]byte{nil, make([]byte, 20*sectorSize)} {
+		if _, err := Open(bytes.NewReader(data)); err != ErrNotISO {
+			t.Errorf("expected %v; got %v", ErrNotISO, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package isotest writes small ISO 9660 images, for testing the readers of
+// them
+package isotest
+
+import (
+	"encoding/binary"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sectorSize = 2048
+
+// Image is an ISO 9660 image of the files (keyed by their slash separated
+// paths), all recorded with mtime. With rockRidge, each record also has its
+// Rock Ridge name, otherwise the names are only the upper case ISO 9660 ones.
+// Each directory must fit in one sector.
+func Image(files map[string][]byte, mtime time.Time, rockRidge bool) []byte {
+	dirs := map[string][]string{"": nil}
+	names := []string{}
+	for name := range files {
+		names = append(names, strings.Trim(name, "/"))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for child := name; child != ""; child = parent(child) {
+			p := parent(child)
+			if !contains(dirs[p], child) {
+				dirs[p] = append(dirs[p], child)
+			}
+		}
+	}
+
+	// allocate a sector for each directory, and then the files after them
+	extents := map[string]uint32{}
+	next := uint32(18)
+	dirNames := []string{}
+	for dir := range dirs {
+		dirNames = append(dirNames, dir)
+	}
+	sort.Strings(dirNames)
+	for _, dir := range dirNames {
+		extents[dir] = next
+		next++
+	}
+	for _, name := range names {
+		extents[name] = next
+		next += uint32((len(files[name]) + sectorSize - 1) / sectorSize)
+		if len(files[name]) == 0 {
+			next++
+		}
+	}
+
+	img := make([]byte, int(next)*sectorSize)
+	pvd := img[16*sectorSize:]
+	pvd[0] = 1
+	copy(pvd[1:6], "CD001")
+	pvd[6] = 1
+	copy(pvd[156:], record("\x00", "", extents[""], sectorSize, true, mtime))
+	term := img[17*sectorSize:]
+	term[0] = 255
+	copy(term[1:6], "CD001")
+	term[6] = 1
+
+	for _, dir := range dirNames {
+		buf := img[int(extents[dir])*sectorSize:]
+		off := 0
+		off += copy(buf[off:], record("\x00", "", extents[dir], sectorSize, true, mtime))
+		off += copy(buf[off:], record("\x01", "", extents[parent(dir)], sectorSize, true, mtime))
+		children := dirs[dir]
+		sort.Strings(children)
+		for _, child := range children {
+			base := path.Base(child)
+			_, isDir := dirs[child]
+			isoName := strings.ToUpper(base)
+			size := uint32(sectorSize)
+			if !isDir {
+				isoName += ";1"
+				size = uint32(len(files[child]))
+			}
+			rr := ""
+			if rockRidge {
+				rr = base
+			}
+			off += copy(buf[off:], record(isoName, rr, extents[child], size, isDir, mtime))
+		}
+	}
+	for _, name := range names {
+		copy(img[int(extents[name])*sectorSize:], files[name])
+	}
+	return img
+}
+
+func parent(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// record is a directory record, with a Rock Ridge "NM" entry for rrName
+func record(name, rrName string, extent, size uint32, isDir bool, mtime time.Time) []byte {
+	n := 33 + len(name)
+	if n%2 == 1 {
+		n++
+	}
+	su := []byte{}
+	if rrName != "" {
+		su = append([]byte{'N', 'M', byte(5 + len(rrName)), 1, 0}, rrName...)
+	}
+	rec := make([]byte, n+len(su))
+	if len(rec)%2 == 1 {
+		rec = append(rec, 0)
+	}
+	rec[0] = byte(len(rec))
+	binary.LittleEndian.PutUint32(rec[2:], extent)
+	binary.BigEndian.PutUint32(rec[6:], extent)
+	binary.LittleEndian.PutUint32(rec[10:], size)
+	binary.BigEndian.PutUint32(rec[14:], size)
+	_, offset := mtime.Zone()
+	rec[18] = byte(mtime.Year() - 1900)
+	rec[19] = byte(mtime.Month())
+	rec[20] = byte(mtime.Day())
+	rec[21] = byte(mtime.Hour())
+	rec[22] = byte(mtime.Minute())
+	rec[23] = byte(mtime.Second())
+	rec[24] = byte(int8(offset / (15 * 60)))
+	if isDir {
+		rec[25] = 2
+	}
+	rec[32] = byte(len(name))
+	copy(rec[33:], name)
+	copy(rec[n:], su)
+	return rec
+}
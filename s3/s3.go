@@ -0,0 +1,238 @@
+// Package s3 is a small client of S3 (and compatible) object storage, with
+// just the PUT, HEAD and DELETE of objects needed to publish files, signed by
+// AWS Signature Version 4.
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultRegion is the region when none is set
+const DefaultRegion = "us-east-1"
+
+// ErrNotFound is the error of Head for an object that does not exist
+var ErrNotFound = errors.New("s3: no such object")
+
+// Client makes requests of the objects of the buckets at the Endpoint. The
+// objects are addressed path-style, as "Endpoint/bucket/key", which AWS and
+// the compatible servers all support.
+type Client struct {
+	// Endpoint is the URL of the service (default "https://s3.REGION.amazonaws.com")
+	Endpoint string
+	// Region is that of the buckets (default DefaultRegion)
+	Region string
+	// AccessKeyID and SecretAccessKey are the credentials of the requests,
+	// with the SessionToken of temporary ones
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// HTTPClient makes the requests (default http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+// Error is an error response of the service
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %d status", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %d status: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Put stores body as the object key of the bucket, with the header (like the
+// Content-Type, and any "X-Amz-Meta-" metadata)
+func (c *Client) Put(bucket, key string, body []byte, header http.Header) error {
+	resp, err := c.do(http.MethodPut, bucket, key, body, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Head is the header of the object key of the bucket, or ErrNotFound
+func (c *Client) Head(bucket, key string) (http.Header, error) {
+	resp, err := c.do(http.MethodHead, bucket, key, nil, nil)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+// Delete removes the object key of the bucket, which is not an error when it
+// does not exist
+func (c *Client) Delete(bucket, key string) error {
+	resp, err := c.do(http.MethodDelete, bucket, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// URL is that of the object key of the bucket
+func (c *Client) URL(bucket, key string) string {
+	return c.endpoint() + "/" + uriEncode(bucket, true) + "/" + uriEncode(key, false)
+}
+
+func (c *Client) endpoint() string {
+	if c.Endpoint != "" {
+		return strings.TrimSuffix(c.Endpoint, "/")
+	}
+	return "https://s3." + c.region() + ".amazonaws.com"
+}
+
+func (c *Client) region() string {
+	if c.Region != "" {
+		return c.Region
+	}
+	return DefaultRegion
+}
+
+// do makes the signed request, with a response of a 2xx status, or else an
+// *Error
+func (c *Client) do(method, bucket, key string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.URL(bucket, key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.ContentLength = nil, 0
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.sign(req, body, time.Now())
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		e := &Error{StatusCode: resp.StatusCode}
+		// (a HEAD, or some proxies, have no body of the error)
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		xml.Unmarshal(data, e)
+		return nil, e
+	}
+	return resp, nil
+}
+
+// sign adds the Authorization of AWS Signature Version 4 to the request, of
+// its every header (but those a proxy may change), at the time now
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		switch k = strings.ToLower(k); k {
+		case "authorization", "user-agent", "expect", "connection":
+			continue
+		}
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		headers[k] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region() + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	for _, s := range []string{c.region(), "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s", c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery is the query of the request, sorted and encoded for signing
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	pairs := []string{}
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes s as AWS does, leaving only the unreserved
+// characters (and the slashes, unless encodeSlash)
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+// Package s3test is an in-memory S3 server, for testing uploads
+package s3test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Object is a stored object
+type Object struct {
+	Data   []byte
+	Header http.Header
+}
+
+// Server is an S3 server of path-style requests, listening on the loopback
+// interface
+type Server struct {
+	// URL is the endpoint of the server
+	URL string
+	// AccessKeyID is the only one accepted (but the signatures are not checked)
+	AccessKeyID string
+
+	ts      *httptest.Server
+	mu      sync.Mutex
+	objects map[string]Object
+	log     []string
+}
+
+// NewServer starts a Server accepting the access key
+func NewServer(accessKeyID string) *Server {
+	s := &Server{AccessKeyID: accessKeyID, objects: map[string]Object{}}
+	s.ts = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.ts.URL
+	return s
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// Objects are the objects on the server, by "bucket/key"
+func (s *Server) Objects() map[string]Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := map[string]Object{}
+	for path, o := range s.objects {
+		objects[path] = o
+	}
+	return objects
+}
+
+// SetObject puts an object on the server
+func (s *Server) SetObject(path string, o Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[path] = o
+}
+
+// Requests are the requests received, as "METHOD bucket/key"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.log...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, req.Method+" "+path)
+
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+	switch req.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		header := http.Header{}
+		for k, v := range req.Header {
+			if k == "Content-Type" || strings.HasPrefix(k, "X-Amz-Meta-") {
+				header[k] = v
+			}
+		}
+		s.objects[path] = Object{Data: data, Header: header}
+	case http.MethodHead, http.MethodGet:
+		o, ok := s.objects[path]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		for k, v := range o.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(o.Data)))
+		if req.Method == http.MethodGet {
+			w.Write(o.Data)
+		}
+	case http.MethodDelete:
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed.")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, msg)
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WriteFileAtomic writes to a temporary file next to path, and only renames it
+// over path when write, fsync and chtimes have all succeeded. On any error the
+// temporary file is removed and path is left as it was. A zero mtime leaves
+// the file with the current time.
+func WriteFileAtomic(path string, mtime time.Time, write func(w io.Writer) error) error {
+	f, err := CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit(mtime)
+}
+
+// AtomicFile is a temporary file next to its path, which is only renamed over
+// the path by Commit, like for WriteFileAtomic
+type AtomicFile struct {
+	fh   *os.File
+	path string
+}
+
+// CreateAtomic creates the temporary file of path
+func CreateAtomic(path string) (*AtomicFile, error) {
+	fh, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{fh: fh, path: path}, nil
+}
+
+func (f *AtomicFile) Write(p []byte) (int, error) {
+	return f.fh.Write(p)
+}
+
+// Commit renames the file over its path once fsync and chtimes (unless mtime
+// is zero) have succeeded, or else removes it
+func (f *AtomicFile) Commit(mtime time.Time) (err error) {
+	defer func() {
+		if err != nil {
+			f.Abort()
+		}
+	}()
+	if err = f.fh.Sync(); err != nil {
+		return err
+	}
+	if err = f.fh.Chmod(0644); err != nil {
+		return err
+	}
+	if err = f.fh.Close(); err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		if err = os.Chtimes(f.fh.Name(), mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(f.fh.Name(), f.path)
+}
+
+// Abort removes the file, leaving the path as it was
+func (f *AtomicFile) Abort() {
+	f.fh.Close()
+	os.Remove(f.fh.Name())
+}
+
+// CopyFileAtomic copies src to dst with WriteFileAtomic, keeping the
+// modification time of src.
+func CopyFileAtomic(src, dst string) error {
+	fh, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	stat, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(dst, stat.ModTime(), func(w io.Writer) error {
+		_, err := io.Copy(w, fh)
+		return err
+	})
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sl-feeds-atomic.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "feed.rss")
+	mtime := time.Unix(1485207013, 0)
+	err = WriteFileAtomic(path, mtime, func(w io.Writer) error {
+		_, err := io.WriteString(w, "first")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %s; got %s", mtime, stat.ModTime())
+	}
+
+	// a failed write leaves the previous content and no temporary files
+	err = WriteFileAtomic(path, time.Time{}, func(w io.Writer) error {
+		io.WriteString(w, "second")
+		return errors.New("disk full")
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first" {
+		t.Errorf("expected %q; got %q", "first", string(data))
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("expected %d file, but found %d", 1, len(infos))
+	}
+
+	copyPath := filepath.Join(dir, "copy.rss")
+	if err := CopyFileAtomic(path, copyPath); err != nil {
+		t.Fatal(err)
+	}
+	stat, err = os.Stat(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %s; got %s", mtime, stat.ModTime())
+	}
+}